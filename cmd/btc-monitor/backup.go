@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/scheduler"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/storage"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/client"
+)
+
+// Names of the archives the backup job writes, around their UTC time
+const (
+	scheduledBackupPrefix = "btc-monitor-"
+	scheduledBackupSuffix = ".tar.gz"
+)
+
+// zstdMagic starts a zstd frame, which backups are not compressed with
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// backupCommand writes a tar archive of the stored metrics. A running
+// agent writes it over the query socket, holding back compression and
+// cleanup meanwhile; otherwise data_dir is read directly.
+func backupCommand(configPath string, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to configuration file")
+	out := flags.String("out", "", "Archive to write: .tar, .tar.gz or .tgz, or - for a tar on stdout")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	if *out == "" {
+		return errors.New("backup requires -out")
+	}
+
+	compress := false
+	switch name := strings.ToLower(*out); {
+	case *out == "-", strings.HasSuffix(name, ".tar"):
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		compress = true
+	case strings.HasSuffix(name, ".zst"):
+		return errors.New("zstd is not built in; write a .tar to stdout with -out - and pipe it through zstd")
+	default:
+		return fmt.Errorf("unknown archive type for %s (use .tar, .tar.gz or .tgz)", *out)
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if cfg.StorageBackend == "memory" {
+		return errors.New("the memory backend keeps no files to back up")
+	}
+
+	write := func(w io.Writer) error {
+		agent := client.New(cfg.SocketPath)
+		if _, err := agent.Status(); err == nil {
+			return agent.Backup(w)
+		}
+		_, err := storage.BackupDir(w, cfg.DataDir)
+		return err
+	}
+
+	if *out == "-" {
+		buffered := bufio.NewWriter(os.Stdout)
+		if err := write(buffered); err != nil {
+			return err
+		}
+		return buffered.Flush()
+	}
+
+	if err := writeArchive(*out, compress, write); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(*out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s (%d bytes)\n", filepath.Join(cfg.DataDir, "metrics"), *out, info.Size())
+	return nil
+}
+
+// writeArchive writes a backup to path through a temporary file next to
+// it, so a failed backup leaves no partial archive
+func writeArchive(path string, compress bool, write func(io.Writer) error) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	buffered := bufio.NewWriter(file)
+	var w io.Writer = buffered
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(buffered)
+		w = gz
+	}
+
+	err = write(w)
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// backupJob writes a gzip-compressed backup of the metrics to dir and
+// removes all but the newest keep, for the "backup" maintenance job
+func backupJob(archiver storage.Archiver, dir string, keep int) scheduler.JobFunc {
+	return func(context.Context) error {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, scheduledBackupPrefix+time.Now().UTC().Format("20060102-150405")+scheduledBackupSuffix)
+		var info *storage.BackupInfo
+		err := writeArchive(path, true, func(w io.Writer) error {
+			var err error
+			info, err = archiver.Backup(w)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info("Wrote scheduled backup", "path", path, "files", info.Files, "bytes", info.Bytes)
+		return pruneFiles(dir, scheduledBackupPrefix, scheduledBackupSuffix, keep)
+	}
+}
+
+// pruneFiles removes all but the newest keep files in dir named prefix,
+// a UTC time and suffix
+func pruneFiles(dir, prefix, suffix string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	// Names sort by time, oldest first
+	var files []string
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) {
+			files = append(files, name)
+		}
+	}
+	var errs []error
+	for len(files) > keep {
+		if err := os.Remove(filepath.Join(dir, files[0])); err != nil {
+			errs = append(errs, err)
+		}
+		files = files[1:]
+	}
+	return errors.Join(errs...)
+}
+
+// restoreCommand replaces the stored metrics with those in a backup. The
+// agent must be stopped, since it keeps the current day's file open.
+func restoreCommand(configPath string, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to configuration file")
+	in := flags.String("in", "", "Archive to restore, plain or gzip-compressed tar, or - for stdin")
+	force := flags.Bool("force", false, "Replace metrics already in data_dir")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	if *in == "" {
+		return errors.New("restore requires -in")
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if _, err := client.New(cfg.SocketPath).Status(); err == nil {
+		return fmt.Errorf("the agent is running on %s; stop it before restoring", cfg.SocketPath)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(4)
+	r = buffered
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.Equal(magic, zstdMagic):
+		return errors.New("zstd is not built in; decompress the backup with zstd -d and restore the .tar")
+	}
+
+	info, err := storage.RestoreDir(r, cfg.DataDir, *force)
+	if err != nil {
+		if errors.Is(err, storage.ErrMetricsExist) {
+			return fmt.Errorf("%w; use -force to replace them", err)
+		}
+		return err
+	}
+	fmt.Printf("Restored %d files (%d bytes) from a backup taken %s\n", info.Files, info.Bytes, info.Created.Format("2006-01-02 15:04:05 UTC"))
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/export"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/query"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/redact"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/server"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/storage"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/client"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// exportCommand writes the stored samples in a time range as a flat table.
+// It reads data_dir directly unless -socket is given, in which case the
+// running agent is asked, which also works with the memory backend.
+func exportCommand(configPath string, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to configuration file")
+	start := flags.String("start", "-1d", "Start of the range: RFC3339, now, -1h, -2d, today or yesterday")
+	end := flags.String("end", "", "End of the range (default now)")
+	format := flags.String("format", "csv", "Output format: csv, parquet, json (one object per line), or sqlite (one table per section)")
+	output := flags.String("o", "", "Output file (default stdout)")
+	fields := flags.String("fields", "", "Comma-separated fields or sections to export (default all)")
+	viaSocket := flags.Bool("socket", false, "Query the running agent instead of reading data_dir")
+	profile := flags.String("redact", "", "Apply a redaction profile from the config")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	if !slices.Contains(export.Formats, *format) {
+		return fmt.Errorf("unknown export format %q (use csv, parquet, json or sqlite)", *format)
+	}
+	startTime, endTime, err := server.ParseTimeRange(*start, *end)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	var redactor *redact.Profile
+	if *profile != "" {
+		profileConfig, ok := cfg.RedactionProfiles[*profile]
+		if !ok {
+			return fmt.Errorf("unknown redaction profile %q", *profile)
+		}
+		redactor = redact.New(profileConfig)
+	}
+
+	var samples []*metrics.Sample
+	switch {
+	case *viaSocket:
+		samples, err = client.New(cfg.SocketPath).QueryRange(startTime, endTime)
+	case cfg.StorageBackend == "memory":
+		return fmt.Errorf("the memory backend keeps no files, use -socket to export from the running agent")
+	default:
+		samples, err = storage.ReadRange(cfg.DataDir, startTime, endTime)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metrics: %w", err)
+	}
+
+	if redactor != nil {
+		for i, sample := range samples {
+			if samples[i], err = redactor.Sample(sample); err != nil {
+				return fmt.Errorf("failed to redact sample: %w", err)
+			}
+		}
+	}
+
+	table := export.NewTable(samples, query.ParseFields(*fields))
+
+	if *output == "" {
+		out := bufio.NewWriter(os.Stdout)
+		if err := export.Write(out, *format, table); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(file)
+	if err := export.Write(out, *format, table); err != nil {
+		file.Close()
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d samples with %d fields to %s\n", table.Rows(), len(table.Columns), *output)
+	return nil
+}
@@ -1,26 +1,61 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/alert"
 	"github.com/bitcoin-node-manager/btc-node-monitor/internal/collector"
 	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/faults"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/influx"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/permissions"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/pushgateway"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/redact"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/replicate"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/scheduler"
 	"github.com/bitcoin-node-manager/btc-node-monitor/internal/server"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/snmp"
 	"github.com/bitcoin-node-manager/btc-node-monitor/internal/storage"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/zabbix"
+	custom "github.com/bitcoin-node-manager/btc-node-monitor/pkg/collector"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
 )
 
 const version = "0.1.3"
 
+var logger = logging.New("main")
+
+// injectFaults holds the -fault.* testing flags, which usage leaves out
+var injectFaults = faults.RegisterFlags(flag.CommandLine)
+
+// setupLogging configures the default logger; the Windows service replaces
+// it to log to the Event Log
+var setupLogging = func(cfg config.LoggingConfig) error {
+	return logging.Setup(os.Stderr, cfg.Level, cfg.Format)
+}
+
 func main() {
 	// Parse flags
-	configPath := flag.String("config", "/var/lib/bitcoin-monitor/config.json", "Path to configuration file")
+	configPath := flag.String("config", defaultConfigPath, "Path to configuration file")
 	showVersion := flag.Bool("version", false, "Show version and exit")
+	serviceCommand := flag.String("service", "", "Manage the Windows service: install, uninstall, start, or stop")
+	genSecretsKey := flag.Bool("gen-secrets-key", false, "Create the key for encrypted config values and exit")
+	encryptSecret := flag.Bool("encrypt-secret", false, "Encrypt a value read from stdin for the config file and exit")
+	convertStorage := flag.String("convert-storage", "", "Convert the stored metrics to jsonl or cbor and exit; stop the agent first")
+	flag.Usage = usage
 	flag.Parse()
 
 	if *showVersion {
@@ -28,104 +63,653 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Setup logging
-	log.SetPrefix("[btc-monitor] ")
-	log.SetFlags(log.LstdFlags)
+	if flag.Arg(0) == "export" {
+		if err := exportCommand(*configPath, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "btc-monitor: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "selftest" {
+		// Flags may also follow the command
+		flag.CommandLine.Parse(flag.Args()[1:])
+		os.Exit(selftest(*configPath))
+	}
+
+	if command := flag.Arg(0); command == "backup" || command == "restore" {
+		run := backupCommand
+		if command == "restore" {
+			run = restoreCommand
+		}
+		if err := run(*configPath, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "btc-monitor: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *genSecretsKey || *encryptSecret {
+		if err := secretsCommand(*configPath, *genSecretsKey); err != nil {
+			fmt.Fprintf(os.Stderr, "btc-monitor: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *convertStorage != "" {
+		if err := convertCommand(*configPath, *convertStorage); err != nil {
+			fmt.Fprintf(os.Stderr, "btc-monitor: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *serviceCommand != "" {
+		if err := controlService(*serviceCommand, *configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "btc-monitor: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if isService() {
+		runService(*configPath)
+		return
+	}
+
+	// Setup signal handling
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	run(*configPath, stop)
+}
+
+// secretsCommand creates the secrets key for the config file, or encrypts
+// the first line of stdin with it and prints the value to paste into the
+// config
+func secretsCommand(configPath string, generate bool) error {
+	data, _, err := config.ReadLayers(configPath)
+	if err != nil {
+		return err
+	}
+	keyPath := config.SecretsKeyPath(configPath, data)
+
+	if generate {
+		if err := config.GenerateSecretsKey(keyPath); err != nil {
+			return fmt.Errorf("failed to create secrets key: %w", err)
+		}
+		fmt.Printf("Created secrets key %s\n", keyPath)
+		return nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	value, err := config.EncryptSecret(keyPath, strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// convertCommand rewrites the stored metrics in the file encoding of a
+// storage backend. Set storage_backend to match before starting the agent
+// again, or it writes new samples in the old encoding.
+func convertCommand(configPath, backend string) error {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	days, err := storage.Convert(cfg.DataDir, backend)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Converted %d days of metrics to %s\n", days, backend)
+	if cfg.StorageBackend != backend {
+		fmt.Printf("Set storage_backend to %q before starting the agent\n", backend)
+	}
+	return nil
+}
+
+// usage prints the flags, except those for fault injection
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+
+	visible := flag.NewFlagSet("", flag.ContinueOnError)
+	visible.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !faults.IsFlag(f.Name) {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
 
-	log.Printf("[INFO] Bitcoin Node Monitor v%s starting...", version)
+	fmt.Fprintf(flag.CommandLine.Output(), "\nCommands:\n  selftest\n    \tCollect once, round-trip a sample through storage and a scratch socket,\n    \tand dry-run notifications, then print a pass/fail matrix\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  export [-start -1d] [-end now] [-format csv|parquet|json|sqlite] [-o file]\n    \tWrite stored metrics as flat columns; run \"export -h\" for all options\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  backup -out file.tar.gz\n    \tArchive the stored metrics, through the running agent if there is one\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  restore -in file.tar.gz [-force]\n    \tReplace the stored metrics with a backup; stop the agent first\n")
+}
 
+// run starts the agent and collects until a value arrives on stop
+func run(configPath string, stop <-chan os.Signal) {
 	// Load configuration
-	cfg, err := config.LoadConfig(*configPath)
+	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("[ERROR] Failed to load config: %v", err)
+		fatal("Failed to load config", err)
 	}
 
-	log.Printf("[INFO] Loaded configuration from %s", *configPath)
-	log.Printf("[INFO] Collection interval: %ds, Retention: %d days", cfg.CollectionIntervalSeconds, cfg.RetentionDays)
+	// Setup logging
+	if err := setupLogging(cfg.Logging); err != nil {
+		fatal("Failed to configure logging", err)
+	}
+
+	logger.Info("Bitcoin Node Monitor starting", "version", version)
+	logger.Info("Loaded configuration", "path", configPath,
+		"interval_seconds", cfg.CollectionIntervalSeconds, "retention_days", cfg.RetentionDays)
+	if len(cfg.Files) > 1 {
+		logger.Info("Merged config overrides", "files", strings.Join(cfg.Files[1:], ", "))
+	}
+
+	// Shutdown lets the current cycle finish and runs the deferred cleanup
+	// below. ctx is only cancelled if that takes longer than the timeout,
+	// abandoning in-flight collection, jobs and requests.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer logger.Info("Shutdown complete")
+
+	shutdown := make(chan struct{})
+	go func() {
+		sig := <-stop
+		timeout := time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second
+		logger.Info("Received signal, shutting down", "signal", sig.String(), "timeout", timeout)
+		close(shutdown)
+
+		select {
+		case <-time.After(timeout):
+			logger.Warn("Shutdown timed out, cancelling in-flight work")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
 	// Create data directory
 	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
-		log.Fatalf("[ERROR] Failed to create data directory: %v", err)
+		fatal("Failed to create data directory", err)
+	}
+	if err := permissions.Check(cfg.Permissions, cfg.DataDir, cfg.SocketPath); err != nil {
+		fatal("Failed to check permissions", err)
 	}
 
 	// Initialize storage
-	stor, err := storage.NewStorage(cfg.DataDir, cfg.RetentionDays)
+	stor, err := storage.NewBackend(cfg.StorageBackend, cfg.DataDir, cfg.MetricsRetentionDays())
 	if err != nil {
-		log.Fatalf("[ERROR] Failed to initialize storage: %v", err)
+		fatal("Failed to initialize storage", err)
 	}
 	defer stor.Close()
+	if jsonl, ok := stor.(*storage.Storage); ok && cfg.MaxStorageBytes > 0 {
+		jsonl.SetMaxBytes(cfg.MaxStorageBytes)
+	}
+	if jsonl, ok := stor.(*storage.Storage); ok && len(cfg.SectionRetentionDays) > 0 {
+		jsonl.SetSectionRetention(cfg.SectionRetentionDays, cfg.RetentionDays)
+	}
+	if jsonl, ok := stor.(*storage.Storage); ok && cfg.PowerSaving.Enabled {
+		jsonl.SetFlushInterval(time.Duration(cfg.PowerSaving.FlushIntervalSeconds) * time.Second)
+	}
+	files, _ := stor.(*storage.Storage) // nil with the memory backend
+
+	injector := injectFaults.Enabled()
+	if injector != nil {
+		logger.Warn("Fault injection enabled", "faults", injector.String())
+		stor = injector.WrapStorage(stor)
+	}
 
-	log.Printf("[INFO] Storage initialized at %s", cfg.DataDir)
+	logger.Info("Storage initialized", "path", cfg.DataDir, "backend", cfg.StorageBackend)
 
 	// Initialize collector
 	coll := collector.NewCollector(cfg)
-	log.Printf("[INFO] Collector initialized (System: %v, Bitcoin: %v, Tor: %v)",
-		cfg.System.Enabled, cfg.Bitcoin.Enabled, cfg.Tor.Enabled)
+	defer coll.Close()
+	coll.SetFaults(injector)
+	if cfg.Demo {
+		logger.Warn("Demo mode: serving simulated metrics, nothing is collected")
+	}
+	if cfg.Capture.Mode != "" {
+		capture, err := collector.OpenCapture(cfg.Capture.Mode, cfg.Capture.Path)
+		if err != nil {
+			fatal("Failed to open capture", err)
+		}
+		defer capture.Close()
+		coll.SetCapture(capture)
+		logger.Warn("Capture enabled", "mode", cfg.Capture.Mode, "path", cfg.Capture.Path)
+	}
+	logger.Info("Collector initialized",
+		"system", cfg.System.Enabled, "bitcoin", cfg.Bitcoin.Enabled, "tor", cfg.Tor.Enabled, "hardware", cfg.Hardware.Enabled)
+	for _, c := range custom.Registered() {
+		logger.Info("Custom collector registered", "collector", c.Name())
+	}
+	for _, e := range cfg.ExecCollectors {
+		logger.Info("Exec collector configured", "collector", e.Name, "command", e.Command)
+	}
+
+	// Seed derived metrics from stored history
+	historyStart := time.Now().UTC().AddDate(0, 0, -cfg.System.DiskForecastWindowDays)
+	if history, err := stor.Query(historyStart, time.Now().UTC()); err == nil {
+		coll.SeedHistory(history)
+	} else {
+		logger.Warn("Failed to load history for derived metrics", "error", err)
+	}
 
 	// Initialize server
 	srv := server.NewServer(cfg.SocketPath, stor, version)
+	srv.SetRPCProxy(coll)
+	srv.SetMempoolSource(coll)
+	srv.SetBlockStatsSource(coll)
+	srv.SetConfig(cfg)
+	if err := srv.SetSchemaVersion(cfg.OutputSchemaVersion); err != nil {
+		fatal("Failed to configure output schema", err)
+	}
+	srv.SetSocketLimits(cfg.SocketLimits)
+	if cfg.SocketAccess.Enabled() {
+		if err := srv.SetSocketAccess(cfg.SocketAccess); err != nil {
+			fatal("Failed to configure socket access", err)
+		}
+	}
+	if cfg.HTTP.Enabled {
+		srv.EnableHTTP(cfg.HTTP)
+	}
+	if cfg.QueryTCP.Enabled {
+		srv.EnableTCP(cfg.QueryTCP)
+	}
+	if cfg.CollectionPaused {
+		srv.Pause("paused by configuration")
+	}
+	if cfg.PowerSaving.Enabled {
+		srv.SetSocketCheckAlignment(time.Duration(cfg.CollectionIntervalSeconds) * time.Second)
+	}
 	if err := srv.Start(); err != nil {
-		log.Fatalf("[ERROR] Failed to start server: %v", err)
+		fatal("Failed to start server", err)
 	}
-	defer srv.Stop()
+	defer srv.Shutdown(ctx)
 
-	log.Printf("[INFO] Server started on %s", cfg.SocketPath)
+	logger.Info("Server started", "path", cfg.SocketPath)
 
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Connections to external services, through Tor when configured
+	outbound := netproxy.New(cfg.OutboundProxy)
+	if outbound != nil {
+		logger.Info("Routing outbound connections through proxy", "address", outbound.ProxyAddr(), "direct_hosts", cfg.OutboundProxy.DirectHosts)
+	}
+
+	// Initialize alerting
+	var alerts *alert.Engine
+	if cfg.Alerts.Enabled {
+		notifiers, err := alert.NewNotifiers(&cfg.Alerts, outbound)
+		if err != nil {
+			fatal("Failed to initialize alerting", err)
+		}
+		// External channels get a persistent queue so alerts raised while
+		// they are unreachable are delivered later; closed after alerts.Wait
+		channels := make([]alert.Notifier, 0, len(notifiers)+1)
+		for _, n := range notifiers {
+			queue, err := alert.NewQueue(n, filepath.Join(cfg.DataDir, "notifications"), cfg.Alerts.Queue)
+			if err != nil {
+				fatal("Failed to initialize alerting", err)
+			}
+			defer queue.Close()
+			channels = append(channels, queue)
+		}
+		alerts, err = alert.NewEngine(cfg.Alerts.Rules, append(channels, srv.Events()))
+		if err != nil {
+			fatal("Failed to initialize alerting", err)
+		}
+		logger.Info("Alerting enabled", "rules", len(cfg.Alerts.Rules), "locale", cfg.Alerts.Locale)
+		defer alerts.Wait(ctx)
+	}
+
+	// Initialize exporters that push each sample elsewhere
+	var sinks []sampleSink
+	if cfg.Zabbix.Enabled {
+		sinks = append(sinks, redacted(zabbix.NewSender(cfg, outbound), cfg, cfg.Zabbix.RedactionProfile))
+		logger.Info("Zabbix sender enabled", "server", cfg.Zabbix.Server)
+	}
+	if cfg.InfluxDB.Enabled {
+		writer, err := influx.NewWriter(cfg.InfluxDB, outbound)
+		if err != nil {
+			fatal("Failed to initialize InfluxDB writer", err)
+		}
+		sinks = append(sinks, redacted(writer, cfg, cfg.InfluxDB.RedactionProfile))
+		logger.Info("InfluxDB writer enabled", "url", cfg.InfluxDB.URL, "version", cfg.InfluxDB.Version)
+	}
+	if cfg.Pushgateway.Enabled {
+		dialer := outbound
+		if cfg.Pushgateway.UseTor && dialer == nil {
+			dialer = netproxy.New(config.OutboundProxyConfig{Enabled: true, Address: fmt.Sprintf("127.0.0.1:%d", cfg.Tor.SOCKSPort)})
+		}
+		pusher, err := pushgateway.NewPusher(cfg.Pushgateway, cfg.DataDir, version, dialer)
+		if err != nil {
+			fatal("Failed to initialize pushgateway", err)
+		}
+		sinks = append(sinks, pusher)
+		logger.Info("Pushing public statistics to pushgateway", "url", cfg.Pushgateway.URL, "proxy", dialer.ProxyAddr())
+		if dialer == nil {
+			logger.Warn("Pushgateway is reached directly, revealing this host's IP address to it")
+		}
+	}
+	defer func() {
+		for _, sink := range sinks {
+			sink.Close()
+		}
+	}()
+
+	// Copy each day's compressed metrics file off the host
+	if cfg.Replication.Enabled {
+		if files == nil {
+			fatal("Failed to initialize replication", fmt.Errorf("the %s backend keeps no files to replicate", cfg.StorageBackend))
+		}
+		replicator, err := replicate.New(cfg.Replication, cfg.DataDir, outbound)
+		if err != nil {
+			fatal("Failed to initialize replication", err)
+		}
+		defer replicator.Close()
+		files.SetReplicator(replicator)
+		logger.Info("Replicating compressed metrics files", "target", replicator.String())
+	}
+
+	// Initialize SNMP subagent
+	if cfg.SNMP.Enabled {
+		subagent, err := snmp.NewSubagent(cfg.SNMP, stor.GetCurrent, version)
+		if err != nil {
+			fatal("Failed to initialize SNMP subagent", err)
+		}
+		subagent.Start()
+		defer subagent.Stop()
+	}
+
+	// Initialize the raw snapshot stream
+	var raw *storage.RawStore
+	if cfg.RawSnapshots.Enabled {
+		raw, err = storage.NewRawStore(cfg.DataDir, cfg.RawSnapshots.RetentionDays)
+		if err != nil {
+			fatal("Failed to initialize raw snapshot storage", err)
+		}
+		defer raw.Close()
+	}
+
+	// Initialize maintenance scheduler
+	sched, err := newScheduler(cfg, stor, raw, coll)
+	if err != nil {
+		fatal("Failed to initialize scheduler", err)
+	}
+	sched.Start()
+	defer sched.Stop()
+	srv.SetJobLister(sched)
 
 	// Collection ticker
-	ticker := time.NewTicker(time.Duration(cfg.CollectionIntervalSeconds) * time.Second)
-	defer ticker.Stop()
+	ticks, stopTicks := collectionTicks(time.Duration(cfg.CollectionIntervalSeconds)*time.Second, cfg.PowerSaving.Enabled)
+	defer stopTicks()
+	if cfg.PowerSaving.Enabled {
+		logger.Info("Power saving enabled", "interval_seconds", cfg.CollectionIntervalSeconds,
+			"flush_interval_seconds", cfg.PowerSaving.FlushIntervalSeconds, "skipped_system_metrics", cfg.PowerSaving.SkipSystemMetrics)
+	}
 
 	// Stats
 	var collectionCount, errorCount int64
+	var pauseRecorded bool
 
-	log.Printf("[INFO] Starting collection loop...")
+	logger.Info("Starting collection loop")
 
 	// Initial collection
-	collectAndStore(coll, stor, &collectionCount, &errorCount, srv)
+	if !recordPause(stor, srv, &pauseRecorded) {
+		collectAndStore(ctx, coll, stor, alerts, sinks, &collectionCount, &errorCount, srv)
+	}
 
 	// Main loop
 	for {
 		select {
-		case <-ticker.C:
-			collectAndStore(coll, stor, &collectionCount, &errorCount, srv)
+		case <-ticks:
+			if recordPause(stor, srv, &pauseRecorded) {
+				continue
+			}
+			collectAndStore(ctx, coll, stor, alerts, sinks, &collectionCount, &errorCount, srv)
 
-		case sig := <-sigChan:
-			log.Printf("[INFO] Received signal %v, shutting down...", sig)
+		case <-shutdown:
 			return
 		}
 	}
 }
 
+// fatal logs an unrecoverable startup error and exits
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// collectionTicks returns a channel that receives a value every interval,
+// and a function that stops it. Aligned ticks fall on wall-clock multiples
+// of the interval, such as every full five minutes. Like a ticker, ticks
+// are dropped while collection is slow.
+func collectionTicks(interval time.Duration, aligned bool) (<-chan time.Time, func()) {
+	if !aligned {
+		ticker := time.NewTicker(interval)
+		return ticker.C, ticker.Stop
+	}
+
+	ticks := make(chan time.Time, 1)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			// A second ahead, so a tick never repeats its boundary
+			next := scheduler.Align(time.Now().Add(time.Second), interval)
+			select {
+			case t := <-time.After(time.Until(next)):
+				select {
+				case ticks <- t:
+				default:
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return ticks, func() { close(stop) }
+}
+
+// newScheduler registers the maintenance jobs that have a schedule
+// configured, and the raw snapshot calls if raw is not nil
+func newScheduler(cfg *config.Config, stor storage.StorageBackend, raw *storage.RawStore, coll *collector.Collector) (*scheduler.Scheduler, error) {
+	jitter := time.Duration(cfg.Maintenance.JitterSeconds) * time.Second
+	if cfg.PowerSaving.Enabled {
+		jitter = 0 // Jobs run with the aligned collections instead
+	}
+	sched := scheduler.New(jitter)
+	if cfg.PowerSaving.Enabled {
+		sched.SetAlignment(time.Duration(cfg.CollectionIntervalSeconds) * time.Second)
+	}
+
+	cleanup := stor.Cleanup
+	if raw != nil {
+		cleanup = func() error {
+			return errors.Join(stor.Cleanup(), raw.Cleanup())
+		}
+	}
+
+	jobs := map[string]scheduler.JobFunc{
+		"cleanup":     ignoreContext(cleanup),
+		"compaction":  nil, // Only for backends that implement storage.Compactor
+		"utxo_stats":  coll.RefreshUTXOStats,
+		"onion_check": coll.CheckOnionReachability,
+		"backup":      nil, // Only for backends that implement storage.Archiver
+		"reports":     reportJob(stor, cfg.Maintenance),
+	}
+	if compactor, ok := stor.(storage.Compactor); ok {
+		jobs["compaction"] = ignoreContext(compactor.Compact)
+	}
+	if archiver, ok := stor.(storage.Archiver); ok {
+		jobs["backup"] = backupJob(archiver, cfg.Maintenance.BackupDir, cfg.Maintenance.BackupKeep)
+	}
+
+	for name, spec := range cfg.Maintenance.Jobs {
+		if spec == "" {
+			continue
+		}
+
+		fn, ok := jobs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown maintenance job: %s", name)
+		}
+		if fn == nil {
+			logger.Info("Skipping maintenance job: not supported by the storage backend", "job", name)
+			continue
+		}
+
+		if err := sched.Add(name, spec, fn); err != nil {
+			return nil, err
+		}
+		logger.Info("Scheduled maintenance job", "job", name, "schedule", spec)
+	}
+
+	if raw == nil {
+		return sched, nil
+	}
+	for _, call := range cfg.RawSnapshots.Calls {
+		name := "raw_snapshot:" + call.Method
+		if call.Node != "" {
+			name += "@" + call.Node
+		}
+		if err := sched.Add(name, call.Schedule, rawSnapshotJob(raw, coll, call)); err != nil {
+			return nil, err
+		}
+		logger.Info("Scheduled raw snapshot", "job", name, "schedule", call.Schedule)
+	}
+
+	return sched, nil
+}
+
+// rawSnapshotJob runs an RPC call and stores its result in the raw stream
+func rawSnapshotJob(raw *storage.RawStore, coll *collector.Collector, call config.RawSnapshotCall) scheduler.JobFunc {
+	return func(ctx context.Context) error {
+		result, err := coll.RawCall(ctx, call.Node, call.Method, call.Params)
+		if err != nil {
+			return err
+		}
+		return raw.Write(&storage.RawRecord{
+			Timestamp: time.Now().UTC(),
+			Node:      call.Node,
+			Method:    call.Method,
+			Params:    call.Params,
+			Result:    result,
+		})
+	}
+}
+
+// ignoreContext adapts a job that runs to completion once started
+func ignoreContext(fn func() error) scheduler.JobFunc {
+	return func(context.Context) error {
+		return fn()
+	}
+}
+
+// recordPause reports whether collection is paused. The first paused cycle
+// writes a marker sample so the gap in the data is annotated rather than
+// looking like a failure. Storage keeps the marker out of the current
+// sample, so the last values stay served; status reports the pause.
+func recordPause(stor storage.StorageBackend, srv *server.Server, recorded *bool) bool {
+	pause := srv.PauseState()
+	if pause == nil {
+		*recorded = false
+		return false
+	}
+
+	if !*recorded {
+		marker := &metrics.Sample{
+			Timestamp: time.Now().UTC(),
+			Paused:    pause,
+		}
+		if err := stor.Write(marker); err != nil {
+			logger.Warn("Failed to record pause marker", "error", err)
+		}
+		srv.InvalidateQueryCache(marker.Timestamp)
+		*recorded = true
+	}
+
+	return true
+}
+
+// sampleSink receives every stored sample; Send must not block collection.
+// Close waits for anything still being delivered.
+type sampleSink interface {
+	Send(sample *metrics.Sample)
+	Close()
+}
+
+// redactingSink passes a redacted copy of each sample on to a sink
+type redactingSink struct {
+	sampleSink
+	profile *redact.Profile
+}
+
+// redacted wraps sink so it only sees samples redacted with the named
+// profile, if one is set
+func redacted(sink sampleSink, cfg *config.Config, profile string) sampleSink {
+	if profile == "" {
+		return sink
+	}
+	return &redactingSink{sampleSink: sink, profile: redact.New(cfg.RedactionProfiles[profile])}
+}
+
+func (r *redactingSink) Send(sample *metrics.Sample) {
+	redacted, err := r.profile.Sample(sample)
+	if err != nil {
+		logger.Warn("Failed to redact sample, not sending it", "error", err)
+		return
+	}
+	r.sampleSink.Send(redacted)
+}
+
 // collectAndStore performs collection and storage
-func collectAndStore(coll *collector.Collector, stor *storage.Storage, collectionCount, errorCount *int64, srv *server.Server) {
+func collectAndStore(ctx context.Context, coll *collector.Collector, stor storage.StorageBackend, alerts *alert.Engine, sinks []sampleSink, collectionCount, errorCount *int64, srv *server.Server) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("[ERROR] Panic during collection: %v", r)
+			logger.Error("Panic during collection", "panic", r)
 			*errorCount++
 		}
 	}()
 
 	// Collect metrics
-	sample := coll.Collect()
+	startTime := time.Now()
+	sample := coll.Collect(ctx)
+	sample.Socket = srv.SocketHealth()
 
-	// Write to storage
+	// Write to storage. A failed write still goes to alerts and sinks, as
+	// a full disk is among the things they report.
 	if err := stor.Write(sample); err != nil {
-		log.Printf("[ERROR] Failed to write sample: %v", err)
+		logger.Error("Failed to write sample", "error", err)
 		*errorCount++
-		return
+		srv.UpdateStatus(*collectionCount, *errorCount, sample.Timestamp)
+	} else {
+		*collectionCount++
+		logger.Debug("Collected sample", "duration", time.Since(startTime))
+
+		// Update server status
+		srv.InvalidateQueryCache(sample.Timestamp)
+		srv.UpdateStatus(*collectionCount, *errorCount, sample.Timestamp)
 	}
+	srv.Events().PublishSample(sample)
 
-	*collectionCount++
+	// Evaluate alert rules
+	if alerts != nil {
+		alerts.Evaluate(sample)
+	}
 
-	// Update server status
-	srv.UpdateStatus(*collectionCount, *errorCount, sample.Timestamp)
+	for _, sink := range sinks {
+		sink.Send(sample)
+	}
 
 	// Log summary
 	if *collectionCount%10 == 0 {
-		log.Printf("[INFO] Collected %d samples (%d errors)", *collectionCount, *errorCount)
+		logger.Info("Collection progress", "samples", *collectionCount, "errors", *errorCount)
 	}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/query"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/scheduler"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/storage"
+)
+
+// Names of the reports the reports job writes, around their UTC time
+const (
+	reportPrefix = "report-"
+	reportSuffix = ".json"
+)
+
+// report holds statistics of the samples stored in a period
+type report struct {
+	From    time.Time                     `json:"from"`
+	To      time.Time                     `json:"to"`
+	Samples int                           `json:"samples"`
+	Fields  map[string]map[string]float64 `json:"fields"` // field -> min, avg or max -> value
+}
+
+// reportJob writes a report on the samples stored since its previous run,
+// or in the last day on its first run, to the report directory and keeps
+// the newest reports
+func reportJob(stor storage.StorageBackend, m config.MaintenanceConfig) scheduler.JobFunc {
+	var last time.Time
+	return func(context.Context) error {
+		to := time.Now().UTC().Truncate(time.Second)
+		from := last
+		if from.IsZero() {
+			from = to.Add(-24 * time.Hour)
+		}
+
+		samples, err := stor.Query(from, to)
+		if err != nil {
+			return err
+		}
+		rep := &report{From: from, To: to, Fields: map[string]map[string]float64{}}
+		counts := map[string]int{}
+		for _, sample := range samples {
+			if sample.Paused != nil {
+				continue
+			}
+			rep.Samples++
+			for name, value := range query.Flatten(sample) {
+				if len(m.ReportFields) > 0 && !query.MatchesField(name, m.ReportFields) {
+					continue
+				}
+				stats := rep.Fields[name]
+				if stats == nil {
+					stats = map[string]float64{query.AggMin: value, query.AggMax: value}
+					rep.Fields[name] = stats
+				}
+				stats[query.AggMin] = math.Min(stats[query.AggMin], value)
+				stats[query.AggMax] = math.Max(stats[query.AggMax], value)
+				stats[query.AggAvg] += value
+				counts[name]++
+			}
+		}
+		for name, stats := range rep.Fields {
+			stats[query.AggAvg] /= float64(counts[name])
+		}
+
+		data, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(m.ReportDir, 0750); err != nil {
+			return err
+		}
+		path := filepath.Join(m.ReportDir, reportPrefix+to.Format("20060102-150405")+reportSuffix)
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, append(data, '\n'), 0640); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		last = to
+		logger.Info("Wrote maintenance report", "path", path, "samples", rep.Samples, "fields", len(rep.Fields))
+		return pruneFiles(m.ReportDir, reportPrefix, reportSuffix, m.ReportKeep)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/alert"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/collector"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/server"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/storage"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/client"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Results of a selftest check
+const (
+	checkPass = "PASS"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// checkResult is one row of the selftest report
+type checkResult struct {
+	name   string
+	result string
+	detail string
+}
+
+// selftest runs the agent's main paths once against the config and prints
+// a pass/fail matrix, returning the exit code. Storage and the socket use a
+// scratch directory in data_dir, so a running agent and its history are
+// not touched, and notifications are rendered but never sent.
+func selftest(configPath string) int {
+	var results []checkResult
+	report := func(name, result, detail string) {
+		results = append(results, checkResult{name: name, result: result, detail: detail})
+	}
+	defer func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.name, r.result, r.detail)
+		}
+		w.Flush()
+	}()
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		report("config", checkFail, err.Error())
+		return 1
+	}
+	report("config", checkPass, strings.Join(cfg.Files, ", "))
+	if err := setupLogging(cfg.Logging); err != nil {
+		report("logging", checkFail, err.Error())
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	sample := selftestCollect(ctx, cfg, report)
+
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		report("storage", checkFail, err.Error())
+		return 1
+	}
+	scratch, err := os.MkdirTemp(cfg.DataDir, "selftest-")
+	if err != nil {
+		report("storage", checkFail, fmt.Sprintf("data_dir is not writable: %v", err))
+		return 1
+	}
+	defer os.RemoveAll(scratch)
+
+	stor := selftestStorage(cfg, scratch, sample, report)
+	if stor != nil {
+		selftestSocket(ctx, cfg, scratch, stor, sample, report)
+		stor.Close()
+	} else {
+		report("socket", checkSkip, "needs storage")
+	}
+
+	selftestNotify(cfg, sample, report)
+
+	for _, r := range results {
+		if r.result == checkFail {
+			return 1
+		}
+	}
+	return 0
+}
+
+// selftestCollect performs one full collection and checks every enabled
+// source contributed to it
+func selftestCollect(ctx context.Context, cfg *config.Config, report func(name, result, detail string)) *metrics.Sample {
+	coll := collector.NewCollector(cfg)
+	defer coll.Close()
+
+	start := time.Now()
+	sample := coll.Collect(ctx)
+	took := time.Since(start).Round(time.Millisecond)
+
+	sources := []struct {
+		name    string
+		enabled bool
+		present bool
+	}{
+		{"system", cfg.System.Enabled, sample.System != nil},
+		{"bitcoin", cfg.Bitcoin.Enabled, sample.Bitcoin != nil},
+		{"tor", cfg.Tor.Enabled, sample.Tor != nil},
+		{"hardware", cfg.Hardware.Enabled, sample.Hardware != nil},
+		{"systemd", cfg.Systemd.Enabled, sample.Services != nil},
+	}
+	var collected, missing []string
+	for _, source := range sources {
+		switch {
+		case cfg.Demo || !source.enabled:
+		case source.present:
+			collected = append(collected, source.name)
+		default:
+			missing = append(missing, source.name)
+		}
+	}
+	for _, node := range cfg.BitcoinNodes {
+		if sample.Nodes[node.Name] == nil {
+			missing = append(missing, "bitcoin_nodes."+node.Name)
+		} else {
+			collected = append(collected, "bitcoin_nodes."+node.Name)
+		}
+	}
+
+	switch {
+	case cfg.Demo:
+		report("collection", checkPass, fmt.Sprintf("demo mode, simulated sample in %s", took))
+	case len(missing) > 0:
+		report("collection", checkFail, fmt.Sprintf("no metrics from %s, see the log above", strings.Join(missing, ", ")))
+	case len(collected) == 0:
+		report("collection", checkSkip, "no collectors enabled")
+	default:
+		report("collection", checkPass, fmt.Sprintf("%s in %s", strings.Join(collected, ", "), took))
+	}
+	return sample
+}
+
+// selftestStorage writes the sample with the configured backend and reads
+// it back, returning the open backend on success
+func selftestStorage(cfg *config.Config, dir string, sample *metrics.Sample, report func(name, result, detail string)) storage.StorageBackend {
+	stor, err := storage.NewBackend(cfg.StorageBackend, dir, 1)
+	if err != nil {
+		report("storage", checkFail, err.Error())
+		return nil
+	}
+
+	fail := func(err error) storage.StorageBackend {
+		report("storage", checkFail, err.Error())
+		stor.Close()
+		return nil
+	}
+
+	if err := stor.Write(sample); err != nil {
+		return fail(fmt.Errorf("write failed: %w", err))
+	}
+	samples, err := stor.Query(sample.Timestamp.Add(-time.Second), sample.Timestamp.Add(time.Second))
+	if err != nil {
+		return fail(fmt.Errorf("read failed: %w", err))
+	}
+	if len(samples) != 1 || !samples[0].Timestamp.Equal(sample.Timestamp) {
+		return fail(fmt.Errorf("read back %d samples instead of the one written", len(samples)))
+	}
+
+	report("storage", checkPass, fmt.Sprintf("%s backend wrote and read back a sample", cfg.StorageBackend))
+	return stor
+}
+
+// selftestSocket serves stor on a scratch socket of the configured kind and
+// queries it with the client library
+func selftestSocket(ctx context.Context, cfg *config.Config, dir string, stor storage.StorageBackend, sample *metrics.Sample, report func(name, result, detail string)) {
+	path := filepath.Join(dir, "selftest.sock")
+	switch {
+	case strings.HasPrefix(cfg.SocketPath, "tcp:"):
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			report("socket", checkFail, err.Error())
+			return
+		}
+		path = "tcp:" + listener.Addr().String()
+		listener.Close()
+	case strings.HasPrefix(cfg.SocketPath, `\\.\pipe\`):
+		path = fmt.Sprintf(`\\.\pipe\btc-monitor-selftest-%d`, os.Getpid())
+	}
+
+	srv := server.NewServer(path, stor, version)
+	if err := srv.Start(); err != nil {
+		report("socket", checkFail, err.Error())
+		return
+	}
+	defer srv.Shutdown(ctx)
+
+	current, err := client.New(path).Current()
+	if err != nil {
+		report("socket", checkFail, fmt.Sprintf("GET current failed: %v", err))
+		return
+	}
+	if !current.Timestamp.Equal(sample.Timestamp) {
+		report("socket", checkFail, fmt.Sprintf("GET current returned the sample from %s instead of %s", current.Timestamp, sample.Timestamp))
+		return
+	}
+	report("socket", checkPass, "GET current answered on "+path)
+}
+
+// selftestNotify renders an alert for every enabled notification channel
+// without sending it
+func selftestNotify(cfg *config.Config, sample *metrics.Sample, report func(name, result, detail string)) {
+	if !cfg.Alerts.Enabled {
+		report("notification", checkSkip, "alerts are disabled")
+		return
+	}
+
+	notifiers, err := alert.NewNotifiers(&cfg.Alerts, netproxy.New(cfg.OutboundProxy))
+	if err != nil {
+		report("notification", checkFail, err.Error())
+		return
+	}
+	if len(notifiers) == 0 {
+		report("notification", checkSkip, "no notification channels enabled")
+		return
+	}
+
+	test := &alert.Alert{
+		Rule:      "selftest",
+		Severity:  "info",
+		State:     alert.StateFiring,
+		Field:     "selftest",
+		Op:        ">",
+		Threshold: 0,
+		Value:     1,
+		Since:     sample.Timestamp,
+		Time:      sample.Timestamp,
+	}
+	for _, n := range notifiers {
+		name := "notification:" + n.Name()
+		runner, ok := n.(alert.DryRunner)
+		if !ok {
+			report(name, checkSkip, "no dry run for this channel")
+			continue
+		}
+		message, err := runner.DryRun(test)
+		if err != nil {
+			report(name, checkFail, err.Error())
+			continue
+		}
+		report(name, checkPass, fmt.Sprintf("rendered a %d-byte message, not sent", len(message)))
+	}
+}
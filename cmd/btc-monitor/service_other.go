@@ -0,0 +1,22 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// defaultConfigPath is where the agent looks for its configuration
+const defaultConfigPath = "/var/lib/bitcoin-monitor/config.json"
+
+// isService reports whether the process was started by a service manager
+// that needs a control handler; only Windows services do
+func isService() bool {
+	return false
+}
+
+// runService is only used on Windows
+func runService(configPath string) {}
+
+// controlService is only supported on Windows
+func controlService(command, configPath string) error {
+	return errors.New("-service is only supported on Windows")
+}
@@ -0,0 +1,183 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the Windows service name and Event Log source
+const serviceName = "btc-monitor"
+
+// defaultConfigPath is where the agent looks for its configuration
+var defaultConfigPath = filepath.Join(programData(), "bitcoin-monitor", "config.json")
+
+// programData returns the machine-wide application data directory
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return `C:\ProgramData`
+}
+
+// isService reports whether the process was started by the service manager
+func isService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// service adapts the agent to the service control manager
+type service struct {
+	configPath string
+}
+
+// Execute runs the agent until the service manager asks it to stop
+func (s *service) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(s.configPath, stop)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				stop <- syscall.SIGTERM
+				<-done
+				return false, 0
+			}
+		case <-done:
+			// run only returns on its own after a fatal error
+			return false, 1
+		}
+	}
+}
+
+// runService runs the agent under the service control manager, logging to
+// the Event Log
+func runService(configPath string) {
+	setupLogging = func(cfg config.LoggingConfig) error {
+		_, err := logging.SetupEventLog(serviceName, cfg.Level)
+		return err
+	}
+
+	if err := svc.Run(serviceName, &service{configPath: configPath}); err != nil {
+		if elog, err2 := eventlog.Open(serviceName); err2 == nil {
+			elog.Error(3, fmt.Sprintf("Service failed: %v", err))
+			elog.Close()
+		}
+		os.Exit(1)
+	}
+}
+
+// controlService installs, removes, starts or stops the Windows service
+func controlService(command, configPath string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	switch command {
+	case "install":
+		return installService(m, configPath)
+	case "uninstall":
+		return uninstallService(m)
+	case "start":
+		s, err := m.OpenService(serviceName)
+		if err != nil {
+			return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+		}
+		defer s.Close()
+		return s.Start()
+	case "stop":
+		s, err := m.OpenService(serviceName)
+		if err != nil {
+			return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+		}
+		defer s.Close()
+		_, err = s.Control(svc.Stop)
+		return err
+	default:
+		return fmt.Errorf("unknown service command %q (expected install, uninstall, start, or stop)", command)
+	}
+}
+
+// installService registers the service to start automatically with the
+// current executable and configuration, and registers the Event Log source
+func installService(m *mgr.Mgr, configPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Bitcoin Node Monitor",
+		Description: "Collects Bitcoin Core, Tor and host metrics for btc-node-monitor",
+		StartType:   mgr.StartAutomatic,
+	}, "-config", configPath)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	// Restart after crashes rather than leaving the node unmonitored
+	s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 10 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 60 * time.Second},
+	}, 86400)
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %w", err)
+	}
+
+	fmt.Printf("Installed service %s (config: %s)\n", serviceName, configPath)
+	return nil
+}
+
+// uninstallService removes the service and its Event Log source
+func uninstallService(m *mgr.Mgr) error {
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	eventlog.Remove(serviceName)
+
+	fmt.Printf("Removed service %s\n", serviceName)
+	return nil
+}
@@ -2,9 +2,17 @@ module github.com/bitcoin-node-manager/btc-node-monitor
 
 go 1.25.7
 
-require github.com/shirou/gopsutil/v3 v3.24.5
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/shirou/gopsutil/v3 v3.24.5
+	golang.org/x/crypto v0.23.0
+	golang.org/x/sys v0.20.0
+)
 
 require (
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
 	github.com/power-devops/perfstat v0.0.0-20210106213030-5aafc221ea8c // indirect
@@ -12,5 +20,4 @@ require (
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/sys v0.20.0 // indirect
 )
@@ -0,0 +1,245 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/i18n"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+)
+
+// emailTemplate is the plain-text body of alert emails. Labels are
+// translated and padded to a common width by emailLabels.
+var emailTemplate = template.Must(template.New("email").Parse(`{{.Text}}
+
+{{.Labels.rule}}{{.Alert.Rule}}
+{{.Labels.severity}}{{.Severity}}
+{{.Labels.state}}{{.State}}
+{{.Labels.condition}}{{.Alert.Field}} {{.Alert.Op}} {{.Alert.Threshold}}
+{{.Labels.value}}{{.Alert.Value}}
+{{.Labels.since}}{{.Since}}
+{{.Labels.time}}{{.Time}}
+{{if .Alert.Extreme}}{{.Labels.duration}}{{.Alert.Duration}}
+{{index .Labels .ExtremeKind}}{{.Extreme}}
+{{end}}{{if .Values}}
+{{.RecentValues}}:
+{{range .Values}}  {{.Name}}: {{.Value}}
+{{end}}{{end}}
+-- 
+btc-monitor
+`))
+
+// emailFields are the labelled lines of the email body, in order
+var emailFields = []string{"rule", "severity", "state", "condition", "value", "since", "time", "duration", "peak", "trough"}
+
+// emailLabels translates the field labels and pads them so values line up
+func emailLabels(loc *i18n.Localizer) map[string]string {
+	labels := make(map[string]string, len(emailFields))
+	width := 0
+	for _, field := range emailFields {
+		labels[field] = loc.T("email."+field) + ":"
+		width = max(width, utf8.RuneCountInString(labels[field]))
+	}
+	for field, label := range labels {
+		labels[field] = label + strings.Repeat(" ", width-utf8.RuneCountInString(label)+1)
+	}
+	return labels
+}
+
+// EmailNotifier sends alerts by SMTP
+type EmailNotifier struct {
+	host     string
+	port     int
+	security string // "starttls", "tls", or "none"
+	username string
+	password string
+	from     string
+	to       []string
+	loc      *i18n.Localizer
+	timeout  time.Duration
+	dialer   *netproxy.Dialer // nil connects directly
+}
+
+// NewEmailNotifier creates an SMTP notifier
+func NewEmailNotifier(host string, port int, security, username, password, from string, to []string, loc *i18n.Localizer) *EmailNotifier {
+	return &EmailNotifier{
+		host:     host,
+		port:     port,
+		security: security,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+		loc:      loc,
+		timeout:  30 * time.Second,
+	}
+}
+
+// SetDialer connects to the SMTP server through d
+func (e *EmailNotifier) SetDialer(d *netproxy.Dialer) {
+	e.dialer = d
+}
+
+// Name returns the notifier name
+func (e *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Notify sends the alert as a plain-text email
+func (e *EmailNotifier) Notify(alert *Alert) error {
+	if len(e.to) == 0 {
+		return &PermanentError{Err: errors.New("no recipients configured")}
+	}
+
+	msg, err := e.buildMessage(alert)
+	if err != nil {
+		return err
+	}
+
+	client, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if e.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(e.from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range e.to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp server rejected message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// DryRun returns the message Notify would send, headers included
+func (e *EmailNotifier) DryRun(alert *Alert) (string, error) {
+	if e.host == "" || e.from == "" || len(e.to) == 0 {
+		return "", fmt.Errorf("email requires a host, a from address and recipients")
+	}
+	msg, err := e.buildMessage(alert)
+	if err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
+
+// dial connects to the SMTP server using the configured security mode
+func (e *EmailNotifier) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(e.host, fmt.Sprintf("%d", e.port))
+	tlsConfig := &tls.Config{ServerName: e.host}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	conn, err := e.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(e.timeout))
+
+	if e.security == "tls" {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect to smtp server: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp handshake failed: %w", err)
+	}
+
+	if e.security == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("smtp STARTTLS failed: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// namedValue is a metric value listed in the email body
+type namedValue struct {
+	Name  string
+	Value float64
+}
+
+// buildMessage renders headers and body for an alert
+func (e *EmailNotifier) buildMessage(alert *Alert) ([]byte, error) {
+	values := make([]namedValue, 0, len(alert.Values))
+	for name, value := range alert.Values {
+		values = append(values, namedValue{Name: name, Value: value})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+
+	var extreme float64
+	if alert.Extreme != nil {
+		extreme = *alert.Extreme
+	}
+
+	var body bytes.Buffer
+	err := emailTemplate.Execute(&body, map[string]interface{}{
+		"Alert":        alert,
+		"Text":         alert.LocalizedText(e.loc),
+		"Labels":       emailLabels(e.loc),
+		"Severity":     severityLabel(e.loc, alert.Severity),
+		"State":        stateLabel(e.loc, alert.State),
+		"Since":        alert.Since.Format(time.RFC1123Z),
+		"Time":         alert.Time.Format(time.RFC1123Z),
+		"RecentValues": e.loc.T("email.recent_values"),
+		"Values":       values,
+		"ExtremeKind":  alert.extremeKind(),
+		"Extreme":      extreme,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+
+	subject := mime.QEncoding.Encode("utf-8", e.loc.T("alert.subject", alert.Rule, stateLabel(e.loc, alert.State)))
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+
+	return msg.Bytes(), nil
+}
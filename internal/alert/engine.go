@@ -0,0 +1,341 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/i18n"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/query"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+var logger = logging.New("alert")
+
+// Alert states
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Alert is a state transition of a rule, delivered to notifiers
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Severity  string    `json:"severity"`
+	State     string    `json:"state"` // "firing" or "resolved"
+	Field     string    `json:"field"`
+	Op        string    `json:"op"`
+	Threshold float64   `json:"threshold"`
+	Value     float64   `json:"value"`
+	Since     time.Time `json:"since"` // When the condition started
+	Time      time.Time `json:"time"`  // When this transition happened
+
+	// Key metric values from the sample that triggered the transition
+	Values map[string]float64 `json:"values,omitempty"`
+
+	// How long the condition held and its worst value meanwhile, the
+	// highest or lowest depending on the operator; resolved alerts only
+	DurationSeconds int64    `json:"duration_seconds,omitempty"`
+	Extreme         *float64 `json:"extreme,omitempty"`
+}
+
+// MarshalJSON encodes a non-finite value, such as the disk forecast of a
+// disk that is not filling up, as null, as JSON has no number for it
+func (a Alert) MarshalJSON() ([]byte, error) {
+	type plain Alert
+	encoded := struct {
+		plain
+		Value *float64 `json:"value"`
+	}{plain: plain(a)}
+	if !math.IsInf(a.Value, 0) && !math.IsNaN(a.Value) {
+		encoded.Value = &a.Value
+	}
+	return json.Marshal(encoded)
+}
+
+// summaryFields are included with every alert for context
+var summaryFields = []string{
+	"bitcoin.block_height",
+	"bitcoin.blocks_behind",
+	"bitcoin.peers",
+	"bitcoin.mempool_tx_count",
+	"system.cpu_percent",
+	"system.disk_used_percent",
+	"system.memory_used_bytes",
+	"tor.established_count",
+}
+
+// Text renders the alert as a short human-readable message in English
+func (a *Alert) Text() string {
+	return a.LocalizedText(i18n.English())
+}
+
+// LocalizedText renders the alert message in the localizer's language. Rule
+// names and metric fields are identifiers and are left untranslated.
+func (a *Alert) LocalizedText(loc *i18n.Localizer) string {
+	if a.State == StateResolved {
+		if a.Extreme == nil {
+			return loc.T("alert.resolved", a.Rule, a.Field, a.Value, a.Op, a.Threshold)
+		}
+		return loc.T("alert.resolved_incident", a.Rule, a.Field, a.Value, a.Op, a.Threshold,
+			a.Duration(), loc.T("alert."+a.extremeKind()), *a.Extreme)
+	}
+	return loc.T("alert.firing", severityLabel(loc, a.Severity), a.Rule, a.Field,
+		a.Value, a.Op, a.Threshold, a.Since.Format(time.RFC3339))
+}
+
+// Duration returns how long the condition of a resolved alert held
+func (a *Alert) Duration() time.Duration {
+	return time.Duration(a.DurationSeconds) * time.Second
+}
+
+// extremeKind names the extreme of a resolved alert: "trough" below the
+// threshold, "peak" otherwise
+func (a *Alert) extremeKind() string {
+	if a.Extreme != nil && *a.Extreme < a.Threshold {
+		return "trough"
+	}
+	return "peak"
+}
+
+// severityLabel returns the upper-case severity used in message prefixes
+func severityLabel(loc *i18n.Localizer, severity string) string {
+	switch severity {
+	case "critical", "info":
+		return loc.T("severity." + severity)
+	default:
+		return loc.T("severity.warning")
+	}
+}
+
+// stateLabel returns the translated name of an alert state
+func stateLabel(loc *i18n.Localizer, state string) string {
+	return loc.T("state." + state)
+}
+
+// ruleState tracks a rule across evaluations
+type ruleState struct {
+	pendingSince time.Time // When the condition was first seen true; zero if false
+	firing       bool
+	extreme      float64 // Worst value since pendingSince
+}
+
+// Engine evaluates alert rules against each collected sample and sends
+// firing and resolved transitions to the configured notifiers
+type Engine struct {
+	rules     []config.AlertRule
+	notifiers []Notifier
+
+	mu     sync.Mutex
+	states map[string]*ruleState
+
+	pending sync.WaitGroup // Notifications still being delivered
+}
+
+// NewEngine creates an alert engine for the given rules and notifiers
+func NewEngine(rules []config.AlertRule, notifiers []Notifier) (*Engine, error) {
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		// State is kept by name, so rules sharing one would interfere
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %s: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Field == "" {
+			return nil, fmt.Errorf("rule %s: field is required", rule.Name)
+		}
+		if _, ok := comparisons[rule.Op]; !ok {
+			return nil, fmt.Errorf("rule %s: unknown operator %q", rule.Name, rule.Op)
+		}
+		for _, state := range rule.States {
+			if !nodeStates[state] {
+				return nil, fmt.Errorf("rule %s: unknown state %q (use ibd, reindex, pruning or steady)", rule.Name, state)
+			}
+		}
+	}
+
+	return &Engine{
+		rules:     rules,
+		notifiers: notifiers,
+		states:    make(map[string]*ruleState),
+	}, nil
+}
+
+// comparisons implements the supported rule operators
+var comparisons = map[string]func(value, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// worse reports whether value is further into a rule's condition than
+// extreme: higher for > and >=, lower for < and <=, and further from the
+// threshold for == and !=
+func worse(op string, value, extreme, threshold float64) bool {
+	switch op {
+	case ">", ">=":
+		return value > extreme
+	case "<", "<=":
+		return value < extreme
+	default:
+		return math.Abs(value-threshold) > math.Abs(extreme-threshold)
+	}
+}
+
+// nodeStates are the states a rule can be limited to
+var nodeStates = map[string]bool{
+	metrics.NodeStateIBD:     true,
+	metrics.NodeStateReindex: true,
+	metrics.NodeStatePruning: true,
+	metrics.NodeStateSteady:  true,
+}
+
+// Evaluate checks every rule against a sample. A rule fires once its
+// condition has held for ForSeconds and resolves as soon as it no longer
+// holds. Rules whose field is missing from the sample keep their state.
+// A rule limited to some node states does not hold in others.
+func (e *Engine) Evaluate(sample *metrics.Sample) {
+	fields := Fields(sample)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rule := range e.rules {
+		value, ok := fields[rule.Field]
+		if !ok {
+			continue
+		}
+
+		state, ok := e.states[rule.Name]
+		if !ok {
+			state = &ruleState{}
+			e.states[rule.Name] = state
+		}
+
+		alert := &Alert{
+			Rule:      rule.Name,
+			Severity:  rule.Severity,
+			Field:     rule.Field,
+			Op:        rule.Op,
+			Threshold: rule.Threshold,
+			Value:     value,
+			Time:      sample.Timestamp,
+			Values:    summaryValues(fields),
+		}
+
+		inState := len(rule.States) == 0 || slices.Contains(rule.States, sample.State)
+		if !inState || !comparisons[rule.Op](value, rule.Threshold) {
+			if state.firing {
+				alert.State = StateResolved
+				alert.Since = state.pendingSince
+				alert.DurationSeconds = int64(sample.Timestamp.Sub(state.pendingSince).Seconds())
+				extreme := state.extreme
+				alert.Extreme = &extreme
+				e.dispatch(alert)
+			}
+			state.pendingSince = time.Time{}
+			state.firing = false
+			continue
+		}
+
+		if state.pendingSince.IsZero() {
+			state.pendingSince = sample.Timestamp
+			state.extreme = value
+		} else if worse(rule.Op, value, state.extreme, rule.Threshold) {
+			state.extreme = value
+		}
+
+		forDuration := time.Duration(rule.ForSeconds) * time.Second
+		if !state.firing && sample.Timestamp.Sub(state.pendingSince) >= forDuration {
+			state.firing = true
+			alert.State = StateFiring
+			alert.Since = state.pendingSince
+			e.dispatch(alert)
+		}
+	}
+}
+
+// dispatch sends an alert to every notifier without blocking collection
+func (e *Engine) dispatch(alert *Alert) {
+	logger.Info("Alert "+alert.State, "rule", alert.Rule, "severity", alert.Severity, "field", alert.Field, "value", alert.Value, "threshold", alert.Threshold)
+
+	for _, n := range e.notifiers {
+		e.pending.Add(1)
+		go func(n Notifier) {
+			defer e.pending.Done()
+			if err := n.Notify(alert); err != nil {
+				logger.Warn("Failed to send alert", "notifier", n.Name(), "rule", alert.Rule, "error", err)
+			}
+		}(n)
+	}
+}
+
+// Wait blocks until notifications already dispatched have been delivered
+// or ctx expires
+func (e *Engine) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// summaryValues picks the summary fields present in a sample
+func summaryValues(fields map[string]float64) map[string]float64 {
+	values := make(map[string]float64, len(summaryFields))
+	for _, name := range summaryFields {
+		if value, ok := fields[name]; ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// Fields returns the flattened numeric fields of a sample plus the derived
+// values alert rules commonly need
+func Fields(sample *metrics.Sample) map[string]float64 {
+	fields := query.Flatten(sample)
+
+	if b := sample.Bitcoin; b != nil {
+		fields["bitcoin.blocks_behind"] = float64(b.Headers - b.BlockHeight)
+		if b.ExternalTipHeight > 0 {
+			fields["bitcoin.blocks_behind_external"] = float64(b.ExternalTipHeight - b.BlockHeight)
+		}
+		fields["bitcoin.time_drift_seconds"] = math.Abs(float64(b.TimeOffsetSeconds))
+	}
+	if s := sample.System; s != nil && s.DiskTotalBytes > 0 {
+		fields["system.disk_used_percent"] = float64(s.DiskUsedBytes) / float64(s.DiskTotalBytes) * 100
+	}
+	// The forecast is omitted while usage is not growing; report that as
+	// never filling up, so a forecast rule resolves once space is freed
+	// instead of keeping its state
+	if s := sample.System; s != nil && s.DiskTotalBytes > 0 {
+		if _, ok := fields["derived.disk_days_until_full"]; !ok {
+			fields["derived.disk_days_until_full"] = math.Inf(1)
+		}
+	}
+	if s := sample.System; s != nil && s.ClockOffsetSeconds != nil {
+		fields["system.clock_drift_seconds"] = math.Abs(*s.ClockOffsetSeconds)
+	}
+
+	return fields
+}
@@ -0,0 +1,16 @@
+package alert
+
+import (
+	"errors"
+	"net/url"
+)
+
+// redactURLError strips the request URL from an HTTP client error, for
+// APIs that carry credentials in the URL
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,582 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	mrand "math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"golang.org/x/crypto/chacha20"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/i18n"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/websocket"
+)
+
+// Nostr event kinds
+const (
+	nostrKindDM       = 4    // NIP-04 encrypted direct message
+	nostrKindSeal     = 13   // NIP-59 seal, signed by the sender
+	nostrKindChat     = 14   // NIP-17 chat message, sent unsigned inside a seal
+	nostrKindGiftWrap = 1059 // NIP-59 gift wrap, signed by a one-time key
+)
+
+// Direct message protocols
+const (
+	nostrNIP17 = "nip17"
+	nostrNIP04 = "nip04"
+)
+
+// nostrRelayTimeout bounds connecting to a relay and waiting for it to
+// accept an event
+const nostrRelayTimeout = 15 * time.Second
+
+// nostrWrapJitter is how far back seals and gift wraps are dated at random,
+// so their timestamps do not reveal when the message was sent (NIP-59)
+const nostrWrapJitter = 48 * time.Hour
+
+// NostrNotifier sends alerts as encrypted Nostr direct messages from the
+// agent's own key, publishing them to every configured relay
+type NostrNotifier struct {
+	key       *btcec.PrivateKey
+	recipient *btcec.PublicKey
+	relays    []string
+	protocol  string
+	loc       *i18n.Localizer
+	dialer    *netproxy.Dialer
+}
+
+// nostrEvent is a Nostr event (NIP-01). Chat messages inside a seal are
+// unsigned and have no sig.
+type nostrEvent struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig,omitempty"`
+}
+
+// NewNostrNotifier creates a notifier messaging recipient, an npub or hex
+// public key, through relays. protocol is "nip17" for gift-wrapped private
+// messages or "nip04" for clients that only read the older direct
+// messages. The agent's key is read from keyFile, or generated there on
+// first use.
+func NewNostrNotifier(recipient string, relays []string, protocol, keyFile string, loc *i18n.Localizer) (*NostrNotifier, error) {
+	pubKey, err := parseNostrPubKey(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nostr recipient: %w", err)
+	}
+	if len(relays) == 0 {
+		return nil, fmt.Errorf("nostr requires at least one relay")
+	}
+	for _, relay := range relays {
+		if !strings.HasPrefix(relay, "wss://") && !strings.HasPrefix(relay, "ws://") {
+			return nil, fmt.Errorf("nostr relay %q must be a ws:// or wss:// URL", relay)
+		}
+	}
+	switch protocol {
+	case "":
+		protocol = nostrNIP17
+	case nostrNIP17, nostrNIP04:
+	default:
+		return nil, fmt.Errorf("unknown nostr protocol %q (use nip17 or nip04)", protocol)
+	}
+
+	key, err := loadNostrKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NostrNotifier{
+		key:       key,
+		recipient: pubKey,
+		relays:    relays,
+		protocol:  protocol,
+		loc:       loc,
+	}, nil
+}
+
+// SetDialer routes relay connections through d
+func (n *NostrNotifier) SetDialer(d *netproxy.Dialer) {
+	n.dialer = d
+}
+
+// Name returns the notifier name
+func (n *NostrNotifier) Name() string {
+	return "nostr"
+}
+
+// Notify publishes the alert as a direct message to every relay. Delivery
+// succeeds once any relay accepts it, since the recipient's client reads
+// from several relays.
+func (n *NostrNotifier) Notify(alert *Alert) error {
+	text := n.loc.T("alert.title", alert.Rule, stateLabel(n.loc, alert.State)) + "\n\n" + alert.LocalizedText(n.loc)
+
+	var event *nostrEvent
+	var err error
+	if n.protocol == nostrNIP04 {
+		event, err = n.newDirectMessage(text)
+	} else {
+		event, err = n.newGiftWrap(text)
+	}
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(n.relays))
+	var wg sync.WaitGroup
+	for i, relay := range n.relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.publish(relay, event); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", relay, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no nostr relay accepted the message: %w", errors.Join(errs...))
+}
+
+// newDirectMessage encrypts text for the recipient and signs it as a NIP-04
+// direct message
+func (n *NostrNotifier) newDirectMessage(text string) (*nostrEvent, error) {
+	content, err := nip04Encrypt(n.key, n.recipient, text)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &nostrEvent{
+		CreatedAt: time.Now().Unix(),
+		Kind:      nostrKindDM,
+		Tags:      [][]string{{"p", nostrPubKeyHex(n.recipient)}},
+		Content:   content,
+	}
+	if err := signNostrEvent(n.key, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// newGiftWrap wraps text as a NIP-17 private message: an unsigned chat
+// message, sealed and signed by the agent, then wrapped and signed by a
+// one-time key so relays see neither the sender nor the content
+func (n *NostrNotifier) newGiftWrap(text string) (*nostrEvent, error) {
+	recipientHex := nostrPubKeyHex(n.recipient)
+
+	rumor := &nostrEvent{
+		PubKey:    nostrPubKeyHex(n.key.PubKey()),
+		CreatedAt: time.Now().Unix(),
+		Kind:      nostrKindChat,
+		Tags:      [][]string{{"p", recipientHex}},
+		Content:   text,
+	}
+	id, err := nostrEventID(rumor)
+	if err != nil {
+		return nil, err
+	}
+	rumor.ID = hex.EncodeToString(id[:])
+
+	seal, err := nip59Wrap(n.key, n.recipient, rumor, nostrKindSeal, [][]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nostr wrap key: %w", err)
+	}
+	return nip59Wrap(ephemeral, n.recipient, seal, nostrKindGiftWrap, [][]string{{"p", recipientHex}})
+}
+
+// nip59Wrap encrypts inner for recipient into a new event of kind signed by
+// key, dated a random time in the past
+func nip59Wrap(key *btcec.PrivateKey, recipient *btcec.PublicKey, inner *nostrEvent, kind int, tags [][]string) (*nostrEvent, error) {
+	data, err := json.Marshal(inner)
+	if err != nil {
+		return nil, err
+	}
+	content, err := nip44Encrypt(key, recipient, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	event := &nostrEvent{
+		CreatedAt: time.Now().Add(-mrand.N(nostrWrapJitter)).Unix(),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   content,
+	}
+	if err := signNostrEvent(key, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// nostrEventID returns the ID of an event: the hash of its serialized
+// fields without id and sig
+func nostrEventID(event *nostrEvent) ([32]byte, error) {
+	// NIP-01 escapes only quotes, backslashes and control characters, so
+	// HTML escaping is turned off
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode([]interface{}{0, event.PubKey, event.CreatedAt, event.Kind, event.Tags, event.Content}); err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// signNostrEvent sets the public key, ID and signature of an event
+func signNostrEvent(key *btcec.PrivateKey, event *nostrEvent) error {
+	event.PubKey = nostrPubKeyHex(key.PubKey())
+	id, err := nostrEventID(event)
+	if err != nil {
+		return err
+	}
+	sig, err := schnorr.Sign(key, id[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign nostr event: %w", err)
+	}
+	event.ID = hex.EncodeToString(id[:])
+	event.Sig = hex.EncodeToString(sig.Serialize())
+	return nil
+}
+
+// publish sends the event to a relay and waits for the relay to accept it
+func (n *NostrNotifier) publish(relay string, event *nostrEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), nostrRelayTimeout)
+	defer cancel()
+
+	ws, err := websocket.Dial(ctx, relay, n.dialer.DialContext)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	message, err := json.Marshal([]interface{}{"EVENT", event})
+	if err != nil {
+		return err
+	}
+	if err := ws.WriteText(message, nostrRelayTimeout); err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	for {
+		data, err := ws.ReadText(time.Until(deadline))
+		if err != nil {
+			return fmt.Errorf("no reply from relay: %w", err)
+		}
+
+		// ["OK", <event id>, <accepted>, <message>]; notices and other
+		// messages are skipped
+		var reply []json.RawMessage
+		if json.Unmarshal(data, &reply) != nil || len(reply) < 4 {
+			continue
+		}
+		var label, id, reason string
+		var accepted bool
+		if json.Unmarshal(reply[0], &label) != nil || label != "OK" ||
+			json.Unmarshal(reply[1], &id) != nil || id != event.ID {
+			continue
+		}
+		json.Unmarshal(reply[2], &accepted)
+		json.Unmarshal(reply[3], &reason)
+		if !accepted {
+			return fmt.Errorf("relay rejected the message: %s", reason)
+		}
+		return nil
+	}
+}
+
+// nip04Encrypt encrypts text with AES-256-CBC under the ECDH secret of the
+// two keys, as NIP-04 specifies
+func nip04Encrypt(key *btcec.PrivateKey, recipient *btcec.PublicKey, text string) (string, error) {
+	secret := btcec.GenerateSharedSecret(key, recipient)
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	// PKCS#7 padding
+	padding := aes.BlockSize - len(text)%aes.BlockSize
+	plaintext := append([]byte(text), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	return base64.StdEncoding.EncodeToString(ciphertext) + "?iv=" + base64.StdEncoding.EncodeToString(iv), nil
+}
+
+// nip44Encrypt encrypts text for recipient with NIP-44 version 2
+func nip44Encrypt(key *btcec.PrivateKey, recipient *btcec.PublicKey, text string) (string, error) {
+	conversationKey, err := nip44ConversationKey(key, recipient)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return nip44EncryptWithNonce(conversationKey, nonce, text)
+}
+
+// nip44ConversationKey derives the key shared by the two parties from the
+// x coordinate of their ECDH point
+func nip44ConversationKey(key *btcec.PrivateKey, pubKey *btcec.PublicKey) ([]byte, error) {
+	return hkdf.Extract(sha256.New, btcec.GenerateSharedSecret(key, pubKey), []byte("nip44-v2"))
+}
+
+// nip44EncryptWithNonce pads text, encrypts it with ChaCha20 and
+// authenticates it with HMAC-SHA256, under keys derived from the
+// conversation key and the 32-byte nonce
+func nip44EncryptWithNonce(conversationKey, nonce []byte, text string) (string, error) {
+	if len(text) == 0 || len(text) > 65535 {
+		return "", fmt.Errorf("nip44 message must be 1 to 65535 bytes")
+	}
+	keys, err := hkdf.Expand(sha256.New, conversationKey, string(nonce), 76)
+	if err != nil {
+		return "", err
+	}
+	chachaKey, chachaNonce, hmacKey := keys[:32], keys[32:44], keys[44:]
+
+	// The length prefix and zero padding hide the exact message length
+	padded := make([]byte, 2+nip44PaddedLen(len(text)))
+	binary.BigEndian.PutUint16(padded, uint16(len(text)))
+	copy(padded[2:], text)
+
+	stream, err := chacha20.NewUnauthenticatedCipher(chachaKey, chachaNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(padded))
+	stream.XORKeyStream(ciphertext, padded)
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(nonce)
+	mac.Write(ciphertext)
+
+	payload := append([]byte{2}, nonce...)
+	payload = append(payload, ciphertext...)
+	payload = mac.Sum(payload)
+	return base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// nip44PaddedLen rounds a message length up to 32 bytes, or to an eighth
+// of the next power of two above 256 bytes
+func nip44PaddedLen(n int) int {
+	if n <= 32 {
+		return 32
+	}
+	nextPower := 1 << bits.Len(uint(n-1))
+	chunk := 32
+	if nextPower > 256 {
+		chunk = nextPower / 8
+	}
+	return chunk * ((n-1)/chunk + 1)
+}
+
+// loadNostrKey reads the agent's private key, a hex string, from path. A
+// missing file is created with a new key, whose public key is logged so
+// the recipient can recognize the agent.
+func loadNostrKey(path string) (*btcec.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("nostr key file %s must hold a 32-byte hex private key", path)
+		}
+		key, _ := btcec.PrivKeyFromBytes(raw)
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read nostr key: %w", err)
+	}
+
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nostr key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create nostr key directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nostr key: %w", err)
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key.Serialize()) + "\n"); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write nostr key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write nostr key: %w", err)
+	}
+
+	npub, _ := bech32Encode("npub", schnorr.SerializePubKey(key.PubKey()))
+	logger.Info("Generated nostr key for alert messages", "path", path, "npub", npub)
+	return key, nil
+}
+
+// nostrPubKeyHex returns the x-only hex form Nostr uses for public keys
+func nostrPubKeyHex(key *btcec.PublicKey) string {
+	return hex.EncodeToString(schnorr.SerializePubKey(key))
+}
+
+// parseNostrPubKey parses an npub or a 64-character hex public key
+func parseNostrPubKey(s string) (*btcec.PublicKey, error) {
+	var raw []byte
+	var err error
+	if strings.HasPrefix(s, "npub1") {
+		var hrp string
+		hrp, raw, err = bech32Decode(s)
+		if err == nil && hrp != "npub" {
+			err = fmt.Errorf("not an npub")
+		}
+	} else {
+		raw, err = hex.DecodeString(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("public key must be 32 bytes")
+	}
+	return schnorr.ParsePubKey(raw)
+}
+
+// bech32Charset maps 5-bit values to bech32 characters (BIP-173)
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Polymod computes the bech32 checksum over values
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// bech32HRPExpand returns the human-readable part as checksum input
+func bech32HRPExpand(hrp string) []byte {
+	values := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	return values
+}
+
+// convertBits regroups data from fromBits-bit to toBits-bit values
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var result []byte
+	acc, bits := uint32(0), uint(0)
+	maxValue := uint32(1)<<toBits - 1
+	for _, b := range data {
+		acc = acc<<fromBits | uint32(b)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, fmt.Errorf("invalid bech32 padding")
+	}
+	return result, nil
+}
+
+// bech32Encode encodes data with the human-readable part hrp
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	checksumInput := append(bech32HRPExpand(hrp), values...)
+	polymod := bech32Polymod(append(checksumInput, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var b strings.Builder
+	b.WriteString(hrp + "1")
+	for _, v := range values {
+		b.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[polymod>>(5*(5-i))&31])
+	}
+	return b.String(), nil
+}
+
+// bech32Decode decodes a bech32 string into its human-readable part and data
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("mixed-case bech32 string")
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, fmt.Errorf("invalid bech32 string")
+	}
+	hrp := s[:sep]
+	values := make([]byte, 0, len(s)-sep-1)
+	for _, c := range s[sep+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid bech32 character %q", c)
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, fmt.Errorf("invalid bech32 checksum")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
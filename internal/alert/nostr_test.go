@@ -0,0 +1,303 @@
+package alert
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"golang.org/x/crypto/chacha20"
+)
+
+// testKey returns the private key whose scalar is the given hex value
+func testKey(t *testing.T, scalar string) *btcec.PrivateKey {
+	t.Helper()
+	raw, err := hex.DecodeString(strings.Repeat("0", 64-len(scalar)) + scalar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := btcec.PrivKeyFromBytes(raw)
+	return key
+}
+
+func TestBech32(t *testing.T) {
+	const npub = "npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6"
+	const pubHex = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+
+	hrp, data, err := bech32Decode(npub)
+	if err != nil {
+		t.Fatalf("decode %s: %v", npub, err)
+	}
+	if hrp != "npub" || hex.EncodeToString(data) != pubHex {
+		t.Fatalf("decode %s = %s %x, want npub %s", npub, hrp, data, pubHex)
+	}
+
+	raw, _ := hex.DecodeString(pubHex)
+	encoded, err := bech32Encode("npub", raw)
+	if err != nil || encoded != npub {
+		t.Fatalf("encode %s = %s, %v, want %s", pubHex, encoded, err, npub)
+	}
+
+	for _, key := range []string{npub, pubHex} {
+		pubKey, err := parseNostrPubKey(key)
+		if err != nil {
+			t.Fatalf("parse %s: %v", key, err)
+		}
+		if got := nostrPubKeyHex(pubKey); got != pubHex {
+			t.Errorf("parse %s = %s, want %s", key, got, pubHex)
+		}
+	}
+
+	// BIP-173 test vectors
+	valid := []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	}
+	for _, s := range valid {
+		if _, _, err := bech32Decode(s); err != nil {
+			t.Errorf("decode %s: %v", s, err)
+		}
+	}
+	invalid := []string{
+		"npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w7", // checksum
+		"A12uEL5L",      // mixed case
+		"pzry9x0s0muk",  // no separator
+		"1pzry9x0s0muk", // empty human-readable part
+		"x1b4n0q5v",     // invalid character
+		"li1dgmt3",      // checksum too short
+	}
+	for _, s := range invalid {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("decode %s succeeded, want error", s)
+		}
+	}
+}
+
+func TestNIP04(t *testing.T) {
+	sender := testKey(t, "1")
+	recipient := testKey(t, "2")
+	const text = "btc-monitor: no_peers firing\n\n[CRITICAL] no_peers: bitcoin.peers is 0 (threshold < 1)"
+
+	content, err := nip04Encrypt(sender, recipient.PubKey(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decrypt as the recipient would, from its own key and the sender's
+	// public key
+	ciphertextB64, ivB64, ok := strings.Cut(content, "?iv=")
+	if !ok {
+		t.Fatalf("content %q has no iv", content)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(ivB64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(btcec.GenerateSharedSecret(recipient, sender.PubKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if got := string(plaintext[:len(plaintext)-padding]); got != text {
+		t.Errorf("decrypted %q, want %q", got, text)
+	}
+}
+
+func TestNIP44(t *testing.T) {
+	// Test vector from the NIP-44 specification
+	sender := testKey(t, "1")
+	recipient := testKey(t, "2")
+	conversationKey, err := nip44ConversationKey(sender, recipient.PubKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(conversationKey), "c41c775356fd92eadc63ff5a0dc1da211b268cbea22316767095b2871ea1412d"; got != want {
+		t.Fatalf("conversation key = %s, want %s", got, want)
+	}
+
+	nonce, _ := hex.DecodeString(strings.Repeat("0", 63) + "1")
+	payload, err := nip44EncryptWithNonce(conversationKey, nonce, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "AgAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAABee0G5VSK0/9YypIObAtDKfYEAjD35uVkHyB0F4DwrcNaCXlCWZKaArsGrY6M9wnuTMxWfp1RTN9Xga8no+kF5Vsb"
+	if payload != want {
+		t.Errorf("payload = %s, want %s", payload, want)
+	}
+
+	// The recipient derives the same key and reads a longer message back
+	if got, err := nip44ConversationKey(recipient, sender.PubKey()); err != nil || !bytes.Equal(got, conversationKey) {
+		t.Fatalf("recipient conversation key = %x, %v", got, err)
+	}
+	text := strings.Repeat("block height 850000 ", 20)
+	payload, err = nip44Encrypt(sender, recipient.PubKey(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nip44Decrypt(t, conversationKey, payload); got != text {
+		t.Errorf("decrypted %q, want %q", got, text)
+	}
+
+	paddedLens := map[int]int{
+		1: 32, 16: 32, 32: 32, 33: 64, 37: 64, 45: 64, 49: 64, 64: 64, 65: 96,
+		100: 128, 111: 128, 200: 224, 250: 256, 320: 320, 383: 384, 384: 384,
+		400: 448, 500: 512, 512: 512, 515: 640, 700: 768, 800: 896, 900: 1024,
+		1020: 1024, 65536: 65536,
+	}
+	for n, want := range paddedLens {
+		if got := nip44PaddedLen(n); got != want {
+			t.Errorf("nip44PaddedLen(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestNostrEvents(t *testing.T) {
+	sender := testKey(t, "1")
+	recipient := testKey(t, "2")
+	n := &NostrNotifier{key: sender, recipient: recipient.PubKey(), protocol: nostrNIP04}
+	const text = "disk <90%> & rising"
+
+	// NIP-04: a signed kind 4 event addressed to the recipient
+	dm, err := n.newDirectMessage(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyNostrEvent(t, dm, nostrPubKeyHex(sender.PubKey()))
+	if dm.Kind != nostrKindDM || len(dm.Tags) != 1 || dm.Tags[0][1] != nostrPubKeyHex(recipient.PubKey()) {
+		t.Errorf("direct message kind %d, tags %v", dm.Kind, dm.Tags)
+	}
+
+	// NIP-17: a gift wrap from a one-time key, holding a seal from the
+	// agent, holding the unsigned chat message
+	wrap, err := n.newGiftWrap(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap.Kind != nostrKindGiftWrap || wrap.PubKey == nostrPubKeyHex(sender.PubKey()) {
+		t.Errorf("gift wrap kind %d from %s", wrap.Kind, wrap.PubKey)
+	}
+	verifyNostrEvent(t, wrap, wrap.PubKey)
+
+	var seal nostrEvent
+	openNostrEvent(t, recipient, wrap, &seal)
+	if seal.Kind != nostrKindSeal || len(seal.Tags) != 0 {
+		t.Errorf("seal kind %d, tags %v", seal.Kind, seal.Tags)
+	}
+	verifyNostrEvent(t, &seal, nostrPubKeyHex(sender.PubKey()))
+
+	var rumor nostrEvent
+	openNostrEvent(t, recipient, &seal, &rumor)
+	if rumor.Kind != nostrKindChat || rumor.Content != text || rumor.Sig != "" ||
+		rumor.PubKey != seal.PubKey || rumor.Tags[0][1] != nostrPubKeyHex(recipient.PubKey()) {
+		t.Errorf("chat message %+v", rumor)
+	}
+	id, err := nostrEventID(&rumor)
+	if err != nil || hex.EncodeToString(id[:]) != rumor.ID {
+		t.Errorf("chat message id %s does not match its content", rumor.ID)
+	}
+}
+
+// verifyNostrEvent checks the ID and the BIP-340 signature of an event
+func verifyNostrEvent(t *testing.T, event *nostrEvent, pubKeyHex string) {
+	t.Helper()
+	if event.PubKey != pubKeyHex {
+		t.Fatalf("event from %s, want %s", event.PubKey, pubKeyHex)
+	}
+
+	serialized, err := json.Marshal([]interface{}{0, event.PubKey, event.CreatedAt, event.Kind, event.Tags, event.Content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NIP-01 leaves <, > and & unescaped
+	unescaped := strings.NewReplacer(`\u003c`, "<", `\u003e`, ">", `\u0026`, "&").Replace(string(serialized))
+	id := sha256.Sum256([]byte(unescaped))
+	if hex.EncodeToString(id[:]) != event.ID {
+		t.Fatalf("event id %s, want %x", event.ID, id)
+	}
+
+	rawPubKey, _ := hex.DecodeString(event.PubKey)
+	pubKey, err := schnorr.ParsePubKey(rawPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawSig, _ := hex.DecodeString(event.Sig)
+	sig, err := schnorr.ParseSignature(rawSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(id[:], pubKey) {
+		t.Fatalf("invalid signature on event %s", event.ID)
+	}
+}
+
+// openNostrEvent decrypts the NIP-44 content of event with the recipient's
+// key and decodes it into inner
+func openNostrEvent(t *testing.T, recipient *btcec.PrivateKey, event *nostrEvent, inner *nostrEvent) {
+	t.Helper()
+	rawPubKey, _ := hex.DecodeString(event.PubKey)
+	pubKey, err := schnorr.ParsePubKey(rawPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conversationKey, err := nip44ConversationKey(recipient, pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(nip44Decrypt(t, conversationKey, event.Content)), inner); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// nip44Decrypt checks the MAC of a NIP-44 payload and returns its text
+func nip44Decrypt(t *testing.T, conversationKey []byte, payload string) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) < 1+32+34+32 || raw[0] != 2 {
+		t.Fatalf("malformed nip44 payload of %d bytes", len(raw))
+	}
+	nonce, ciphertext, tag := raw[1:33], raw[33:len(raw)-32], raw[len(raw)-32:]
+
+	keys, err := hkdf.Expand(sha256.New, conversationKey, string(nonce), 76)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, keys[44:])
+	mac.Write(nonce)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		t.Fatal("nip44 MAC mismatch")
+	}
+
+	stream, err := chacha20.NewUnauthenticatedCipher(keys[:32], keys[32:44])
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded := make([]byte, len(ciphertext))
+	stream.XORKeyStream(padded, ciphertext)
+	n := int(binary.BigEndian.Uint16(padded))
+	if n == 0 || 2+n > len(padded) || len(padded) != 2+nip44PaddedLen(n) {
+		t.Fatalf("invalid nip44 padding for length %d", n)
+	}
+	return string(padded[2 : 2+n])
+}
@@ -0,0 +1,97 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/i18n"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+)
+
+// Notifier delivers alerts to an external channel
+type Notifier interface {
+	Name() string
+	Notify(alert *Alert) error
+}
+
+// PermanentError is a delivery failure that retrying cannot fix, such as a
+// rejected token or chat; queues drop the notification instead of
+// retrying it
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// statusError marks err permanent for HTTP client errors other than a
+// timeout or rate limiting
+func statusError(code int, err error) error {
+	if code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
+
+// isPermanent reports whether retrying a delivery that failed with err is
+// pointless: a PermanentError, or a permanent (5xx) SMTP reply
+func isPermanent(err error) bool {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return true
+	}
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 500
+}
+
+// DryRunner is implemented by notifiers that can check their settings and
+// render an alert as they would send it, without sending it
+type DryRunner interface {
+	DryRun(alert *Alert) (string, error)
+}
+
+// NewNotifiers creates a notifier for every enabled channel in the config,
+// writing messages in the configured locale and connecting through dialer
+func NewNotifiers(cfg *config.AlertsConfig, dialer *netproxy.Dialer) ([]Notifier, error) {
+	loc, err := i18n.New(cfg.Locale, cfg.LocaleDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load alert locale: %w", err)
+	}
+
+	var notifiers []Notifier
+
+	if cfg.Telegram.Enabled {
+		telegram := NewTelegramNotifier(cfg.Telegram.BotToken, cfg.Telegram.ChatID, loc)
+		telegram.SetDialer(dialer)
+		notifiers = append(notifiers, telegram)
+	}
+	if cfg.Email.Enabled {
+		e := cfg.Email
+		email := NewEmailNotifier(e.Host, e.Port, e.Security, e.Username, e.Password, e.From, e.To, loc)
+		email.SetDialer(dialer)
+		notifiers = append(notifiers, email)
+	}
+	if cfg.Ntfy.Enabled {
+		ntfy := NewNtfyNotifier(cfg.Ntfy.ServerURL, cfg.Ntfy.Topic, cfg.Ntfy.Token, loc)
+		ntfy.SetDialer(dialer)
+		notifiers = append(notifiers, ntfy)
+	}
+	if cfg.Nostr.Enabled {
+		nostr, err := NewNostrNotifier(cfg.Nostr.Recipient, cfg.Nostr.Relays, cfg.Nostr.Protocol, cfg.Nostr.KeyFile, loc)
+		if err != nil {
+			return nil, fmt.Errorf("nostr: %w", err)
+		}
+		nostr.SetDialer(dialer)
+		notifiers = append(notifiers, nostr)
+	}
+
+	return notifiers, nil
+}
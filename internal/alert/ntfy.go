@@ -0,0 +1,111 @@
+package alert
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/i18n"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+)
+
+// NtfyNotifier publishes alerts to an ntfy topic (ntfy.sh or self-hosted)
+type NtfyNotifier struct {
+	serverURL string
+	topic     string
+	token     string
+	loc       *i18n.Localizer
+	client    *http.Client
+}
+
+// NewNtfyNotifier creates a notifier publishing to serverURL/topic, using
+// token as a bearer token when it is non-empty
+func NewNtfyNotifier(serverURL, topic, token string, loc *i18n.Localizer) *NtfyNotifier {
+	return &NtfyNotifier{
+		serverURL: strings.TrimSuffix(serverURL, "/"),
+		topic:     topic,
+		token:     token,
+		loc:       loc,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// SetDialer routes requests to the ntfy server through d
+func (n *NtfyNotifier) SetDialer(d *netproxy.Dialer) {
+	n.client.Transport = d.Transport()
+}
+
+// Name returns the notifier name
+func (n *NtfyNotifier) Name() string {
+	return "ntfy"
+}
+
+// ntfyPriority maps an alert to an ntfy priority (1 = min, 5 = urgent)
+func ntfyPriority(alert *Alert) string {
+	if alert.State == StateResolved {
+		return "3"
+	}
+	switch alert.Severity {
+	case "critical":
+		return "5"
+	case "info":
+		return "3"
+	default:
+		return "4"
+	}
+}
+
+// Notify publishes the alert text with a title, priority and tag
+func (n *NtfyNotifier) Notify(alert *Alert) error {
+	req, err := n.newRequest(alert)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ntfy request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return statusError(resp.StatusCode, fmt.Errorf("ntfy returned %s: %s", resp.Status, strings.TrimSpace(string(body))))
+	}
+
+	return nil
+}
+
+// DryRun returns the title and text Notify would publish
+func (n *NtfyNotifier) DryRun(alert *Alert) (string, error) {
+	req, err := n.newRequest(alert)
+	if err != nil {
+		return "", err
+	}
+	return req.Header.Get("Title") + "\n" + alert.LocalizedText(n.loc), nil
+}
+
+// newRequest builds the publish request for an alert
+func (n *NtfyNotifier) newRequest(alert *Alert) (*http.Request, error) {
+	if n.topic == "" {
+		return nil, fmt.Errorf("ntfy requires a topic")
+	}
+	req, err := http.NewRequest(http.MethodPost, n.serverURL+"/"+n.topic, strings.NewReader(alert.LocalizedText(n.loc)))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Title", n.loc.T("alert.title", alert.Rule, stateLabel(n.loc, alert.State)))
+	req.Header.Set("Priority", ntfyPriority(alert))
+	if alert.State == StateResolved {
+		req.Header.Set("Tags", "white_check_mark")
+	} else {
+		req.Header.Set("Tags", "warning")
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return req, nil
+}
@@ -0,0 +1,295 @@
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+)
+
+// queuedAlert is a notification waiting for delivery
+type queuedAlert struct {
+	Alert    *Alert    `json:"alert"`
+	Queued   time.Time `json:"queued"`
+	Attempts int       `json:"attempts"`
+}
+
+// Queue delivers alerts to a notifier in order, retrying with exponential
+// backoff while the channel is unreachable. Notifications the channel
+// rejects for good, or that fail MaxAttempts times, are dropped so they do
+// not hold back the ones behind them. It holds at most MaxQueued
+// notifications, dropping by the configured policy when full, and saves
+// them to a file so they are still delivered after a restart.
+type Queue struct {
+	notifier      Notifier
+	path          string
+	maxQueued     int
+	maxAge        time.Duration
+	retryInterval time.Duration
+	maxRetry      time.Duration
+	maxAttempts   int // 0 for no limit
+	dropPolicy    string
+
+	mu      sync.Mutex
+	items   []*queuedAlert // Oldest first
+	dropped int            // Notifications discarded since the last delivery
+	failing bool
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewQueue creates a queue for a notifier, saved in dir as <name>.json,
+// loads notifications left from a previous run and starts delivering them
+func NewQueue(notifier Notifier, dir string, cfg config.NotificationQueueConfig) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create notification queue directory: %w", err)
+	}
+
+	q := &Queue{
+		notifier:      notifier,
+		path:          filepath.Join(dir, notifier.Name()+".json"),
+		maxQueued:     max(cfg.MaxQueued, 1),
+		maxAge:        time.Duration(cfg.MaxAgeHours) * time.Hour,
+		retryInterval: time.Duration(cfg.RetryIntervalSeconds) * time.Second,
+		maxRetry:      time.Duration(cfg.MaxRetryIntervalSeconds) * time.Second,
+		maxAttempts:   cfg.MaxAttempts,
+		dropPolicy:    cfg.DropPolicy,
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if err := q.load(); err != nil {
+		logger.Warn("Failed to load notification queue, starting empty", "notifier", q.Name(), "error", err)
+	} else if len(q.items) > 0 {
+		logger.Info("Resuming queued notifications", "notifier", q.Name(), "queued", len(q.items))
+	}
+
+	go q.run()
+	return q, nil
+}
+
+// Name returns the name of the wrapped notifier
+func (q *Queue) Name() string {
+	return q.notifier.Name()
+}
+
+// Notify queues an alert for delivery and returns without waiting for it
+func (q *Queue) Notify(alert *Alert) error {
+	q.mu.Lock()
+	if len(q.items) < q.maxQueued || q.dropOne(alert) {
+		q.items = append(q.items, &queuedAlert{Alert: alert, Queued: time.Now().UTC()})
+	}
+	err := q.save()
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// Close stops delivery after the attempt in progress. Notifications still
+// queued stay in the file for the next run.
+func (q *Queue) Close() {
+	close(q.stop)
+	<-q.done
+}
+
+// severityRank orders severities for the lowest_severity drop policy
+func severityRank(severity string) int {
+	switch severity {
+	case "info":
+		return 0
+	case "critical":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// dropOne makes room for an incoming alert in a full queue. With the
+// lowest_severity policy the oldest notification of the lowest severity
+// goes, which is the incoming one itself if everything queued outranks it.
+// Otherwise the oldest notification goes. It reports whether the incoming
+// alert should be queued. q.mu must be held.
+func (q *Queue) dropOne(incoming *Alert) bool {
+	victim := 0
+	if q.dropPolicy == "lowest_severity" {
+		rank := severityRank(incoming.Severity)
+		victim = -1
+		for i, item := range q.items {
+			if r := severityRank(item.Alert.Severity); r <= rank && (victim < 0 || r < rank) {
+				victim, rank = i, r
+			}
+		}
+	}
+
+	dropped := incoming
+	if victim >= 0 {
+		dropped = q.items[victim].Alert
+		q.items = append(q.items[:victim:victim], q.items[victim+1:]...)
+	}
+	q.dropped++
+	logger.Warn("Notification queue full, dropping notification", "notifier", q.Name(), "rule", dropped.Rule, "state", dropped.State, "severity", dropped.Severity)
+	return victim >= 0
+}
+
+// run delivers queued notifications oldest first. A failed delivery blocks
+// the ones behind it, so they arrive in order once the channel is back.
+func (q *Queue) run() {
+	defer close(q.done)
+
+	delay := q.retryInterval
+	for {
+		item := q.next()
+		if item == nil {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.stop:
+				return
+			}
+		}
+
+		err := q.notifier.Notify(item.Alert)
+
+		q.mu.Lock()
+		wasFailing := q.failing
+		q.failing = err != nil
+		dropped := q.dropped
+		giveUp := false
+		if err == nil {
+			q.remove(item)
+			q.dropped = 0
+		} else {
+			item.Attempts++
+			giveUp = isPermanent(err) || (q.maxAttempts > 0 && item.Attempts >= q.maxAttempts)
+			if giveUp {
+				q.remove(item)
+				q.dropped++
+			}
+		}
+		queued := len(q.items)
+		saveErr := q.save()
+		q.mu.Unlock()
+
+		if saveErr != nil {
+			logger.Warn("Failed to save notification queue", "notifier", q.Name(), "error", saveErr)
+		}
+
+		if err == nil {
+			if wasFailing || dropped > 0 {
+				logger.Info("Notification delivery recovered", "notifier", q.Name(), "queued", queued, "dropped", dropped)
+			}
+			delay = q.retryInterval
+			continue
+		}
+
+		if giveUp {
+			logger.Error("Dropping notification that could not be delivered", "notifier", q.Name(), "rule", item.Alert.Rule, "state", item.Alert.State, "attempts", item.Attempts, "error", err)
+			continue // The next one may go through
+		}
+		if !wasFailing {
+			logger.Warn("Failed to send alert, will retry", "notifier", q.Name(), "rule", item.Alert.Rule, "queued", queued, "error", err)
+		}
+		select {
+		case <-time.After(delay):
+			delay = min(delay*2, q.maxRetry)
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// next returns the oldest queued notification after discarding those that
+// have waited longer than the maximum age, or nil if the queue is empty
+func (q *Queue) next() *queuedAlert {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cutoff := time.Now().Add(-q.maxAge)
+	expired := 0
+	for len(q.items) > 0 && q.items[0].Queued.Before(cutoff) {
+		q.items = q.items[1:]
+		expired++
+	}
+	if expired > 0 {
+		q.dropped += expired
+		logger.Warn("Dropping notifications that could not be delivered in time", "notifier", q.Name(), "count", expired)
+		if err := q.save(); err != nil {
+			logger.Warn("Failed to save notification queue", "notifier", q.Name(), "error", err)
+		}
+	}
+
+	if len(q.items) == 0 {
+		return nil
+	}
+	return q.items[0]
+}
+
+// remove deletes an item, unless the drop policy already has. q.mu must be
+// held.
+func (q *Queue) remove(item *queuedAlert) {
+	for i, queued := range q.items {
+		if queued == item {
+			q.items = append(q.items[:i:i], q.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// load reads notifications saved by a previous run
+func (q *Queue) load() error {
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var items []*queuedAlert
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item != nil && item.Alert != nil {
+			q.items = append(q.items, item)
+		}
+	}
+	if excess := len(q.items) - q.maxQueued; excess > 0 {
+		q.items = q.items[excess:]
+	}
+	return nil
+}
+
+// save writes the queue to its file, replacing it atomically, or removes
+// the file when the queue is empty. q.mu must be held.
+func (q *Queue) save() error {
+	if len(q.items) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(q.items)
+	if err != nil {
+		return err
+	}
+
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
@@ -0,0 +1,85 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/i18n"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+)
+
+// telegramAPI is the Telegram Bot API base URL
+const telegramAPI = "https://api.telegram.org"
+
+// TelegramNotifier sends alerts as messages from a Telegram bot
+type TelegramNotifier struct {
+	botToken string
+	chatID   string
+	loc      *i18n.Localizer
+	client   *http.Client
+}
+
+// NewTelegramNotifier creates a notifier posting to chatID as the given bot
+func NewTelegramNotifier(botToken, chatID string, loc *i18n.Localizer) *TelegramNotifier {
+	return &TelegramNotifier{
+		botToken: botToken,
+		chatID:   chatID,
+		loc:      loc,
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// SetDialer routes requests to the Bot API through d
+func (t *TelegramNotifier) SetDialer(d *netproxy.Dialer) {
+	t.client.Transport = d.Transport()
+}
+
+// Name returns the notifier name
+func (t *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+// Notify sends the alert text with the sendMessage method
+func (t *TelegramNotifier) Notify(alert *Alert) error {
+	body, err := json.Marshal(map[string]string{
+		"chat_id": t.chatID,
+		"text":    alert.LocalizedText(t.loc),
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, t.botToken)
+	resp, err := t.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL contains the bot token; don't let it reach the logs
+		return fmt.Errorf("telegram request failed: %w", redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(data, &result); err != nil {
+		return statusError(resp.StatusCode, fmt.Errorf("telegram returned %s", resp.Status))
+	}
+	if !result.OK {
+		return statusError(resp.StatusCode, fmt.Errorf("telegram rejected message: %s", result.Description))
+	}
+
+	return nil
+}
+
+// DryRun returns the message text Notify would send
+func (t *TelegramNotifier) DryRun(alert *Alert) (string, error) {
+	if t.botToken == "" || t.chatID == "" {
+		return "", fmt.Errorf("telegram requires a bot_token and a chat_id")
+	}
+	return alert.LocalizedText(t.loc), nil
+}
@@ -0,0 +1,882 @@
+// Package cbor encodes values as CBOR (RFC 8949) under the names and
+// omitempty rules of their JSON encoding, so stored samples keep the JSON
+// schema while taking less space and time to parse. It covers the types
+// the metrics use: embedded structs are not flattened, map keys must be
+// strings, and custom JSON marshalers other than time.Time are ignored.
+//
+// A Codec can also write known map keys as their position in a table
+// instead of as text, which is most of the saving for records that repeat
+// the same field names.
+package cbor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Major types
+const (
+	majorUint   = 0
+	majorNegint = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// Simple values and float heads of major type 7
+const (
+	simpleFalse     = 20
+	simpleTrue      = 21
+	simpleNull      = 22
+	simpleUndefined = 23
+	simpleFloat16   = 25
+	simpleFloat32   = 26
+	simpleFloat64   = 27
+)
+
+// tagDateTime marks an RFC 3339 timestamp string
+const tagDateTime = 0
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	numberType = reflect.TypeOf(json.Number(""))
+)
+
+// Codec encodes map keys found in its key table as unsigned integers, the
+// key's position in the table. The table may only be appended to once data
+// is stored with it; keys missing from it are written as text.
+type Codec struct {
+	keys  []string
+	codes map[string]uint64
+}
+
+// plain has no key table
+var plain = &Codec{}
+
+// NewCodec creates a codec with a key table
+func NewCodec(keys []string) *Codec {
+	c := &Codec{keys: keys, codes: make(map[string]uint64, len(keys))}
+	for i, key := range keys {
+		if _, dup := c.codes[key]; !dup {
+			c.codes[key] = uint64(i)
+		}
+	}
+	return c
+}
+
+// Marshal returns the CBOR encoding of v
+func Marshal(v interface{}) ([]byte, error) {
+	return plain.Marshal(v)
+}
+
+// Unmarshal decodes the single CBOR item in data into the value v points to.
+// Numbers decoded into an interface{} are float64 and timestamps are RFC
+// 3339 strings, as encoding/json would produce.
+func Unmarshal(data []byte, v interface{}) error {
+	return plain.Unmarshal(data, v)
+}
+
+// Marshal returns the CBOR encoding of v using the key table
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{codec: c}
+	if err := e.value(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// Unmarshal decodes data written by Marshal with the same or a shorter key
+// table. Struct fields under keys the table does not have are skipped.
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cbor: Unmarshal needs a non-nil pointer, got %T", v)
+	}
+
+	d := &decoder{data: data, codec: c}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.pos != len(data) {
+		return fmt.Errorf("cbor: %d bytes of trailing data", len(data)-d.pos)
+	}
+	return nil
+}
+
+// ScanItems is a bufio.SplitFunc for a sequence of CBOR items (RFC 8742).
+// A truncated item at the end of the input is returned as the last token,
+// so the caller can skip it like a partial line. Malformed data has no
+// item boundary to resume at, so the buffered rest is returned as one
+// token and later items may be lost with it.
+func ScanItems(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	d := &decoder{data: data}
+	err = d.skip()
+	switch {
+	case err == nil:
+		return d.pos, data[:d.pos], nil
+	case errors.Is(err, io.ErrUnexpectedEOF) && !atEOF:
+		return 0, nil, nil
+	}
+	return len(data), data, nil
+}
+
+// field is an encoded struct field
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// fieldCache maps struct types to their fields
+var fieldCache sync.Map
+
+// structFields returns the exported fields of t under their JSON names
+func structFields(t reflect.Type) []field {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{
+			name:      name,
+			index:     i,
+			omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+		})
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// encoder appends CBOR items to buf
+type encoder struct {
+	buf   []byte
+	codec *Codec
+}
+
+// key writes a map key as its code, or as text if it has none
+func (e *encoder) key(name string) {
+	if code, ok := e.codec.codes[name]; ok {
+		e.head(majorUint, code)
+		return
+	}
+	e.text(name)
+}
+
+// head writes the initial bytes of an item with the shortest argument
+func (e *encoder) head(major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, major|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, major|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, major|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		e.buf = append(e.buf, major|27,
+			byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+			byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func (e *encoder) int(i int64) {
+	if i < 0 {
+		e.head(majorNegint, uint64(-1-i))
+		return
+	}
+	e.head(majorUint, uint64(i))
+}
+
+// float writes whole numbers as integers and others in the smallest float
+// width that holds them exactly
+func (e *encoder) float(f float64) {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 && !(f == 0 && math.Signbit(f)) {
+		e.int(int64(f))
+		return
+	}
+	if float64(float32(f)) == f {
+		bits := math.Float32bits(float32(f))
+		e.buf = append(e.buf, majorSimple<<5|simpleFloat32,
+			byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits))
+		return
+	}
+	bits := math.Float64bits(f)
+	e.buf = append(e.buf, majorSimple<<5|simpleFloat64,
+		byte(bits>>56), byte(bits>>48), byte(bits>>40), byte(bits>>32),
+		byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits))
+}
+
+func (e *encoder) text(s string) {
+	e.head(majorText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) null() {
+	e.buf = append(e.buf, majorSimple<<5|simpleNull)
+}
+
+func (e *encoder) value(v reflect.Value) error {
+	if !v.IsValid() {
+		e.null()
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		t := v.Interface().(time.Time)
+		e.head(majorTag, tagDateTime)
+		e.text(t.Format(time.RFC3339Nano))
+		return nil
+	case numberType:
+		return e.number(v.String())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, majorSimple<<5|simpleTrue)
+		} else {
+			e.buf = append(e.buf, majorSimple<<5|simpleFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(majorUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.float(v.Float())
+	case reflect.String:
+		e.text(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.null()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.head(majorBytes, uint64(v.Len()))
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		return e.array(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.null()
+			return nil
+		}
+		return e.mapValue(v)
+	case reflect.Struct:
+		return e.structValue(v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.null()
+			return nil
+		}
+		return e.value(v.Elem())
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// number writes a json.Number, which is "0" when empty as in JSON
+func (e *encoder) number(s string) error {
+	if s == "" {
+		s = "0"
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		e.int(i)
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("cbor: invalid number %q", s)
+	}
+	e.float(f)
+	return nil
+}
+
+func (e *encoder) array(v reflect.Value) error {
+	e.head(majorArray, uint64(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		if err := e.value(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapValue writes a map with its keys sorted, as JSON does
+func (e *encoder) mapValue(v reflect.Value) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("cbor: unsupported map key type %s", v.Type().Key())
+	}
+
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	e.head(majorMap, uint64(len(keys)))
+	for _, key := range keys {
+		e.key(key.String())
+		if err := e.value(v.MapIndex(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) structValue(v reflect.Value) error {
+	fields := structFields(v.Type())
+
+	present := make([]field, 0, len(fields))
+	for _, f := range fields {
+		if f.omitEmpty && isEmpty(v.Field(f.index)) {
+			continue
+		}
+		present = append(present, f)
+	}
+
+	e.head(majorMap, uint64(len(present)))
+	for _, f := range present {
+		e.key(f.name)
+		if err := e.value(v.Field(f.index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isEmpty reports whether omitempty leaves out v, following encoding/json
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// decoder reads one item from data
+type decoder struct {
+	data  []byte
+	pos   int
+	codec *Codec
+}
+
+// head reads the initial bytes of an item. For floats, arg holds the bits.
+func (d *decoder) head() (major, info byte, arg uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	initial := d.data[d.pos]
+	d.pos++
+	major, info = initial>>5, initial&0x1f
+
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		return 0, 0, 0, fmt.Errorf("cbor: unsupported additional info %d at offset %d", info, d.pos-1)
+	}
+
+	if len(d.data)-d.pos < size {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	for _, b := range d.data[d.pos : d.pos+size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.pos += size
+	return major, info, arg, nil
+}
+
+// payload returns the n bytes of a byte or text string
+func (d *decoder) payload(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// count checks that a container of n items can fit in the remaining data
+func (d *decoder) count(n uint64, perItem uint64) (int, error) {
+	if n > uint64(len(d.data)-d.pos)/perItem {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(n), nil
+}
+
+// skip moves past one item
+func (d *decoder) skip() error {
+	major, _, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+
+	switch major {
+	case majorBytes, majorText:
+		_, err = d.payload(arg)
+		return err
+	case majorArray, majorMap:
+		items := arg
+		if major == majorMap {
+			items *= 2
+		}
+		n, err := d.count(items, 1)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	case majorTag:
+		return d.skip()
+	}
+	return nil
+}
+
+// float converts the argument of a major type 7 float head
+func float(info byte, arg uint64) (float64, bool) {
+	switch info {
+	case simpleFloat16:
+		return float16(uint16(arg)), true
+	case simpleFloat32:
+		return float64(math.Float32frombits(uint32(arg))), true
+	case simpleFloat64:
+		return math.Float64frombits(arg), true
+	}
+	return 0, false
+}
+
+// float16 converts an IEEE 754 half-precision value
+func float16(bits uint16) float64 {
+	sign := 1.0
+	if bits&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(bits>>10) & 0x1f
+	frac := float64(bits & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	}
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
+
+// generic decodes an item as encoding/json would into an interface{}
+func (d *decoder) generic() (interface{}, error) {
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		return float64(arg), nil
+	case majorNegint:
+		return -1 - float64(arg), nil
+	case majorBytes:
+		b, err := d.payload(arg)
+		return append([]byte(nil), b...), err
+	case majorText:
+		b, err := d.payload(arg)
+		return string(b), err
+	case majorArray:
+		n, err := d.count(arg, 1)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			if list[i], err = d.generic(); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case majorMap:
+		n, err := d.count(arg, 2)
+		if err != nil {
+			return nil, err
+		}
+		object := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			name, err := d.knownKey()
+			if err != nil {
+				return nil, err
+			}
+			if object[name], err = d.generic(); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	case majorTag:
+		return d.generic()
+	}
+
+	switch info {
+	case simpleFalse:
+		return false, nil
+	case simpleTrue:
+		return true, nil
+	case simpleNull, simpleUndefined:
+		return nil, nil
+	}
+	if f, ok := float(info, arg); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d at offset %d", info, d.pos)
+}
+
+// decode reads an item into v
+func (d *decoder) decode(v reflect.Value) error {
+	if d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case majorSimple<<5 | simpleNull, majorSimple<<5 | simpleUndefined:
+			d.pos++
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+	}
+
+	switch {
+	case v.Kind() == reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		x, err := d.generic()
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case v.Type() == timeType:
+		return d.decodeTime(v)
+	}
+
+	start := d.pos
+	major, info, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+	mismatch := func(what string) error {
+		return fmt.Errorf("cbor: cannot decode %s into %s at offset %d", what, v.Type(), start)
+	}
+
+	switch major {
+	case majorUint, majorNegint:
+		return d.setInteger(v, major == majorNegint, arg, mismatch)
+	case majorBytes:
+		b, err := d.payload(arg)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 {
+			return mismatch("byte string")
+		}
+		v.SetBytes(append([]byte(nil), b...))
+	case majorText:
+		b, err := d.payload(arg)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.String {
+			return mismatch("string")
+		}
+		v.SetString(string(b))
+	case majorArray:
+		return d.decodeArray(v, arg, mismatch)
+	case majorMap:
+		return d.decodeMap(v, arg, mismatch)
+	case majorTag:
+		return d.decode(v)
+	default:
+		return d.decodeSimple(v, info, arg, mismatch)
+	}
+	return nil
+}
+
+// decodeTime reads a tagged RFC 3339 timestamp
+func (d *decoder) decodeTime(v reflect.Value) error {
+	start := d.pos
+	major, _, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+	if major == majorTag {
+		if arg != tagDateTime {
+			return fmt.Errorf("cbor: unsupported time tag %d at offset %d", arg, start)
+		}
+		if major, _, arg, err = d.head(); err != nil {
+			return err
+		}
+	}
+	if major != majorText {
+		return fmt.Errorf("cbor: cannot decode major type %d into time.Time at offset %d", major, start)
+	}
+
+	b, err := d.payload(arg)
+	if err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(b))
+	if err != nil {
+		return fmt.Errorf("cbor: %w", err)
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func (d *decoder) setInteger(v reflect.Value, negative bool, arg uint64, mismatch func(string) error) error {
+	if negative && arg > math.MaxInt64 {
+		return mismatch("integer")
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !negative && arg > math.MaxInt64 {
+			return mismatch("integer")
+		}
+		i := int64(arg)
+		if negative {
+			i = -1 - i
+		}
+		if v.OverflowInt(i) {
+			return mismatch("integer")
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if negative || v.OverflowUint(arg) {
+			return mismatch("integer")
+		}
+		v.SetUint(arg)
+	case reflect.Float32, reflect.Float64:
+		f := float64(arg)
+		if negative {
+			f = -1 - f
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		if v.Type() != numberType {
+			return mismatch("integer")
+		}
+		s := strconv.FormatUint(arg, 10)
+		if negative {
+			s = strconv.FormatInt(-1-int64(arg), 10)
+		}
+		v.SetString(s)
+	default:
+		return mismatch("integer")
+	}
+	return nil
+}
+
+func (d *decoder) decodeSimple(v reflect.Value, info byte, arg uint64, mismatch func(string) error) error {
+	switch info {
+	case simpleFalse, simpleTrue:
+		if v.Kind() != reflect.Bool {
+			return mismatch("bool")
+		}
+		v.SetBool(info == simpleTrue)
+		return nil
+	}
+
+	f, ok := float(info, arg)
+	if !ok {
+		return mismatch(fmt.Sprintf("simple value %d", info))
+	}
+	switch {
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		v.SetFloat(f)
+	case v.Type() == numberType:
+		v.SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	default:
+		return mismatch("float")
+	}
+	return nil
+}
+
+func (d *decoder) decodeArray(v reflect.Value, arg uint64, mismatch func(string) error) error {
+	n, err := d.count(arg, 1)
+	if err != nil {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+	case reflect.Array:
+		v.Set(reflect.Zero(v.Type()))
+	default:
+		return mismatch("array")
+	}
+
+	for i := 0; i < n; i++ {
+		if i >= v.Len() {
+			if err := d.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.decode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *decoder) decodeMap(v reflect.Value, arg uint64, mismatch func(string) error) error {
+	n, err := d.count(arg, 2)
+	if err != nil {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		for i := 0; i < n; i++ {
+			key, known, err := d.key()
+			if err != nil {
+				return err
+			}
+			f, ok := lookupField(fields, key)
+			if !known || !ok {
+				if err := d.skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return mismatch("map")
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), n))
+		}
+		for i := 0; i < n; i++ {
+			key, err := d.knownKey()
+			if err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	}
+	return mismatch("map")
+}
+
+// key reads a map key, as text or as a code in the key table. known is
+// false for a code past the end of the table, from a newer writer.
+func (d *decoder) key() (name string, known bool, err error) {
+	start := d.pos
+	major, _, arg, err := d.head()
+	if err != nil {
+		return "", false, err
+	}
+
+	switch major {
+	case majorText:
+		b, err := d.payload(arg)
+		return string(b), true, err
+	case majorUint:
+		if arg >= uint64(len(d.codec.keys)) {
+			return "", false, nil
+		}
+		return d.codec.keys[arg], true, nil
+	}
+	return "", false, fmt.Errorf("cbor: map key is neither a string nor a key code at offset %d", start)
+}
+
+// knownKey reads a map key that must be text or a code in the key table
+func (d *decoder) knownKey() (string, error) {
+	start := d.pos
+	name, known, err := d.key()
+	if err == nil && !known {
+		err = fmt.Errorf("cbor: unknown key code at offset %d", start)
+	}
+	return name, err
+}
+
+// lookupField finds a field by name, preferring an exact match but
+// accepting any case as encoding/json does
+func lookupField(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
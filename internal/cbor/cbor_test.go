@@ -0,0 +1,317 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// populate sets every field reachable from v to a non-empty value, so no
+// field is left out by omitempty. n makes the values differ between fields.
+func populate(v reflect.Value, n *int, depth int) {
+	*n++
+	switch v.Type() {
+	case timeType:
+		v.Set(reflect.ValueOf(time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC).Add(time.Duration(*n) * time.Second)))
+		return
+	case numberType:
+		v.SetString(fmt.Sprintf("%d.5", *n))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Alternate signs and sizes to cover every integer head
+		i := int64(*n) * 1_000_003
+		if *n%2 == 1 {
+			i = -i
+		}
+		if v.OverflowInt(i) {
+			i = int64(*n % 100)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := uint64(*n) << 33
+		if v.OverflowUint(u) {
+			u = uint64(*n % 200)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		// Halves fit a float32, thirds need a float64
+		f := float64(*n) + 0.5
+		if *n%2 == 1 {
+			f = float64(*n) / 3
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		v.SetString(fmt.Sprintf("value-%d", *n))
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			populate(v.Index(i), n, depth+1)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			populate(v.Index(i), n, depth+1)
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		for i := 0; i < 2; i++ {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			populate(elem, n, depth+1)
+			v.SetMapIndex(reflect.ValueOf(fmt.Sprintf("key-%d", *n)).Convert(v.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				populate(v.Field(i), n, depth+1)
+			}
+		}
+	case reflect.Pointer:
+		if depth > 8 {
+			return
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		populate(v.Elem(), n, depth+1)
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(map[string]interface{}{
+			"number": float64(*n) + 0.25,
+			"text":   "nested",
+			"list":   []interface{}{true, nil, -3.0},
+			"object": map[string]interface{}{"deep": 1e20},
+		}))
+	}
+}
+
+// fullSample returns a sample with every field set
+func fullSample(t *testing.T) *metrics.Sample {
+	t.Helper()
+	sample := &metrics.Sample{}
+	n := 0
+	populate(reflect.ValueOf(sample).Elem(), &n, 0)
+	return sample
+}
+
+// jsonKeys returns every object key in the JSON encoding of v, sorted
+func jsonKeys(t *testing.T, v interface{}) []string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var walk func(interface{})
+	walk = func(node interface{}) {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			for key, value := range node {
+				seen[key] = true
+				walk(value)
+			}
+		case []interface{}:
+			for _, value := range node {
+				walk(value)
+			}
+		}
+	}
+	walk(tree)
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// assertSameJSON fails unless got and want have the same JSON encoding
+func assertSameJSON(t *testing.T, got, want interface{}) {
+	t.Helper()
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("round trip differs:\ngot  %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+func TestSampleRoundTrip(t *testing.T) {
+	sample := fullSample(t)
+	keys := jsonKeys(t, sample)
+
+	tests := []struct {
+		name  string
+		codec *Codec
+	}{
+		{"plain", plain},
+		{"key table", NewCodec(keys)},
+		{"partial key table", NewCodec(keys[:len(keys)/2])},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.codec.Marshal(sample)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			var decoded metrics.Sample
+			if err := tt.codec.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			assertSameJSON(t, &decoded, sample)
+
+			// Decoded without a type, the result matches decoding the JSON
+			var generic, fromJSON interface{}
+			if err := tt.codec.Unmarshal(data, &generic); err != nil {
+				t.Fatalf("Unmarshal into interface{}: %v", err)
+			}
+			jsonData, _ := json.Marshal(sample)
+			if err := json.Unmarshal(jsonData, &fromJSON); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+			if tt.codec == plain && !reflect.DeepEqual(generic, fromJSON) {
+				t.Errorf("generic decode differs from JSON:\ngot  %v\nwant %v", generic, fromJSON)
+			}
+		})
+	}
+}
+
+func TestKeyTableAppend(t *testing.T) {
+	sample := fullSample(t)
+	keys := jsonKeys(t, sample)
+
+	// Data stored with a table must still decode after keys are appended
+	old := NewCodec(keys[:len(keys)-5])
+	data, err := old.Marshal(sample)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var decoded metrics.Sample
+	if err := NewCodec(append(keys[:len(keys)-5:len(keys)-5], "appended-a", "appended-b")).Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal with an appended table: %v", err)
+	}
+	assertSameJSON(t, &decoded, sample)
+}
+
+func TestScanItemsTruncated(t *testing.T) {
+	sample := fullSample(t)
+	codec := NewCodec(jsonKeys(t, sample))
+
+	var items [][]byte
+	var stream []byte
+	for i := 0; i < 3; i++ {
+		sample.Timestamp = sample.Timestamp.Add(time.Minute)
+		item, err := codec.Marshal(sample)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		items = append(items, item)
+		stream = append(stream, item...)
+	}
+
+	for cut := 0; cut <= len(stream); cut++ {
+		scanner := bufio.NewScanner(bytes.NewReader(stream[:cut]))
+		scanner.Buffer(make([]byte, 0, 64), len(stream)+1)
+		scanner.Split(ScanItems)
+
+		var tokens [][]byte
+		for scanner.Scan() {
+			tokens = append(tokens, append([]byte(nil), scanner.Bytes()...))
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatalf("cut at %d: scan: %v", cut, err)
+		}
+
+		// Whole items come back intact, followed by the torn one if any
+		whole, rest := 0, cut
+		for whole < len(items) && rest >= len(items[whole]) {
+			rest -= len(items[whole])
+			whole++
+		}
+		wantTokens := whole
+		if rest > 0 {
+			wantTokens++
+		}
+		if len(tokens) != wantTokens {
+			t.Fatalf("cut at %d: got %d tokens, want %d", cut, len(tokens), wantTokens)
+		}
+		for i := 0; i < whole; i++ {
+			if !bytes.Equal(tokens[i], items[i]) {
+				t.Fatalf("cut at %d: item %d differs", cut, i)
+			}
+			var decoded metrics.Sample
+			if err := codec.Unmarshal(tokens[i], &decoded); err != nil {
+				t.Fatalf("cut at %d: item %d: %v", cut, i, err)
+			}
+		}
+		if rest > 0 {
+			var decoded metrics.Sample
+			if err := codec.Unmarshal(tokens[whole], &decoded); err == nil {
+				t.Fatalf("cut at %d: torn item decoded without error", cut)
+			}
+		}
+	}
+}
+
+func TestJSONCompatibility(t *testing.T) {
+	type inner struct {
+		Value float64 `json:"value,omitempty"`
+	}
+	type record struct {
+		Name     string            `json:"name"`
+		Skipped  string            `json:"-"`
+		Untagged int               `json:",omitempty"`
+		Empty    string            `json:"empty,omitempty"`
+		Zero     int64             `json:"zero"`
+		Nil      *inner            `json:"nil"`
+		Omitted  *inner            `json:"omitted,omitempty"`
+		Inner    inner             `json:"inner"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		Number   json.Number       `json:"number"`
+		Negative int64             `json:"negative"`
+		Large    uint64            `json:"large"`
+		Fraction float64           `json:"fraction"`
+		When     time.Time         `json:"when"`
+	}
+
+	tests := []record{
+		{},
+		{Name: "all", Skipped: "x", Untagged: 3, Empty: "e", Zero: 0, Nil: &inner{1.5},
+			Omitted: &inner{}, Inner: inner{-2.25}, Labels: map[string]string{"b": "2", "a": "1"},
+			Number: "12.75", Negative: -1 << 40, Large: 1<<64 - 1, Fraction: 0.1,
+			When: time.Date(2024, 2, 29, 23, 59, 59, 999999999, time.UTC)},
+	}
+
+	for i, want := range tests {
+		data, err := Marshal(want)
+		if err != nil {
+			t.Fatalf("case %d: Marshal: %v", i, err)
+		}
+		var got record
+		if err := Unmarshal(data, &got); err != nil {
+			t.Fatalf("case %d: Unmarshal: %v", i, err)
+		}
+		assertSameJSON(t, got, want)
+	}
+}
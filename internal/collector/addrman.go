@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// addrmanTables is one network's entry in the getaddrmaninfo result
+type addrmanTables struct {
+	New   int `json:"new"`
+	Tried int `json:"tried"`
+	Total int `json:"total"`
+}
+
+// nodeAddress is the part of a getnodeaddresses entry we count
+type nodeAddress struct {
+	Network string `json:"network"`
+}
+
+// updateAddrman records address manager table sizes per network.
+// getaddrmaninfo needs Bitcoin Core 26 or later; usable counts from
+// getnodeaddresses are recorded on older nodes too.
+func (c *BitcoinCollector) updateAddrman(ctx context.Context, m *metrics.BitcoinMetrics) {
+	networks := make(map[string]metrics.AddrmanNetwork)
+
+	tables, err := c.getAddrmanInfo(ctx)
+	if err != nil {
+		logger.Debug("Failed to get address manager info", "error", err)
+	}
+	for network, t := range tables {
+		if network == "all_networks" {
+			continue
+		}
+		networks[network] = metrics.AddrmanNetwork{New: t.New, Tried: t.Tried, Total: t.Total}
+	}
+
+	addresses, err := c.getNodeAddresses(ctx)
+	if err != nil {
+		logger.Debug("Failed to get node addresses", "error", err)
+	}
+	for _, address := range addresses {
+		if address.Network == "" {
+			continue // Nodes before v22 don't report the network
+		}
+		entry := networks[address.Network]
+		entry.Usable++
+		networks[address.Network] = entry
+	}
+
+	if len(networks) > 0 {
+		m.Addrman = networks
+	}
+}
+
+// getAddrmanInfo executes getaddrmaninfo RPC
+func (c *BitcoinCollector) getAddrmanInfo(ctx context.Context) (map[string]addrmanTables, error) {
+	output, err := c.call(ctx, "getaddrmaninfo")
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]addrmanTables
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse getaddrmaninfo: %w", err)
+	}
+
+	return result, nil
+}
+
+// getNodeAddresses executes getnodeaddresses RPC for every address the
+// node would share
+func (c *BitcoinCollector) getNodeAddresses(ctx context.Context) ([]nodeAddress, error) {
+	output, err := c.call(ctx, "getnodeaddresses", "0")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []nodeAddress
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse getnodeaddresses: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// AgentCollector reports the agent's own resource use, so leaks show up on
+// long-running deployments
+type AgentCollector struct {
+	process   *process.Process // nil if the process could not be opened
+	startTime time.Time
+
+	lastWakeups int64 // At lastTime, for the rate
+	lastTime    time.Time
+}
+
+// NewAgentCollector creates a collector for the running process
+func NewAgentCollector() *AgentCollector {
+	c := &AgentCollector{startTime: time.Now()}
+	if p, err := process.NewProcess(int32(os.Getpid())); err == nil {
+		c.process = p
+	} else {
+		logger.Warn("Failed to open own process, agent RSS will not be reported", "error", err)
+	}
+	return c
+}
+
+// Collect gathers current agent metrics
+func (c *AgentCollector) Collect() *metrics.AgentMetrics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	m := &metrics.AgentMetrics{
+		HeapBytes:     int64(mem.HeapAlloc),
+		Goroutines:    runtime.NumGoroutine(),
+		UptimeSeconds: int64(time.Since(c.startTime).Seconds()),
+	}
+
+	if c.process == nil {
+		return m
+	}
+	if info, err := c.process.MemoryInfo(); err == nil {
+		m.RSSBytes = int64(info.RSS)
+	}
+	if times, err := c.process.Times(); err == nil {
+		m.CPUSeconds = times.User + times.System
+	}
+	if wakeups, ok := voluntarySwitches(); ok {
+		now := time.Now()
+		m.Wakeups = wakeups
+		if !c.lastTime.IsZero() && m.Wakeups >= c.lastWakeups {
+			if minutes := now.Sub(c.lastTime).Minutes(); minutes > 0 {
+				m.WakeupsPerMinute = float64(m.Wakeups-c.lastWakeups) / minutes
+			}
+		}
+		c.lastWakeups = m.Wakeups
+		c.lastTime = now
+	}
+
+	return m
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package collector
+
+import "syscall"
+
+// voluntarySwitches returns how often the agent's threads have blocked,
+// counting all of them, where /proc/<pid>/status only has the main thread
+func voluntarySwitches() (int64, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return int64(usage.Nvcsw), true
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package collector
+
+// voluntarySwitches is not available on Windows
+func voluntarySwitches() (int64, bool) {
+	return 0, false
+}
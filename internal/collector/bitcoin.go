@@ -2,39 +2,121 @@ package collector
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os/exec"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/derived"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/faults"
 	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
 )
 
-// BitcoinCollector collects Bitcoin Core metrics via bitcoin-cli
+// restEndpoints maps RPC methods to their equivalent on bitcoind's REST interface
+var restEndpoints = map[string]string{
+	"getblockchaininfo": "/rest/chaininfo.json",
+	"getmempoolinfo":    "/rest/mempool/info.json",
+}
+
+// BitcoinCollector collects Bitcoin Core metrics via bitcoin-cli or the REST interface
 type BitcoinCollector struct {
-	cliPath string
-	dataDir string
-	user    string
-	timeout time.Duration
+	cliPath    string
+	dataDir    string
+	chain      string // -chain passed to bitcoin-cli; empty for the node's default
+	user       string
+	timeout    time.Duration
+	transport  string // "cli", "rest", or "auto"
+	restURL    string
+	httpClient *http.Client
+	latency    *latencyTracker
+	cache      *rpcCache
+	utxo       *utxoStats       // nil unless UTXO statistics are enabled
+	capture    *Capture         // nil unless capturing or replaying
+	source     string           // Identifies this node in a capture
+	faults     *faults.Injector // nil unless fault injection is enabled
+
+	// -maxconnections, for inbound slot utilization
+	maxConnections     int // Configured; 0 reads bitcoin.conf
+	confMaxConnections int
+	confRead           bool
+
+	// Local address advertisement
+	advertise  []string        // Networks expected in localaddresses
+	lastOnions map[string]bool // Onion addresses seen last collection
+
+	lastPruneHeight int // For telling when the node pruned
+
+	blocks        *derived.BlockIntervals // nil unless block intervals are tracked
+	lastBlockHash string                  // Best block at the previous collection
+
+	// getnettotals state for rate and monthly total calculation
+	lastNetRecv uint64
+	lastNetSent uint64
+	lastNetTime time.Time
+	netMonth    string
+	monthRecv   int64
+	monthSent   int64
 }
 
 // NewBitcoinCollector creates a new Bitcoin metrics collector
-func NewBitcoinCollector(cliPath, dataDir, user string, timeoutSeconds int) *BitcoinCollector {
+func NewBitcoinCollector(cliPath, dataDir, user string, timeoutSeconds int, transport, restURL string) *BitcoinCollector {
+	if transport == "rest" {
+		methods := make([]string, 0, len(restEndpoints))
+		for method := range restEndpoints {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		logger.Warn("Bitcoin transport is rest: other RPC methods fail and their metrics are missing", "rest_methods", strings.Join(methods, ","))
+	}
+
+	timeout := time.Duration(timeoutSeconds) * time.Second
 	return &BitcoinCollector{
-		cliPath: cliPath,
-		dataDir: dataDir,
-		user:    user,
-		timeout: time.Duration(timeoutSeconds) * time.Second,
+		cliPath:    cliPath,
+		dataDir:    dataDir,
+		user:       user,
+		timeout:    timeout,
+		transport:  transport,
+		restURL:    strings.TrimSuffix(restURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+		latency:    newLatencyTracker(),
+		cache:      newRPCCache(nil),
 	}
 }
 
+// SetChain selects the chain bitcoin-cli talks to, such as "test" or "signet"
+func (c *BitcoinCollector) SetChain(chain string) {
+	c.chain = chain
+}
+
+// SetCapture records RPC responses to capture, or serves them from it when
+// replaying. source tells this node's responses apart from other nodes'.
+func (c *BitcoinCollector) SetCapture(capture *Capture, source string) {
+	c.capture = capture
+	c.source = source
+}
+
+// SetFaults injects RPC delays for testing
+func (c *BitcoinCollector) SetFaults(injector *faults.Injector) {
+	c.faults = injector
+}
+
+// SetCacheTTLs configures which RPC results are cached and for how long
+func (c *BitcoinCollector) SetCacheTTLs(ttls map[string]time.Duration) {
+	c.cache = newRPCCache(ttls)
+}
+
 // Collect gathers current Bitcoin metrics
-func (c *BitcoinCollector) Collect() (*metrics.BitcoinMetrics, error) {
+func (c *BitcoinCollector) Collect(ctx context.Context) (*metrics.BitcoinMetrics, error) {
 	m := &metrics.BitcoinMetrics{}
 
 	// Measure RPC latency with getblockchaininfo
 	startTime := time.Now()
-	blockchainInfo, err := c.getBlockchainInfo()
+	blockchainInfo, err := c.getBlockchainInfo(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("getblockchaininfo failed: %w", err)
 	}
@@ -59,12 +141,14 @@ func (c *BitcoinCollector) Collect() (*metrics.BitcoinMetrics, error) {
 	if chain, ok := blockchainInfo["chain"].(string); ok {
 		m.Chain = chain
 	}
+	c.updateState(m, blockchainInfo)
+	c.updateBlocks(ctx, m, blockchainInfo, startTime)
 	if sizeOnDisk, ok := blockchainInfo["size_on_disk"].(float64); ok {
 		m.ChainSizeBytes = int64(sizeOnDisk)
 	}
 
 	// Get network info
-	networkInfo, err := c.getNetworkInfo()
+	networkInfo, err := c.getNetworkInfo(ctx)
 	if err == nil {
 		if connections, ok := networkInfo["connections"].(float64); ok {
 			m.Peers = int(connections)
@@ -75,10 +159,21 @@ func (c *BitcoinCollector) Collect() (*metrics.BitcoinMetrics, error) {
 		if connectionsOut, ok := networkInfo["connections_out"].(float64); ok {
 			m.OutboundPeers = int(connectionsOut)
 		}
+		if offset, ok := networkInfo["timeoffset"].(float64); ok {
+			m.TimeOffsetSeconds = int(offset)
+		}
+		if version, ok := networkInfo["version"].(float64); ok {
+			m.Version = int(version)
+		}
+		if subversion, ok := networkInfo["subversion"].(string); ok {
+			m.Subversion = subversion
+		}
+		c.updateInboundSlots(m, networkInfo)
+		c.updateLocalAddresses(m, networkInfo)
 	}
 
 	// Get mempool info
-	mempoolInfo, err := c.getMempoolInfo()
+	mempoolInfo, err := c.getMempoolInfo(ctx)
 	if err == nil {
 		if size, ok := mempoolInfo["size"].(float64); ok {
 			m.MempoolTxCount = int(size)
@@ -89,22 +184,135 @@ func (c *BitcoinCollector) Collect() (*metrics.BitcoinMetrics, error) {
 	}
 
 	// Get uptime
-	uptime, err := c.getUptime()
+	uptime, err := c.getUptime(ctx)
 	if err == nil {
 		m.UptimeSeconds = uptime
 	}
 
+	// Get chain tips
+	tips, err := c.getChainTips(ctx)
+	if err == nil {
+		for _, tip := range tips {
+			switch tip.Status {
+			case "active":
+				continue
+			case "valid-fork":
+				m.ChainTipsValidFork++
+			case "valid-headers":
+				m.ChainTipsValidHeaders++
+			case "invalid":
+				m.ChainTipsInvalid++
+			}
+			if tip.BranchLen > m.LongestForkLength {
+				m.LongestForkLength = tip.BranchLen
+			}
+		}
+	}
+
+	// Get address manager statistics
+	c.updateAddrman(ctx, m)
+
+	// Get network traffic totals
+	netTotals, err := c.getNetTotals(ctx)
+	if err == nil {
+		c.updateNetTotals(m, netTotals)
+	}
+
+	c.applyUTXOStats(m)
+
+	m.RPCMethodLatency = c.latency.Snapshot()
+
 	return m, nil
 }
 
+// call executes an RPC method over the configured transport, serving it from
+// the cache when a TTL is configured for the method
+func (c *BitcoinCollector) call(ctx context.Context, method string, params ...string) ([]byte, error) {
+	request := strings.Join(append([]string{method}, params...), " ")
+	return c.cache.get(method, params, func() ([]byte, error) {
+		return c.capture.do(c.source, request, func() ([]byte, error) {
+			return c.callUncached(ctx, method, params...)
+		})
+	})
+}
+
+// callUncached executes an RPC method over the configured transport. Methods
+// without a REST equivalent, and calls with parameters, are unavailable in
+// "rest" mode.
+func (c *BitcoinCollector) callUncached(ctx context.Context, method string, params ...string) ([]byte, error) {
+	if err := c.faults.SlowRPC(ctx, c.timeout); err != nil {
+		return nil, err
+	}
+
+	endpoint, hasREST := restEndpoints[method]
+	hasREST = hasREST && len(params) == 0
+	args := append([]string{method}, params...)
+
+	switch c.transport {
+	case "rest":
+		if !hasREST {
+			return nil, fmt.Errorf("%s is not available over REST", method)
+		}
+		return c.restGet(ctx, endpoint)
+	case "auto":
+		output, err := c.runCLI(ctx, args...)
+		if err == nil || !hasREST {
+			return output, err
+		}
+		restOutput, restErr := c.restGet(ctx, endpoint)
+		if restErr != nil {
+			return nil, fmt.Errorf("cli: %v; rest: %w", err, restErr)
+		}
+		return restOutput, nil
+	default:
+		return c.runCLI(ctx, args...)
+	}
+}
+
+// restGet fetches a path from bitcoind's unauthenticated REST interface
+func (c *BitcoinCollector) restGet(ctx context.Context, path string) ([]byte, error) {
+	startTime := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.restURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rest request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rest response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rest request returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	c.latency.Record("rest:"+path, time.Since(startTime))
+	return body, nil
+}
+
 // runCLI executes bitcoin-cli command
-func (c *BitcoinCollector) runCLI(args ...string) ([]byte, error) {
+func (c *BitcoinCollector) runCLI(ctx context.Context, args ...string) ([]byte, error) {
+	return c.runCLIWithTimeout(ctx, c.timeout, args...)
+}
+
+// runCLIWithTimeout executes bitcoin-cli command with a specific timeout
+func (c *BitcoinCollector) runCLIWithTimeout(ctx context.Context, timeout time.Duration, args ...string) ([]byte, error) {
 	// Build command: bitcoin-cli [args]
 	// Agent runs as bitcoin user via systemd, so no sudo needed
 	cmdArgs := []string{}
 	if c.dataDir != "" {
 		cmdArgs = append(cmdArgs, fmt.Sprintf("-datadir=%s", c.dataDir))
 	}
+	if c.chain != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-chain=%s", c.chain))
+	}
 	cmdArgs = append(cmdArgs, args...)
 
 	cmd := exec.Command(c.cliPath, cmdArgs...)
@@ -114,6 +322,7 @@ func (c *BitcoinCollector) runCLI(args ...string) ([]byte, error) {
 	cmd.Stderr = &stderr
 
 	// Set timeout
+	startTime := time.Now()
 	done := make(chan error, 1)
 	go func() {
 		done <- cmd.Run()
@@ -124,16 +333,23 @@ func (c *BitcoinCollector) runCLI(args ...string) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("command failed: %w, stderr: %s", err, stderr.String())
 		}
+		// Only successful calls are timed, so failures don't skew percentiles
+		if len(args) > 0 {
+			c.latency.Record(args[0], time.Since(startTime))
+		}
 		return stdout.Bytes(), nil
-	case <-time.After(c.timeout):
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("command timed out after %v", timeout)
+	case <-ctx.Done():
 		cmd.Process.Kill()
-		return nil, fmt.Errorf("command timed out after %v", c.timeout)
+		return nil, ctx.Err()
 	}
 }
 
 // getBlockchainInfo executes getblockchaininfo RPC
-func (c *BitcoinCollector) getBlockchainInfo() (map[string]interface{}, error) {
-	output, err := c.runCLI("getblockchaininfo")
+func (c *BitcoinCollector) getBlockchainInfo(ctx context.Context) (map[string]interface{}, error) {
+	output, err := c.call(ctx, "getblockchaininfo")
 	if err != nil {
 		return nil, err
 	}
@@ -147,8 +363,8 @@ func (c *BitcoinCollector) getBlockchainInfo() (map[string]interface{}, error) {
 }
 
 // getNetworkInfo executes getnetworkinfo RPC
-func (c *BitcoinCollector) getNetworkInfo() (map[string]interface{}, error) {
-	output, err := c.runCLI("getnetworkinfo")
+func (c *BitcoinCollector) getNetworkInfo(ctx context.Context) (map[string]interface{}, error) {
+	output, err := c.call(ctx, "getnetworkinfo")
 	if err != nil {
 		return nil, err
 	}
@@ -162,8 +378,8 @@ func (c *BitcoinCollector) getNetworkInfo() (map[string]interface{}, error) {
 }
 
 // getMempoolInfo executes getmempoolinfo RPC
-func (c *BitcoinCollector) getMempoolInfo() (map[string]interface{}, error) {
-	output, err := c.runCLI("getmempoolinfo")
+func (c *BitcoinCollector) getMempoolInfo(ctx context.Context) (map[string]interface{}, error) {
+	output, err := c.call(ctx, "getmempoolinfo")
 	if err != nil {
 		return nil, err
 	}
@@ -176,9 +392,101 @@ func (c *BitcoinCollector) getMempoolInfo() (map[string]interface{}, error) {
 	return result, nil
 }
 
+// updateNetTotals derives traffic rates and monthly totals from getnettotals counters
+func (c *BitcoinCollector) updateNetTotals(m *metrics.BitcoinMetrics, netTotals map[string]interface{}) {
+	recvF, okRecv := netTotals["totalbytesrecv"].(float64)
+	sentF, okSent := netTotals["totalbytessent"].(float64)
+	if !okRecv || !okSent {
+		return
+	}
+	recv, sent := uint64(recvF), uint64(sentF)
+
+	now := time.Now().UTC()
+	month := now.Format("2006-01")
+	if month != c.netMonth {
+		c.netMonth = month
+		c.monthRecv = 0
+		c.monthSent = 0
+	}
+
+	if !c.lastNetTime.IsZero() {
+		// Counters reset when bitcoind restarts; count from zero in that case
+		deltaRecv, deltaSent := recv, sent
+		if recv >= c.lastNetRecv && sent >= c.lastNetSent {
+			deltaRecv = recv - c.lastNetRecv
+			deltaSent = sent - c.lastNetSent
+		}
+
+		elapsed := now.Sub(c.lastNetTime).Seconds()
+		if elapsed > 0 {
+			m.NetRecvBPS = int64(float64(deltaRecv) / elapsed)
+			m.NetSentBPS = int64(float64(deltaSent) / elapsed)
+		}
+
+		c.monthRecv += int64(deltaRecv)
+		c.monthSent += int64(deltaSent)
+	}
+
+	c.lastNetRecv = recv
+	c.lastNetSent = sent
+	c.lastNetTime = now
+
+	m.NetRecvMonthBytes = c.monthRecv
+	m.NetSentMonthBytes = c.monthSent
+}
+
+// seedNetTotals continues the monthly totals of a sample stored at t, so
+// they do not start over when the agent restarts. Traffic while the agent
+// was not running is not counted.
+func (c *BitcoinCollector) seedNetTotals(m *metrics.BitcoinMetrics, t time.Time) {
+	if month := t.UTC().Format("2006-01"); month == time.Now().UTC().Format("2006-01") {
+		c.netMonth = month
+		c.monthRecv = m.NetRecvMonthBytes
+		c.monthSent = m.NetSentMonthBytes
+	}
+}
+
+// chainTip is a single entry of the getchaintips result
+type chainTip struct {
+	Height    int    `json:"height"`
+	Hash      string `json:"hash"`
+	BranchLen int    `json:"branchlen"`
+	Status    string `json:"status"`
+}
+
+// getChainTips executes getchaintips RPC
+func (c *BitcoinCollector) getChainTips(ctx context.Context) ([]chainTip, error) {
+	output, err := c.call(ctx, "getchaintips")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []chainTip
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse getchaintips: %w", err)
+	}
+
+	return result, nil
+}
+
+// getNetTotals executes getnettotals RPC
+func (c *BitcoinCollector) getNetTotals(ctx context.Context) (map[string]interface{}, error) {
+	output, err := c.call(ctx, "getnettotals")
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse getnettotals: %w", err)
+	}
+
+	return result, nil
+}
+
 // getUptime executes uptime RPC
-func (c *BitcoinCollector) getUptime() (int, error) {
-	output, err := c.runCLI("uptime")
+func (c *BitcoinCollector) getUptime(ctx context.Context) (int, error) {
+	output, err := c.call(ctx, "uptime")
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/derived"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// maxHeaderWalk bounds how many headers are fetched for blocks found since
+// the last one recorded. Further back, as after the agent was stopped for a
+// while, the first block fetched starts the history again without an
+// interval.
+const maxHeaderWalk = 12
+
+// blockHeader is the part of getblockheader the interval history uses
+type blockHeader struct {
+	Hash         string `json:"hash"`
+	Height       int    `json:"height"`
+	Time         int64  `json:"time"`
+	PreviousHash string `json:"previousblockhash"`
+}
+
+// SetBlockIntervals records the times of new blocks in history
+func (c *BitcoinCollector) SetBlockIntervals(history *derived.BlockIntervals) {
+	c.blocks = history
+}
+
+// updateBlocks records the blocks added since the last recorded one. Only
+// a tip first seen by this process gets an arrival time; earlier blocks and
+// blocks found while syncing were seen late.
+func (c *BitcoinCollector) updateBlocks(ctx context.Context, m *metrics.BitcoinMetrics, blockchainInfo map[string]interface{}, seen time.Time) {
+	hash, _ := blockchainInfo["bestblockhash"].(string)
+	if c.blocks == nil || hash == "" || m.IBD || hash == c.lastBlockHash {
+		return
+	}
+	followed := c.lastBlockHash != ""
+	c.lastBlockHash = hash
+
+	if c.blocks.Recorded(hash) {
+		return // Recorded before a restart
+	}
+	first := c.blocks.Tip() == ""
+
+	var blocks []derived.Block
+	for len(blocks) < maxHeaderWalk {
+		header, err := c.getBlockHeader(ctx, hash)
+		if err != nil {
+			logger.Debug("Failed to get block header", "hash", hash, "error", err)
+			break
+		}
+		blocks = append(blocks, derived.Block{
+			Height:       header.Height,
+			Hash:         header.Hash,
+			PreviousHash: header.PreviousHash,
+			Time:         time.Unix(header.Time, 0).UTC(),
+		})
+		if first || header.PreviousHash == "" || c.blocks.Recorded(header.PreviousHash) {
+			break
+		}
+		hash = header.PreviousHash
+	}
+	if len(blocks) == 0 {
+		c.lastBlockHash = "" // Try again next collection
+		return
+	}
+
+	slices.Reverse(blocks)
+	if followed {
+		blocks[len(blocks)-1].Seen = seen
+	}
+	if err := c.blocks.Add(blocks); err != nil {
+		logger.Warn("Failed to save block intervals", "error", err)
+	}
+}
+
+// getBlockHeader fetches a block header by hash
+func (c *BitcoinCollector) getBlockHeader(ctx context.Context, hash string) (*blockHeader, error) {
+	if c.transport == "rest" {
+		output, err := c.restGet(ctx, fmt.Sprintf("/rest/headers/%s.json?count=1", hash))
+		if err != nil {
+			return nil, err
+		}
+		var headers []blockHeader
+		if err := json.Unmarshal(output, &headers); err != nil {
+			return nil, fmt.Errorf("failed to parse headers: %w", err)
+		}
+		if len(headers) == 0 {
+			return nil, fmt.Errorf("no header for block %s", hash)
+		}
+		return &headers[0], nil
+	}
+
+	output, err := c.call(ctx, "getblockheader", hash)
+	if err != nil {
+		return nil, err
+	}
+	var header blockHeader
+	if err := json.Unmarshal(output, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse getblockheader: %w", err)
+	}
+	return &header, nil
+}
+
+// BlockIntervalStats summarizes the primary node's block intervals in a
+// range
+func (c *Collector) BlockIntervalStats(start, end time.Time) (*metrics.BlockIntervalStats, error) {
+	if c.blockIntervals == nil {
+		return nil, fmt.Errorf("block intervals are not tracked without bitcoin collection")
+	}
+	return c.blockIntervals.Stats(start, end), nil
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// rpcCache caches results of expensive RPCs for a per-method TTL, so collectors
+// and proxy requests share one call instead of repeating it within a cycle
+type rpcCache struct {
+	mu       sync.Mutex
+	ttls     map[string]time.Duration
+	entries  map[string]cacheEntry
+	inflight map[string]*inflightCall
+}
+
+// cacheEntry is a cached RPC result
+type cacheEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// inflightCall lets concurrent callers wait for a single in-progress RPC
+type inflightCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// newRPCCache creates a cache with the given per-method TTLs
+func newRPCCache(ttls map[string]time.Duration) *rpcCache {
+	return &rpcCache{
+		ttls:     ttls,
+		entries:  make(map[string]cacheEntry),
+		inflight: make(map[string]*inflightCall),
+	}
+}
+
+// get returns the cached result for method and params, calling fetch on a miss.
+// Methods without a TTL are never cached.
+func (c *rpcCache) get(method string, params []string, fetch func() ([]byte, error)) ([]byte, error) {
+	ttl := c.ttls[method]
+	if ttl <= 0 {
+		return fetch()
+	}
+
+	key := method
+	if len(params) > 0 {
+		key += " " + strings.Join(params, " ")
+	}
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.data, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.data, call.err
+	}
+
+	call := &inflightCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	call.data, call.err = fetch()
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if call.err == nil {
+		c.entries[key] = cacheEntry{data: call.data, expires: time.Now().Add(ttl)}
+	}
+	c.pruneLocked()
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.data, call.err
+}
+
+// pruneLocked drops expired entries; c.mu must be held
+func (c *rpcCache) pruneLocked() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Capture modes
+const (
+	CaptureRecord = "record"
+	CaptureReplay = "replay"
+)
+
+// cookiePlaceholder is recorded instead of the Tor control cookie so that
+// captures can be shared without leaking it
+const cookiePlaceholder = "REDACTED"
+
+// errCaptureExhausted is returned in replay mode once every recorded
+// response for a request has been served
+var errCaptureExhausted = errors.New("no more recorded responses in capture")
+
+// captureEntry is one recorded input, stored one per line in a capture file
+type captureEntry struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`  // e.g. "bitcoin", "bitcoin:testnet", or "tor"
+	Request  string    `json:"request"` // RPC method, or "control" for a control-port session
+	Response string    `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Capture records the raw inputs collectors parse (RPC responses and Tor
+// control-port transcripts) to a file, or replays a recorded file in place
+// of the real sources. Replaying a user's capture reproduces exactly what
+// their collectors saw. A nil *Capture does neither.
+type Capture struct {
+	replay bool
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	queued  map[string][]captureEntry // Replay: remaining responses by source and request
+	warned  bool                      // A write failure or the end of the replay was logged
+}
+
+// OpenCapture creates or truncates a capture file for recording, or loads
+// one for replay
+func OpenCapture(mode, path string) (*Capture, error) {
+	switch mode {
+	case CaptureRecord:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create capture file: %w", err)
+		}
+		return &Capture{file: file, encoder: json.NewEncoder(file)}, nil
+	case CaptureReplay:
+		return loadCapture(path)
+	default:
+		return nil, fmt.Errorf("unknown capture mode %q (use record or replay)", mode)
+	}
+}
+
+// loadCapture reads a capture file for replay
+func loadCapture(path string) (*Capture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	defer file.Close()
+
+	c := &Capture{replay: true, queued: make(map[string][]captureEntry)}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry captureEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid capture entry on line %d: %w", line, err)
+		}
+		key := captureKey(entry.Source, entry.Request)
+		c.queued[key] = append(c.queued[key], entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read capture file: %w", err)
+	}
+
+	return c, nil
+}
+
+// Replaying reports whether recorded inputs replace the real sources
+func (c *Capture) Replaying() bool {
+	return c != nil && c.replay
+}
+
+// Close finishes a recording
+func (c *Capture) Close() error {
+	if c == nil || c.file == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.file.Close()
+}
+
+// do returns the next recorded response when replaying; otherwise it calls
+// fetch, recording the result when recording
+func (c *Capture) do(source, request string, fetch func() ([]byte, error)) ([]byte, error) {
+	if c.Replaying() {
+		return c.next(source, request)
+	}
+
+	output, err := fetch()
+	c.record(source, request, output, err)
+	return output, err
+}
+
+// record appends an input to the capture file
+func (c *Capture) record(source, request string, response []byte, err error) {
+	if c == nil || c.replay {
+		return
+	}
+
+	entry := captureEntry{
+		Time:     time.Now().UTC(),
+		Source:   source,
+		Request:  request,
+		Response: string(response),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.encoder.Encode(&entry); err != nil && !c.warned {
+		logger.Warn("Failed to write capture entry", "error", err)
+		c.warned = true
+	}
+}
+
+// next pops the next recorded response for a request
+func (c *Capture) next(source, request string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := captureKey(source, request)
+	queue := c.queued[key]
+	if len(queue) == 0 {
+		if !c.warned {
+			logger.Warn("Capture replay reached the end of the recording", "source", source, "request", request)
+			c.warned = true
+		}
+		return nil, fmt.Errorf("%s %s: %w", source, request, errCaptureExhausted)
+	}
+	entry := queue[0]
+	c.queued[key] = queue[1:]
+
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+	return []byte(entry.Response), nil
+}
+
+// captureKey identifies a request within a capture
+func captureKey(source, request string) string {
+	return source + " " + request
+}
+
+// controlConn is the part of a control-port connection the Tor collector uses
+type controlConn interface {
+	io.ReadWriteCloser
+	SetDeadline(t time.Time) error
+}
+
+// recordingConn copies everything read from a control-port connection and
+// records the transcript when the connection is closed
+type recordingConn struct {
+	net.Conn
+	capture    *Capture
+	transcript bytes.Buffer
+}
+
+func (r *recordingConn) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	r.transcript.Write(p[:n])
+	return n, err
+}
+
+func (r *recordingConn) Close() error {
+	r.capture.record("tor", "control", r.transcript.Bytes(), nil)
+	return r.Conn.Close()
+}
+
+// replayConn serves a recorded control-port transcript, discarding writes
+type replayConn struct {
+	io.Reader
+}
+
+func (replayConn) Write(p []byte) (int, error)   { return len(p), nil }
+func (replayConn) Close() error                  { return nil }
+func (replayConn) SetDeadline(t time.Time) error { return nil }
@@ -0,0 +1,258 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+const (
+	// clockCommandTimeout bounds chronyc and timedatectl
+	clockCommandTimeout = 5 * time.Second
+
+	// ntpInterval is how often ntp_server is queried; public pools ask
+	// clients not to poll more often than this
+	ntpInterval = 5 * time.Minute
+
+	// ntpEpochOffset is the number of seconds from 1900, the NTP epoch, to 1970
+	ntpEpochOffset = 2208988800
+)
+
+// clockState is one reading of the system clock's accuracy
+type clockState struct {
+	offset       float64 // Seconds the local clock is ahead
+	hasOffset    bool
+	synchronized bool
+	hasSync      bool
+	source       string
+}
+
+// clockChecker reads the system clock offset from the configured source
+type clockChecker struct {
+	source      string // "auto", "chrony", "timedatectl", "ntp" or "none"
+	ntpServer   string
+	chronyc     string // Paths, if installed
+	timedatectl string
+
+	mu         sync.Mutex
+	ntpState   *clockState
+	ntpQueried time.Time
+}
+
+// newClockChecker creates a checker, locating chronyc and timedatectl
+func newClockChecker(source, ntpServer string) *clockChecker {
+	c := &clockChecker{source: source, ntpServer: ntpServer}
+	if path, err := exec.LookPath("chronyc"); err == nil {
+		c.chronyc = path
+	}
+	if path, err := exec.LookPath("timedatectl"); err == nil {
+		c.timedatectl = path
+	}
+	return c
+}
+
+// apply sets the clock fields of m from the configured source
+func (c *clockChecker) apply(m *metrics.SystemMetrics) {
+	state, err := c.read()
+	if err != nil {
+		logger.Debug("Failed to read clock offset", "source", c.source, "error", err)
+		return
+	}
+	if state == nil {
+		return
+	}
+
+	m.ClockSource = state.source
+	if state.hasOffset {
+		offset := state.offset
+		m.ClockOffsetSeconds = &offset
+	}
+	if state.hasSync {
+		synchronized := state.synchronized
+		m.ClockSynchronized = &synchronized
+	}
+}
+
+// read returns the clock state, or nil if no source is available
+func (c *clockChecker) read() (*clockState, error) {
+	switch c.source {
+	case "chrony":
+		return chronyTracking(c.chronyc)
+	case "timedatectl":
+		return timedatectlSync(c.timedatectl)
+	case "ntp":
+		return c.queryNTP()
+	case "none":
+		return nil, nil
+	}
+
+	// auto
+	if c.chronyc != "" {
+		if state, err := chronyTracking(c.chronyc); err == nil {
+			return state, nil
+		}
+	}
+	if c.timedatectl != "" {
+		return timedatectlSync(c.timedatectl)
+	}
+	return nil, nil
+}
+
+// runClockCommand runs a time daemon client with a short timeout
+func runClockCommand(path string, args ...string) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("not installed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clockCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(cmd.Environ(), "LC_ALL=C")
+	return cmd.Output()
+}
+
+// chronyTracking parses chronyc tracking, whose relevant lines are
+//
+//	System time     : 0.000012345 seconds fast of NTP time
+//	Leap status     : Normal
+func chronyTracking(chronyc string) (*clockState, error) {
+	output, err := runClockCommand(chronyc, "tracking")
+	if err != nil {
+		return nil, fmt.Errorf("chronyc tracking failed: %w", err)
+	}
+
+	state := &clockState{source: "chrony"}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "System time":
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				continue
+			}
+			offset, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				continue
+			}
+			if fields[2] == "slow" {
+				offset = -offset
+			}
+			state.offset, state.hasOffset = offset, true
+		case "Leap status":
+			state.synchronized, state.hasSync = value != "Not synchronised", true
+		}
+	}
+
+	if !state.hasOffset {
+		return nil, fmt.Errorf("no system time in chronyc tracking output")
+	}
+	return state, nil
+}
+
+// timedatectlSync reads whether systemd considers the clock synchronized.
+// It does not report an offset.
+func timedatectlSync(timedatectl string) (*clockState, error) {
+	output, err := runClockCommand(timedatectl, "show", "--property=NTPSynchronized", "--value")
+	if err != nil {
+		return nil, fmt.Errorf("timedatectl failed: %w", err)
+	}
+
+	value := strings.TrimSpace(string(output))
+	if value != "yes" && value != "no" {
+		return nil, fmt.Errorf("unexpected NTPSynchronized value %q", value)
+	}
+	return &clockState{source: "timedatectl", synchronized: value == "yes", hasSync: true}, nil
+}
+
+// queryNTP returns the offset from ntp_server, querying it at most once per
+// ntpInterval
+func (c *clockChecker) queryNTP() (*clockState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ntpState != nil && time.Since(c.ntpQueried) < ntpInterval {
+		return c.ntpState, nil
+	}
+
+	offset, err := sntpOffset(c.ntpServer, clockCommandTimeout)
+	c.ntpQueried = time.Now()
+	if err != nil {
+		c.ntpState = nil
+		return nil, err
+	}
+
+	// A server answering means the offset is known, not that the local
+	// clock is disciplined by it
+	c.ntpState = &clockState{source: "ntp", offset: offset, hasOffset: true}
+	return c.ntpState, nil
+}
+
+// sntpOffset sends a single SNTP request (RFC 4330) and returns how many
+// seconds the local clock is ahead of the server
+func sntpOffset(server string, timeout time.Duration) (float64, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	request := make([]byte, 48)
+	request[0] = 0x23 // Leap indicator 0, version 4, client mode
+
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	received := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < 48 {
+		return 0, fmt.Errorf("short NTP response (%d bytes)", n)
+	}
+	if mode := response[0] & 0x7; mode != 4 {
+		return 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if stratum := response[1]; stratum == 0 || stratum > 15 {
+		return 0, fmt.Errorf("NTP server is unsynchronized (stratum %d)", stratum)
+	}
+
+	serverReceived := ntpTime(response[32:40])
+	serverSent := ntpTime(response[40:48])
+
+	// Standard NTP offset: how far the server is ahead of us
+	serverAhead := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	return -serverAhead.Seconds(), nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(seconds, fraction*1e9>>32)
+}
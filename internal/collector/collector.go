@@ -1,33 +1,196 @@
 package collector
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/derived"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/faults"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	custom "github.com/bitcoin-node-manager/btc-node-monitor/pkg/collector"
 	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
 )
 
+var logger = logging.New("collector")
+
 // Collector orchestrates all metric collection
 type Collector struct {
-	config  *config.Config
-	system  *SystemCollector
-	bitcoin *BitcoinCollector
-	tor     *TorCollector
+	config       *config.Config
+	system       *SystemCollector
+	bitcoin      *BitcoinCollector
+	nodes        map[string]*BitcoinCollector // Additional enabled nodes by name
+	tor          *TorCollector
+	hardware     *HardwareCollector
+	systemd      *SystemdCollector
+	custom       []custom.Collector
+	diskForecast *derived.DiskForecaster
+	externalTip  *ExternalTip    // nil unless an external tip source is enabled
+	agent        *AgentCollector // nil unless self metrics are enabled
+	leaks        *derived.LeakDetector
+	leakReported bool
+	demo         *Simulator // Replaces every source in demo mode
+
+	mempoolSpace *MempoolSpaceCollector // nil unless a mempool.space instance is configured
+
+	blockIntervals *derived.BlockIntervals // nil unless bitcoin collection is enabled
+
+	mempoolSnapshot mempoolSnapshotCache
 }
 
 // NewCollector creates a new metrics collector
 func NewCollector(cfg *config.Config) *Collector {
-	return &Collector{
-		config:  cfg,
-		system:  NewSystemCollector(cfg.System.MonitorDiskPath),
-		bitcoin: NewBitcoinCollector(cfg.Bitcoin.CLIPath, cfg.Bitcoin.DataDir, cfg.Bitcoin.User, cfg.Bitcoin.TimeoutSeconds),
-		tor:     NewTorCollector(cfg.Tor.ControlPort, cfg.Tor.CookiePath, cfg.Tor.TimeoutSeconds),
+	nodes := make(map[string]*BitcoinCollector)
+	for _, node := range cfg.BitcoinNodes {
+		if node.Enabled {
+			nodes[node.Name] = newBitcoinCollector(node)
+		}
+	}
+
+	tor := NewTorCollector(cfg.Tor)
+	tor.EnableSelfCheck(
+		fmt.Sprintf("127.0.0.1:%d", cfg.Tor.SOCKSPort),
+		cfg.Tor.OnionAddress,
+		cfg.Tor.OnionPort,
+		time.Duration(cfg.Tor.SelfCheckTimeoutSeconds)*time.Second,
+	)
+
+	c := &Collector{
+		config:   cfg,
+		system:   NewSystemCollector(cfg.System),
+		bitcoin:  newBitcoinCollector(cfg.Bitcoin),
+		nodes:    nodes,
+		tor:      tor,
+		hardware: NewHardwareCollector(cfg.Hardware),
+		systemd:  NewSystemdCollector(cfg.Systemd),
+		custom:   customCollectors(cfg),
+
+		diskForecast: derived.NewDiskForecaster(time.Duration(cfg.System.DiskForecastWindowDays) * 24 * time.Hour),
+	}
+	if cfg.ExternalTip.Enabled {
+		proxy := cfg.OutboundProxy
+		if cfg.ExternalTip.UseTor && !proxy.Enabled {
+			// use_tor predates outbound_proxy and routes only the explorer
+			proxy = config.OutboundProxyConfig{Enabled: true, Address: fmt.Sprintf("127.0.0.1:%d", cfg.Tor.SOCKSPort)}
+		}
+		c.externalTip = NewExternalTip(cfg.ExternalTip, netproxy.New(proxy))
+	}
+	if cfg.MempoolSpace.Enabled {
+		c.mempoolSpace = NewMempoolSpaceCollector(cfg.MempoolSpace, netproxy.New(cfg.OutboundProxy))
+	}
+	if cfg.Bitcoin.Enabled && !cfg.Demo {
+		c.blockIntervals = newBlockIntervals(cfg)
+		c.bitcoin.SetBlockIntervals(c.blockIntervals)
 	}
+	if cfg.PowerSaving.Enabled {
+		c.system.SetSkipped(cfg.PowerSaving.SkipSystemMetrics)
+	}
+	if cfg.System.SelfMetrics {
+		c.agent = NewAgentCollector()
+		c.leaks = derived.NewLeakDetector(time.Duration(cfg.System.LeakWindowDays)*24*time.Hour, cfg.System.LeakMinGrowthPercent)
+	}
+	if cfg.Demo {
+		c.demo = NewSimulator()
+	}
+	return c
+}
+
+// newBlockIntervals loads the primary node's block interval history from
+// data_dir, or keeps it in memory with the memory backend
+func newBlockIntervals(cfg *config.Config) *derived.BlockIntervals {
+	path := ""
+	if cfg.StorageBackend != "memory" {
+		path = filepath.Join(cfg.DataDir, "block_intervals.json")
+	}
+	history, err := derived.NewBlockIntervals(path)
+	if err != nil {
+		logger.Warn("Failed to load block intervals, starting over", "path", path, "error", err)
+	}
+	return history
+}
+
+// newBitcoinCollector creates a collector for one configured node
+func newBitcoinCollector(cfg config.BitcoinConfig) *BitcoinCollector {
+	bitcoin := NewBitcoinCollector(cfg.CLIPath, cfg.DataDir, cfg.User, cfg.TimeoutSeconds, cfg.Transport, cfg.RESTURL)
+	bitcoin.SetChain(cfg.Chain)
+	bitcoin.SetMaxConnections(cfg.MaxConnections)
+	bitcoin.SetAdvertiseNetworks(cfg.AdvertiseNetworks)
+
+	ttls := make(map[string]time.Duration, len(cfg.CacheTTLSeconds))
+	for method, seconds := range cfg.CacheTTLSeconds {
+		ttls[method] = time.Duration(seconds) * time.Second
+	}
+	bitcoin.SetCacheTTLs(ttls)
+
+	// gettxoutsetinfo has no REST equivalent
+	if cfg.Transport != "rest" {
+		bitcoin.EnableUTXOStats(time.Duration(cfg.UTXOStatsTimeoutSeconds) * time.Second)
+	}
+
+	return bitcoin
+}
+
+// SetCapture records the Bitcoin RPC responses and Tor control-port replies
+// collectors parse, or replays them from an earlier recording. System,
+// hardware and custom collectors are not captured.
+func (c *Collector) SetCapture(capture *Capture) {
+	c.bitcoin.SetCapture(capture, "bitcoin")
+	for name, node := range c.nodes {
+		node.SetCapture(capture, "bitcoin:"+name)
+	}
+	c.tor.SetCapture(capture)
+}
+
+// SetFaults injects slow RPC calls and partial Tor replies for testing
+func (c *Collector) SetFaults(injector *faults.Injector) {
+	c.bitcoin.SetFaults(injector)
+	for _, node := range c.nodes {
+		node.SetFaults(injector)
+	}
+	c.tor.SetFaults(injector)
+}
+
+// customCollectors combines registered collectors with configured exec
+// collectors, dropping any whose name is already taken
+func customCollectors(cfg *config.Config) []custom.Collector {
+	collectors := custom.Registered()
+
+	names := make(map[string]bool, len(collectors))
+	for _, c := range collectors {
+		names[c.Name()] = true
+	}
+
+	for _, e := range cfg.ExecCollectors {
+		if e.Name == "" || e.Command == "" {
+			logger.Warn("Ignoring exec collector without a name or command")
+			continue
+		}
+		if names[e.Name] {
+			logger.Warn("Ignoring exec collector: name already in use", "collector", e.Name)
+			continue
+		}
+		names[e.Name] = true
+		collectors = append(collectors, NewExecCollector(e.Name, e.Command, e.Args, e.TimeoutSeconds))
+	}
+
+	return collectors
 }
 
 // Collect gathers all enabled metrics
-func (c *Collector) Collect() *metrics.Sample {
+func (c *Collector) Collect(ctx context.Context) *metrics.Sample {
+	if c.demo != nil {
+		sample := c.demo.Collect(time.Now())
+		sample.State = sample.Bitcoin.State
+		c.diskForecast.Update(sample)
+		c.collectAgent(sample)
+		return sample
+	}
+
 	sample := &metrics.Sample{
 		Timestamp: time.Now().UTC(),
 	}
@@ -36,7 +199,7 @@ func (c *Collector) Collect() *metrics.Sample {
 	if c.config.System.Enabled {
 		systemMetrics, err := c.system.Collect()
 		if err != nil {
-			log.Printf("[WARN] Failed to collect system metrics: %v", err)
+			logger.Warn("Failed to collect system metrics", "error", err)
 		} else {
 			sample.System = systemMetrics
 		}
@@ -44,23 +207,179 @@ func (c *Collector) Collect() *metrics.Sample {
 
 	// Bitcoin metrics
 	if c.config.Bitcoin.Enabled {
-		bitcoinMetrics, err := c.bitcoin.Collect()
+		bitcoinMetrics, err := c.bitcoin.Collect(ctx)
 		if err != nil {
-			log.Printf("[WARN] Failed to collect Bitcoin metrics: %v", err)
+			logger.Warn("Failed to collect Bitcoin metrics", "error", err)
 		} else {
 			sample.Bitcoin = bitcoinMetrics
+			sample.State = bitcoinMetrics.State
 		}
 	}
 
+	// Additional Bitcoin nodes
+	c.collectNodes(ctx, sample)
+
+	// Best height seen from outside the local node
+	if c.externalTip != nil {
+		c.externalTip.Apply(ctx, sample)
+	}
+
+	// Self-hosted mempool.space instance, compared with its node
+	if c.mempoolSpace != nil {
+		c.mempoolSpace.Apply(ctx, sample)
+	}
+
 	// Tor metrics
 	if c.config.Tor.Enabled {
-		torMetrics, err := c.tor.Collect()
+		torMetrics, err := c.tor.Collect(ctx)
 		if err != nil {
-			log.Printf("[WARN] Failed to collect Tor metrics: %v", err)
+			logger.Warn("Failed to collect Tor metrics", "error", err)
 		} else {
 			sample.Tor = torMetrics
 		}
 	}
 
+	// Hardware health from the BMC
+	if c.config.Hardware.Enabled {
+		hardwareMetrics, err := c.hardware.Collect(ctx)
+		if err != nil {
+			logger.Warn("Failed to collect hardware metrics", "error", err)
+		} else {
+			sample.Hardware = hardwareMetrics
+		}
+	}
+
+	// systemd unit states
+	if c.config.Systemd.Enabled {
+		services, err := c.systemd.Collect(ctx)
+		if err != nil {
+			logger.Warn("Failed to collect systemd unit states", "error", err)
+		} else {
+			sample.Services = services
+		}
+	}
+
+	// Custom metrics from registered collectors, bounded by the interval
+	collectCustom(ctx, c.custom, sample, time.Duration(c.config.CollectionIntervalSeconds)*time.Second)
+
+	// Derived metrics
+	c.diskForecast.Update(sample)
+	if c.blockIntervals != nil {
+		c.blockIntervals.Update(sample)
+	}
+
+	// The agent's own resource use, last so it includes this cycle's work
+	c.collectAgent(sample)
+
 	return sample
 }
+
+// collectAgent adds the agent's own metrics and checks them for leaks,
+// logging when a leak is first suspected
+func (c *Collector) collectAgent(sample *metrics.Sample) {
+	if c.agent == nil {
+		return
+	}
+
+	sample.Agent = c.agent.Collect()
+	c.leaks.Update(sample)
+
+	if sample.Agent.LeakSuspected && !c.leakReported {
+		logger.Warn("Possible memory leak in the agent", "warning", sample.Agent.LeakWarning)
+	}
+	c.leakReported = sample.Agent.LeakSuspected
+}
+
+// collectNodes collects the additional Bitcoin nodes concurrently and
+// stores their metrics in sample.Nodes
+func (c *Collector) collectNodes(ctx context.Context, sample *metrics.Sample) {
+	if len(c.nodes) == 0 {
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]*metrics.BitcoinMetrics, len(c.nodes))
+	)
+
+	for name, node := range c.nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			nodeMetrics, err := node.Collect(ctx)
+			if err != nil {
+				logger.Warn("Failed to collect Bitcoin metrics", "node", name, "error", err)
+				return
+			}
+
+			mu.Lock()
+			results[name] = nodeMetrics
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(results) > 0 {
+		sample.Nodes = results
+	}
+}
+
+// SeedHistory primes derived metrics and the monthly traffic totals with
+// previously stored samples, oldest first
+func (c *Collector) SeedHistory(samples []*metrics.Sample) {
+	c.diskForecast.Seed(samples)
+
+	for _, sample := range samples {
+		if c.bitcoin != nil && sample.Bitcoin != nil {
+			c.bitcoin.seedNetTotals(sample.Bitcoin, sample.Timestamp)
+		}
+		for name, node := range sample.Nodes {
+			if collector := c.nodes[name]; collector != nil && node != nil {
+				collector.seedNetTotals(node, sample.Timestamp)
+			}
+		}
+	}
+}
+
+// RefreshUTXOStats runs gettxoutsetinfo on every node and caches the
+// results for later samples
+func (c *Collector) RefreshUTXOStats(ctx context.Context) error {
+	if c.demo != nil {
+		return nil // Simulated samples carry their own statistics
+	}
+	if !c.config.Bitcoin.Enabled && len(c.nodes) == 0 {
+		return fmt.Errorf("bitcoin collection is disabled")
+	}
+
+	var errs []error
+	if c.config.Bitcoin.Enabled {
+		errs = append(errs, c.bitcoin.RefreshUTXOStats(ctx))
+	}
+	for name, node := range c.nodes {
+		if node.utxo == nil {
+			continue // REST-only node
+		}
+		if err := node.RefreshUTXOStats(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases connections kept between collections
+func (c *Collector) Close() {
+	c.tor.Close()
+}
+
+// CheckOnionReachability probes the node's own onion service through Tor
+func (c *Collector) CheckOnionReachability(ctx context.Context) error {
+	if c.demo != nil {
+		return nil
+	}
+	if !c.config.Tor.Enabled {
+		return fmt.Errorf("tor collection is disabled")
+	}
+	return c.tor.CheckOnionReachability(ctx)
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	custom "github.com/bitcoin-node-manager/btc-node-monitor/pkg/collector"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// collectCustom runs the registered custom collectors concurrently and
+// stores their results in sample.Custom. Each collector gets at most timeout.
+func collectCustom(ctx context.Context, collectors []custom.Collector, sample *metrics.Sample, timeout time.Duration) {
+	if len(collectors) == 0 {
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]any, len(collectors))
+	)
+
+	for _, c := range collectors {
+		wg.Add(1)
+		go func(c custom.Collector) {
+			defer wg.Done()
+
+			value, err := runCustom(ctx, c, timeout)
+			if err != nil {
+				logger.Warn("Failed to collect custom metrics", "collector", c.Name(), "error", err)
+				return
+			}
+			if value == nil {
+				return
+			}
+
+			mu.Lock()
+			results[c.Name()] = value
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	if len(results) > 0 {
+		sample.Custom = results
+	}
+}
+
+// runCustom calls a collector, abandoning it if it ignores its deadline
+func runCustom(ctx context.Context, c custom.Collector, timeout time.Duration) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		value any
+		err   error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Collector panicked", "collector", c.Name(), "panic", r)
+				done <- result{}
+			}
+		}()
+		value, err := c.Collect(ctx)
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,301 @@
+package collector
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Simulated node and host parameters
+const (
+	demoStartTip       = 870000
+	demoIBDBacklog     = 25000                     // Blocks behind the tip at startup
+	demoIBDRate        = 40.0                      // Blocks validated per second during IBD
+	demoBlockInterval  = 10 * time.Minute          // Mean time between network blocks
+	demoMempoolPeriod  = 4 * time.Hour             // Period of the mempool inflow wave
+	demoBytesPerBlock  = 700 * 1000                // Average chain growth per block
+	demoMemoryTotal    = 16 << 30                  // 16 GiB
+	demoDiskTotal      = 2000 * 1000 * 1000 * 1000 // 2 TB
+	demoOtherDiskUsage = 50 * 1000 * 1000 * 1000   // OS, logs and the agent's own data
+	demoCores          = 4
+)
+
+// Simulator generates plausible Bitcoin, system and Tor metrics without a
+// node: the node starts in initial block download and catches up, the
+// mempool fills in waves and empties when blocks are found, and peers are
+// occasionally lost and reconnected. It is used by demo mode for UI
+// development and documentation screenshots.
+type Simulator struct {
+	rng       *rand.Rand
+	startTime time.Time
+	lastTime  time.Time
+
+	tip        int
+	height     float64
+	mempool    float64
+	inbound    int
+	dropCycles int // Remaining cycles of a simulated peer drop
+	blockFound bool
+	load       [3]float64
+	recvMonth  int64
+	sentMonth  int64
+	month      string
+	utxoCount  int64
+	utxoAmount float64
+	circuits   int
+}
+
+// NewSimulator creates a simulator whose node is partway through IBD
+func NewSimulator() *Simulator {
+	now := time.Now()
+	return &Simulator{
+		rng:        rand.New(rand.NewSource(now.UnixNano())),
+		startTime:  now,
+		lastTime:   now,
+		tip:        demoStartTip,
+		height:     demoStartTip - demoIBDBacklog,
+		inbound:    12,
+		utxoCount:  180_000_000,
+		utxoAmount: 19_800_000,
+		circuits:   10,
+	}
+}
+
+// Collect advances the simulation to now and returns a sample
+func (s *Simulator) Collect(now time.Time) *metrics.Sample {
+	dt := now.Sub(s.lastTime).Seconds()
+	if dt <= 0 {
+		dt = 1
+	}
+	s.lastTime = now
+
+	s.advanceChain(dt)
+	s.advanceMempool(now, dt)
+	s.advancePeers()
+
+	bitcoin := s.bitcoinMetrics(now, dt)
+	system := s.systemMetrics(now, dt, bitcoin)
+
+	return &metrics.Sample{
+		Timestamp: now.UTC(),
+		System:    system,
+		Bitcoin:   bitcoin,
+		Tor:       s.torMetrics(bitcoin),
+	}
+}
+
+// syncing reports whether the simulated node is still in IBD
+func (s *Simulator) syncing() bool {
+	return s.tip-int(s.height) > 6
+}
+
+// advanceChain finds network blocks as a Poisson process and validates
+// them, quickly while in IBD
+func (s *Simulator) advanceChain(dt float64) {
+	s.blockFound = false
+	if s.rng.Float64() < 1-math.Exp(-dt/demoBlockInterval.Seconds()) {
+		s.tip++
+		s.blockFound = true
+		s.utxoCount += int64(s.rng.Intn(20000) - 5000)
+		s.utxoAmount += 3.125
+	}
+
+	if s.syncing() {
+		s.height = math.Min(float64(s.tip), s.height+demoIBDRate*dt*(0.7+0.6*s.rng.Float64()))
+	} else {
+		s.height = float64(s.tip)
+	}
+}
+
+// advanceMempool adds transactions at a rate that rises and falls over a
+// few hours and removes a block's worth when one is found. A node in IBD does
+// not relay transactions.
+func (s *Simulator) advanceMempool(now time.Time, dt float64) {
+	if s.syncing() {
+		s.mempool = 0
+		return
+	}
+
+	phase := 2 * math.Pi * now.Sub(s.startTime).Seconds() / demoMempoolPeriod.Seconds()
+	rate := 7 + 5*math.Sin(phase) + s.rng.NormFloat64()
+	s.mempool += math.Max(0, rate) * dt
+
+	if s.blockFound {
+		s.mempool = math.Max(0, s.mempool-float64(3500+s.rng.Intn(2000)))
+	}
+}
+
+// advancePeers drifts the inbound count and occasionally drops most peers
+// for a few cycles
+func (s *Simulator) advancePeers() {
+	if s.dropCycles > 0 {
+		s.dropCycles--
+	} else if s.rng.Float64() < 0.01 {
+		s.dropCycles = 3 + s.rng.Intn(8)
+	}
+
+	s.inbound += s.rng.Intn(3) - 1
+	s.inbound = max(0, min(s.inbound, 40))
+
+	if s.circuits += s.rng.Intn(3) - 1; s.circuits < 6 || s.circuits > 16 {
+		s.circuits = 10
+	}
+}
+
+// bitcoinMetrics reports the simulated node state
+func (s *Simulator) bitcoinMetrics(now time.Time, dt float64) *metrics.BitcoinMetrics {
+	height := int(s.height)
+	syncing := s.syncing()
+
+	outbound, inbound := 10, s.inbound
+	if s.dropCycles > 0 {
+		outbound, inbound = s.rng.Intn(3), 0
+	}
+
+	latency := int64(2 + s.rng.Intn(8))
+	recvBPS := int64(50_000 + s.rng.Intn(250_000))
+	sentBPS := int64(100_000 + s.rng.Intn(400_000))
+	if syncing {
+		latency = int64(20 + s.rng.Intn(60))
+		recvBPS = int64(15_000_000 + s.rng.Intn(10_000_000))
+		sentBPS = int64(20_000 + s.rng.Intn(50_000))
+	}
+	if outbound == 0 {
+		recvBPS, sentBPS = 0, 0
+	}
+
+	if month := now.UTC().Format("2006-01"); month != s.month {
+		s.month = month
+		s.recvMonth, s.sentMonth = 0, 0
+	}
+	s.recvMonth += int64(float64(recvBPS) * dt)
+	s.sentMonth += int64(float64(sentBPS) * dt)
+
+	mempool := int(s.mempool)
+
+	m := &metrics.BitcoinMetrics{
+		BlockHeight:       height,
+		Headers:           s.tip,
+		SyncProgress:      math.Min(1, s.height/float64(s.tip)),
+		IBD:               syncing,
+		Peers:             outbound + inbound,
+		InboundPeers:      inbound,
+		OutboundPeers:     outbound,
+		InboundSlots:      defaultMaxConnections - outboundSlots,
+		MempoolTxCount:    mempool,
+		MempoolSizeBytes:  int64(mempool) * int64(420+s.rng.Intn(60)),
+		ChainSizeBytes:    int64(height) * demoBytesPerBlock,
+		UptimeSeconds:     int(now.Sub(s.startTime).Seconds()) + 86400,
+		RPCLatencyMs:      latency,
+		Chain:             "main",
+		NetRecvBPS:        recvBPS,
+		NetSentBPS:        sentBPS,
+		NetRecvMonthBytes: s.recvMonth,
+		NetSentMonthBytes: s.sentMonth,
+		RPCMethodLatency: map[string]metrics.RPCLatencyStats{
+			"getblockchaininfo": {LastMs: latency, P50Ms: latency, P95Ms: latency * 2, Samples: 60},
+			"getnetworkinfo":    {LastMs: latency / 2, P50Ms: latency / 2, P95Ms: latency, Samples: 60},
+		},
+	}
+
+	m.InboundSlotsUsedPercent = float64(inbound) / float64(m.InboundSlots) * 100
+
+	m.State = metrics.NodeStateSteady
+	if syncing {
+		m.State = metrics.NodeStateIBD
+	}
+
+	if !syncing {
+		m.UTXOCount = s.utxoCount
+		m.UTXOTotalAmount = s.utxoAmount
+		m.UTXODiskSizeBytes = s.utxoCount * 60
+		m.UTXOStatsHeight = height
+	}
+
+	return m
+}
+
+// systemMetrics reports host load consistent with the node's activity
+func (s *Simulator) systemMetrics(now time.Time, dt float64, b *metrics.BitcoinMetrics) *metrics.SystemMetrics {
+	cpu := 3 + 10*s.rng.Float64()
+	memory := int64(4<<30) + int64(s.rng.Intn(512<<20))
+	writeBPS := int64(200_000 + s.rng.Intn(800_000))
+	readBPS := int64(100_000 + s.rng.Intn(400_000))
+	switch {
+	case b.IBD:
+		cpu = 70 + 25*s.rng.Float64()
+		memory = int64(9<<30) + int64(s.rng.Intn(1<<30)) // Large dbcache during IBD
+		writeBPS = int64(60_000_000 + s.rng.Intn(40_000_000))
+		readBPS = int64(10_000_000 + s.rng.Intn(10_000_000))
+	case s.blockFound:
+		cpu = 35 + 15*s.rng.Float64()
+		writeBPS = int64(20_000_000 + s.rng.Intn(10_000_000))
+	}
+
+	// Exponentially smoothed load averages over 1, 5 and 15 minutes
+	for i, window := range []float64{60, 300, 900} {
+		alpha := 1 - math.Exp(-dt/window)
+		s.load[i] += alpha * (cpu/100*demoCores - s.load[i])
+	}
+
+	diskUsed := b.ChainSizeBytes + demoOtherDiskUsage
+
+	return &metrics.SystemMetrics{
+		CPUPercent:       math.Round(cpu*10) / 10,
+		MemoryUsedBytes:  memory,
+		MemoryTotalBytes: demoMemoryTotal,
+		MemoryAvailBytes: demoMemoryTotal - memory,
+		DiskUsedBytes:    diskUsed,
+		DiskTotalBytes:   demoDiskTotal,
+		DiskAvailBytes:   demoDiskTotal - diskUsed,
+		DiskReadBPS:      readBPS,
+		DiskWriteBPS:     writeBPS,
+		NetRxBPS:         b.NetRecvBPS + int64(s.rng.Intn(20_000)),
+		NetTxBPS:         b.NetSentBPS + int64(s.rng.Intn(20_000)),
+		LoadAvg1m:        math.Round(s.load[0]*100) / 100,
+		LoadAvg5m:        math.Round(s.load[1]*100) / 100,
+		LoadAvg15m:       math.Round(s.load[2]*100) / 100,
+		UptimeSeconds:    int64(now.Sub(s.startTime).Seconds()) + 7*86400,
+		CPUTemperatureC:  math.Round((42+0.35*cpu+2*s.rng.Float64())*10) / 10,
+	}
+}
+
+// torMetrics reports a healthy Tor daemon carrying part of the node's traffic
+func (s *Simulator) torMetrics(b *metrics.BitcoinMetrics) *metrics.TorMetrics {
+	established := s.circuits - s.rng.Intn(2)
+	reachable := b.OutboundPeers > 0 // Peer drops double as network outages
+	authenticated := true
+	bootstrapped := 100
+
+	m := &metrics.TorMetrics{
+		ControlReachable:   true,
+		CircuitCount:       s.circuits,
+		EstablishedCount:   established,
+		BandwidthReadBPS:   b.NetRecvBPS * 3 / 10,
+		BandwidthWriteBPS:  b.NetSentBPS * 3 / 10,
+		OnionServices:      1,
+		ControlLatencyMs:   int64(1 + s.rng.Intn(3)),
+		OnionSelfReachable: &reachable,
+		Authenticated:      &authenticated,
+		AuthStatus:         "ok",
+		BootstrapProgress:  &bootstrapped,
+		BootstrapTag:       "done",
+		CircuitEstablished: &reachable,
+		Purposes: map[string]*metrics.TorPurposeStats{
+			// Three introduction circuits and one rendezvous for the node's
+			// onion service; the rest carry outbound peers
+			"general":    {Circuits: s.circuits - 4, Established: established - 4, Streams: b.OutboundPeers / 2},
+			"hs_client":  {},
+			"hs_service": {Circuits: 4, Established: 4, Streams: 1},
+			"other":      {},
+		},
+	}
+	if reachable {
+		m.OnionSelfLatencyMs = int64(1500 + s.rng.Intn(3000))
+	} else {
+		m.OnionSelfError = "SOCKS connect failed: onion service introduction timed out"
+	}
+	return m
+}
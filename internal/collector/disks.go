@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// diskUsage returns space and inode usage for each path's filesystem.
+// Paths that cannot be read are left out and logged at debug level, since a
+// removable or network mount may come and go.
+func diskUsage(paths []string) map[string]metrics.DiskUsage {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	// Partitions only need listing once per collection for all paths
+	partitions, _ := disk.Partitions(true)
+
+	usage := make(map[string]metrics.DiskUsage, len(paths))
+	for _, path := range paths {
+		stat, err := disk.Usage(path)
+		if err != nil {
+			logger.Debug("Failed to get disk usage", "path", path, "error", err)
+			continue
+		}
+
+		usage[path] = metrics.DiskUsage{
+			Mountpoint:        mountpointOf(path, partitions),
+			Fstype:            stat.Fstype,
+			UsedBytes:         int64(stat.Used),
+			TotalBytes:        int64(stat.Total),
+			AvailBytes:        int64(stat.Free),
+			UsedPercent:       stat.UsedPercent,
+			InodesUsed:        int64(stat.InodesUsed),
+			InodesTotal:       int64(stat.InodesTotal),
+			InodesFree:        int64(stat.InodesFree),
+			InodesUsedPercent: stat.InodesUsedPercent,
+		}
+	}
+	return usage
+}
+
+// mountpointOf returns the deepest mount point containing path, so two
+// configured paths on the same filesystem can be told apart from two disks
+func mountpointOf(path string, partitions []disk.PartitionStat) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	var best string
+	for _, p := range partitions {
+		mount := p.Mountpoint
+		if !withinMount(path, mount) || len(mount) <= len(best) {
+			continue
+		}
+		best = mount
+	}
+	return best
+}
+
+// withinMount reports whether path is mount or below it
+func withinMount(path, mount string) bool {
+	if path == mount || mount == "/" {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(mount, string(filepath.Separator))+string(filepath.Separator))
+}
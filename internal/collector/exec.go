@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxExecOutput bounds the stdout read from an exec collector
+const maxExecOutput = 1 << 20
+
+// ExecCollector runs an operator-supplied command each cycle and records
+// the JSON it prints under Sample.Custom[name]
+type ExecCollector struct {
+	name    string
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+// NewExecCollector creates an exec collector; a zero timeout leaves the
+// collection interval as the only limit
+func NewExecCollector(name, command string, args []string, timeoutSeconds int) *ExecCollector {
+	return &ExecCollector{
+		name:    name,
+		command: command,
+		args:    args,
+		timeout: time.Duration(timeoutSeconds) * time.Second,
+	}
+}
+
+// Name returns the collector name
+func (e *ExecCollector) Name() string {
+	return e.name
+}
+
+// Collect runs the command and decodes its stdout as JSON
+func (e *ExecCollector) Collect(ctx context.Context) (any, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, e.command, e.args...)
+
+	var stdout limitedBuffer
+	var stderr bytes.Buffer
+	stdout.limit = maxExecOutput
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("command timed out: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("command failed: %w, stderr: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("output exceeds %d bytes", maxExecOutput)
+	}
+
+	var value any
+	if err := json.Unmarshal(stdout.Bytes(), &value); err != nil {
+		return nil, fmt.Errorf("output is not JSON: %w", err)
+	}
+
+	return value, nil
+}
+
+// limitedBuffer collects up to limit bytes, discarding the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write implements io.Writer; it never fails so the command is not killed
+// by a broken pipe
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.Len(); remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			b.Buffer.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,149 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// externalTipMaxAge is how many refresh intervals an explorer height is
+// reused for while the explorer cannot be reached
+const externalTipMaxAge = 10
+
+// ExternalTip reports the best block height known independently of the
+// local node, from another configured node or a block explorer. A node
+// partitioned from the network keeps its peers and looks synced to itself;
+// only an outside view shows that it has stopped seeing new blocks.
+type ExternalTip struct {
+	source  string // "node" or "explorer"
+	node    string // Name of a bitcoin_nodes entry
+	url     string // Explorer API base
+	client  *http.Client
+	refresh time.Duration
+
+	mu        sync.Mutex
+	height    int
+	fetchedAt time.Time
+	lastErr   string // Last explorer error, logged once
+	mismatch  bool   // Chain mismatch with the other node was logged
+}
+
+// NewExternalTip creates a tip source that reaches the explorer through
+// dialer
+func NewExternalTip(cfg config.ExternalTipConfig, dialer *netproxy.Dialer) *ExternalTip {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+
+	return &ExternalTip{
+		source:  cfg.Source,
+		node:    cfg.Node,
+		url:     strings.TrimSuffix(cfg.URL, "/"),
+		client:  &http.Client{Timeout: timeout, Transport: dialer.Transport()},
+		refresh: time.Duration(cfg.RefreshSeconds) * time.Second,
+	}
+}
+
+// Apply sets the external tip height on the sample's primary node metrics
+func (t *ExternalTip) Apply(ctx context.Context, sample *metrics.Sample) {
+	if sample.Bitcoin == nil {
+		return
+	}
+
+	var height int
+	switch t.source {
+	case "node":
+		height = t.fromNode(sample)
+	default:
+		height = t.fromExplorer(ctx)
+	}
+
+	sample.Bitcoin.ExternalTipHeight = height
+}
+
+// fromNode returns the other node's best header height, or 0 if it was not
+// collected or follows a different chain
+func (t *ExternalTip) fromNode(sample *metrics.Sample) int {
+	other := sample.Nodes[t.node]
+	if other == nil {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if other.Chain != sample.Bitcoin.Chain {
+		if !t.mismatch {
+			logger.Warn("External tip node is on a different chain, ignoring it",
+				"node", t.node, "chain", other.Chain, "local_chain", sample.Bitcoin.Chain)
+			t.mismatch = true
+		}
+		return 0
+	}
+	t.mismatch = false
+
+	return max(other.Headers, other.BlockHeight)
+}
+
+// fromExplorer returns the explorer's tip height, fetching it at most once
+// per refresh interval. A recent height is reused while the explorer is
+// unreachable.
+func (t *ExternalTip) fromExplorer(ctx context.Context) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.fetchedAt.IsZero() && time.Since(t.fetchedAt) < t.refresh {
+		return t.height
+	}
+
+	height, err := t.fetchHeight(ctx)
+	if err != nil {
+		if err.Error() != t.lastErr {
+			logger.Warn("Failed to fetch external tip height", "url", t.url, "error", err)
+			t.lastErr = err.Error()
+		}
+		if time.Since(t.fetchedAt) > externalTipMaxAge*t.refresh {
+			t.height = 0
+		}
+		return t.height
+	}
+
+	t.height, t.fetchedAt, t.lastErr = height, time.Now(), ""
+	return height
+}
+
+// fetchHeight queries an Esplora-compatible API, such as mempool.space or
+// Blockstream's, for the tip height
+func (t *ExternalTip) fetchHeight(ctx context.Context) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url+"/blocks/tip/height", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("explorer returned %s", resp.Status)
+	}
+
+	height, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected tip height %q", strings.TrimSpace(string(body)))
+	}
+	return height, nil
+}
@@ -0,0 +1,359 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Component health values, following Redfish's Status.Health
+const (
+	healthOK       = "OK"
+	healthWarning  = "Warning"
+	healthCritical = "Critical"
+)
+
+// HardwareCollector polls a BMC over Redfish, or the local BMC through
+// ipmitool, for fan, power supply and temperature health. BMCs are slow,
+// so results are reused until the poll interval has passed.
+type HardwareCollector struct {
+	source       string // "redfish" or "ipmi"
+	redfishURL   string
+	username     string
+	password     string
+	ipmitoolPath string
+	ipmitoolArgs []string
+	timeout      time.Duration
+	interval     time.Duration
+	httpClient   *http.Client
+
+	mu       sync.Mutex
+	last     *metrics.HardwareMetrics
+	lastPoll time.Time
+}
+
+// NewHardwareCollector creates a hardware health collector
+func NewHardwareCollector(cfg config.HardwareConfig) *HardwareCollector {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.InsecureTLS {
+		// BMCs commonly ship self-signed certificates
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &HardwareCollector{
+		source:       cfg.Source,
+		redfishURL:   strings.TrimSuffix(cfg.RedfishURL, "/"),
+		username:     cfg.Username,
+		password:     cfg.Password,
+		ipmitoolPath: cfg.IPMIToolPath,
+		ipmitoolArgs: cfg.IPMIToolArgs,
+		timeout:      timeout,
+		interval:     time.Duration(cfg.PollIntervalSeconds) * time.Second,
+		httpClient:   &http.Client{Timeout: timeout, Transport: transport},
+	}
+}
+
+// Collect returns hardware health, polling the BMC if the last result is stale
+func (c *HardwareCollector) Collect(ctx context.Context) (*metrics.HardwareMetrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last != nil && time.Since(c.lastPoll) < c.interval {
+		return c.last, nil
+	}
+
+	var m *metrics.HardwareMetrics
+	var err error
+	switch c.source {
+	case "ipmi":
+		m, err = c.collectIPMI(ctx)
+	default:
+		m, err = c.collectRedfish(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	summarizeHardware(m)
+	c.last = m
+	c.lastPoll = time.Now()
+
+	return m, nil
+}
+
+// summarizeHardware fills the fault count, worst health and hottest reading
+func summarizeHardware(m *metrics.HardwareMetrics) {
+	worst := healthOK
+	note := func(health string) {
+		switch health {
+		case healthOK, "":
+			return
+		case healthCritical:
+			worst = healthCritical
+		default:
+			if worst != healthCritical {
+				worst = healthWarning
+			}
+		}
+		m.Faults++
+	}
+
+	for _, fan := range m.Fans {
+		note(fan.Health)
+	}
+	for _, psu := range m.PowerSupplies {
+		note(psu.Health)
+	}
+	for _, temp := range m.Temperatures {
+		note(temp.Health)
+		if temp.Celsius > m.MaxTemperatureC {
+			m.MaxTemperatureC = temp.Celsius
+		}
+	}
+
+	if m.ChassisHealth == "" {
+		m.ChassisHealth = worst
+	} else if m.ChassisHealth != healthOK {
+		m.Faults++
+	}
+}
+
+// redfishStatus is the common Status object of Redfish resources
+type redfishStatus struct {
+	Health string `json:"Health"`
+	State  string `json:"State"`
+}
+
+// redfishLink is a reference to another resource
+type redfishLink struct {
+	ID string `json:"@odata.id"`
+}
+
+// collectRedfish walks every chassis' Thermal and Power resources
+func (c *HardwareCollector) collectRedfish(ctx context.Context) (*metrics.HardwareMetrics, error) {
+	var collection struct {
+		Members []redfishLink `json:"Members"`
+	}
+	if err := c.redfishGet(ctx, "/redfish/v1/Chassis", &collection); err != nil {
+		return nil, err
+	}
+
+	m := &metrics.HardwareMetrics{Source: "redfish"}
+	worstChassis := healthOK
+
+	for _, member := range collection.Members {
+		var chassis struct {
+			Status  redfishStatus `json:"Status"`
+			Thermal redfishLink   `json:"Thermal"`
+			Power   redfishLink   `json:"Power"`
+		}
+		if err := c.redfishGet(ctx, member.ID, &chassis); err != nil {
+			return nil, err
+		}
+
+		switch chassis.Status.Health {
+		case healthCritical:
+			worstChassis = healthCritical
+		case healthWarning:
+			if worstChassis != healthCritical {
+				worstChassis = healthWarning
+			}
+		}
+
+		if chassis.Thermal.ID != "" {
+			var thermal struct {
+				Fans []struct {
+					Name         string        `json:"Name"`
+					Reading      *float64      `json:"Reading"`
+					ReadingUnits string        `json:"ReadingUnits"`
+					Status       redfishStatus `json:"Status"`
+				} `json:"Fans"`
+				Temperatures []struct {
+					Name           string        `json:"Name"`
+					ReadingCelsius *float64      `json:"ReadingCelsius"`
+					Status         redfishStatus `json:"Status"`
+				} `json:"Temperatures"`
+			}
+			if err := c.redfishGet(ctx, chassis.Thermal.ID, &thermal); err != nil {
+				return nil, err
+			}
+
+			for _, fan := range thermal.Fans {
+				if fan.Status.State == "Absent" {
+					continue
+				}
+				status := metrics.FanStatus{Name: fan.Name, Health: fan.Status.Health}
+				if fan.Reading != nil && (fan.ReadingUnits == "" || fan.ReadingUnits == "RPM") {
+					status.RPM = int(*fan.Reading)
+				}
+				m.Fans = append(m.Fans, status)
+			}
+			for _, temp := range thermal.Temperatures {
+				if temp.Status.State == "Absent" || temp.ReadingCelsius == nil {
+					continue
+				}
+				m.Temperatures = append(m.Temperatures, metrics.TemperatureReading{
+					Name:    temp.Name,
+					Celsius: *temp.ReadingCelsius,
+					Health:  temp.Status.Health,
+				})
+			}
+		}
+
+		if chassis.Power.ID != "" {
+			var power struct {
+				PowerSupplies []struct {
+					Name   string        `json:"Name"`
+					Status redfishStatus `json:"Status"`
+				} `json:"PowerSupplies"`
+			}
+			if err := c.redfishGet(ctx, chassis.Power.ID, &power); err != nil {
+				return nil, err
+			}
+
+			for _, psu := range power.PowerSupplies {
+				if psu.Status.State == "Absent" {
+					continue
+				}
+				m.PowerSupplies = append(m.PowerSupplies, metrics.PowerSupplyStatus{
+					Name:   psu.Name,
+					Health: psu.Status.Health,
+					State:  psu.Status.State,
+				})
+			}
+		}
+	}
+
+	m.ChassisHealth = worstChassis
+	return m, nil
+}
+
+// redfishGet fetches a Redfish resource by path
+func (c *HardwareCollector) redfishGet(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.redfishURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("redfish %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("redfish %s: %s", path, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(v)
+}
+
+// collectIPMI reads the sensor repository with "ipmitool -c sdr list full",
+// whose CSV rows are name,value,unit,status
+func (c *HardwareCollector) collectIPMI(ctx context.Context) (*metrics.HardwareMetrics, error) {
+	args := append(append([]string{}, c.ipmitoolArgs...), "-c", "sdr", "list", "full")
+	cmd := exec.Command(c.ipmitoolPath, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("ipmitool failed: %w, stderr: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	case <-time.After(c.timeout):
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("ipmitool timed out after %v", c.timeout)
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		return nil, ctx.Err()
+	}
+
+	return parseIPMISensors(stdout.Bytes())
+}
+
+// parseIPMISensors classifies ipmitool CSV sensor rows
+func parseIPMISensors(output []byte) (*metrics.HardwareMetrics, error) {
+	reader := csv.NewReader(bytes.NewReader(output))
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ipmitool output: %w", err)
+	}
+
+	m := &metrics.HardwareMetrics{Source: "ipmi"}
+	for _, row := range rows {
+		if len(row) < 4 {
+			continue
+		}
+		name, value, unit, status := strings.TrimSpace(row[0]), strings.TrimSpace(row[1]), strings.TrimSpace(row[2]), strings.TrimSpace(row[3])
+
+		health, present := ipmiHealth(status)
+		if !present {
+			continue
+		}
+
+		reading, numeric := strconv.ParseFloat(value, 64)
+		lowerName := strings.ToLower(name)
+
+		switch {
+		case unit == "RPM":
+			fan := metrics.FanStatus{Name: name, Health: health}
+			if numeric == nil {
+				fan.RPM = int(reading)
+			}
+			m.Fans = append(m.Fans, fan)
+		case unit == "degrees C" && numeric == nil:
+			m.Temperatures = append(m.Temperatures, metrics.TemperatureReading{Name: name, Celsius: reading, Health: health})
+		case strings.HasPrefix(lowerName, "ps") || strings.Contains(lowerName, "power supply") || strings.Contains(lowerName, "psu"):
+			if unit == "discrete" || unit == "" {
+				m.PowerSupplies = append(m.PowerSupplies, metrics.PowerSupplyStatus{Name: name, Health: health})
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// ipmiHealth maps an ipmitool sensor status to a health value; "ns" (no
+// reading) sensors are reported as not present
+func ipmiHealth(status string) (string, bool) {
+	switch strings.ToLower(status) {
+	case "ok":
+		return healthOK, true
+	case "ns", "":
+		return "", false
+	case "nc", "lnc", "unc":
+		return healthWarning, true
+	default: // cr, lcr, ucr, nr, lnr, unr
+		return healthCritical, true
+	}
+}
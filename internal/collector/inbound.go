@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+const (
+	// defaultMaxConnections is Bitcoin Core's -maxconnections default
+	defaultMaxConnections = 125
+
+	// outboundSlots are reserved from maxconnections for automatic outbound
+	// connections: 8 full-relay, 2 block-relay-only and 1 feeler
+	outboundSlots = 11
+)
+
+// SetMaxConnections sets the node's -maxconnections. 0 reads it from
+// bitcoin.conf in the data directory, falling back to Core's default.
+func (c *BitcoinCollector) SetMaxConnections(maxConnections int) {
+	c.maxConnections = maxConnections
+}
+
+// updateInboundSlots sets the number of inbound slots and how many are in
+// use. maxconnections comes from getnetworkinfo when the node reports it,
+// otherwise from configuration or bitcoin.conf.
+func (c *BitcoinCollector) updateInboundSlots(m *metrics.BitcoinMetrics, networkInfo map[string]interface{}) {
+	maxConnections := c.maxConnections
+	if reported, ok := networkInfo["maxconnections"].(float64); ok {
+		maxConnections = int(reported)
+	}
+	if maxConnections == 0 {
+		if !c.confRead {
+			c.confMaxConnections = readMaxConnections(c.dataDir, m.Chain)
+			c.confRead = true
+		}
+		maxConnections = c.confMaxConnections
+	}
+
+	m.InboundSlots = max(0, maxConnections-outboundSlots)
+	if m.InboundSlots > 0 {
+		m.InboundSlotsUsedPercent = float64(m.InboundPeers) / float64(m.InboundSlots) * 100
+	}
+}
+
+// readMaxConnections returns maxconnections from bitcoin.conf, honouring
+// the section for chain, or Core's default if it is not set or the file
+// cannot be read
+func readMaxConnections(dataDir, chain string) int {
+	file, err := os.Open(filepath.Join(dataDir, "bitcoin.conf"))
+	if err != nil {
+		return defaultMaxConnections
+	}
+	defer file.Close()
+
+	// A setting for the chain overrides the global one
+	global, forChain := -1, -1
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value, _, _ = strings.Cut(value, "#")
+
+		// Options can be scoped by a [chain] section or a chain. prefix
+		scope := section
+		key = strings.TrimSpace(key)
+		if prefix, option, prefixed := strings.Cut(key, "."); prefixed {
+			scope, key = prefix, option
+		}
+		if key != "maxconnections" || (scope != "" && scope != chain) {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			continue
+		}
+		if scope == "" {
+			global = n
+		} else {
+			forChain = n
+		}
+	}
+
+	switch {
+	case forChain >= 0:
+		return forChain
+	case global >= 0:
+		return global
+	default:
+		return defaultMaxConnections
+	}
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// latencyWindowSize is the number of recent calls kept per RPC method
+const latencyWindowSize = 100
+
+// latencyTracker keeps a rolling window of call durations per RPC method
+type latencyTracker struct {
+	mu      sync.Mutex
+	windows map[string][]int64 // method -> ring of durations in ms
+	next    map[string]int     // method -> next ring slot to overwrite
+	last    map[string]int64   // method -> most recent duration in ms
+}
+
+// newLatencyTracker creates an empty latency tracker
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		windows: make(map[string][]int64),
+		next:    make(map[string]int),
+		last:    make(map[string]int64),
+	}
+}
+
+// Record adds a call duration for a method
+func (t *latencyTracker) Record(method string, d time.Duration) {
+	ms := d.Milliseconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.last[method] = ms
+
+	window := t.windows[method]
+	if len(window) < latencyWindowSize {
+		t.windows[method] = append(window, ms)
+		return
+	}
+
+	window[t.next[method]] = ms
+	t.next[method] = (t.next[method] + 1) % latencyWindowSize
+}
+
+// Snapshot returns rolling percentiles for every method seen so far
+func (t *latencyTracker) Snapshot() map[string]metrics.RPCLatencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.windows) == 0 {
+		return nil
+	}
+
+	stats := make(map[string]metrics.RPCLatencyStats, len(t.windows))
+	for method, window := range t.windows {
+		sorted := make([]int64, len(window))
+		copy(sorted, window)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		stats[method] = metrics.RPCLatencyStats{
+			LastMs:  t.last[method],
+			P50Ms:   percentile(sorted, 0.50),
+			P95Ms:   percentile(sorted, 0.95),
+			Samples: len(sorted),
+		}
+	}
+
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of an ascending slice
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
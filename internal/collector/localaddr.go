@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"net"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// SetAdvertiseNetworks sets the networks the node is expected to advertise
+// a local address on, such as "onion"
+func (c *BitcoinCollector) SetAdvertiseNetworks(networks []string) {
+	c.advertise = networks
+}
+
+// updateLocalAddresses records the node's advertised addresses and checks
+// each expected network is among them. Onion addresses that stop being
+// advertised are logged, since a Tor restart that lost the service key
+// silently moves the node to a new address.
+func (c *BitcoinCollector) updateLocalAddresses(m *metrics.BitcoinMetrics, networkInfo map[string]interface{}) {
+	entries, _ := networkInfo["localaddresses"].([]interface{})
+	onions := make(map[string]bool)
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _ := fields["address"].(string)
+		if address == "" {
+			continue
+		}
+		port, _ := fields["port"].(float64)
+		score, _ := fields["score"].(float64)
+
+		local := metrics.LocalAddress{
+			Address: address,
+			Port:    int(port),
+			Score:   int(score),
+			Network: addressNetwork(address),
+		}
+		m.LocalAddresses = append(m.LocalAddresses, local)
+		if local.Network == "onion" {
+			onions[address] = true
+		}
+	}
+
+	for address := range c.lastOnions {
+		if !onions[address] {
+			logger.Warn("Onion address is no longer advertised", "address", address)
+		}
+	}
+	c.lastOnions = onions
+
+	if len(c.advertise) == 0 {
+		return
+	}
+
+	reachable := make(map[string]bool)
+	networks, _ := networkInfo["networks"].([]interface{})
+	for _, entry := range networks {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := fields["name"].(string)
+		reachable[name], _ = fields["reachable"].(bool)
+	}
+
+	m.Advertised = make(map[string]metrics.AdvertisedNetwork, len(c.advertise))
+	for _, network := range c.advertise {
+		advertised := metrics.AdvertisedNetwork{Reachable: reachable[network]}
+		for _, local := range m.LocalAddresses {
+			if local.Network == network {
+				advertised.Listed = true
+				advertised.Score = max(advertised.Score, local.Score)
+			}
+		}
+		m.Advertised[network] = advertised
+	}
+}
+
+// addressNetwork classifies a local address the way getnetworkinfo names
+// networks
+func addressNetwork(address string) string {
+	switch {
+	case strings.HasSuffix(address, ".onion"):
+		return "onion"
+	case strings.HasSuffix(address, ".i2p"):
+		return "i2p"
+	}
+
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return "unknown"
+	case ip.To4() != nil:
+		return "ipv4"
+	case ip[0] == 0xfc: // CJDNS uses fc00::/8
+		return "cjdns"
+	default:
+		return "ipv6"
+	}
+}
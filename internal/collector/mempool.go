@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// mempoolSnapshotMinInterval is how long a computed snapshot is served to
+// later requests. getrawmempool serializes the whole mempool, which takes
+// the node a noticeable while when it is full.
+const mempoolSnapshotMinInterval = 10 * time.Second
+
+// projectedBlockVSize is the space for transactions in one block
+const projectedBlockVSize = 1_000_000
+
+// projectedBlockCount is how many upcoming blocks a snapshot projects
+const projectedBlockCount = 3
+
+// feeBucketEdges are the lower bounds of the fee-rate buckets, in sat/vB.
+// The last bucket is open-ended.
+var feeBucketEdges = []float64{0, 1, 2, 3, 4, 5, 6, 8, 10, 12, 15, 20, 30, 40, 50, 70, 100, 150, 200, 300, 500, 1000}
+
+// mempoolSnapshotCache rate-limits snapshots; its mutex also makes
+// concurrent requests wait for one computation instead of starting their own
+type mempoolSnapshotCache struct {
+	mu       sync.Mutex
+	snapshot *metrics.MempoolSnapshot
+}
+
+// mempoolEntry is the part of a verbose getrawmempool entry the snapshot uses
+type mempoolEntry struct {
+	VSize int64 `json:"vsize"`
+	Fees  struct {
+		Base float64 `json:"base"` // BTC
+	} `json:"fees"`
+}
+
+// MempoolSnapshot returns the fee distribution of the primary node's
+// mempool, computed now unless the last one is recent enough
+func (c *Collector) MempoolSnapshot(ctx context.Context) (*metrics.MempoolSnapshot, error) {
+	if c.demo != nil {
+		return nil, fmt.Errorf("no node to query in demo mode")
+	}
+	if !c.config.Bitcoin.Enabled {
+		return nil, fmt.Errorf("bitcoin collection is disabled")
+	}
+
+	cache := &c.mempoolSnapshot
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.snapshot != nil && time.Since(cache.snapshot.ComputedAt) < mempoolSnapshotMinInterval {
+		return cache.snapshot, nil
+	}
+
+	snapshot, err := c.bitcoin.MempoolSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cache.snapshot = snapshot
+	return snapshot, nil
+}
+
+// MempoolSnapshot fetches the verbose mempool and computes its fee
+// distribution
+func (c *BitcoinCollector) MempoolSnapshot(ctx context.Context) (*metrics.MempoolSnapshot, error) {
+	var output []byte
+	var err error
+	if c.transport == "rest" {
+		output, err = c.restGet(ctx, "/rest/mempool/contents.json")
+	} else {
+		output, err = c.call(ctx, "getrawmempool", "true")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]mempoolEntry
+	if err := json.Unmarshal(output, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse getrawmempool: %w", err)
+	}
+	return computeMempoolSnapshot(entries, time.Now().UTC()), nil
+}
+
+// feeTx is a mempool transaction reduced to what the distribution needs
+type feeTx struct {
+	vsize   int64
+	fee     int64 // sat
+	feeRate float64
+}
+
+// computeMempoolSnapshot buckets transactions by fee rate and fills the
+// projected blocks highest fee rate first. Packages are not considered, so
+// a child paying for its parent is placed by its own fee rate.
+func computeMempoolSnapshot(entries map[string]mempoolEntry, now time.Time) *metrics.MempoolSnapshot {
+	snapshot := &metrics.MempoolSnapshot{ComputedAt: now, ProjectedBlocks: []metrics.ProjectedBlock{}}
+
+	for i, edge := range feeBucketEdges {
+		bucket := metrics.FeeBucket{MinFeeRate: edge}
+		if i+1 < len(feeBucketEdges) {
+			bucket.MaxFeeRate = feeBucketEdges[i+1]
+		}
+		snapshot.Buckets = append(snapshot.Buckets, bucket)
+	}
+
+	txs := make([]feeTx, 0, len(entries))
+	for _, entry := range entries {
+		if entry.VSize <= 0 {
+			continue
+		}
+		tx := feeTx{vsize: entry.VSize, fee: int64(math.Round(entry.Fees.Base * 1e8))}
+		tx.feeRate = float64(tx.fee) / float64(tx.vsize)
+		txs = append(txs, tx)
+
+		snapshot.TxCount++
+		snapshot.VSizeBytes += tx.vsize
+		snapshot.TotalFeeSat += tx.fee
+
+		i := sort.SearchFloat64s(feeBucketEdges, tx.feeRate)
+		if i == len(feeBucketEdges) || feeBucketEdges[i] > tx.feeRate {
+			i--
+		}
+		bucket := &snapshot.Buckets[i]
+		bucket.TxCount++
+		bucket.VSizeBytes += tx.vsize
+		bucket.TotalFeeSat += tx.fee
+	}
+
+	sort.Slice(txs, func(i, j int) bool { return txs[i].feeRate > txs[j].feeRate })
+
+	var block *metrics.ProjectedBlock
+	var rates []float64
+	finish := func() {
+		if block != nil {
+			block.MedianFeeRate = rates[len(rates)/2]
+			snapshot.ProjectedBlocks = append(snapshot.ProjectedBlocks, *block)
+		}
+	}
+	for _, tx := range txs {
+		if block == nil || block.VSizeBytes+tx.vsize > projectedBlockVSize {
+			finish()
+			if len(snapshot.ProjectedBlocks) == projectedBlockCount {
+				block = nil
+				break
+			}
+			block, rates = &metrics.ProjectedBlock{}, nil
+		}
+		block.TxCount++
+		block.VSizeBytes += tx.vsize
+		block.TotalFeeSat += tx.fee
+		block.MinFeeRate = tx.feeRate
+		rates = append(rates, tx.feeRate)
+	}
+	finish()
+
+	return snapshot
+}
@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// MempoolSpaceCollector checks that a self-hosted mempool.space instance
+// answers and keeps up with the node it is backed by. Its backend indexes
+// blocks after bitcoind sees them, so a stuck or crashed indexer shows up
+// as a growing lag while the web UI still loads.
+type MempoolSpaceCollector struct {
+	url    string // API base
+	node   string // bitcoin_nodes entry backing the instance; "" for the primary node
+	client *http.Client
+
+	mu      sync.Mutex
+	lastErr string // Last error, logged once
+}
+
+// NewMempoolSpaceCollector creates a collector for the instance in cfg,
+// reached through dialer
+func NewMempoolSpaceCollector(cfg config.MempoolSpaceConfig, dialer *netproxy.Dialer) *MempoolSpaceCollector {
+	return &MempoolSpaceCollector{
+		url:  strings.TrimSuffix(cfg.URL, "/"),
+		node: cfg.Node,
+		client: &http.Client{
+			Timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+			Transport: dialer.Transport(),
+		},
+	}
+}
+
+// Apply queries the instance's tip height and sets sample.MempoolSpace,
+// comparing it with the backing node's height already in the sample
+func (c *MempoolSpaceCollector) Apply(ctx context.Context, sample *metrics.Sample) {
+	m := &metrics.MempoolSpaceMetrics{}
+
+	start := time.Now()
+	height, err := c.tipHeight(ctx)
+	m.APILatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	c.mu.Lock()
+	if err != nil && err.Error() != c.lastErr {
+		logger.Warn("Failed to query mempool.space instance", "url", c.url, "error", err)
+	} else if err == nil && c.lastErr != "" {
+		logger.Info("mempool.space instance recovered", "url", c.url)
+	}
+	c.lastErr = ""
+	if err != nil {
+		c.lastErr = err.Error()
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		m.Error = err.Error()
+		sample.MempoolSpace = m
+		return
+	}
+
+	m.Reachable = true
+	m.TipHeight = height
+
+	node := sample.Bitcoin
+	if c.node != "" {
+		node = sample.Nodes[c.node]
+	}
+	if node != nil && node.BlockHeight > 0 {
+		lag := node.BlockHeight - height
+		m.BackendLagBlocks = &lag
+	}
+
+	sample.MempoolSpace = m
+}
+
+// tipHeight fetches the height of the instance's best block
+func (c *MempoolSpaceCollector) tipHeight(ctx context.Context) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/blocks/tip/height", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("mempool.space returned %s", resp.Status)
+	}
+
+	height, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected tip height %q", strings.TrimSpace(string(body)))
+	}
+	return height, nil
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// pressureDir holds the kernel's pressure stall information files
+const pressureDir = "/proc/pressure"
+
+// readPressure returns CPU, memory and IO pressure, or nil on systems
+// without PSI (non-Linux, kernels before 4.20, or booted with psi=0)
+func readPressure() *metrics.PressureMetrics {
+	memory, err := readPressureFile(filepath.Join(pressureDir, "memory"))
+	if err != nil {
+		return nil
+	}
+
+	p := &metrics.PressureMetrics{Memory: memory}
+	if cpu, err := readPressureFile(filepath.Join(pressureDir, "cpu")); err == nil {
+		p.CPU = cpu
+	}
+	if io, err := readPressureFile(filepath.Join(pressureDir, "io")); err == nil {
+		p.IO = io
+	}
+	return p
+}
+
+// readPressureFile parses a PSI file, whose lines look like
+//
+//	some avg10=0.12 avg60=0.05 avg300=0.01 total=123456
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=4567
+func readPressureFile(path string) (metrics.PressureStall, error) {
+	var stall metrics.PressureStall
+
+	file, err := os.Open(path)
+	if err != nil {
+		return stall, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var avg10, avg60, avg300 *float64
+		switch fields[0] {
+		case "some":
+			avg10, avg60, avg300 = &stall.SomeAvg10, &stall.SomeAvg60, &stall.SomeAvg300
+		case "full":
+			avg10, avg60, avg300 = &stall.FullAvg10, &stall.FullAvg60, &stall.FullAvg300
+		default:
+			continue
+		}
+
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			percent, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "avg10":
+				*avg10 = percent
+			case "avg60":
+				*avg60 = percent
+			case "avg300":
+				*avg300 = percent
+			}
+		}
+	}
+
+	return stall, scanner.Err()
+}
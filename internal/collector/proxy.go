@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// proxyAllowlist lists the read-only RPC methods that may be forwarded for
+// local tools, along with the maximum number of parameters each accepts
+var proxyAllowlist = map[string]int{
+	"getblockhash":   1,
+	"getblockheader": 2,
+}
+
+// Proxy forwards an allowlisted read-only RPC to bitcoind using the
+// collector's own credentials and returns the result as JSON
+func (c *BitcoinCollector) Proxy(method string, params []string) (json.RawMessage, error) {
+	method = strings.ToLower(method)
+
+	maxParams, ok := proxyAllowlist[method]
+	if !ok {
+		return nil, fmt.Errorf("method not allowed: %s", method)
+	}
+	if len(params) > maxParams {
+		return nil, fmt.Errorf("%s accepts at most %d parameters", method, maxParams)
+	}
+	for _, p := range params {
+		// Never let a parameter be interpreted as a bitcoin-cli option
+		if strings.HasPrefix(p, "-") {
+			return nil, fmt.Errorf("invalid parameter: %s", p)
+		}
+	}
+
+	if c.transport == "rest" {
+		return nil, fmt.Errorf("proxy requires the cli transport")
+	}
+
+	output, err := c.cache.get(method, params, func() ([]byte, error) {
+		return c.runCLI(context.Background(), append([]string{method}, params...)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// bitcoin-cli prints string results unquoted
+	output = bytes.TrimSpace(output)
+	if json.Valid(output) {
+		return output, nil
+	}
+	return json.Marshal(string(output))
+}
+
+// Proxy forwards an allowlisted RPC to the Bitcoin node
+func (c *Collector) Proxy(method string, params []string) (json.RawMessage, error) {
+	if c.demo != nil {
+		return nil, fmt.Errorf("no node to proxy to in demo mode")
+	}
+	if !c.config.Bitcoin.Enabled {
+		return nil, fmt.Errorf("bitcoin collection is disabled")
+	}
+	return c.bitcoin.Proxy(method, params)
+}
@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// RawCall runs an RPC method on the named node, or the primary node if
+// node is empty, and returns its result as JSON. Methods with a cache TTL
+// share their cached result with collectors and PROXY. bitcoin-cli prints
+// string results without quotes; those are returned as JSON strings.
+func (c *Collector) RawCall(ctx context.Context, node, method string, params []string) (json.RawMessage, error) {
+	if c.demo != nil {
+		return nil, fmt.Errorf("no node to query in demo mode")
+	}
+
+	bitcoin := c.bitcoin
+	if node != "" {
+		bitcoin = c.nodes[node]
+		if bitcoin == nil {
+			return nil, fmt.Errorf("bitcoin node %q is not enabled", node)
+		}
+	} else if !c.config.Bitcoin.Enabled {
+		return nil, fmt.Errorf("bitcoin collection is disabled")
+	}
+
+	output, err := bitcoin.call(ctx, method, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	output = bytes.TrimSpace(output)
+	if !json.Valid(output) {
+		return json.Marshal(string(output))
+	}
+	return output, nil
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// reindexFlags are the bitcoind options that rebuild the chain from the
+// block files, which the node reports as initial block download
+var reindexFlags = []string{"reindex", "reindex-chainstate"}
+
+// updateState sets the node's operating state. Pruning is only seen when
+// the prune height moved since the previous collection.
+func (c *BitcoinCollector) updateState(m *metrics.BitcoinMetrics, blockchainInfo map[string]interface{}) {
+	if height, ok := blockchainInfo["pruneheight"].(float64); ok {
+		m.PruneHeight = int(height)
+	}
+	pruning := m.Pruned && c.lastPruneHeight > 0 && m.PruneHeight > c.lastPruneHeight
+	c.lastPruneHeight = m.PruneHeight
+
+	switch {
+	case m.IBD && c.reindexing():
+		m.State = metrics.NodeStateReindex
+	case m.IBD:
+		m.State = metrics.NodeStateIBD
+	case pruning:
+		m.State = metrics.NodeStatePruning
+	default:
+		m.State = metrics.NodeStateSteady
+	}
+}
+
+// reindexing reports whether a local bitcoind was started with -reindex or
+// -reindex-chainstate. With a data directory configured, only a bitcoind
+// using it counts. Nodes on other hosts are never seen reindexing.
+func (c *BitcoinCollector) reindexing() bool {
+	processes, err := process.Processes()
+	if err != nil {
+		return false
+	}
+
+	for _, p := range processes {
+		name, err := p.Name()
+		if err != nil || strings.TrimSuffix(name, ".exe") != "bitcoind" {
+			continue
+		}
+		args, err := p.CmdlineSlice()
+		if err != nil {
+			continue
+		}
+
+		reindex := false
+		dataDir := ""
+		for _, arg := range args[min(1, len(args)):] {
+			option, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			switch {
+			case option == "datadir":
+				dataDir = value
+			case slices.Contains(reindexFlags, option):
+				reindex = !hasValue || (value != "0" && value != "")
+			}
+		}
+		if reindex && (c.dataDir == "" || dataDir == "" || filepath.Clean(dataDir) == filepath.Clean(c.dataDir)) {
+			return true
+		}
+	}
+	return false
+}
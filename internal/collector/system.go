@@ -1,8 +1,11 @@
 package collector
 
 import (
+	"os/exec"
+	"strings"
 	"time"
 
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
 	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
@@ -14,17 +17,36 @@ import (
 
 // SystemCollector collects system metrics
 type SystemCollector struct {
-	diskPath string
-	lastNet  *net.IOCountersStat
-	lastDisk *disk.IOCountersStat
-	lastTime time.Time
+	diskPaths []string                      // The first sets the top-level disk fields
+	counts    func(iface string) bool       // Whether an interface is in the totals
+	lastNet   map[string]net.IOCountersStat // Per interface
+	lastDisk  *disk.IOCountersStat
+	lastTime  time.Time
+	vcgencmd  string // Path to vcgencmd on Raspberry Pi OS, if installed
+	clock     *clockChecker
+	skip      map[string]bool // Metric groups left out; see SetSkipped
 }
 
 // NewSystemCollector creates a new system metrics collector
-func NewSystemCollector(diskPath string) *SystemCollector {
-	return &SystemCollector{
-		diskPath: diskPath,
-		lastTime: time.Now(),
+func NewSystemCollector(cfg config.SystemConfig) *SystemCollector {
+	c := &SystemCollector{
+		diskPaths: cfg.DiskPaths(),
+		counts:    cfg.CountsInterface,
+		lastTime:  time.Now(),
+		clock:     newClockChecker(cfg.ClockSource, cfg.NTPServer),
+	}
+	if path, err := exec.LookPath("vcgencmd"); err == nil {
+		c.vcgencmd = path
+	}
+	return c
+}
+
+// SetSkipped leaves out groups of metrics, named as in power_saving
+// skip_system_metrics
+func (c *SystemCollector) SetSkipped(groups []string) {
+	c.skip = make(map[string]bool, len(groups))
+	for _, group := range groups {
+		c.skip[group] = true
 	}
 }
 
@@ -44,11 +66,23 @@ func (c *SystemCollector) Collect() (*metrics.SystemMetrics, error) {
 		m.MemoryAvailBytes = int64(vmStat.Available)
 	}
 
+	// Swap
+	if swap, err := mem.SwapMemory(); err == nil {
+		m.SwapTotalBytes = int64(swap.Total)
+		m.SwapUsedBytes = int64(swap.Used)
+	}
+	if !c.skip["pressure"] {
+		m.Pressure = readPressure()
+	}
+
 	// Disk usage
-	if diskStat, err := disk.Usage(c.diskPath); err == nil {
-		m.DiskTotalBytes = int64(diskStat.Total)
-		m.DiskUsedBytes = int64(diskStat.Used)
-		m.DiskAvailBytes = int64(diskStat.Free)
+	m.Disks = diskUsage(c.diskPaths)
+	if len(c.diskPaths) > 0 {
+		if primary, ok := m.Disks[c.diskPaths[0]]; ok {
+			m.DiskTotalBytes = primary.TotalBytes
+			m.DiskUsedBytes = primary.UsedBytes
+			m.DiskAvailBytes = primary.AvailBytes
+		}
 	}
 
 	// Disk I/O rates
@@ -75,18 +109,38 @@ func (c *SystemCollector) Collect() (*metrics.SystemMetrics, error) {
 		}
 	}
 
-	// Network I/O rates
-	if netIO, err := net.IOCounters(false); err == nil && len(netIO) > 0 {
+	// Network I/O rates, per interface and in total
+	if netIO, err := net.IOCounters(true); err == nil && len(netIO) > 0 {
 		now := time.Now()
-		if c.lastNet != nil {
-			elapsed := now.Sub(c.lastTime).Seconds()
-			if elapsed > 0 {
-				m.NetRxBPS = int64(float64(netIO[0].BytesRecv-c.lastNet.BytesRecv) / elapsed)
-				m.NetTxBPS = int64(float64(netIO[0].BytesSent-c.lastNet.BytesSent) / elapsed)
+		elapsed := now.Sub(c.lastTime).Seconds()
+
+		current := make(map[string]net.IOCountersStat, len(netIO))
+		for _, iface := range netIO {
+			current[iface.Name] = iface
+
+			last, ok := c.lastNet[iface.Name]
+			// Counters restart when an interface is recreated, e.g. a VPN reconnecting
+			if !ok || elapsed <= 0 || iface.BytesRecv < last.BytesRecv || iface.BytesSent < last.BytesSent {
+				continue
+			}
+			rates := metrics.InterfaceRates{
+				RxBPS: int64(float64(iface.BytesRecv-last.BytesRecv) / elapsed),
+				TxBPS: int64(float64(iface.BytesSent-last.BytesSent) / elapsed),
+			}
+
+			if !isLoopback(iface.Name) && !c.skip["interfaces"] {
+				if m.Interfaces == nil {
+					m.Interfaces = make(map[string]metrics.InterfaceRates)
+				}
+				m.Interfaces[iface.Name] = rates
+			}
+			if c.counts(iface.Name) {
+				m.NetRxBPS += rates.RxBPS
+				m.NetTxBPS += rates.TxBPS
 			}
 		}
 
-		c.lastNet = &netIO[0]
+		c.lastNet = current
 		c.lastTime = now
 	}
 
@@ -102,5 +156,24 @@ func (c *SystemCollector) Collect() (*metrics.SystemMetrics, error) {
 		m.UptimeSeconds = int64(uptime)
 	}
 
+	// Thermal state
+	if !c.skip["thermal"] {
+		if temperature, ok := cpuTemperature(); ok {
+			m.CPUTemperatureC = temperature
+		}
+		m.Throttling = piThrottling(c.vcgencmd)
+	}
+
+	// Clock offset and synchronization
+	if !c.skip["clock"] {
+		c.clock.apply(m)
+	}
+
 	return m, nil
 }
+
+// isLoopback reports whether an interface name is the loopback device on
+// Linux, macOS or Windows
+func isLoopback(name string) bool {
+	return name == "lo" || name == "lo0" || strings.HasPrefix(name, "Loopback Pseudo-Interface")
+}
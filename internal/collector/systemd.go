@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// systemdProperties are the unit properties requested from systemctl show
+const systemdProperties = "LoadState,ActiveState,SubState,NRestarts,ActiveEnterTimestamp"
+
+// systemdTimestampLayout is how systemctl prints timestamps with TZ=UTC
+const systemdTimestampLayout = "Mon 2006-01-02 15:04:05 MST"
+
+// SystemdCollector reports the state of systemd units via systemctl
+type SystemdCollector struct {
+	systemctl string
+	units     []string
+	timeout   time.Duration
+}
+
+// NewSystemdCollector creates a collector for the configured units
+func NewSystemdCollector(cfg config.SystemdConfig) *SystemdCollector {
+	return &SystemdCollector{
+		systemctl: cfg.SystemctlPath,
+		units:     cfg.Units,
+		timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+	}
+}
+
+// Collect returns the state of each unit, keyed by its name without the
+// .service suffix
+func (c *SystemdCollector) Collect(ctx context.Context) (map[string]*metrics.ServiceStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	args := append([]string{"show", "--property=" + systemdProperties, "--"}, c.units...)
+	cmd := exec.CommandContext(ctx, c.systemctl, args...)
+	// Timestamps are printed in the local zone and locale otherwise
+	cmd.Env = append(os.Environ(), "TZ=UTC", "LC_ALL=C")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("systemctl timed out: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("systemctl failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	blocks := parseSystemctlShow(output)
+	if len(blocks) != len(c.units) {
+		return nil, fmt.Errorf("systemctl returned %d units, expected %d", len(blocks), len(c.units))
+	}
+
+	now := time.Now()
+	services := make(map[string]*metrics.ServiceStatus, len(c.units))
+	for i, unit := range c.units {
+		services[strings.TrimSuffix(unit, ".service")] = serviceStatus(blocks[i], now)
+	}
+	return services, nil
+}
+
+// parseSystemctlShow splits systemctl show output into one property map
+// per unit, in the order the units were given. Units are separated by a
+// blank line.
+func parseSystemctlShow(output []byte) []map[string]string {
+	var blocks []map[string]string
+	var current map[string]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if current != nil {
+				blocks = append(blocks, current)
+				current = nil
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if current == nil {
+			current = make(map[string]string)
+		}
+		current[key] = value
+	}
+	if current != nil {
+		blocks = append(blocks, current)
+	}
+
+	return blocks
+}
+
+// serviceStatus converts a unit's properties
+func serviceStatus(properties map[string]string, now time.Time) *metrics.ServiceStatus {
+	s := &metrics.ServiceStatus{
+		LoadState:   properties["LoadState"],
+		ActiveState: properties["ActiveState"],
+		SubState:    properties["SubState"],
+	}
+	s.Active = s.ActiveState == "active" || s.ActiveState == "reloading"
+	s.Failed = s.ActiveState == "failed"
+
+	// Not reported before systemd 235
+	if restarts, err := strconv.Atoi(properties["NRestarts"]); err == nil {
+		s.Restarts = restarts
+	}
+
+	if s.Active {
+		if since, err := time.Parse(systemdTimestampLayout, properties["ActiveEnterTimestamp"]); err == nil {
+			s.ActiveSeconds = int64(now.Sub(since).Seconds())
+		}
+	}
+
+	return s
+}
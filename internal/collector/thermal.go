@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// cpuSensorPrefixes match the hwmon and thermal zone names of CPU package
+// and core sensors on common x86 machines and ARM boards
+var cpuSensorPrefixes = []string{
+	"coretemp", "k10temp", "zenpower", "x86_pkg_temp",
+	"cpu_thermal", "cpu-thermal", "soc_thermal", "soc-thermal",
+}
+
+// fallbackSensorPrefix is the ACPI thermal zone, which often tracks the CPU
+// on machines without a dedicated driver
+const fallbackSensorPrefix = "acpitz"
+
+// piThrottledPath exposes the Raspberry Pi firmware's throttling flags on
+// recent kernels; older ones only have vcgencmd
+const piThrottledPath = "/sys/devices/platform/soc/soc:firmware/get_throttled"
+
+// get_throttled bits
+const (
+	throttleUnderVoltage     = 1 << 0
+	throttleFrequencyCapped  = 1 << 1
+	throttleThrottled        = 1 << 2
+	throttleSoftTempLimit    = 1 << 3
+	throttleOccurredShift    = 16 // The same flags, set if they happened since boot
+	throttleCurrentFlagsMask = 0xf
+)
+
+// cpuTemperature returns the hottest CPU sensor reading in degrees Celsius
+func cpuTemperature() (float64, bool) {
+	// Partial results come with an error listing the sensors that failed
+	temps, _ := host.SensorsTemperatures()
+
+	var hottest, fallback float64
+	var found, hasFallback bool
+	for _, t := range temps {
+		key := strings.ToLower(t.SensorKey)
+		if t.Temperature <= 0 {
+			continue
+		}
+
+		switch {
+		case hasAnyPrefix(key, cpuSensorPrefixes):
+			hottest = max(hottest, t.Temperature)
+			found = true
+		case strings.HasPrefix(key, fallbackSensorPrefix):
+			fallback = max(fallback, t.Temperature)
+			hasFallback = true
+		}
+	}
+
+	if found {
+		return hottest, true
+	}
+	return fallback, hasFallback
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// piThrottling reads the Raspberry Pi firmware throttling state, from sysfs
+// or vcgencmd. It returns nil on other hardware.
+func piThrottling(vcgencmd string) *metrics.ThrottlingState {
+	var text string
+	if data, err := os.ReadFile(piThrottledPath); err == nil {
+		text = string(data)
+	} else if vcgencmd != "" {
+		// Prints e.g. "throttled=0x50005"
+		output, err := exec.Command(vcgencmd, "get_throttled").Output()
+		if err != nil {
+			return nil
+		}
+		text = strings.TrimPrefix(strings.TrimSpace(string(output)), "throttled=")
+	} else {
+		return nil
+	}
+
+	flags, err := parseThrottled(text)
+	if err != nil {
+		logger.Debug("Failed to parse throttling state", "error", err)
+		return nil
+	}
+
+	occurred := flags >> throttleOccurredShift
+	return &metrics.ThrottlingState{
+		UnderVoltage:            flags&throttleUnderVoltage != 0,
+		FrequencyCapped:         flags&throttleFrequencyCapped != 0,
+		Throttled:               flags&throttleThrottled != 0,
+		SoftTempLimit:           flags&throttleSoftTempLimit != 0,
+		UnderVoltageOccurred:    occurred&throttleUnderVoltage != 0,
+		FrequencyCappedOccurred: occurred&throttleFrequencyCapped != 0,
+		ThrottledOccurred:       occurred&throttleThrottled != 0,
+		SoftTempLimitOccurred:   occurred&throttleSoftTempLimit != 0,
+		Active:                  flags&throttleCurrentFlagsMask != 0,
+	}
+}
+
+// parseThrottled parses the hexadecimal get_throttled value, with or
+// without a 0x prefix
+func parseThrottled(text string) (uint64, error) {
+	text = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(text)), "0x")
+	flags, err := strconv.ParseUint(text, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected get_throttled value %q", text)
+	}
+	return flags, nil
+}
@@ -2,193 +2,664 @@ package collector
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/faults"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
 	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
 )
 
-// TorCollector collects Tor network metrics via control port
+// TorCollector collects Tor network metrics via control port. The
+// authenticated connection is kept open between collections and replaced
+// when a command on it fails, e.g. after Tor restarts.
 type TorCollector struct {
 	controlPort int
 	cookiePath  string
 	timeout     time.Duration
+	selfCheck   *onionSelfCheck  // nil unless the onion self-check is enabled
+	capture     *Capture         // nil unless capturing or replaying
+	faults      *faults.Injector // nil unless fault injection is enabled
+
+	controlSocket string // Unix socket path; the port is used if empty
+	password      string // Used instead of the cookie if set
+
+	lastAuthStatus string // Logged when it changes to a failure
+	lastBootstrap  string // Bootstrap warning, logged when it changes
+
+	mu      sync.Mutex
+	session *controlSession // nil until connected, and after a failure
+}
+
+// controlSession is an authenticated control-port connection
+type controlSession struct {
+	conn   controlConn
+	reader *bufio.Reader
+	writer *bufio.Writer
 }
 
 // NewTorCollector creates a new Tor metrics collector
-func NewTorCollector(controlPort int, cookiePath string, timeoutSeconds int) *TorCollector {
+func NewTorCollector(cfg config.TorConfig) *TorCollector {
 	return &TorCollector{
-		controlPort: controlPort,
-		cookiePath:  cookiePath,
-		timeout:     time.Duration(timeoutSeconds) * time.Second,
+		controlPort:   cfg.ControlPort,
+		controlSocket: cfg.ControlSocket,
+		cookiePath:    cfg.CookiePath,
+		password:      cfg.Password,
+		timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
 	}
 }
 
+// SetCapture records control-port sessions to capture, or serves them from
+// it when replaying
+func (c *TorCollector) SetCapture(capture *Capture) {
+	c.capture = capture
+}
+
+// SetFaults injects partial control-port replies for testing
+func (c *TorCollector) SetFaults(injector *faults.Injector) {
+	c.faults = injector
+}
+
 // Collect gathers current Tor metrics
-func (c *TorCollector) Collect() (*metrics.TorMetrics, error) {
+func (c *TorCollector) Collect(ctx context.Context) (*metrics.TorMetrics, error) {
 	m := &metrics.TorMetrics{}
+	defer c.applySelfCheck(m)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Captures hold one session per collection, and an injected partial
+	// reply ends the session it is injected into. A session kept from an
+	// earlier collection may have been closed, e.g. by a Tor restart, so it
+	// is replaced once if its first command fails.
+	oneShot := c.capture != nil
+	kept := false
+	if limit, partial := c.faults.PartialReply(); partial {
+		c.closeSession()
+		oneShot = true
+		if err := c.openSession(ctx, m, limit); err != nil {
+			return m, nil
+		}
+	} else if c.session != nil {
+		kept = true
+		m.ControlReachable = true
+		c.applyAuthResult(m, nil)
+	} else if err := c.openSession(ctx, m, 0); err != nil {
+		return m, nil
+	}
+	if oneShot {
+		defer c.closeSession()
+	}
 
+	// Control latency is the round trip of the first command
 	startTime := time.Now()
-
-	// Try to connect to control port
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", c.controlPort), c.timeout)
+	circuits, err := c.getCircuits()
+	if err != nil && kept {
+		c.closeSession()
+		*m = metrics.TorMetrics{}
+		if err := c.openSession(ctx, m, 0); err != nil {
+			return m, nil
+		}
+		startTime = time.Now()
+		circuits, err = c.getCircuits()
+	}
 	if err != nil {
-		m.ControlReachable = false
-		return m, nil // Not an error, just Tor not available
+		logger.Debug("Failed to get Tor circuit status", "error", err)
+		c.closeSession()
+		return m, nil
 	}
-	defer conn.Close()
-
-	m.ControlReachable = true
-	conn.SetDeadline(time.Now().Add(c.timeout))
-
-	reader := bufio.NewReader(conn)
-	writer := bufio.NewWriter(conn)
+	m.ControlLatencyMs = time.Since(startTime).Milliseconds()
 
-	// Authenticate
-	if err := c.authenticate(reader, writer); err != nil {
-		return m, nil // Authentication failed, but connection worked
+	m.CircuitCount = len(circuits)
+	m.Purposes = make(map[string]*metrics.TorPurposeStats, len(torPurposeGroups))
+	for _, group := range torPurposeGroups {
+		m.Purposes[group] = &metrics.TorPurposeStats{}
+	}
+	circuitGroups := make(map[string]string, len(circuits))
+	for _, circuit := range circuits {
+		// <id> <status> [<path>] [BUILD_FLAGS=...] [PURPOSE=...] ...
+		fields := strings.Fields(circuit)
+		if len(fields) < 2 {
+			continue
+		}
+		group := torPurposeGroup(parseStatusArgs(circuit)["PURPOSE"])
+		circuitGroups[fields[0]] = group
+		stats := m.Purposes[group]
+		stats.Circuits++
+		if fields[1] == "BUILT" {
+			m.EstablishedCount++
+			stats.Established++
+		}
 	}
 
-	// Measure control latency
-	m.ControlLatencyMs = time.Since(startTime).Milliseconds()
-
-	// Get circuit status
-	circuits, err := c.getCircuits(reader, writer)
-	if err == nil {
-		m.CircuitCount = len(circuits)
-		// Count established circuits
-		for _, circuit := range circuits {
-			if strings.Contains(circuit, "BUILT") {
-				m.EstablishedCount++
+	// <id> <status> <circuit id> <target>; streams not yet attached have
+	// circuit 0
+	streams, err := c.getInfo("stream-status")
+	if err != nil {
+		logger.Debug("Failed to get Tor stream status", "error", err)
+	}
+	for _, stream := range streams {
+		if fields := strings.Fields(stream); len(fields) >= 3 {
+			group, ok := circuitGroups[fields[2]]
+			if !ok {
+				group = "other"
 			}
+			m.Purposes[group].Streams++
 		}
 	}
 
+	// Tor answers on the control port long before it can reach the
+	// network, e.g. while the clock is wrong or guards are unreachable
+	// after a reboot
+	if err := c.getBootstrap(m); err != nil {
+		logger.Debug("Failed to get Tor bootstrap status", "error", err)
+	}
+
 	// Get bandwidth stats
-	readBytes, writeBytes, err := c.getBandwidth(reader, writer)
+	readBytes, writeBytes, err := c.getBandwidth()
 	if err == nil {
 		m.BandwidthReadBPS = readBytes
 		m.BandwidthWriteBPS = writeBytes
 	}
 
 	// Get onion services count
-	onions, err := c.getOnionServices(reader, writer)
-	if err == nil {
-		m.OnionServices = onions
+	onions, err := c.getOnionServices()
+	if err != nil {
+		logger.Debug("Failed to list Tor onion services", "error", err)
+		c.closeSession()
+		return m, nil
 	}
+	m.OnionServices = len(onions)
+	c.rememberOnions(onions)
 
 	return m, nil
 }
 
-// authenticate authenticates with Tor control port using cookie
-func (c *TorCollector) authenticate(reader *bufio.Reader, writer *bufio.Writer) error {
-	// Read cookie file
-	cookie, err := os.ReadFile(c.cookiePath)
+// openSession connects and authenticates, recording reachability and the
+// authentication outcome in m. A positive partialLimit cuts the session's
+// replies off after that many bytes. c.mu must be held.
+func (c *TorCollector) openSession(ctx context.Context, m *metrics.TorMetrics, partialLimit int) error {
+	conn, err := c.dialControl(ctx)
 	if err != nil {
-		// Try PROTOCOLINFO to see if no auth needed
-		writer.WriteString("PROTOCOLINFO 1\r\n")
-		writer.Flush()
+		m.ControlReachable = false
+		return err // Not reported as an error, just Tor not available
+	}
+	if partialLimit > 0 {
+		conn = &partialConn{controlConn: conn, remaining: partialLimit}
+	}
+	m.ControlReachable = true
+
+	session := &controlSession{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	err = c.authenticate(session.reader, session.writer)
+	c.applyAuthResult(m, err)
+	if err != nil {
+		conn.Close()
+		return err
+	}
 
-		response, _ := reader.ReadString('\n')
-		if strings.Contains(response, "NULL") {
-			// No authentication required
-			return nil
+	c.session = session
+	return nil
+}
+
+// closeSession closes the kept session, if any. c.mu must be held.
+func (c *TorCollector) closeSession() {
+	if c.session != nil {
+		c.session.conn.Close()
+		c.session = nil
+	}
+}
+
+// Close closes the control connection
+func (c *TorCollector) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeSession()
+}
+
+// dialControl connects to the control port. When capturing, the replies
+// read are recorded; when replaying, a recorded session is served instead.
+func (c *TorCollector) dialControl(ctx context.Context) (controlConn, error) {
+	if c.capture.Replaying() {
+		transcript, err := c.capture.next("tor", "control")
+		if err != nil {
+			return nil, err
 		}
-		return fmt.Errorf("failed to read cookie: %w", err)
+		return replayConn{bytes.NewReader(transcript)}, nil
 	}
 
-	// Authenticate with cookie
-	hexCookie := fmt.Sprintf("%x", cookie)
-	writer.WriteString(fmt.Sprintf("AUTHENTICATE %s\r\n", hexCookie))
-	writer.Flush()
+	network, address := "tcp", fmt.Sprintf("127.0.0.1:%d", c.controlPort)
+	if c.controlSocket != "" {
+		network, address = "unix", c.controlSocket
+	}
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		c.capture.record("tor", "control", nil, err)
+		return nil, err
+	}
+	if c.capture == nil {
+		return conn, nil
+	}
+	return &recordingConn{Conn: conn, capture: c.capture}, nil
+}
+
+// readCookie reads the control auth cookie. Captures only record whether it
+// could be read, never the cookie itself.
+func (c *TorCollector) readCookie() ([]byte, error) {
+	if c.capture.Replaying() {
+		// Writes are discarded, so the placeholder stands in for the cookie
+		return c.capture.next("tor", "cookie")
+	}
+
+	cookie, err := os.ReadFile(c.cookiePath)
+	if err != nil {
+		c.capture.record("tor", "cookie", nil, err)
+	} else {
+		c.capture.record("tor", "cookie", []byte(cookiePlaceholder), nil)
+	}
+	return cookie, err
+}
 
-	response, err := reader.ReadString('\n')
+// authenticate authenticates with Tor control port using the configured
+// password, or else the cookie, preferring SAFECOOKIE, which proves
+// knowledge of the cookie without sending it. Failures are returned as
+// *authFailure.
+func (c *TorCollector) authenticate(reader *bufio.Reader, writer *bufio.Writer) error {
+	info, err := getProtocolInfo(reader, writer)
 	if err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
+		return &authFailure{torAuthProtocolFailure, err.Error()}
+	}
+	if info.accepts("NULL") {
+		// No authentication required
+		return nil
+	}
+	if c.password != "" && info.accepts("HASHEDPASSWORD") {
+		return c.authenticatePassword(reader, writer)
+	}
+	if !info.accepts("COOKIE") && !info.accepts("SAFECOOKIE") {
+		return c.methodFailure(info)
+	}
+
+	// Read cookie file
+	cookie, err := c.readCookie()
+	if err != nil {
+		return c.cookieFailure(info, err)
+	}
+
+	// Authenticate with cookie
+	if info.accepts("SAFECOOKIE") {
+		err = c.authenticateSafeCookie(reader, writer, cookie)
+	} else {
+		err = sendAuthenticate(reader, writer, fmt.Sprintf("%x", cookie))
 	}
 
-	if !strings.HasPrefix(response, "250") {
-		return fmt.Errorf("authentication rejected: %s", response)
+	if errors.Is(err, errCookieRejected) {
+		// A cookie from another Tor instance or an old run is the usual cause
+		if wrongCookiePath(info.cookieFile, c.cookiePath) {
+			return &authFailure{torAuthCookiePath,
+				fmt.Sprintf("Tor rejected the cookie; it writes its cookie to %s, not %s", info.cookieFile, c.cookiePath)}
+		}
+		return &authFailure{torAuthRejected, err.Error()}
+	}
+	if err != nil {
+		return &authFailure{torAuthProtocolFailure, fmt.Sprintf("authentication failed: %v", err)}
 	}
 
 	return nil
 }
 
-// getCircuits retrieves circuit information
-func (c *TorCollector) getCircuits(reader *bufio.Reader, writer *bufio.Writer) ([]string, error) {
-	writer.WriteString("GETINFO circuit-status\r\n")
-	writer.Flush()
+// applyAuthResult records the authentication outcome in m, logging a
+// failure the first time it is seen
+func (c *TorCollector) applyAuthResult(m *metrics.TorMetrics, err error) {
+	authenticated := err == nil
+	m.Authenticated = &authenticated
+	m.AuthStatus = torAuthOK
 
-	var circuits []string
+	if err != nil {
+		var failure *authFailure
+		if errors.As(err, &failure) {
+			m.AuthStatus = failure.status
+		} else {
+			m.AuthStatus = torAuthProtocolFailure
+		}
+		m.AuthError = err.Error()
+
+		if m.AuthStatus != c.lastAuthStatus {
+			logger.Warn("Tor control authentication failed", "status", m.AuthStatus, "error", err)
+		}
+	}
+	c.lastAuthStatus = m.AuthStatus
+}
+
+// replyLine is one line of a control-port reply, with the data block that
+// follows it for "+" lines
+type replyLine struct {
+	text string   // Without the status code
+	data []string // Unescaped data block lines
+}
+
+// command sends a command on the session and returns its reply lines.
+// Asynchronous event lines are skipped. c.mu must be held.
+func (c *TorCollector) command(command string) ([]replyLine, error) {
+	s := c.session
+	if s == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	s.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	s.writer.WriteString(command + "\r\n")
+	if err := s.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	var reply []replyLine
+	inData := false
 	for {
-		line, err := reader.ReadString('\n')
+		line, err := s.reader.ReadString('\n')
 		if err != nil {
 			return nil, err
 		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if inData {
+			last := &reply[len(reply)-1]
+			switch {
+			case line == ".":
+				inData = false
+			case strings.HasPrefix(line, "."):
+				last.data = append(last.data, line[1:])
+			default:
+				last.data = append(last.data, line)
+			}
+			continue
+		}
 
-		line = strings.TrimSpace(line)
+		if len(line) < 4 {
+			return nil, fmt.Errorf("malformed reply line %q", line)
+		}
+		if line[:3] == "650" {
+			continue
+		}
+		if line[0] != '2' {
+			return nil, fmt.Errorf("%s failed: %s", command, line)
+		}
 
-		if strings.HasPrefix(line, "250 OK") {
-			break
+		reply = append(reply, replyLine{text: line[4:]})
+		switch line[3] {
+		case '+':
+			inData = true
+		case '-':
+		case ' ':
+			return reply, nil
+		default:
+			return nil, fmt.Errorf("malformed reply line %q", line)
 		}
+	}
+}
 
-		if strings.HasPrefix(line, "250-circuit-status=") || strings.HasPrefix(line, "250+circuit-status=") {
+// getInfo returns the value of a GETINFO key as lines, whether Tor sent it
+// inline ("key=value") or as a data block
+func (c *TorCollector) getInfo(key string) ([]string, error) {
+	reply, err := c.command("GETINFO " + key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range reply {
+		value, ok := strings.CutPrefix(line.text, key+"=")
+		if !ok {
 			continue
 		}
-
-		if line == "250 OK" || line == "." {
-			break
+		var values []string
+		if value != "" {
+			values = append(values, value)
+		}
+		for _, data := range line.data {
+			if data != "" {
+				values = append(values, data)
+			}
 		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("GETINFO %s: key missing from reply", key)
+}
+
+// getCircuits returns one line per circuit from GETINFO circuit-status
+func (c *TorCollector) getCircuits() ([]string, error) {
+	return c.getInfo("circuit-status")
+}
+
+// torPurposeGroups are the keys of tor.purposes
+var torPurposeGroups = []string{"general", "hs_client", "hs_service", "other"}
+
+// torPurposeGroup maps a circuit PURPOSE to its tor.purposes key. Onion
+// service circuits are split by side: HS_CLIENT_* for services we connect
+// to, HS_SERVICE_* for the introduction and rendezvous circuits of our own.
+func torPurposeGroup(purpose string) string {
+	switch {
+	case purpose == "GENERAL":
+		return "general"
+	case strings.HasPrefix(purpose, "HS_CLIENT_"):
+		return "hs_client"
+	case strings.HasPrefix(purpose, "HS_SERVICE_"):
+		return "hs_service"
+	default:
+		return "other"
+	}
+}
+
+// getBootstrap records how far Tor has got connecting to the network and
+// whether it has built a circuit, from status/bootstrap-phase, e.g.
+// NOTICE BOOTSTRAP PROGRESS=100 TAG=done SUMMARY="Done"
+func (c *TorCollector) getBootstrap(m *metrics.TorMetrics) error {
+	phase, err := c.getInfo("status/bootstrap-phase")
+	if err != nil {
+		return err
+	}
+	if len(phase) == 0 {
+		return fmt.Errorf("empty bootstrap phase")
+	}
+	args := parseStatusArgs(phase[0])
+	progress, err := strconv.Atoi(args["PROGRESS"])
+	if err != nil {
+		return fmt.Errorf("unexpected bootstrap phase %q", phase[0])
+	}
+	m.BootstrapProgress = &progress
+	m.BootstrapTag = args["TAG"]
+	if progress < 100 {
+		// Only sent with WARN severity, when Tor is stuck
+		m.BootstrapWarning = args["WARNING"]
+	}
 
-		if strings.HasPrefix(line, "250") && strings.Contains(line, "BUILT") {
-			circuits = append(circuits, line)
+	if m.BootstrapWarning != c.lastBootstrap {
+		if m.BootstrapWarning != "" {
+			logger.Warn("Tor bootstrap is stuck", "progress", progress, "tag", m.BootstrapTag, "warning", m.BootstrapWarning)
+		} else if progress == 100 {
+			logger.Info("Tor bootstrap completed")
 		}
+		c.lastBootstrap = m.BootstrapWarning
+	}
+
+	established, err := c.getInfo("status/circuit-established")
+	if err != nil {
+		return err
 	}
+	ok := len(established) == 1 && established[0] == "1"
+	m.CircuitEstablished = &ok
+	return nil
+}
+
+// parseStatusArgs returns the KEY=value arguments of a status event line,
+// unquoting quoted values. Words without "=", such as the severity, are
+// skipped.
+func parseStatusArgs(line string) map[string]string {
+	args := make(map[string]string)
+	for {
+		line = strings.TrimLeft(line, " ")
+		end := strings.IndexAny(line, " =")
+		if end < 0 {
+			return args
+		}
+		if line[end] == ' ' {
+			line = line[end:]
+			continue
+		}
+
+		key, rest := line[:end], line[end+1:]
+		if !strings.HasPrefix(rest, `"`) {
+			args[key], line, _ = strings.Cut(rest, " ")
+			continue
+		}
 
-	return circuits, nil
+		var value strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+			}
+			value.WriteByte(rest[i])
+		}
+		args[key] = value.String()
+		line = rest[min(i+1, len(rest)):]
+	}
 }
 
 // getBandwidth retrieves bandwidth statistics
-func (c *TorCollector) getBandwidth(reader *bufio.Reader, writer *bufio.Writer) (int64, int64, error) {
+func (c *TorCollector) getBandwidth() (int64, int64, error) {
 	// Note: This is cumulative, not rate. For rate calculation, we'd need to track deltas
 	// For now, return 0 as placeholder
 	return 0, 0, nil
 }
 
-// getOnionServices retrieves count of active onion services
-func (c *TorCollector) getOnionServices(reader *bufio.Reader, writer *bufio.Writer) (int, error) {
-	writer.WriteString("GETINFO onions/current\r\n")
-	writer.Flush()
+// getOnionServices retrieves the service IDs of active onion services
+func (c *TorCollector) getOnionServices() ([]string, error) {
+	return c.getInfo("onions/current")
+}
 
-	count := 0
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			return 0, err
-		}
+// onionSelfCheck holds the configuration and latest result of the probe that
+// connects to our own onion service through the local SOCKS port
+type onionSelfCheck struct {
+	socksAddr    string
+	onionAddress string // Configured address; discovered if empty
+	onionPort    int
+	timeout      time.Duration
+
+	mu         sync.Mutex
+	discovered string
+	checked    bool
+	reachable  bool
+	latencyMs  int64
+	lastError  string
+}
 
-		line = strings.TrimSpace(line)
+// EnableSelfCheck allows probing the node's own onion service
+func (c *TorCollector) EnableSelfCheck(socksAddr, onionAddress string, onionPort int, timeout time.Duration) {
+	c.selfCheck = &onionSelfCheck{
+		socksAddr:    socksAddr,
+		onionAddress: onionAddress,
+		onionPort:    onionPort,
+		timeout:      timeout,
+	}
+}
 
-		if strings.HasPrefix(line, "250 OK") {
-			break
-		}
+// rememberOnions records a discovered onion service for the self-check
+func (c *TorCollector) rememberOnions(onions []string) {
+	if c.selfCheck == nil || len(onions) == 0 {
+		return
+	}
 
-		if strings.HasPrefix(line, "250-onions/current=") || strings.HasPrefix(line, "250+onions/current=") {
-			// Parse onion addresses
-			parts := strings.Split(line, "=")
-			if len(parts) > 1 {
-				onions := strings.Split(parts[1], ",")
-				count = len(onions)
-			}
-		}
+	c.selfCheck.mu.Lock()
+	c.selfCheck.discovered = onions[0]
+	c.selfCheck.mu.Unlock()
+}
 
-		if line == "." {
-			break
-		}
+// applySelfCheck copies the latest self-check result into m
+func (c *TorCollector) applySelfCheck(m *metrics.TorMetrics) {
+	sc := c.selfCheck
+	if sc == nil {
+		return
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.checked {
+		reachable := sc.reachable
+		m.OnionSelfReachable = &reachable
+		m.OnionSelfLatencyMs = sc.latencyMs
+		m.OnionSelfError = sc.lastError
+	}
+}
+
+// CheckOnionReachability connects to the node's own onion service through
+// Tor and records whether the rendezvous succeeded and how long it took. It
+// is driven by the maintenance scheduler since a rendezvous can take a while.
+func (c *TorCollector) CheckOnionReachability(ctx context.Context) error {
+	sc := c.selfCheck
+	if sc == nil {
+		return fmt.Errorf("onion self-check is not enabled")
+	}
+
+	sc.mu.Lock()
+	address := sc.onionAddress
+	if address == "" {
+		address = sc.discovered
+	}
+	sc.mu.Unlock()
+
+	if address == "" {
+		return fmt.Errorf("no onion address configured or discovered")
+	}
+	if !strings.HasSuffix(address, ".onion") {
+		address += ".onion"
+	}
+
+	startTime := time.Now()
+	conn, err := netproxy.DialSOCKS5(ctx, sc.socksAddr, address, sc.onionPort, sc.timeout)
+	latency := time.Since(startTime).Milliseconds()
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.checked = true
+	if err != nil {
+		sc.reachable = false
+		sc.latencyMs = 0
+		sc.lastError = err.Error()
+		return err
 	}
+	conn.Close()
 
-	return count, nil
+	sc.reachable = true
+	sc.latencyMs = latency
+	sc.lastError = ""
+	return nil
+}
+
+// partialConn ends a control-port session after a number of bytes, as if
+// Tor had dropped the connection mid-reply
+type partialConn struct {
+	controlConn
+	remaining int
+}
+
+func (p *partialConn) Read(b []byte) (int, error) {
+	if p.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n, err := p.controlConn.Read(b[:min(len(b), p.remaining)])
+	p.remaining -= n
+	return n, err
 }
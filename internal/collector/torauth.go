@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Control-port authentication outcomes, reported as tor.auth_status
+const (
+	torAuthOK              = "ok"
+	torAuthCookieMissing   = "cookie_missing"
+	torAuthCookieDenied    = "cookie_permission_denied"
+	torAuthCookiePath      = "cookie_path_mismatch"
+	torAuthPassword        = "password_required"
+	torAuthRejected        = "rejected"
+	torAuthProtocolFailure = "failed" // The exchange itself failed
+)
+
+// authFailure explains why the collector could not authenticate, in terms
+// an operator can act on
+type authFailure struct {
+	status string
+	detail string
+}
+
+func (f *authFailure) Error() string {
+	return f.detail
+}
+
+// protocolInfo is the part of a PROTOCOLINFO reply used to pick and
+// diagnose an authentication method
+type protocolInfo struct {
+	methods    []string // e.g. "NULL", "COOKIE", "SAFECOOKIE", "HASHEDPASSWORD"
+	cookieFile string   // Where Tor writes its cookie, if cookie auth is on
+}
+
+// accepts reports whether Tor offers an authentication method
+func (p *protocolInfo) accepts(method string) bool {
+	return slices.Contains(p.methods, method)
+}
+
+// getProtocolInfo sends PROTOCOLINFO, which Tor answers before
+// authentication, and parses the AUTH line of the reply
+func getProtocolInfo(reader *bufio.Reader, writer *bufio.Writer) (*protocolInfo, error) {
+	writer.WriteString("PROTOCOLINFO 1\r\n")
+	writer.Flush()
+
+	info := &protocolInfo{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+
+		if line == "250 OK" {
+			return info, nil
+		}
+		if !strings.HasPrefix(line, "250") {
+			return nil, fmt.Errorf("PROTOCOLINFO failed: %s", line)
+		}
+
+		// 250-AUTH METHODS=COOKIE,SAFECOOKIE COOKIEFILE="/run/tor/control.authcookie"
+		rest, ok := strings.CutPrefix(line[4:], "AUTH ")
+		if !ok {
+			continue
+		}
+		if methods, ok := strings.CutPrefix(rest, "METHODS="); ok {
+			methods, _, _ = strings.Cut(methods, " ")
+			info.methods = strings.Split(methods, ",")
+		}
+		if _, quoted, ok := strings.Cut(rest, "COOKIEFILE="); ok {
+			if path, err := strconv.Unquote(quoted); err == nil {
+				info.cookieFile = path
+			}
+		}
+	}
+}
+
+// HMAC keys for the SAFECOOKIE exchange, from Tor's control-spec
+const (
+	safeCookieServerKey = "Tor safe cookie authentication server-to-controller hash"
+	safeCookieClientKey = "Tor safe cookie authentication controller-to-server hash"
+)
+
+// errCookieRejected is returned when Tor refuses the cookie or proves it
+// knows a different one
+var errCookieRejected = errors.New("authentication rejected")
+
+// sendAuthenticate sends AUTHENTICATE with a hex-encoded credential
+func sendAuthenticate(reader *bufio.Reader, writer *bufio.Writer, credential string) error {
+	writer.WriteString(fmt.Sprintf("AUTHENTICATE %s\r\n", credential))
+	writer.Flush()
+
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(response, "250") {
+		return fmt.Errorf("%w: %s", errCookieRejected, strings.TrimSpace(response))
+	}
+	return nil
+}
+
+// authenticateSafeCookie runs the SAFECOOKIE challenge. Tor first proves it
+// holds the cookie by hashing it with our nonce, so a process that merely
+// listens on the control port cannot collect it, then we answer with our
+// own hash.
+func (c *TorCollector) authenticateSafeCookie(reader *bufio.Reader, writer *bufio.Writer, cookie []byte) error {
+	clientNonce := make([]byte, 32)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return err
+	}
+
+	writer.WriteString(fmt.Sprintf("AUTHCHALLENGE SAFECOOKIE %x\r\n", clientNonce))
+	writer.Flush()
+
+	// 250 AUTHCHALLENGE SERVERHASH=<hex> SERVERNONCE=<hex>
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	response = strings.TrimSpace(response)
+	if !strings.HasPrefix(response, "250 AUTHCHALLENGE ") {
+		return fmt.Errorf("AUTHCHALLENGE failed: %s", response)
+	}
+
+	var serverHash, serverNonce []byte
+	for _, field := range strings.Fields(response)[2:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "SERVERHASH":
+			serverHash, err = hex.DecodeString(value)
+		case "SERVERNONCE":
+			serverNonce, err = hex.DecodeString(value)
+		}
+		if err != nil {
+			return fmt.Errorf("malformed AUTHCHALLENGE reply: %s", response)
+		}
+	}
+	if serverHash == nil || serverNonce == nil {
+		return fmt.Errorf("malformed AUTHCHALLENGE reply: %s", response)
+	}
+
+	message := slices.Concat(cookie, clientNonce, serverNonce)
+
+	// A replayed session was answered for another nonce and a real cookie
+	if !c.capture.Replaying() && !hmac.Equal(serverHash, safeCookieHash(safeCookieServerKey, message)) {
+		return fmt.Errorf("%w: Tor's SAFECOOKIE server hash does not match our cookie", errCookieRejected)
+	}
+
+	return sendAuthenticate(reader, writer, hex.EncodeToString(safeCookieHash(safeCookieClientKey, message)))
+}
+
+// safeCookieHash computes one of the SAFECOOKIE HMAC-SHA256 hashes
+func safeCookieHash(key string, message []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// authenticatePassword sends the control password. Tor compares it with
+// its HashedControlPassword.
+func (c *TorCollector) authenticatePassword(reader *bufio.Reader, writer *bufio.Writer) error {
+	err := sendAuthenticate(reader, writer, hex.EncodeToString([]byte(c.password)))
+	if errors.Is(err, errCookieRejected) {
+		return &authFailure{torAuthRejected, "Tor rejected the control password; check tor.password matches HashedControlPassword"}
+	}
+	if err != nil {
+		return &authFailure{torAuthProtocolFailure, fmt.Sprintf("authentication failed: %v", err)}
+	}
+	return nil
+}
+
+// methodFailure explains why none of Tor's authentication methods can be
+// used with the configured credentials
+func (c *TorCollector) methodFailure(info *protocolInfo) *authFailure {
+	switch {
+	case info.accepts("HASHEDPASSWORD") && c.password == "":
+		return &authFailure{torAuthPassword, "Tor requires a control port password (HashedControlPassword); set tor.password"}
+	case c.password != "":
+		return &authFailure{torAuthProtocolFailure,
+			fmt.Sprintf("tor.password is set but Tor does not accept password authentication (%s)", strings.Join(info.methods, ","))}
+	default:
+		return &authFailure{torAuthProtocolFailure,
+			fmt.Sprintf("Tor offers no supported authentication method (%s)", strings.Join(info.methods, ","))}
+	}
+}
+
+// cookieFailure explains why the cookie could not be read: Tor writing it
+// somewhere else, cookie authentication being off, or the file's group
+// not including this process
+func (c *TorCollector) cookieFailure(info *protocolInfo, err error) *authFailure {
+	if wrongCookiePath(info.cookieFile, c.cookiePath) {
+		return &authFailure{torAuthCookiePath,
+			fmt.Sprintf("Tor writes its cookie to %s, not %s; set tor.cookie_path", info.cookieFile, c.cookiePath)}
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return &authFailure{torAuthCookieMissing,
+			fmt.Sprintf("cookie %s does not exist; check CookieAuthentication is enabled in torrc", c.cookiePath)}
+	case errors.Is(err, fs.ErrPermission):
+		detail := fmt.Sprintf("cannot read cookie %s", c.cookiePath)
+		if hint := cookieAccessHint(c.cookiePath); hint != "" {
+			detail += "; " + hint
+		}
+		return &authFailure{torAuthCookieDenied, detail}
+	default:
+		return &authFailure{torAuthProtocolFailure, fmt.Sprintf("failed to read cookie: %v", err)}
+	}
+}
+
+// wrongCookiePath reports whether Tor's cookie file differs from the
+// configured one
+func wrongCookiePath(torPath, configured string) bool {
+	return torPath != "" && filepath.Clean(torPath) != filepath.Clean(configured)
+}
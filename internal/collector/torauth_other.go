@@ -0,0 +1,46 @@
+//go:build !windows
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+)
+
+// cookieAccessHint describes why this process cannot read the cookie, most
+// often because it is not in the group Tor created the file with
+func cookieAccessHint(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		// The directory is not searchable, e.g. /var/lib/tor is 0700
+		return fmt.Sprintf("cannot access %s: %v", filepath.Dir(path), err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+
+	group := strconv.FormatUint(uint64(stat.Gid), 10)
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+
+	mode := info.Mode().Perm()
+	if mode&0o040 == 0 {
+		return fmt.Sprintf("it has mode %04o, so its group %s cannot read it; set CookieAuthFileGroupReadable 1 in torrc", mode, group)
+	}
+
+	groups, err := os.Getgroups()
+	if err != nil {
+		return ""
+	}
+	if !slices.Contains(groups, int(stat.Gid)) && os.Getegid() != int(stat.Gid) {
+		return fmt.Sprintf("it is readable by group %s, which this process is not a member of", group)
+	}
+	return ""
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package collector
+
+// cookieAccessHint has nothing to add on Windows, where files have no group
+// permissions
+func cookieAccessHint(path string) string {
+	return ""
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// utxoStats caches the result of the expensive gettxoutsetinfo RPC between runs
+type utxoStats struct {
+	mu      sync.Mutex
+	timeout time.Duration
+
+	txouts     int64
+	totalAmt   float64
+	diskSize   int64
+	height     int
+	haveResult bool
+}
+
+// EnableUTXOStats allows gettxoutsetinfo collection with the given timeout
+func (c *BitcoinCollector) EnableUTXOStats(timeout time.Duration) {
+	c.utxo = &utxoStats{
+		timeout: timeout,
+	}
+}
+
+// applyUTXOStats copies cached UTXO statistics into m
+func (c *BitcoinCollector) applyUTXOStats(m *metrics.BitcoinMetrics) {
+	u := c.utxo
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.haveResult {
+		m.UTXOCount = u.txouts
+		m.UTXOTotalAmount = u.totalAmt
+		m.UTXODiskSizeBytes = u.diskSize
+		m.UTXOStatsHeight = u.height
+	}
+}
+
+// RefreshUTXOStats runs gettxoutsetinfo and updates the cache. It is driven by
+// the maintenance scheduler rather than the collection loop.
+func (c *BitcoinCollector) RefreshUTXOStats(ctx context.Context) error {
+	u := c.utxo
+	if u == nil {
+		return fmt.Errorf("UTXO statistics are not available with the %s transport", c.transport)
+	}
+
+	startTime := time.Now()
+	info, err := c.getTxOutSetInfo(ctx, u.timeout)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	u.txouts = info.TxOuts
+	u.totalAmt = info.TotalAmount
+	u.diskSize = info.DiskSize
+	u.height = info.Height
+	u.haveResult = true
+	u.mu.Unlock()
+
+	logger.Info("UTXO set statistics updated", "height", info.Height, "duration", time.Since(startTime).Round(time.Second))
+	return nil
+}
+
+// txOutSetInfo is the subset of the gettxoutsetinfo result we record
+type txOutSetInfo struct {
+	Height      int     `json:"height"`
+	TxOuts      int64   `json:"txouts"`
+	DiskSize    int64   `json:"disk_size"`
+	TotalAmount float64 `json:"total_amount"`
+}
+
+// getTxOutSetInfo executes gettxoutsetinfo RPC with its own, longer timeout
+func (c *BitcoinCollector) getTxOutSetInfo(ctx context.Context, timeout time.Duration) (*txOutSetInfo, error) {
+	output, err := c.capture.do(c.source, "gettxoutsetinfo", func() ([]byte, error) {
+		return c.runCLIWithTimeout(ctx, timeout, "gettxoutsetinfo")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result txOutSetInfo
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse gettxoutsetinfo: %w", err)
+	}
+
+	return &result, nil
+}
@@ -2,27 +2,268 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // Config represents the monitoring agent configuration
 type Config struct {
-	CollectionIntervalSeconds int           `json:"collection_interval_seconds"`
-	RetentionDays             int           `json:"retention_days"`
-	DataDir                   string        `json:"data_dir"`
-	SocketPath                string        `json:"socket_path"`
-	Bitcoin                   BitcoinConfig `json:"bitcoin"`
-	Tor                       TorConfig     `json:"tor"`
-	System                    SystemConfig  `json:"system"`
+	CollectionIntervalSeconds int                   `json:"collection_interval_seconds"`
+	RetentionDays             int                   `json:"retention_days"`
+	MaxStorageBytes           int64                 `json:"max_storage_bytes"` // Oldest metrics files are deleted beyond this; 0 for no cap
+	DataDir                   string                `json:"data_dir"`
+	SocketPath                string                `json:"socket_path"`       // Unix socket path, loopback "tcp:host:port", or a Windows \\.\pipe\ name
+	StorageBackend            string                `json:"storage_backend"`   // "jsonl", "cbor" or "memory"
+	CollectionPaused          bool                  `json:"collection_paused"` // Start with collection paused
+	ShutdownTimeoutSeconds    int                   `json:"shutdown_timeout_seconds"`
+	OutputSchemaVersion       int                   `json:"output_schema_version"` // Pin responses to an older schema; 0 means current
+	Demo                      bool                  `json:"demo"`                  // Serve simulated metrics instead of collecting; for UI work and screenshots
+	Capture                   CaptureConfig         `json:"capture"`
+	Logging                   LoggingConfig         `json:"logging"`
+	Bitcoin                   BitcoinConfig         `json:"bitcoin"`
+	BitcoinNodes              []BitcoinConfig       `json:"bitcoin_nodes"` // Additional nodes, e.g. testnet and signet on the same host
+	ExternalTip               ExternalTipConfig     `json:"external_tip"`
+	Tor                       TorConfig             `json:"tor"`
+	System                    SystemConfig          `json:"system"`
+	Hardware                  HardwareConfig        `json:"hardware"`
+	Systemd                   SystemdConfig         `json:"systemd"`
+	MempoolSpace              MempoolSpaceConfig    `json:"mempool_space"`
+	Maintenance               MaintenanceConfig     `json:"maintenance"`
+	Alerts                    AlertsConfig          `json:"alerts"`
+	HTTP                      HTTPConfig            `json:"http"`
+	QueryTCP                  QueryTCPConfig        `json:"query_tcp"`     // The socket protocol over TLS, for other hosts
+	SocketLimits              SocketLimitsConfig    `json:"socket_limits"` // For the socket and query_tcp
+	Zabbix                    ZabbixConfig          `json:"zabbix"`
+	InfluxDB                  InfluxDBConfig        `json:"influxdb"`
+	ExecCollectors            []ExecCollectorConfig `json:"exec_collectors"`
+	SNMP                      SNMPConfig            `json:"snmp"`
+
+	// Route connections to external services through Tor or another proxy
+	OutboundProxy OutboundProxyConfig `json:"outbound_proxy"`
+
+	// Voluntary sharing of a few public statistics with a community
+	// pushgateway
+	Pushgateway PushgatewayConfig `json:"pushgateway"`
+
+	// Full results of selected RPC calls, kept apart from the metrics
+	RawSnapshots RawSnapshotsConfig `json:"raw_snapshots"`
+
+	// Fewer, coalesced wakeups for hosts on battery or solar power
+	PowerSaving PowerSavingConfig `json:"power_saving"`
+
+	// Copies of each day's compressed metrics file on another host
+	Replication ReplicationConfig `json:"replication"`
+
+	// Retention in days of sample sections such as "bitcoin" or "system",
+	// overriding retention_days. Files are kept for the longest retention,
+	// and sections past theirs are removed from them.
+	SectionRetentionDays map[string]int `json:"section_retention_days,omitempty"`
+
+	// Ownership and modes of the data directory and socket directory,
+	// checked at startup
+	Permissions PermissionsConfig `json:"permissions"`
+
+	// Users and groups allowed to connect to the Unix socket
+	SocketAccess SocketAccessConfig `json:"socket_access"`
+
+	// Named sets of privacy-sensitive data removed before samples leave the
+	// host; "public" is built in
+	RedactionProfiles map[string]RedactionProfile `json:"redaction_profiles"`
+
+	// Key for values written as "enc:v1:..." by btc-monitor -encrypt-secret;
+	// defaults to secrets.key next to the config file. A relative path is
+	// taken from the config file's directory.
+	SecretsKeyFile string `json:"secrets_key_file,omitempty"`
+
+	// Further config files merged over this one; see ReadLayers for the
+	// merge order
+	Include []string `json:"include,omitempty"`
+	Files   []string `json:"-"` // Files the config was read from, in merge order
+}
+
+// LoggingConfig contains log output settings
+type LoggingConfig struct {
+	Level  string `json:"level"`  // "debug", "info", "warn", or "error"
+	Format string `json:"format"` // "text" or "json"
+}
+
+// CaptureConfig records the raw responses collectors parse to a file, or
+// replays a recorded file in their place, to reproduce parsing problems
+type CaptureConfig struct {
+	Mode string `json:"mode"` // "record", "replay", or empty to disable
+	Path string `json:"path"`
+}
+
+// SNMPConfig contains settings for the AgentX subagent
+type SNMPConfig struct {
+	Enabled       bool   `json:"enabled"`
+	MasterAddress string `json:"master_address"` // Unix socket path, or "tcp:host:port"
+	BaseOID       string `json:"base_oid"`       // Subtree the subagent registers
+}
+
+// ExecCollectorConfig runs a command each cycle and records the JSON it
+// prints on stdout under custom.<name>
+type ExecCollectorConfig struct {
+	Name           string   `json:"name"`
+	Command        string   `json:"command"` // Executed directly, not through a shell
+	Args           []string `json:"args"`
+	TimeoutSeconds int      `json:"timeout_seconds"` // 0 means the collection interval
+}
+
+// InfluxDBConfig contains settings for writing samples to InfluxDB in line
+// protocol. Version 2 authenticates with Token and writes to Org/Bucket;
+// version 1 writes to Database with optional basic authentication.
+type InfluxDBConfig struct {
+	Enabled           bool              `json:"enabled"`
+	URL               string            `json:"url"`     // e.g. http://127.0.0.1:8086
+	Version           int               `json:"version"` // 1 or 2
+	Org               string            `json:"org"`
+	Bucket            string            `json:"bucket"`
+	Token             string            `json:"token"`
+	Database          string            `json:"database"`
+	RetentionPolicy   string            `json:"retention_policy"`
+	Username          string            `json:"username"`
+	Password          string            `json:"password"`
+	MeasurementPrefix string            `json:"measurement_prefix"` // Measurements are <prefix>_<section>, e.g. btcmon_bitcoin
+	Tags              map[string]string `json:"tags"`               // Added to every point; host defaults to the hostname
+
+	RedactionProfile string `json:"redaction_profile,omitempty"` // Applied to samples before they are written
+
+	BatchSize            int `json:"batch_size"`             // Samples per write
+	FlushIntervalSeconds int `json:"flush_interval_seconds"` // Write a partial batch after this long
+	MaxBufferedSamples   int `json:"max_buffered_samples"`   // Oldest samples are dropped beyond this while InfluxDB is unreachable
+	TimeoutSeconds       int `json:"timeout_seconds"`
+}
+
+// ZabbixConfig contains settings for pushing values to Zabbix trapper items
+type ZabbixConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Server         string `json:"server"`     // Zabbix server or proxy trapper, host:port
+	Host           string `json:"host"`       // Host name as configured in Zabbix; defaults to the hostname
+	KeyPrefix      string `json:"key_prefix"` // Items are <prefix>[<field>]
+	TimeoutSeconds int    `json:"timeout_seconds"`
+
+	RedactionProfile string `json:"redaction_profile,omitempty"` // Applied to samples before they are sent
+}
+
+// HTTPConfig contains settings for the optional HTTP API
+type HTTPConfig struct {
+	Enabled    bool           `json:"enabled"`
+	ListenAddr string         `json:"listen_addr"`
+	APIKeys    []APIKeyConfig `json:"api_keys"` // When empty, only read-metrics is available, without a key
+
+	// Source addresses or CIDR ranges allowed to connect; empty allows all
+	AllowedIPs []string `json:"allowed_ips"`
+
+	// Bind only to loopback and serve only requests addressed to a .onion
+	// host, for publishing the API as a Tor hidden service
+	OnionOnly bool `json:"onion_only"`
+
+	ShareLinks ShareLinksConfig `json:"share_links"`
+}
+
+// QueryTCPConfig serves the socket protocol on TCP with TLS, so a
+// dashboard on another host can query the agent without forwarding the
+// Unix socket. With api_keys, clients send "AUTH <key>" before their
+// command and may only use the commands the key's scopes cover: GET, PING
+// and INFO need read-metrics, GET config read-config, and the rest admin.
+// Without keys, clients presenting a certificate signed by client_ca_file
+// get read-metrics. Redaction profiles of keys do not apply here.
+type QueryTCPConfig struct {
+	Enabled      bool           `json:"enabled"`
+	ListenAddr   string         `json:"listen_addr"`
+	CertFile     string         `json:"cert_file"`
+	KeyFile      string         `json:"key_file"`
+	APIKeys      []APIKeyConfig `json:"api_keys"`
+	ClientCAFile string         `json:"client_ca_file"` // Require client certificates signed by this CA
+
+	// Source addresses or CIDR ranges allowed to connect; empty allows all
+	AllowedIPs []string `json:"allowed_ips"`
+
+	// Bind only to loopback, for publishing the listener as a Tor hidden
+	// service
+	OnionOnly bool `json:"onion_only"`
+}
+
+// SocketLimitsConfig bounds the load clients of the query socket and the
+// query_tcp listener can put on the agent. Connections beyond
+// max_connections are closed at once. Clients are told apart by address
+// on query_tcp and by user on the Unix socket where the platform reports
+// it.
+type SocketLimitsConfig struct {
+	MaxConnections        int `json:"max_connections"`         // Handled at once
+	MaxRequestBytes       int `json:"max_request_bytes"`       // Longest command line
+	RequestTimeoutSeconds int `json:"request_timeout_seconds"` // To send a command and read the response; idle connections are closed after it
+	RateLimitPerMinute    int `json:"rate_limit_per_minute"`   // Per client; 0 means unlimited
+}
+
+// API key scopes
+const (
+	ScopeReadMetrics = "read-metrics"
+	ScopeReadConfig  = "read-config"
+	ScopeAdmin       = "admin" // Implies every other scope
+)
+
+// APIKeyConfig is a named API key with the scopes it grants
+type APIKeyConfig struct {
+	Name               string   `json:"name"` // Used to attribute requests in the log
+	Key                string   `json:"key"`
+	Scopes             []string `json:"scopes"`
+	RateLimitPerMinute int      `json:"rate_limit_per_minute"` // 0 means unlimited
+
+	// Applied to the samples served to this key, e.g. "public" for a key
+	// given to a shared dashboard
+	RedactionProfile string `json:"redaction_profile,omitempty"`
+}
+
+// ShareLinksConfig lets admin keys mint expiring read-only links to the
+// current sample and summary, for showing a node's status to someone
+// without giving them a key. Links grant no controls, configuration or
+// live stream, and are signed with a secret kept in the data directory.
+type ShareLinksConfig struct {
+	Enabled          bool   `json:"enabled"`
+	MaxTTLHours      int    `json:"max_ttl_hours"`
+	RedactionProfile string `json:"redaction_profile"` // Applied to shared samples
 }
 
 // BitcoinConfig contains Bitcoin Core monitoring settings
 type BitcoinConfig struct {
+	Name           string `json:"name,omitempty"` // Required for bitcoin_nodes entries; keys the node in samples
 	Enabled        bool   `json:"enabled"`
 	CLIPath        string `json:"cli_path"`
 	DataDir        string `json:"data_dir"`
 	User           string `json:"user"`
 	TimeoutSeconds int    `json:"timeout_seconds"`
+	Transport      string `json:"transport"`       // "cli", "rest" (only RPCs with a REST equivalent), or "auto" (cli with REST fallback)
+	RESTURL        string `json:"rest_url"`        // Base URL of bitcoind's REST interface (-rest=1)
+	Chain          string `json:"chain,omitempty"` // Passed to bitcoin-cli as -chain, e.g. "test" or "signet"
+	MaxConnections int    `json:"max_connections"` // The node's -maxconnections; 0 reads bitcoin.conf in data_dir
+
+	// Networks the node should advertise a local address on, such as
+	// "onion". Each is reported under bitcoin.advertised.
+	AdvertiseNetworks []string `json:"advertise_networks,omitempty"`
+
+	// gettxoutsetinfo is expensive; it runs as the "utxo_stats" maintenance job
+	UTXOStatsTimeoutSeconds int `json:"utxo_stats_timeout_seconds"`
+
+	// Per-method cache TTLs for expensive RPCs, shared by collectors and PROXY
+	CacheTTLSeconds map[string]int `json:"cache_ttl_seconds"`
+}
+
+// ExternalTipConfig selects an independent view of the chain tip, used to
+// notice a node that looks healthy but no longer hears about new blocks
+type ExternalTipConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Source         string `json:"source"`  // "explorer" or "node"
+	Node           string `json:"node"`    // bitcoin_nodes entry on the same chain, for the "node" source
+	URL            string `json:"url"`     // Esplora-compatible API base, e.g. http://<onion>/api
+	UseTor         bool   `json:"use_tor"` // Reach the explorer through Tor's SOCKS port; implied by outbound_proxy
+	RefreshSeconds int    `json:"refresh_seconds"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
 }
 
 // TorConfig contains Tor monitoring settings
@@ -31,12 +272,388 @@ type TorConfig struct {
 	ControlPort    int    `json:"control_port"`
 	CookiePath     string `json:"cookie_path"`
 	TimeoutSeconds int    `json:"timeout_seconds"`
+
+	// torrc ControlSocket path, used instead of control_port when set
+	ControlSocket string `json:"control_socket"`
+	// Control password for HashedControlPassword, used instead of the
+	// cookie when set
+	Password string `json:"password"`
+
+	// Onion self-reachability probe, run as the "onion_check" maintenance job
+	SOCKSPort               int    `json:"socks_port"`
+	OnionAddress            string `json:"onion_address"` // Discovered via GETINFO onions/current if empty
+	OnionPort               int    `json:"onion_port"`
+	SelfCheckTimeoutSeconds int    `json:"self_check_timeout_seconds"`
+}
+
+// OutboundProxyConfig routes every connection to an external service, such
+// as notifications, exporters and the block explorer, through a SOCKS5
+// proxy so none of them reveal the node's IP address. Hostnames are
+// resolved by the proxy. Loopback addresses are always reached directly.
+type OutboundProxyConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Address     string   `json:"address"`      // host:port; defaults to Tor's socks_port on 127.0.0.1
+	DirectHosts []string `json:"direct_hosts"` // Hostnames or CIDR ranges reached without the proxy, e.g. a LAN InfluxDB
+}
+
+// PushgatewayConfig contains settings for sharing aggregate network-health
+// statistics with a community Prometheus pushgateway. Only a fixed set of
+// public values is pushed: block height, chain, node and monitor version,
+// and node uptime rounded to the hour. Nothing that identifies the host,
+// its peers or its addresses is sent.
+type PushgatewayConfig struct {
+	Enabled         bool   `json:"enabled"`
+	URL             string `json:"url"`              // Pushgateway base URL, e.g. an onion address
+	Job             string `json:"job"`              // Job label of the pushed group
+	Instance        string `json:"instance"`         // Instance label; defaults to a random ID kept in the data directory
+	UseTor          bool   `json:"use_tor"`          // Push through Tor's socks_port when outbound_proxy is disabled
+	IntervalSeconds int    `json:"interval_seconds"` // Time between pushes
+	TimeoutSeconds  int    `json:"timeout_seconds"`
+}
+
+// RawSnapshotsConfig stores the verbatim results of selected RPC calls in
+// the raw stream under <data_dir>/raw, for post-incident analysis beyond
+// the summarized metrics. Only read-only methods are accepted.
+type RawSnapshotsConfig struct {
+	Enabled       bool              `json:"enabled"`
+	RetentionDays int               `json:"retention_days"` // Separate from the metrics, as full results are much larger
+	Calls         []RawSnapshotCall `json:"calls"`
+}
+
+// RawSnapshotCall is one RPC call stored on a schedule
+type RawSnapshotCall struct {
+	Method   string   `json:"method"`
+	Params   []string `json:"params,omitempty"` // Arguments as given to bitcoin-cli
+	Node     string   `json:"node,omitempty"`   // Name of an entry in bitcoin_nodes; empty for the primary node
+	Schedule string   `json:"schedule"`         // Cron expression, or e.g. "@every 10m"
+}
+
+// rawSnapshotMethods are the RPC methods a raw snapshot may call. None of
+// them change the node's state.
+var rawSnapshotMethods = map[string]bool{
+	"getaddednodeinfo":    true,
+	"getaddrmaninfo":      true,
+	"getbestblockhash":    true,
+	"getblockchaininfo":   true,
+	"getchaintips":        true,
+	"getchaintxstats":     true,
+	"getdeploymentinfo":   true,
+	"getindexinfo":        true,
+	"getmemoryinfo":       true,
+	"getmempoolinfo":      true,
+	"getmininginfo":       true,
+	"getnettotals":        true,
+	"getnetworkinfo":      true,
+	"getnodeaddresses":    true,
+	"getpeerinfo":         true,
+	"getrawmempool":       true,
+	"getrpcinfo":          true,
+	"getzmqnotifications": true,
+	"listbanned":          true,
+	"uptime":              true,
+}
+
+// RedactionProfile selects the privacy-sensitive data removed from samples
+// shared outside the host. Removed addresses are replaced with
+// "[redacted]"; removed fields are left out.
+type RedactionProfile struct {
+	PeerAddresses  bool     `json:"peer_addresses"`  // IPv4 and IPv6 addresses, including CJDNS
+	OnionAddresses bool     `json:"onion_addresses"` // Tor onion and I2P addresses
+	WalletData     bool     `json:"wallet_data"`     // Fields whose name mentions a wallet or balance, e.g. from custom collectors
+	Fields         []string `json:"fields"`          // Further fields to remove by path, e.g. "hardware" or "nodes.*.local_addresses"
 }
 
 // SystemConfig contains system monitoring settings
 type SystemConfig struct {
 	Enabled         bool   `json:"enabled"`
 	MonitorDiskPath string `json:"monitor_disk_path"` // Path to monitor for disk metrics
+
+	// Further filesystems, such as the OS disk when the chain is on its own,
+	// reported per path in system.disks alongside monitor_disk_path
+	MonitorDiskPaths []string `json:"monitor_disk_paths"`
+
+	// Interfaces counted in net_rx_bps and net_tx_bps, as names or globs
+	// such as "eth*". Empty counts all, including VPN and tunnel devices
+	// that carry the same traffic twice.
+	NetInterfaces []string `json:"net_interfaces"`
+
+	DiskForecastWindowDays int `json:"disk_forecast_window_days"` // History used for the days-until-full forecast
+
+	SelfMetrics          bool    `json:"self_metrics"`            // Report the agent's own memory and goroutines
+	LeakWindowDays       int     `json:"leak_window_days"`        // History checked for steady growth
+	LeakMinGrowthPercent float64 `json:"leak_min_growth_percent"` // Smaller RSS growth is not flagged
+
+	// Clock offset source: "auto" (chronyc, then timedatectl), "chrony",
+	// "timedatectl", "ntp" (query ntp_server directly), or "none". Only
+	// "ntp" contacts another host.
+	ClockSource string `json:"clock_source"`
+	NTPServer   string `json:"ntp_server"` // host[:port]
+}
+
+// HardwareConfig contains BMC hardware health monitoring settings
+type HardwareConfig struct {
+	Enabled             bool     `json:"enabled"`
+	Source              string   `json:"source"` // "redfish" or "ipmi"
+	RedfishURL          string   `json:"redfish_url"`
+	Username            string   `json:"username"`
+	Password            string   `json:"password"`
+	InsecureTLS         bool     `json:"insecure_tls"` // Accept the BMC's self-signed certificate
+	IPMIToolPath        string   `json:"ipmitool_path"`
+	IPMIToolArgs        []string `json:"ipmitool_args"` // e.g. ["-I", "lanplus", "-H", "bmc", "-U", "admin", "-P", "secret"] for a remote BMC
+	TimeoutSeconds      int      `json:"timeout_seconds"`
+	PollIntervalSeconds int      `json:"poll_interval_seconds"`
+}
+
+// SystemdConfig selects systemd units whose state is reported
+type SystemdConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Units          []string `json:"units"` // e.g. "bitcoind.service"; reported without the .service suffix
+	SystemctlPath  string   `json:"systemctl_path"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+// MempoolSpaceConfig checks a self-hosted mempool.space instance, as many
+// node stacks bundle, against the node it is backed by
+type MempoolSpaceConfig struct {
+	Enabled        bool   `json:"enabled"`
+	URL            string `json:"url"`  // API base, e.g. http://127.0.0.1:4080/api
+	Node           string `json:"node"` // bitcoin_nodes entry backing the instance; empty for the primary node
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// MaintenanceConfig contains schedules for low-frequency maintenance jobs
+type MaintenanceConfig struct {
+	JitterSeconds int               `json:"jitter_seconds"` // Random delay added to each run
+	Jobs          map[string]string `json:"jobs"`           // Job name -> cron expression; empty disables the job
+
+	// Where the "backup" job writes gzip-compressed archives of the metrics,
+	// keeping the newest backup_keep. Best on another disk than data_dir.
+	BackupDir  string `json:"backup_dir"`
+	BackupKeep int    `json:"backup_keep"`
+
+	// Where the "reports" job writes the min, avg and max of report_fields
+	// over the samples stored since its previous run, keeping the newest
+	// report_keep. Fields may name sections; empty reports every numeric
+	// field. The directory defaults to <data_dir>/reports.
+	ReportDir    string   `json:"report_dir"`
+	ReportKeep   int      `json:"report_keep"`
+	ReportFields []string `json:"report_fields"`
+}
+
+// PowerSavingConfig trades resolution for fewer wakeups. Collections,
+// maintenance jobs and socket checks run on the same wall-clock
+// boundaries, samples reach the disk in batches, and system metrics that
+// need frequent sampling or a helper process are left out.
+type PowerSavingConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Boundary everything is aligned to; collection_interval_seconds is
+	// raised to a multiple of it
+	AlignSeconds int `json:"align_seconds"`
+
+	// Samples are held in memory and written together this often; up to
+	// this much data is lost if the agent crashes
+	FlushIntervalSeconds int `json:"flush_interval_seconds"`
+
+	// "pressure" (10-second stall averages), "interfaces" (per-interface
+	// rates; totals are kept), "thermal" (sensor scan and vcgencmd) and
+	// "clock" (chronyc or timedatectl)
+	SkipSystemMetrics []string `json:"skip_system_metrics"`
+}
+
+// skippableSystemMetrics are the valid skip_system_metrics entries
+var skippableSystemMetrics = map[string]bool{"pressure": true, "interfaces": true, "thermal": true, "clock": true}
+
+// retentionSections are the sample sections section_retention_days accepts
+var retentionSections = map[string]bool{
+	"system": true, "bitcoin": true, "nodes": true, "tor": true, "hardware": true, "services": true,
+	"derived": true, "agent": true, "custom": true, "mempool_space": true, "socket": true,
+}
+
+// ReplicationConfig uploads each day's metrics file once it is compressed,
+// so history survives wiping and re-flashing the device. Failed uploads
+// are retried, and files compressed while replication was off are picked
+// up when the agent starts.
+type ReplicationConfig struct {
+	Enabled              bool       `json:"enabled"`
+	Target               string     `json:"target"`                 // "s3" or "sftp"
+	Prefix               string     `json:"prefix"`                 // Key prefix or remote directory; defaults to the hostname
+	RetryIntervalSeconds int        `json:"retry_interval_seconds"` // Time between attempts while uploads fail
+	TimeoutSeconds       int        `json:"timeout_seconds"`        // Per file
+	S3                   S3Config   `json:"s3"`
+	SFTP                 SFTPConfig `json:"sftp"`
+}
+
+// S3Config selects an S3-compatible bucket, such as AWS S3, MinIO or
+// Backblaze B2
+type S3Config struct {
+	Endpoint        string `json:"endpoint"` // e.g. https://minio.lan:9000; defaults to AWS in the region
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	PathStyle       bool   `json:"path_style"` // Bucket in the URL path rather than the host name, as MinIO needs
+}
+
+// SFTPConfig selects a directory on an SFTP server. Uploads run the
+// OpenSSH sftp client with key authentication; the server's key must be in
+// known_hosts. Unlike S3 uploads, they do not go through outbound_proxy.
+type SFTPConfig struct {
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	User           string `json:"user"`
+	KeyFile        string `json:"key_file"`         // Private key; defaults to the user's ssh keys
+	KnownHostsFile string `json:"known_hosts_file"` // Defaults to ~/.ssh/known_hosts
+	Command        string `json:"command"`          // Path to sftp
+}
+
+// PermissionsConfig is the ownership and modes the agent's files should
+// have. Every difference found at startup is logged, and fixed when Repair
+// is set; settings left empty are not checked. Ownership applies to
+// everything under the data directory, modes only to the data directory
+// and the stored metrics and raw snapshots, leaving private state such as
+// notification queues alone. For a dashboard reading the metrics as
+// another user, set group with modes 0750 and 0640.
+type PermissionsConfig struct {
+	Repair   bool   `json:"repair"`    // Fix differences instead of only logging them
+	Owner    string `json:"owner"`     // User name or ID
+	Group    string `json:"group"`     // Group name or ID
+	DirMode  string `json:"dir_mode"`  // Octal, e.g. "0750"
+	FileMode string `json:"file_mode"` // Octal, e.g. "0640"
+
+	// Mode of the directory holding a Unix socket, which is created if it
+	// does not exist, e.g. /run/bitcoin-monitor after a reboot. Empty
+	// leaves the directory alone, as it is usually shared, like /var/run.
+	SocketDirMode string `json:"socket_dir_mode"`
+}
+
+// SocketAccessConfig limits the Unix socket to peers whose credentials,
+// as reported by the kernel for each connection, match a listed user or
+// group. With either list set the socket file is made writable by
+// everyone, so access no longer depends on the socket directory and file
+// permissions; root and the agent's own user are always allowed. Linux
+// only.
+type SocketAccessConfig struct {
+	AllowUsers  []string `json:"allow_users"`  // User names or IDs
+	AllowGroups []string `json:"allow_groups"` // Group names or IDs; supplementary groups count
+}
+
+// Enabled reports whether any users or groups are listed
+func (a *SocketAccessConfig) Enabled() bool {
+	return len(a.AllowUsers) > 0 || len(a.AllowGroups) > 0
+}
+
+// Modes returns the parsed dir_mode, file_mode and socket_dir_mode, each 0
+// when unset
+func (p *PermissionsConfig) Modes() (dir, file, socketDir os.FileMode, err error) {
+	if dir, err = parseMode("dir_mode", p.DirMode); err != nil {
+		return 0, 0, 0, err
+	}
+	if file, err = parseMode("file_mode", p.FileMode); err != nil {
+		return 0, 0, 0, err
+	}
+	if socketDir, err = parseMode("socket_dir_mode", p.SocketDirMode); err != nil {
+		return 0, 0, 0, err
+	}
+	return dir, file, socketDir, nil
+}
+
+// parseMode parses an octal permission such as "0640", or returns 0 for an
+// empty one
+func parseMode(setting, value string) (os.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid permissions %s %q (use octal such as 0640)", setting, value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// AlertsConfig contains alert rules and notification channels
+type AlertsConfig struct {
+	Enabled  bool           `json:"enabled"`
+	Rules    []AlertRule    `json:"rules"`
+	Telegram TelegramConfig `json:"telegram"`
+	Ntfy     NtfyConfig     `json:"ntfy"`
+	Nostr    NostrConfig    `json:"nostr"`
+	Email    EmailConfig    `json:"email"`
+
+	// Notifications a channel could not deliver wait here for a retry
+	Queue NotificationQueueConfig `json:"queue"`
+
+	// Language of notification text, e.g. "de" or "pt-BR". Catalogs in
+	// LocaleDir named <locale>.json override the built-in translations.
+	Locale    string `json:"locale"`
+	LocaleDir string `json:"locale_dir,omitempty"`
+}
+
+// NotificationQueueConfig bounds the queue each notification channel keeps
+// while it cannot deliver, e.g. during an internet outage. Queues are saved
+// under the data directory, so notifications also survive a restart.
+type NotificationQueueConfig struct {
+	MaxQueued               int    `json:"max_queued"`                 // Per channel
+	MaxAgeHours             int    `json:"max_age_hours"`              // Older notifications are dropped undelivered
+	RetryIntervalSeconds    int    `json:"retry_interval_seconds"`     // Wait after the first failure; doubles after each one
+	MaxRetryIntervalSeconds int    `json:"max_retry_interval_seconds"` // Upper bound for the doubling
+	MaxAttempts             int    `json:"max_attempts"`               // Notifications still failing after this many are dropped
+	DropPolicy              string `json:"drop_policy"`                // "oldest" or "lowest_severity", applied when a queue is full
+}
+
+// AlertRule fires when a sample field compares against a threshold for a
+// sustained period. Field uses dotted names such as "bitcoin.peers"; the
+// derived fields "bitcoin.blocks_behind", "bitcoin.blocks_behind_external",
+// "bitcoin.time_drift_seconds", "system.disk_used_percent" and
+// "system.clock_drift_seconds" are also available.
+type AlertRule struct {
+	Name       string  `json:"name"`
+	Field      string  `json:"field"`
+	Op         string  `json:"op"` // ">", ">=", "<", "<=", "==", "!="
+	Threshold  float64 `json:"threshold"`
+	ForSeconds int     `json:"for_seconds"` // How long the condition must hold before firing
+	Severity   string  `json:"severity"`    // "info", "warning", or "critical"
+
+	// Node operating states the rule applies in, e.g. ["steady"]; empty for
+	// all. Outside them the condition is treated as not holding.
+	States []string `json:"states,omitempty"`
+}
+
+// TelegramConfig contains Telegram bot notification settings
+type TelegramConfig struct {
+	Enabled  bool   `json:"enabled"`
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+}
+
+// NtfyConfig contains ntfy push notification settings
+type NtfyConfig struct {
+	Enabled   bool   `json:"enabled"`
+	ServerURL string `json:"server_url"` // https://ntfy.sh or a self-hosted instance
+	Topic     string `json:"topic"`
+	Token     string `json:"token"` // Optional access token
+}
+
+// NostrConfig contains Nostr direct message settings. Alerts are sent as
+// encrypted private messages signed with the agent's own key.
+type NostrConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Recipient string   `json:"recipient"` // npub or hex public key receiving the alerts
+	Relays    []string `json:"relays"`    // wss:// URLs; sent once any relay accepts
+	Protocol  string   `json:"protocol"`  // "nip17" (gift-wrapped, default) or "nip04" for clients without NIP-17
+	KeyFile   string   `json:"key_file"`  // Agent's private key, generated if missing; defaults to <data_dir>/nostr.key
+}
+
+// EmailConfig contains SMTP notification settings
+type EmailConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Security string   `json:"security"` // "starttls", "tls" (implicit, usually port 465), or "none"
+	Username string   `json:"username"` // Leave empty to skip authentication
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
 }
 
 // DefaultConfig returns the default configuration
@@ -44,57 +661,467 @@ func DefaultConfig() *Config {
 	return &Config{
 		CollectionIntervalSeconds: 30,
 		RetentionDays:             30,
-		DataDir:                   "/var/lib/bitcoin-monitor",
-		SocketPath:                "/var/run/bitcoin-monitor.sock",
+		DataDir:                   defaultDataDir,
+		SocketPath:                defaultSocketPath,
+		StorageBackend:            "jsonl",
+		ShutdownTimeoutSeconds:    20,
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
 		Bitcoin: BitcoinConfig{
 			Enabled:        true,
 			CLIPath:        "/usr/local/bin/bitcoin-cli",
 			DataDir:        "/var/lib/bitcoin",
 			User:           "bitcoin",
 			TimeoutSeconds: 10,
+			Transport:      "cli",
+			RESTURL:        "http://127.0.0.1:8332",
+
+			UTXOStatsTimeoutSeconds: 600,
+
+			CacheTTLSeconds: map[string]int{
+				"getrawmempool":    30,
+				"getaddrmaninfo":   300,
+				"getnodeaddresses": 300,
+			},
 		},
 		Tor: TorConfig{
 			Enabled:        true,
 			ControlPort:    9051,
 			CookiePath:     "/var/lib/tor/control_auth_cookie",
 			TimeoutSeconds: 10,
+
+			SOCKSPort:               9050,
+			OnionPort:               8333,
+			SelfCheckTimeoutSeconds: 60,
 		},
 		System: SystemConfig{
 			Enabled:         true,
 			MonitorDiskPath: "/var/lib/bitcoin",
+
+			DiskForecastWindowDays: 7,
+			SelfMetrics:            true,
+			LeakWindowDays:         3,
+			LeakMinGrowthPercent:   20,
+			ClockSource:            "auto",
+			NTPServer:              "pool.ntp.org",
+		},
+		Hardware: HardwareConfig{
+			Enabled:             false,
+			Source:              "redfish",
+			RedfishURL:          "https://127.0.0.1",
+			IPMIToolPath:        "/usr/bin/ipmitool",
+			TimeoutSeconds:      20,
+			PollIntervalSeconds: 300,
+		},
+		Systemd: SystemdConfig{
+			Enabled:        false,
+			Units:          []string{"bitcoind.service", "tor.service"},
+			SystemctlPath:  "/usr/bin/systemctl",
+			TimeoutSeconds: 5,
+		},
+		MempoolSpace: MempoolSpaceConfig{
+			TimeoutSeconds: 10,
+		},
+		Maintenance: MaintenanceConfig{
+			JitterSeconds: 60,
+			Jobs: map[string]string{
+				"cleanup":     "30 3 * * *",
+				"compaction":  "5 0 * * *",
+				"utxo_stats":  "",
+				"onion_check": "",
+				"backup":      "",
+				"reports":     "",
+			},
+			BackupKeep: 7,
+			ReportKeep: 30,
+		},
+		HTTP: HTTPConfig{
+			Enabled:    false,
+			ListenAddr: "127.0.0.1:8335",
+			ShareLinks: ShareLinksConfig{
+				Enabled:          false,
+				MaxTTLHours:      168,
+				RedactionProfile: "public",
+			},
+		},
+		QueryTCP: QueryTCPConfig{
+			Enabled:    false,
+			ListenAddr: ":8336",
+		},
+		SocketLimits: SocketLimitsConfig{
+			MaxConnections:        64,
+			MaxRequestBytes:       64 << 10,
+			RequestTimeoutSeconds: 10,
+		},
+		SNMP: SNMPConfig{
+			Enabled:       false,
+			MasterAddress: "/var/agentx/master",
+			BaseOID:       "1.3.6.1.4.1.8072.9999.9999.8333", // NET-SNMP-MIB::netSnmpPlaypen; use your own PEN in production
+		},
+		Pushgateway: PushgatewayConfig{
+			Job:             "btc_node_monitor",
+			UseTor:          true,
+			IntervalSeconds: 3600,
+			TimeoutSeconds:  60,
+		},
+		RawSnapshots: RawSnapshotsConfig{
+			RetentionDays: 7,
+		},
+		PowerSaving: PowerSavingConfig{
+			Enabled:              false,
+			AlignSeconds:         300,
+			FlushIntervalSeconds: 1800,
+			SkipSystemMetrics:    []string{"pressure", "interfaces", "thermal", "clock"},
+		},
+		Replication: ReplicationConfig{
+			Enabled:              false,
+			Target:               "s3",
+			RetryIntervalSeconds: 900,
+			TimeoutSeconds:       300,
+			S3:                   S3Config{Region: "us-east-1"},
+			SFTP:                 SFTPConfig{Port: 22, Command: "sftp"},
+		},
+		RedactionProfiles: map[string]RedactionProfile{
+			"public": {PeerAddresses: true, OnionAddresses: true, WalletData: true},
+		},
+		Zabbix: ZabbixConfig{
+			Enabled:        false,
+			Server:         "127.0.0.1:10051",
+			KeyPrefix:      "btcmon",
+			TimeoutSeconds: 10,
 		},
+		InfluxDB: InfluxDBConfig{
+			Enabled:              false,
+			URL:                  "http://127.0.0.1:8086",
+			Version:              2,
+			MeasurementPrefix:    "btcmon",
+			BatchSize:            10,
+			FlushIntervalSeconds: 60,
+			MaxBufferedSamples:   1000,
+			TimeoutSeconds:       10,
+		},
+		ExternalTip: ExternalTipConfig{
+			Source:         "explorer",
+			URL:            "http://mempoolhqx4isw62xs7abwphsq7ldayuidyx2v2oethdhhj6mlo2r6ad.onion/api",
+			UseTor:         true,
+			RefreshSeconds: 60,
+			TimeoutSeconds: 30,
+		},
+		Alerts: AlertsConfig{
+			Enabled: false,
+			Rules: []AlertRule{
+				{Name: "no_peers", Field: "bitcoin.peers", Op: "<", Threshold: 1, ForSeconds: 300, Severity: "critical"},
+				{Name: "falling_behind", Field: "bitcoin.blocks_behind", Op: ">", Threshold: 6, ForSeconds: 1800, Severity: "warning", States: []string{"steady", "pruning"}},
+				{Name: "behind_external_tip", Field: "bitcoin.blocks_behind_external", Op: ">", Threshold: 3, ForSeconds: 1800, Severity: "critical"},
+				{Name: "onion_not_advertised", Field: "bitcoin.advertised.onion.listed", Op: "<", Threshold: 1, ForSeconds: 600, Severity: "warning"},
+				{Name: "inbound_slots_full", Field: "bitcoin.inbound_slots_used_percent", Op: ">=", Threshold: 100, ForSeconds: 900, Severity: "warning"},
+				{Name: "memory_pressure", Field: "system.pressure.memory.full_avg60", Op: ">", Threshold: 10, ForSeconds: 300, Severity: "warning"},
+				{Name: "clock_drift", Field: "system.clock_drift_seconds", Op: ">", Threshold: 5, ForSeconds: 900, Severity: "warning"},
+				{Name: "bitcoin_time_offset", Field: "bitcoin.time_drift_seconds", Op: ">", Threshold: 600, ForSeconds: 900, Severity: "warning"},
+				{Name: "disk_full", Field: "system.disk_used_percent", Op: ">=", Threshold: 90, Severity: "critical"},
+				{Name: "disk_full_forecast", Field: "derived.disk_days_until_full", Op: "<", Threshold: 30, Severity: "warning"},
+				{Name: "tor_auth_failed", Field: "tor.authenticated", Op: "<", Threshold: 1, ForSeconds: 300, Severity: "warning"},
+				{Name: "tor_not_bootstrapped", Field: "tor.bootstrap_progress", Op: "<", Threshold: 100, ForSeconds: 600, Severity: "warning"},
+				{Name: "mempool_space_lagging", Field: "mempool_space.backend_lag_blocks", Op: ">", Threshold: 2, ForSeconds: 600, Severity: "warning"},
+				{Name: "bitcoind_service_down", Field: "services.bitcoind.active", Op: "<", Threshold: 1, ForSeconds: 120, Severity: "critical"},
+				{Name: "hardware_fault", Field: "hardware.faults", Op: ">", Threshold: 0, ForSeconds: 120, Severity: "critical"},
+				{Name: "query_socket_unusable", Field: "socket.usable", Op: "<", Threshold: 1, ForSeconds: 120, Severity: "warning"},
+			},
+			Ntfy: NtfyConfig{
+				ServerURL: "https://ntfy.sh",
+			},
+			Nostr: NostrConfig{
+				Protocol: "nip17",
+			},
+			Email: EmailConfig{
+				Port:     587,
+				Security: "starttls",
+			},
+			Queue: NotificationQueueConfig{
+				MaxQueued:               200,
+				MaxAgeHours:             48,
+				RetryIntervalSeconds:    15,
+				MaxRetryIntervalSeconds: 600,
+				MaxAttempts:             100,
+				DropPolicy:              "lowest_severity",
+			},
+			Locale: "en",
+		},
+	}
+}
+
+// MetricsRetentionDays returns how long metrics files are kept: the
+// longest of retention_days and section_retention_days
+func (c *Config) MetricsRetentionDays() int {
+	days := c.RetentionDays
+	for _, sectionDays := range c.SectionRetentionDays {
+		days = max(days, sectionDays)
+	}
+	return days
+}
+
+// DiskPaths returns monitor_disk_path followed by monitor_disk_paths,
+// without duplicates
+func (s *SystemConfig) DiskPaths() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, path := range append([]string{s.MonitorDiskPath}, s.MonitorDiskPaths...) {
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// CountsInterface reports whether traffic on a network interface is included
+// in the system totals
+func (s *SystemConfig) CountsInterface(name string) bool {
+	if len(s.NetInterfaces) == 0 {
+		return true
+	}
+	for _, pattern := range s.NetInterfaces {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// advertiseNetworks are the getnetworkinfo network names a node can have
+// local addresses on
+var advertiseNetworks = map[string]bool{"ipv4": true, "ipv6": true, "onion": true, "i2p": true, "cjdns": true}
+
+// validate checks settings that have no sensible default
+func (b *BitcoinConfig) validate() error {
+	switch b.Transport {
+	case "cli", "rest", "auto":
+	default:
+		return fmt.Errorf("unknown transport %q (use cli, rest or auto)", b.Transport)
+	}
+	for _, network := range b.AdvertiseNetworks {
+		if !advertiseNetworks[network] {
+			return fmt.Errorf("unknown advertise_networks entry %q (use ipv4, ipv6, onion, i2p or cjdns)", network)
+		}
+	}
+	return nil
+}
+
+// applyDefaults fills in zero-valued Bitcoin node settings
+func (b *BitcoinConfig) applyDefaults() {
+	if b.CLIPath == "" {
+		b.CLIPath = "/usr/local/bin/bitcoin-cli"
+	}
+	if b.User == "" {
+		b.User = "bitcoin"
+	}
+	if b.TimeoutSeconds == 0 {
+		b.TimeoutSeconds = 10
+	}
+	if b.Transport == "" {
+		b.Transport = "cli"
+	}
+	if b.RESTURL == "" {
+		b.RESTURL = "http://127.0.0.1:8332"
+	}
+	if b.UTXOStatsTimeoutSeconds == 0 {
+		b.UTXOStatsTimeoutSeconds = 600
 	}
 }
 
-// LoadConfig loads configuration from a JSON file
+// LoadConfig loads configuration from a JSON file and the files layered
+// over it
 func LoadConfig(path string) (*Config, error) {
 	// Start with default config
 	cfg := DefaultConfig()
 
-	// If file doesn't exist, return default config
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	// Merge the file with its includes and conf.d fragments; if there are
+	// none, return default config
+	data, files, err := ReadLayers(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
 		return cfg, nil
 	}
+	cfg.Files = files
 
-	data, err := os.ReadFile(path)
+	// Values such as passwords and tokens may be stored encrypted
+	cfg.SecretsKeyFile = SecretsKeyPath(path, data)
+	data, err = decryptSecrets(data, cfg.SecretsKeyFile)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to decrypt secrets: %w", err)
 	}
 
-	// Unmarshal onto default config, so missing fields keep defaults
+	// Unmarshal onto default config, so missing fields keep defaults. Rules
+	// given in the file replace the default rules rather than being decoded
+	// onto the default rule at the same index.
+	var layout struct {
+		Alerts struct {
+			Rules json.RawMessage `json:"rules"`
+		} `json:"alerts"`
+	}
+	json.Unmarshal(data, &layout)
+	if layout.Alerts.Rules != nil {
+		cfg.Alerts.Rules = nil
+	}
 	if err := json.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
 
 	// Apply defaults for any zero-valued critical fields
-	if cfg.Bitcoin.CLIPath == "" {
-		cfg.Bitcoin.CLIPath = "/usr/local/bin/bitcoin-cli"
+	if cfg.StorageBackend == "" {
+		cfg.StorageBackend = "jsonl"
+	}
+	if cfg.ShutdownTimeoutSeconds == 0 {
+		cfg.ShutdownTimeoutSeconds = 20
+	}
+	if cfg.Logging.Level == "" {
+		cfg.Logging.Level = "info"
+	}
+	if cfg.Logging.Format == "" {
+		cfg.Logging.Format = "text"
+	}
+	if cfg.Alerts.Locale == "" {
+		cfg.Alerts.Locale = "en"
+	}
+	if cfg.Alerts.Queue.MaxQueued == 0 {
+		cfg.Alerts.Queue.MaxQueued = 200
+	}
+	if cfg.Alerts.Queue.MaxAgeHours == 0 {
+		cfg.Alerts.Queue.MaxAgeHours = 48
+	}
+	if cfg.Alerts.Queue.RetryIntervalSeconds == 0 {
+		cfg.Alerts.Queue.RetryIntervalSeconds = 15
+	}
+	if cfg.Alerts.Queue.MaxRetryIntervalSeconds == 0 {
+		cfg.Alerts.Queue.MaxRetryIntervalSeconds = 600
+	}
+	if cfg.Alerts.Queue.MaxAttempts == 0 {
+		cfg.Alerts.Queue.MaxAttempts = 100
+	}
+	if q := cfg.Alerts.Queue; q.MaxQueued < 0 || q.MaxAgeHours < 0 || q.RetryIntervalSeconds < 0 || q.MaxRetryIntervalSeconds < 0 || q.MaxAttempts < 0 {
+		return nil, fmt.Errorf("alerts queue max_queued, max_age_hours, retry_interval_seconds, max_retry_interval_seconds and max_attempts must be positive")
+	}
+	if cfg.Alerts.Queue.MaxRetryIntervalSeconds < cfg.Alerts.Queue.RetryIntervalSeconds {
+		cfg.Alerts.Queue.MaxRetryIntervalSeconds = cfg.Alerts.Queue.RetryIntervalSeconds
+	}
+	switch cfg.Alerts.Queue.DropPolicy {
+	case "":
+		cfg.Alerts.Queue.DropPolicy = "lowest_severity"
+	case "oldest", "lowest_severity":
+	default:
+		return nil, fmt.Errorf("unknown alerts queue drop_policy %q (use oldest or lowest_severity)", cfg.Alerts.Queue.DropPolicy)
+	}
+	cfg.Bitcoin.applyDefaults()
+	if err := cfg.Bitcoin.validate(); err != nil {
+		return nil, fmt.Errorf("bitcoin: %w", err)
+	}
+
+	names := make(map[string]bool, len(cfg.BitcoinNodes))
+	for i := range cfg.BitcoinNodes {
+		node := &cfg.BitcoinNodes[i]
+		if node.Name == "" {
+			return nil, fmt.Errorf("bitcoin_nodes[%d] has no name", i)
+		}
+		if names[node.Name] {
+			return nil, fmt.Errorf("duplicate bitcoin node name %q", node.Name)
+		}
+		names[node.Name] = true
+		node.applyDefaults()
+		if err := node.validate(); err != nil {
+			return nil, fmt.Errorf("bitcoin node %q: %w", node.Name, err)
+		}
+	}
+
+	if tip := &cfg.ExternalTip; tip.Enabled {
+		switch tip.Source {
+		case "explorer":
+			if tip.URL == "" {
+				return nil, fmt.Errorf("external_tip requires a url for the explorer source")
+			}
+		case "node":
+			if !names[tip.Node] {
+				return nil, fmt.Errorf("external_tip node %q is not in bitcoin_nodes", tip.Node)
+			}
+		default:
+			return nil, fmt.Errorf("unknown external_tip source %q (use explorer or node)", tip.Source)
+		}
+	}
+	if ms := &cfg.MempoolSpace; ms.Enabled {
+		if ms.URL == "" {
+			return nil, fmt.Errorf("mempool_space requires a url")
+		}
+		if ms.Node != "" && !names[ms.Node] {
+			return nil, fmt.Errorf("mempool_space node %q is not in bitcoin_nodes", ms.Node)
+		}
+	}
+	if cfg.MempoolSpace.TimeoutSeconds == 0 {
+		cfg.MempoolSpace.TimeoutSeconds = 10
 	}
-	if cfg.Bitcoin.User == "" {
-		cfg.Bitcoin.User = "bitcoin"
+	if cfg.ExternalTip.RefreshSeconds == 0 {
+		cfg.ExternalTip.RefreshSeconds = 60
 	}
-	if cfg.Bitcoin.TimeoutSeconds == 0 {
-		cfg.Bitcoin.TimeoutSeconds = 10
+	if cfg.ExternalTip.TimeoutSeconds == 0 {
+		cfg.ExternalTip.TimeoutSeconds = 30
+	}
+	for _, pattern := range cfg.System.NetInterfaces {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid net_interfaces pattern %q: %w", pattern, err)
+		}
+	}
+	for i, path := range cfg.System.MonitorDiskPaths {
+		if path == "" {
+			return nil, fmt.Errorf("monitor_disk_paths[%d] is empty", i)
+		}
+	}
+	if cfg.System.DiskForecastWindowDays == 0 {
+		cfg.System.DiskForecastWindowDays = 7
+	}
+	if cfg.System.LeakWindowDays == 0 {
+		cfg.System.LeakWindowDays = 3
+	}
+	switch cfg.System.ClockSource {
+	case "":
+		cfg.System.ClockSource = "auto"
+	case "auto", "chrony", "timedatectl", "none":
+	case "ntp":
+		if cfg.System.NTPServer == "" {
+			return nil, fmt.Errorf("clock_source ntp requires an ntp_server")
+		}
+		// NTP is UDP, which a SOCKS proxy such as Tor cannot carry
+		if cfg.OutboundProxy.Enabled {
+			return nil, fmt.Errorf("clock_source ntp cannot be used with outbound_proxy")
+		}
+	default:
+		return nil, fmt.Errorf("unknown clock_source %q (use auto, chrony, timedatectl, ntp or none)", cfg.System.ClockSource)
+	}
+	if cfg.System.LeakMinGrowthPercent == 0 {
+		cfg.System.LeakMinGrowthPercent = 20
+	}
+	if cfg.Hardware.Source == "" {
+		cfg.Hardware.Source = "redfish"
+	}
+	if cfg.Hardware.IPMIToolPath == "" {
+		cfg.Hardware.IPMIToolPath = "/usr/bin/ipmitool"
+	}
+	if cfg.Hardware.TimeoutSeconds == 0 {
+		cfg.Hardware.TimeoutSeconds = 20
+	}
+	if cfg.Systemd.Enabled && len(cfg.Systemd.Units) == 0 {
+		return nil, fmt.Errorf("systemd requires at least one unit")
+	}
+	if cfg.Systemd.SystemctlPath == "" {
+		cfg.Systemd.SystemctlPath = "/usr/bin/systemctl"
+	}
+	if cfg.Systemd.TimeoutSeconds == 0 {
+		cfg.Systemd.TimeoutSeconds = 5
+	}
+	if cfg.Hardware.PollIntervalSeconds == 0 {
+		cfg.Hardware.PollIntervalSeconds = 300
 	}
 	if cfg.Tor.ControlPort == 0 {
 		cfg.Tor.ControlPort = 9051
@@ -102,10 +1129,310 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.Tor.TimeoutSeconds == 0 {
 		cfg.Tor.TimeoutSeconds = 10
 	}
+	if cfg.Tor.SOCKSPort == 0 {
+		cfg.Tor.SOCKSPort = 9050
+	}
+	if cfg.OutboundProxy.Address == "" {
+		cfg.OutboundProxy.Address = fmt.Sprintf("127.0.0.1:%d", cfg.Tor.SOCKSPort)
+	}
+	if _, _, err := net.SplitHostPort(cfg.OutboundProxy.Address); err != nil {
+		return nil, fmt.Errorf("invalid outbound_proxy address %q: %w", cfg.OutboundProxy.Address, err)
+	}
+	for _, host := range cfg.OutboundProxy.DirectHosts {
+		if !strings.Contains(host, "/") {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(host); err != nil {
+			return nil, fmt.Errorf("invalid outbound_proxy direct_hosts entry %q: %w", host, err)
+		}
+	}
+	if cfg.Tor.OnionPort == 0 {
+		cfg.Tor.OnionPort = 8333
+	}
+	if cfg.Tor.SelfCheckTimeoutSeconds == 0 {
+		cfg.Tor.SelfCheckTimeoutSeconds = 60
+	}
+	if share := &cfg.HTTP.ShareLinks; share.Enabled {
+		if share.MaxTTLHours == 0 {
+			share.MaxTTLHours = 168
+		}
+		if share.MaxTTLHours < 0 {
+			return nil, fmt.Errorf("http share_links max_ttl_hours must not be negative")
+		}
+		if len(cfg.HTTP.APIKeys) == 0 {
+			return nil, fmt.Errorf("http share_links requires api_keys; without them the metrics endpoints are already open")
+		}
+	}
+	if cfg.Alerts.Nostr.KeyFile == "" {
+		cfg.Alerts.Nostr.KeyFile = filepath.Join(cfg.DataDir, "nostr.key")
+	}
+	if cfg.SNMP.MasterAddress == "" {
+		cfg.SNMP.MasterAddress = "/var/agentx/master"
+	}
+	if cfg.SNMP.BaseOID == "" {
+		cfg.SNMP.BaseOID = "1.3.6.1.4.1.8072.9999.9999.8333"
+	}
+	if cfg.Zabbix.KeyPrefix == "" {
+		cfg.Zabbix.KeyPrefix = "btcmon"
+	}
+	if cfg.Zabbix.TimeoutSeconds == 0 {
+		cfg.Zabbix.TimeoutSeconds = 10
+	}
+	if cfg.InfluxDB.Version == 0 {
+		cfg.InfluxDB.Version = 2
+	}
+	if cfg.InfluxDB.MeasurementPrefix == "" {
+		cfg.InfluxDB.MeasurementPrefix = "btcmon"
+	}
+	if cfg.InfluxDB.BatchSize == 0 {
+		cfg.InfluxDB.BatchSize = 10
+	}
+	if cfg.InfluxDB.FlushIntervalSeconds == 0 {
+		cfg.InfluxDB.FlushIntervalSeconds = 60
+	}
+	if cfg.InfluxDB.MaxBufferedSamples == 0 {
+		cfg.InfluxDB.MaxBufferedSamples = 1000
+	}
+	if cfg.InfluxDB.TimeoutSeconds == 0 {
+		cfg.InfluxDB.TimeoutSeconds = 10
+	}
+	if cfg.Pushgateway.Job == "" {
+		cfg.Pushgateway.Job = "btc_node_monitor"
+	}
+	if cfg.Pushgateway.IntervalSeconds == 0 {
+		cfg.Pushgateway.IntervalSeconds = 3600
+	}
+	if cfg.Pushgateway.TimeoutSeconds == 0 {
+		cfg.Pushgateway.TimeoutSeconds = 60
+	}
+	if cfg.Pushgateway.Enabled && cfg.Pushgateway.URL == "" {
+		return nil, fmt.Errorf("pushgateway requires a url")
+	}
+	type profileRef struct{ setting, name string }
+	refs := []profileRef{
+		{"influxdb", cfg.InfluxDB.RedactionProfile},
+		{"zabbix", cfg.Zabbix.RedactionProfile},
+	}
+	for _, key := range cfg.HTTP.APIKeys {
+		if key.Key == "" || strings.ContainsAny(key.Key, " \t\r\n") {
+			return nil, fmt.Errorf("http api key %s must be non-empty and without whitespace", key.Name)
+		}
+		refs = append(refs, profileRef{"api key " + key.Name, key.RedactionProfile})
+	}
+	if cfg.HTTP.ShareLinks.Enabled {
+		refs = append(refs, profileRef{"http share_links", cfg.HTTP.ShareLinks.RedactionProfile})
+	}
+	for _, ref := range refs {
+		if _, ok := cfg.RedactionProfiles[ref.name]; ref.name != "" && !ok {
+			return nil, fmt.Errorf("%s: unknown redaction profile %q", ref.setting, ref.name)
+		}
+	}
+	// The plain socket protocol has no authentication and serves PAUSE,
+	// BACKUP and PROXY, so it must not reach the network
+	if addr, ok := strings.CutPrefix(cfg.SocketPath, "tcp:"); ok {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket_path %q: %w", cfg.SocketPath, err)
+		}
+		if ip := net.ParseIP(host); !strings.EqualFold(host, "localhost") && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("socket_path %q is not a loopback address; use query_tcp to serve other hosts", cfg.SocketPath)
+		}
+	}
+	if q := &cfg.QueryTCP; q.Enabled {
+		if q.ListenAddr == "" {
+			q.ListenAddr = ":8336"
+		}
+		if _, _, err := net.SplitHostPort(q.ListenAddr); err != nil {
+			return nil, fmt.Errorf("invalid query_tcp listen_addr %q: %w", q.ListenAddr, err)
+		}
+		if q.CertFile == "" || q.KeyFile == "" {
+			return nil, fmt.Errorf("query_tcp requires a cert_file and key_file")
+		}
+		if len(q.APIKeys) == 0 && q.ClientCAFile == "" {
+			return nil, fmt.Errorf("query_tcp requires api_keys or a client_ca_file to authenticate clients")
+		}
+		for _, key := range q.APIKeys {
+			if key.Key == "" || strings.ContainsAny(key.Key, " \t\r\n") {
+				return nil, fmt.Errorf("query_tcp api key %s must be non-empty and without whitespace", key.Name)
+			}
+			if key.RedactionProfile != "" {
+				return nil, fmt.Errorf("query_tcp api key %s: redaction_profile is only supported by the HTTP API", key.Name)
+			}
+		}
+	}
+	if l := &cfg.SocketLimits; l.MaxConnections <= 0 || l.MaxRequestBytes <= 0 || l.RequestTimeoutSeconds <= 0 {
+		return nil, fmt.Errorf("socket_limits max_connections, max_request_bytes and request_timeout_seconds must be positive")
+	}
+	if cfg.SocketLimits.RateLimitPerMinute < 0 {
+		return nil, fmt.Errorf("socket_limits rate_limit_per_minute must not be negative")
+	}
+	if cfg.MaxStorageBytes < 0 {
+		return nil, fmt.Errorf("max_storage_bytes must not be negative")
+	}
+	if cfg.RawSnapshots.RetentionDays == 0 {
+		cfg.RawSnapshots.RetentionDays = 7
+	}
+	if m := &cfg.Maintenance; m.Jobs["backup"] != "" {
+		if m.BackupDir == "" {
+			return nil, fmt.Errorf("maintenance backup job requires backup_dir")
+		}
+		metricsDir, _ := filepath.Abs(filepath.Join(cfg.DataDir, "metrics"))
+		if dir, _ := filepath.Abs(m.BackupDir); dir == metricsDir || strings.HasPrefix(dir, metricsDir+string(filepath.Separator)) {
+			return nil, fmt.Errorf("maintenance backup_dir must not be inside the metrics directory %s", metricsDir)
+		}
+		if m.BackupKeep == 0 {
+			m.BackupKeep = 7
+		}
+		if m.BackupKeep < 0 {
+			return nil, fmt.Errorf("maintenance backup_keep must not be negative")
+		}
+	}
+	if m := &cfg.Maintenance; m.Jobs["reports"] != "" {
+		if m.ReportDir == "" {
+			m.ReportDir = filepath.Join(cfg.DataDir, "reports")
+		}
+		if m.ReportKeep == 0 {
+			m.ReportKeep = 30
+		}
+		if m.ReportKeep < 0 {
+			return nil, fmt.Errorf("maintenance report_keep must not be negative")
+		}
+	}
+	if ps := &cfg.PowerSaving; ps.Enabled {
+		if ps.AlignSeconds == 0 {
+			ps.AlignSeconds = 300
+		}
+		if ps.FlushIntervalSeconds == 0 {
+			ps.FlushIntervalSeconds = 1800
+		}
+		if ps.AlignSeconds < 0 || ps.FlushIntervalSeconds < 0 {
+			return nil, fmt.Errorf("power_saving intervals must not be negative")
+		}
+		for _, name := range ps.SkipSystemMetrics {
+			if !skippableSystemMetrics[name] {
+				return nil, fmt.Errorf("unknown power_saving skip_system_metrics entry %q (use pressure, interfaces, thermal or clock)", name)
+			}
+		}
+		// Collect on the boundaries, as often as the interval allows
+		cfg.CollectionIntervalSeconds = max(cfg.CollectionIntervalSeconds, ps.AlignSeconds)
+		if rest := cfg.CollectionIntervalSeconds % ps.AlignSeconds; rest != 0 {
+			cfg.CollectionIntervalSeconds += ps.AlignSeconds - rest
+		}
+	}
+	if r := &cfg.Replication; r.Enabled {
+		if r.RetryIntervalSeconds == 0 {
+			r.RetryIntervalSeconds = 900
+		}
+		if r.TimeoutSeconds == 0 {
+			r.TimeoutSeconds = 300
+		}
+		if r.S3.Region == "" {
+			r.S3.Region = "us-east-1"
+		}
+		if r.SFTP.Port == 0 {
+			r.SFTP.Port = 22
+		}
+		if r.SFTP.Command == "" {
+			r.SFTP.Command = "sftp"
+		}
+		if r.RetryIntervalSeconds < 0 || r.TimeoutSeconds < 0 {
+			return nil, fmt.Errorf("replication intervals must not be negative")
+		}
+		if strings.ContainsAny(r.Prefix, "\"\n") {
+			return nil, fmt.Errorf("replication prefix must not contain quotes or newlines")
+		}
+		switch r.Target {
+		case "s3":
+			if r.S3.Bucket == "" || r.S3.AccessKeyID == "" || r.S3.SecretAccessKey == "" {
+				return nil, fmt.Errorf("replication to s3 requires a bucket, access_key_id and secret_access_key")
+			}
+		case "sftp":
+			if r.SFTP.Host == "" || r.SFTP.User == "" {
+				return nil, fmt.Errorf("replication to sftp requires a host and user")
+			}
+		default:
+			return nil, fmt.Errorf("unknown replication target %q (use s3 or sftp)", r.Target)
+		}
+	}
+	for section, days := range cfg.SectionRetentionDays {
+		if !retentionSections[section] {
+			return nil, fmt.Errorf("unknown section_retention_days section %q (use system, bitcoin, nodes, tor, hardware, services, derived, agent, custom, mempool_space or socket)", section)
+		}
+		if days <= 0 {
+			return nil, fmt.Errorf("section_retention_days for %q must be positive", section)
+		}
+	}
+	if _, _, _, err := cfg.Permissions.Modes(); err != nil {
+		return nil, err
+	}
+	for i, call := range cfg.RawSnapshots.Calls {
+		if !rawSnapshotMethods[call.Method] {
+			return nil, fmt.Errorf("raw_snapshots.calls[%d]: %q is not a read-only method raw snapshots may call", i, call.Method)
+		}
+		if call.Schedule == "" {
+			return nil, fmt.Errorf("raw_snapshots.calls[%d] requires a schedule", i)
+		}
+		if call.Node != "" && !names[call.Node] {
+			return nil, fmt.Errorf("raw_snapshots.calls[%d]: node %q is not in bitcoin_nodes", i, call.Node)
+		}
+	}
 
 	return cfg, nil
 }
 
+// Redacted returns a copy of the configuration with credentials removed,
+// suitable for returning from the query APIs
+func (c *Config) Redacted() *Config {
+	redacted := *c
+
+	redacted.Alerts.Telegram.BotToken = redact(c.Alerts.Telegram.BotToken)
+	redacted.Alerts.Ntfy.Token = redact(c.Alerts.Ntfy.Token)
+	redacted.Alerts.Email.Password = redact(c.Alerts.Email.Password)
+	redacted.Hardware.Password = redact(c.Hardware.Password)
+	redacted.Tor.Password = redact(c.Tor.Password)
+	redacted.InfluxDB.Token = redact(c.InfluxDB.Token)
+	redacted.InfluxDB.Password = redact(c.InfluxDB.Password)
+	redacted.Replication.S3.SecretAccessKey = redact(c.Replication.S3.SecretAccessKey)
+	redacted.Hardware.IPMIToolArgs = redactIPMIToolArgs(c.Hardware.IPMIToolArgs)
+
+	redacted.HTTP.APIKeys = make([]APIKeyConfig, len(c.HTTP.APIKeys))
+	for i, key := range c.HTTP.APIKeys {
+		key.Key = redact(key.Key)
+		redacted.HTTP.APIKeys[i] = key
+	}
+	redacted.QueryTCP.APIKeys = make([]APIKeyConfig, len(c.QueryTCP.APIKeys))
+	for i, key := range c.QueryTCP.APIKeys {
+		key.Key = redact(key.Key)
+		redacted.QueryTCP.APIKeys[i] = key
+	}
+
+	return &redacted
+}
+
+// redact masks a non-empty secret
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "REDACTED"
+}
+
+// redactIPMIToolArgs masks the value following ipmitool's -P password flag
+func redactIPMIToolArgs(args []string) []string {
+	if args == nil {
+		return nil
+	}
+
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i := 0; i+1 < len(redacted); i++ {
+		if redacted[i] == "-P" {
+			redacted[i+1] = redact(redacted[i+1])
+		}
+	}
+	return redacted
+}
+
 // SaveConfig saves configuration to a JSON file
 func SaveConfig(cfg *Config, path string) error {
 	data, err := json.MarshalIndent(cfg, "", "  ")
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// loadConfig writes a configuration file with the given contents and loads
+// it
+func loadConfig(t *testing.T, contents string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "btc-monitor.json")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+func TestAlertRulesReplaceDefaults(t *testing.T) {
+	cfg := loadConfig(t, `{"alerts": {"rules": [
+		{"name": "few_peers", "field": "bitcoin.peers", "op": "<", "threshold": 4}
+	]}}`)
+
+	want := []AlertRule{{Name: "few_peers", Field: "bitcoin.peers", Op: "<", Threshold: 4}}
+	if !reflect.DeepEqual(cfg.Alerts.Rules, want) {
+		t.Errorf("rules = %+v, want %+v", cfg.Alerts.Rules, want)
+	}
+}
+
+func TestAlertRulesDefaultWhenAbsent(t *testing.T) {
+	cfg := loadConfig(t, `{"alerts": {"enabled": true}}`)
+
+	if want := DefaultConfig().Alerts.Rules; !reflect.DeepEqual(cfg.Alerts.Rules, want) {
+		t.Errorf("got %d rules, want the %d default rules", len(cfg.Alerts.Rules), len(want))
+	}
+}
+
+func TestBitcoinTransport(t *testing.T) {
+	for _, transport := range []string{"cli", "rest", "auto"} {
+		cfg := loadConfig(t, `{"bitcoin": {"transport": "`+transport+`"}}`)
+		if cfg.Bitcoin.Transport != transport {
+			t.Errorf("transport = %q, want %q", cfg.Bitcoin.Transport, transport)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "btc-monitor.json")
+	if err := os.WriteFile(path, []byte(`{"bitcoin": {"transport": "http"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf("LoadConfig accepted transport \"http\"")
+	}
+}
+
+func TestSecretsKeyPath(t *testing.T) {
+	configPath := filepath.Join("/etc", "btc-monitor", "btc-monitor.json")
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{}`, filepath.Join("/etc", "btc-monitor", "secrets.key")},
+		{`{"secrets_key_file": "keys/secrets.key"}`, filepath.Join("/etc", "btc-monitor", "keys", "secrets.key")},
+		{`{"secrets_key_file": "/var/lib/btc-monitor/secrets.key"}`, "/var/lib/btc-monitor/secrets.key"},
+	}
+
+	for _, tt := range tests {
+		if got := SecretsKeyPath(configPath, []byte(tt.data)); got != tt.want {
+			t.Errorf("SecretsKeyPath(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
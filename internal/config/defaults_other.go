@@ -0,0 +1,9 @@
+//go:build !windows
+
+package config
+
+// Platform defaults for the agent's own files
+const (
+	defaultDataDir    = "/var/lib/bitcoin-monitor"
+	defaultSocketPath = "/var/run/bitcoin-monitor.sock"
+)
@@ -0,0 +1,20 @@
+//go:build windows
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultSocketPath is a named pipe; Windows has no /var/run equivalent
+const defaultSocketPath = `\\.\pipe\bitcoin-monitor`
+
+// defaultDataDir is under ProgramData, which services can write to
+var defaultDataDir = func() string {
+	dir := os.Getenv("ProgramData")
+	if dir == "" {
+		dir = `C:\ProgramData`
+	}
+	return filepath.Join(dir, "bitcoin-monitor")
+}()
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// confDir is the directory next to the main config file whose *.json
+// fragments are applied last
+const confDir = "conf.d"
+
+// ReadLayers reads the config file at path and the fragments layered over
+// it, and returns them merged into one JSON document along with the files
+// used, in merge order:
+//
+//  1. the main config file, which a package can own and replace on upgrade
+//  2. the files in its "include" list, in the order listed; entries may be
+//     globs, matched files are taken in lexical order, and relative paths
+//     are resolved against the main file's directory
+//  3. conf.d/*.json next to the main file, in lexical order, for local
+//     overrides that survive upgrades
+//
+// Later files win. Objects are merged key by key, so a fragment only needs
+// the settings it changes; any other value, including a list, replaces the
+// earlier one. A missing main file is skipped like an empty one.
+func ReadLayers(path string) ([]byte, []string, error) {
+	merged := map[string]interface{}{}
+	var files []string
+	seen := map[string]bool{}
+
+	apply := func(file string, optional bool) error {
+		clean := filepath.Clean(file)
+		if seen[clean] {
+			return nil
+		}
+		seen[clean] = true
+
+		layer, err := readLayer(file)
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if file != path {
+			if _, ok := layer["include"]; ok {
+				return fmt.Errorf("%s: include is only allowed in the main config file", file)
+			}
+		}
+		mergeLayer(merged, layer)
+		files = append(files, file)
+		return nil
+	}
+
+	if err := apply(path, true); err != nil {
+		return nil, nil, err
+	}
+
+	base := filepath.Dir(path)
+	var includes []string
+	if raw, ok := merged["include"]; ok {
+		list, ok := raw.([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: include must be a list of files", path)
+		}
+		for _, entry := range list {
+			pattern, ok := entry.(string)
+			if !ok || pattern == "" {
+				return nil, nil, fmt.Errorf("%s: include must be a list of files", path)
+			}
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(base, pattern)
+			}
+			if !hasGlobMeta(pattern) {
+				// A named file that is missing is an error, an empty glob is not
+				includes = append(includes, pattern)
+				continue
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: bad include pattern %q: %w", path, entry, err)
+			}
+			includes = append(includes, matches...)
+		}
+	}
+	for _, file := range includes {
+		if err := apply(file, false); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	fragments, err := filepath.Glob(filepath.Join(base, confDir, "*.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range fragments {
+		if err := apply(file, false); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, nil, nil
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, files, nil
+}
+
+// readLayer parses one config file, which must hold a JSON object. Numbers
+// are kept as written so large integers survive the merge.
+func readLayer(file string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var layer map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&layer); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("%s: config must be a JSON object", file)
+	}
+	return layer, nil
+}
+
+// mergeLayer applies layer over dst, merging nested objects
+func mergeLayer(dst, layer map[string]interface{}) {
+	for key, value := range layer {
+		src, srcIsObject := value.(map[string]interface{})
+		existing, dstIsObject := dst[key].(map[string]interface{})
+		if srcIsObject && dstIsObject {
+			mergeLayer(existing, src)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// hasGlobMeta reports whether an include entry is a pattern rather than a
+// single file
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[`)
+}
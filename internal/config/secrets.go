@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// secretPrefix marks an encrypted config value. The rest is the base64 of
+// a random nonce followed by the AES-256-GCM ciphertext.
+const secretPrefix = "enc:v1:"
+
+// secretsKeySize is the AES-256 key length
+const secretsKeySize = 32
+
+// SecretsKeyPath returns the key file used for a config file: its
+// secrets_key_file setting, or secrets.key next to it. A relative setting
+// is taken from the config file's directory, like the default, rather than
+// from the working directory.
+func SecretsKeyPath(configPath string, data []byte) string {
+	var settings struct {
+		SecretsKeyFile string `json:"secrets_key_file"`
+	}
+	json.Unmarshal(data, &settings)
+
+	switch {
+	case settings.SecretsKeyFile == "":
+		return filepath.Join(filepath.Dir(configPath), "secrets.key")
+	case filepath.IsAbs(settings.SecretsKeyFile):
+		return settings.SecretsKeyFile
+	default:
+		return filepath.Join(filepath.Dir(configPath), settings.SecretsKeyFile)
+	}
+}
+
+// GenerateSecretsKey writes a new random key to path, readable only by its
+// owner. An existing file is never overwritten, since values encrypted with
+// it could no longer be read.
+func GenerateSecretsKey(path string) error {
+	key := make([]byte, secretsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readSecretsKey loads a key written by GenerateSecretsKey
+func readSecretsKey(path string) (cipher.AEAD, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != secretsKeySize {
+		return nil, fmt.Errorf("secrets key %s is not a base64-encoded %d-byte key", path, secretsKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptSecret encrypts a value with the key at keyPath for use in the
+// config file
+func EncryptSecret(keyPath, plaintext string) (string, error) {
+	aead, err := readSecretsKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecrets replaces every encrypted string in a JSON config with its
+// plaintext. The key is only read if the config has encrypted values.
+func decryptSecrets(data []byte, keyPath string) ([]byte, error) {
+	if !bytes.Contains(data, []byte(secretPrefix)) {
+		return data, nil
+	}
+
+	var tree interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+
+	aead, err := readSecretsKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err = decryptNode(aead, "", tree)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// decryptNode decrypts the encrypted strings in node, found at the dotted
+// path, and its children
+func decryptNode(aead cipher.AEAD, path string, node interface{}) (interface{}, error) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			decrypted, err := decryptNode(aead, childPath, child)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = decrypted
+		}
+	case []interface{}:
+		for i, child := range v {
+			decrypted, err := decryptNode(aead, path+"["+strconv.Itoa(i)+"]", child)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = decrypted
+		}
+	case string:
+		encoded, ok := strings.CutPrefix(v, secretPrefix)
+		if !ok {
+			return v, nil
+		}
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			return nil, fmt.Errorf("%s: malformed encrypted value", path)
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to decrypt, the value was encrypted with another key", path)
+		}
+		return string(plaintext), nil
+	}
+	return node, nil
+}
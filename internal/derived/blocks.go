@@ -0,0 +1,300 @@
+package derived
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+const (
+	// blockTarget is the network's target time between blocks
+	blockTarget = 10 * time.Minute
+
+	// longBlockGap is the interval counted as a long gap
+	longBlockGap = 30 * time.Minute
+
+	// maxBlockRecords is how many recent blocks are kept for range
+	// statistics, one difficulty period or about two weeks
+	maxBlockRecords = 2016
+)
+
+// intervalBuckets are the upper bounds of the histogram buckets in
+// seconds; a last bucket holds longer intervals
+var intervalBuckets = []int64{60, 120, 300, 600, 900, 1200, 1800, 2700, 3600, 5400}
+
+// Block is a block the node added to its chain
+type Block struct {
+	Height       int
+	Hash         string
+	PreviousHash string
+	Time         time.Time // Header time
+	Seen         time.Time // When a collection first saw it as the tip; zero if unknown
+}
+
+// blockRecord is a block kept for range statistics. Interval and Delay are
+// nil when the parent or the arrival time is unknown.
+type blockRecord struct {
+	Height   int    `json:"height"`
+	Hash     string `json:"hash"`
+	Time     int64  `json:"time"`
+	Interval *int64 `json:"interval,omitempty"`
+	Delay    *int64 `json:"delay,omitempty"`
+}
+
+// blockIntervalsState is what BlockIntervals keeps on disk
+type blockIntervalsState struct {
+	Since     time.Time     `json:"since"`
+	Histogram []int64       `json:"histogram"` // One count per bucket
+	Blocks    []blockRecord `json:"blocks"`    // Oldest first; the last is the tip
+}
+
+// BlockIntervals keeps a histogram of the time between blocks and the
+// recent blocks behind it, saved to a file after each new block so neither
+// starts over when the agent restarts
+type BlockIntervals struct {
+	path string // Empty keeps the history in memory only
+
+	mu    sync.Mutex
+	state blockIntervalsState
+}
+
+// NewBlockIntervals loads the history saved at path. An unreadable file is
+// reported and replaced by an empty history.
+func NewBlockIntervals(path string) (*BlockIntervals, error) {
+	b := &BlockIntervals{path: path}
+	b.reset()
+	if path == "" {
+		return b, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return b, err
+	}
+	var state blockIntervalsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return b, err
+	}
+	if len(state.Histogram) == len(intervalBuckets)+1 {
+		b.state = state
+	}
+	return b, nil
+}
+
+// reset starts an empty history
+func (b *BlockIntervals) reset() {
+	b.state = blockIntervalsState{
+		Since:     time.Now().UTC(),
+		Histogram: make([]int64, len(intervalBuckets)+1),
+	}
+}
+
+// Tip returns the hash of the newest block recorded, or "" before the first
+func (b *BlockIntervals) Tip() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.state.Blocks) == 0 {
+		return ""
+	}
+	return b.state.Blocks[len(b.state.Blocks)-1].Hash
+}
+
+// Recorded reports whether a block is in the history
+func (b *BlockIntervals) Recorded(hash string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := len(b.state.Blocks) - 1; i >= 0; i-- {
+		if b.state.Blocks[i].Hash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Add records new blocks, oldest first, and saves the history. Blocks at
+// heights already recorded replace them, as after a reorg.
+func (b *BlockIntervals) Add(blocks []Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, block := range blocks {
+		b.addLocked(block)
+	}
+	if excess := len(b.state.Blocks) - maxBlockRecords; excess > 0 {
+		b.state.Blocks = slices.Delete(b.state.Blocks, 0, excess)
+	}
+	return b.saveLocked()
+}
+
+// addLocked records one block, taking its interval from the recorded
+// parent. b.mu must be held.
+func (b *BlockIntervals) addLocked(block Block) {
+	for n := len(b.state.Blocks); n > 0 && b.state.Blocks[n-1].Height >= block.Height; n-- {
+		if interval := b.state.Blocks[n-1].Interval; interval != nil {
+			b.state.Histogram[bucketOf(*interval)]--
+		}
+		b.state.Blocks = b.state.Blocks[:n-1]
+	}
+
+	record := blockRecord{Height: block.Height, Hash: block.Hash, Time: block.Time.Unix()}
+	if n := len(b.state.Blocks); n > 0 && b.state.Blocks[n-1].Hash == block.PreviousHash {
+		interval := record.Time - b.state.Blocks[n-1].Time
+		record.Interval = &interval
+		b.state.Histogram[bucketOf(interval)]++
+	}
+	if !block.Seen.IsZero() {
+		delay := max(int64(block.Seen.Sub(block.Time).Seconds()), 0)
+		record.Delay = &delay
+	}
+
+	b.state.Blocks = append(b.state.Blocks, record)
+}
+
+// saveLocked writes the history to its file, replacing it atomically.
+// b.mu must be held.
+func (b *BlockIntervals) saveLocked() error {
+	if b.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(&b.state)
+	if err != nil {
+		return err
+	}
+
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// Update sets the sample's derived block discovery metrics from the tip
+func (b *BlockIntervals) Update(sample *metrics.Sample) {
+	if sample.Bitcoin == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(b.state.Blocks)
+	if n == 0 {
+		return
+	}
+	tip := b.state.Blocks[n-1]
+
+	if sample.Derived == nil {
+		sample.Derived = &metrics.DerivedMetrics{}
+	}
+	sample.Derived.TipAgeSeconds = max(sample.Timestamp.Unix()-tip.Time, 0)
+	if tip.Interval != nil {
+		sample.Derived.BlockIntervalSeconds = *tip.Interval
+	}
+	if tip.Delay != nil {
+		sample.Derived.BlockArrivalDelaySeconds = *tip.Delay
+	}
+}
+
+// Stats summarizes the intervals of blocks with header times in a range
+func (b *BlockIntervals) Stats(start, end time.Time) *metrics.BlockIntervalStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := &metrics.BlockIntervalStats{
+		Start:                  start,
+		End:                    end,
+		ExpectedLongGapPercent: 100 * math.Exp(-longBlockGap.Seconds()/blockTarget.Seconds()),
+		Histogram:              histogram(make([]int64, len(intervalBuckets)+1)),
+		TotalHistogram:         histogram(b.state.Histogram),
+		Since:                  b.state.Since,
+	}
+	for _, count := range b.state.Histogram {
+		stats.TotalBlocks += count
+	}
+
+	var intervals, delays []int64
+	var total int64
+	for _, record := range b.state.Blocks {
+		t := time.Unix(record.Time, 0).UTC()
+		if t.Before(start) || t.After(end) {
+			continue
+		}
+		if record.Delay != nil {
+			delays = append(delays, *record.Delay)
+		}
+		if record.Interval == nil {
+			continue
+		}
+
+		interval := *record.Interval
+		intervals = append(intervals, interval)
+		total += interval
+		stats.Histogram[bucketOf(interval)].Count++
+		if interval > int64(longBlockGap.Seconds()) {
+			stats.LongGaps++
+		}
+		if stats.LongestGap == nil || interval > stats.LongestGap.Seconds {
+			stats.LongestGap = &metrics.BlockGap{Height: record.Height, Time: t, Seconds: interval}
+		}
+	}
+
+	stats.Blocks = len(intervals)
+	if stats.Blocks > 0 {
+		stats.MeanIntervalSeconds = float64(total) / float64(stats.Blocks)
+		stats.MedianIntervalSeconds = median(intervals)
+		stats.LongGapPercent = 100 * float64(stats.LongGaps) / float64(stats.Blocks)
+		if total > 0 {
+			stats.LuckPercent = 100 * float64(stats.Blocks) * blockTarget.Seconds() / float64(total)
+		}
+	}
+	if len(delays) > 0 {
+		stats.ArrivalDelayMedianSeconds = median(delays)
+		stats.ArrivalDelayMaxSeconds = slices.Max(delays)
+	}
+	return stats
+}
+
+// bucketOf returns the histogram bucket of an interval. Negative intervals,
+// from header times out of order, fall in the first.
+func bucketOf(seconds int64) int {
+	for i, bound := range intervalBuckets {
+		if seconds <= bound {
+			return i
+		}
+	}
+	return len(intervalBuckets)
+}
+
+// histogram pairs bucket counts with their bounds
+func histogram(counts []int64) []metrics.IntervalBucket {
+	buckets := make([]metrics.IntervalBucket, len(counts))
+	for i, count := range counts {
+		buckets[i].Count = count
+		if i < len(intervalBuckets) {
+			buckets[i].MaxSeconds = intervalBuckets[i]
+		}
+	}
+	return buckets
+}
+
+// median returns the middle value, sorting values in place
+func median(values []int64) int64 {
+	slices.Sort(values)
+	return values[len(values)/2]
+}
@@ -0,0 +1,143 @@
+package derived
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+const (
+	// pointInterval is the minimum spacing of history points kept for the fit
+	pointInterval = 10 * time.Minute
+
+	// minHistory is how much history is needed before forecasting
+	minHistory = 24 * time.Hour
+)
+
+// point is a timestamped observation
+type point struct {
+	t     time.Time
+	value float64
+}
+
+// DiskForecaster estimates when the monitored disk fills up by fitting a
+// line to recent DiskUsedBytes history. Blockchain growth is steady, so a
+// linear fit over a few days is a good predictor.
+type DiskForecaster struct {
+	window time.Duration
+
+	mu       sync.Mutex
+	points   []point
+	baseline string // Baseline the points belong to, see baselineOf
+}
+
+// NewDiskForecaster creates a forecaster fitting over the given window
+func NewDiskForecaster(window time.Duration) *DiskForecaster {
+	return &DiskForecaster{window: window}
+}
+
+// Seed loads historical samples, e.g. from storage at startup
+func (f *DiskForecaster) Seed(samples []*metrics.Sample) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, sample := range samples {
+		f.addLocked(sample)
+	}
+}
+
+// Update records a new sample and sets its derived disk forecast
+func (f *DiskForecaster) Update(sample *metrics.Sample) {
+	if sample.System == nil || sample.System.DiskTotalBytes == 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.addLocked(sample)
+
+	slope, ok := slopePerDay(f.points)
+	if !ok {
+		return
+	}
+
+	if sample.Derived == nil {
+		sample.Derived = &metrics.DerivedMetrics{}
+	}
+	sample.Derived.DiskGrowthBytesPerDay = int64(slope)
+	if slope > 0 {
+		sample.Derived.DiskDaysUntilFull = float64(sample.System.DiskAvailBytes) / slope
+	}
+}
+
+// addLocked appends a history point and prunes points outside the window
+func (f *DiskForecaster) addLocked(sample *metrics.Sample) {
+	if sample.System == nil || sample.System.DiskTotalBytes == 0 {
+		return
+	}
+
+	// History from another baseline would skew the fit, e.g. IBD growth
+	// carried into the first days of steady state
+	if baseline := baselineOf(sample.State); baseline != "" && baseline != f.baseline {
+		f.points = nil
+		f.baseline = baseline
+	}
+	if sample.State == metrics.NodeStatePruning {
+		return // A one-off drop in usage, not a change in growth
+	}
+
+	if n := len(f.points); n > 0 && sample.Timestamp.Sub(f.points[n-1].t) < pointInterval {
+		return
+	}
+	f.points = append(f.points, point{t: sample.Timestamp, value: float64(sample.System.DiskUsedBytes)})
+
+	cutoff := sample.Timestamp.Add(-f.window)
+	drop := 0
+	for drop < len(f.points) && f.points[drop].t.Before(cutoff) {
+		drop++
+	}
+	f.points = f.points[drop:]
+}
+
+// baselineOf groups node states whose resource use is comparable: syncing
+// (IBD and reindex) and following the tip. Samples without a state fit in
+// either.
+func baselineOf(state string) string {
+	switch state {
+	case metrics.NodeStateIBD, metrics.NodeStateReindex:
+		return "sync"
+	case metrics.NodeStateSteady, metrics.NodeStatePruning:
+		return "steady"
+	default:
+		return ""
+	}
+}
+
+// slopePerDay returns the least-squares growth rate per day of points
+// spanning at least minHistory
+func slopePerDay(points []point) (float64, bool) {
+	n := len(points)
+	if n < 2 || points[n-1].t.Sub(points[0].t) < minHistory {
+		return 0, false
+	}
+
+	origin := points[0].t
+	var sumX, sumY, sumXX, sumXY float64
+	for _, p := range points {
+		x := p.t.Sub(origin).Hours() / 24
+		sumX += x
+		sumY += p.value
+		sumXX += x * x
+		sumXY += x * p.value
+	}
+
+	count := float64(n)
+	denominator := count*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+
+	return (count*sumXY - sumX*sumY) / denominator, true
+}
@@ -0,0 +1,134 @@
+package derived
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+const (
+	// leakSegments is how many consecutive parts of the window must each
+	// sit above the previous one for growth to count as monotonic
+	leakSegments = 6
+
+	// leakMinGoroutineGrowth is the smallest goroutine increase reported
+	leakMinGoroutineGrowth = 20
+)
+
+// usageSeries keeps the lowest value seen in each pointInterval. Minimums
+// ignore garbage collection sawtooth and short bursts of work, so steady
+// growth in them means memory or goroutines are not being released.
+type usageSeries struct {
+	points    []point
+	bucket    point // Minimum of the interval in progress
+	hasBucket bool
+}
+
+// add records an observation, closing the current interval once it is over
+// and pruning intervals outside the window
+func (s *usageSeries) add(t time.Time, value float64, window time.Duration) {
+	switch {
+	case !s.hasBucket:
+		s.bucket, s.hasBucket = point{t: t, value: value}, true
+	case t.Sub(s.bucket.t) >= pointInterval:
+		s.points = append(s.points, s.bucket)
+		s.bucket = point{t: t, value: value}
+	case value < s.bucket.value:
+		s.bucket.value = value
+	}
+
+	cutoff := t.Add(-window)
+	drop := 0
+	for drop < len(s.points) && s.points[drop].t.Before(cutoff) {
+		drop++
+	}
+	s.points = s.points[drop:]
+}
+
+// growth returns the increase from the first to the last segment of the
+// window if every segment's minimum is above the previous one's. Usage that
+// grows while warming up and then levels off is not counted.
+func (s *usageSeries) growth() (float64, bool) {
+	n := len(s.points)
+	if n < leakSegments || s.points[n-1].t.Sub(s.points[0].t) < minHistory {
+		return 0, false
+	}
+
+	var minimums [leakSegments]float64
+	for i := range minimums {
+		segment := s.points[i*n/leakSegments : (i+1)*n/leakSegments]
+		minimums[i] = segment[0].value
+		for _, p := range segment[1:] {
+			minimums[i] = min(minimums[i], p.value)
+		}
+		if i > 0 && minimums[i] <= minimums[i-1] {
+			return 0, false
+		}
+	}
+
+	return minimums[leakSegments-1] - minimums[0], true
+}
+
+// first returns the oldest value in the window
+func (s *usageSeries) first() float64 {
+	if len(s.points) == 0 {
+		return s.bucket.value
+	}
+	return s.points[0].value
+}
+
+// LeakDetector watches the agent's own memory and goroutine count and flags
+// steady growth over days, which on a 24/7 deployment points to a leak. It
+// only sees the running process, so it is not seeded from stored history.
+type LeakDetector struct {
+	window       time.Duration
+	minRSSGrowth float64 // Fraction of the starting RSS
+
+	mu         sync.Mutex
+	rss        usageSeries
+	goroutines usageSeries
+}
+
+// NewLeakDetector creates a detector looking at the given window. RSS
+// growth below minGrowthPercent of the starting value is not reported.
+func NewLeakDetector(window time.Duration, minGrowthPercent float64) *LeakDetector {
+	return &LeakDetector{window: window, minRSSGrowth: minGrowthPercent / 100}
+}
+
+// Update records the sample's agent metrics and sets their growth rates
+// and leak warning
+func (d *LeakDetector) Update(sample *metrics.Sample) {
+	agent := sample.Agent
+	if agent == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rss.add(sample.Timestamp, float64(agent.RSSBytes), d.window)
+	d.goroutines.add(sample.Timestamp, float64(agent.Goroutines), d.window)
+
+	if slope, ok := slopePerDay(d.rss.points); ok {
+		agent.RSSGrowthBytesPerDay = int64(slope)
+	}
+	if slope, ok := slopePerDay(d.goroutines.points); ok {
+		agent.GoroutineGrowthPerDay = slope
+	}
+
+	var warnings []string
+	if growth, ok := d.rss.growth(); ok && growth > d.rss.first()*d.minRSSGrowth {
+		warnings = append(warnings, fmt.Sprintf("RSS grew steadily by %d MiB", int64(growth)>>20))
+	}
+	if growth, ok := d.goroutines.growth(); ok && growth >= leakMinGoroutineGrowth {
+		warnings = append(warnings, fmt.Sprintf("goroutines grew steadily by %d", int(growth)))
+	}
+	if len(warnings) > 0 {
+		agent.LeakSuspected = true
+		span := d.rss.points[len(d.rss.points)-1].t.Sub(d.rss.points[0].t)
+		agent.LeakWarning = fmt.Sprintf("%s over %.0f hours", strings.Join(warnings, " and "), span.Hours())
+	}
+}
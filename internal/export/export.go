@@ -0,0 +1,154 @@
+// Package export writes stored samples as a flat table, one row per sample
+// and one column per field, for spreadsheets and data frame tools
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/query"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"csv", "parquet", "json", "sqlite"}
+
+// Column is one flattened field. A column is numeric when every sample
+// that has the field holds a number or boolean there; otherwise its values
+// are written as text.
+type Column struct {
+	Name    string
+	Numeric bool
+	values  []interface{} // One per row; nil where a sample lacks the field
+}
+
+// Table holds flattened samples. Columns are sorted by name and follow the
+// timestamp, which every row has.
+type Table struct {
+	Timestamps []time.Time
+	Columns    []*Column
+}
+
+// NewTable flattens samples, keeping only the requested dotted field paths
+// if any are given
+func NewTable(samples []*metrics.Sample, fields []string) *Table {
+	table := &Table{Timestamps: make([]time.Time, len(samples))}
+	columns := map[string]*Column{}
+
+	for row, sample := range samples {
+		table.Timestamps[row] = sample.Timestamp
+		for name, value := range query.FlattenScalars(sample) {
+			if len(fields) > 0 && !query.MatchesField(name, fields) {
+				continue
+			}
+			column := columns[name]
+			if column == nil {
+				column = &Column{Name: name, Numeric: true, values: make([]interface{}, len(samples))}
+				columns[name] = column
+				table.Columns = append(table.Columns, column)
+			}
+			if _, ok := value.(float64); !ok {
+				column.Numeric = false
+			}
+			column.values[row] = value
+		}
+	}
+
+	sort.Slice(table.Columns, func(i, j int) bool {
+		return table.Columns[i].Name < table.Columns[j].Name
+	})
+	return table
+}
+
+// Rows returns the number of rows
+func (t *Table) Rows() int {
+	return len(t.Timestamps)
+}
+
+// Float returns a numeric column's value in a row
+func (c *Column) Float(row int) (float64, bool) {
+	f, ok := c.values[row].(float64)
+	return f, ok
+}
+
+// Text returns a column's value in a row as text, as written to CSV
+func (c *Column) Text(row int) (string, bool) {
+	switch v := c.values[row].(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return v, true
+	}
+	return "", false
+}
+
+// Write writes the table to w in format: "csv", "parquet", "json" or
+// "sqlite"
+func Write(w io.Writer, format string, table *Table) error {
+	switch format {
+	case "csv":
+		return writeCSV(w, table)
+	case "parquet":
+		return writeParquet(w, table)
+	case "json":
+		return writeJSON(w, table)
+	case "sqlite":
+		return writeSQLite(w, table)
+	default:
+		return fmt.Errorf("unknown export format %q (use csv, parquet, json or sqlite)", format)
+	}
+}
+
+// writeCSV writes a header row and one row per sample. Missing fields are
+// left empty.
+func writeCSV(w io.Writer, table *Table) error {
+	out := csv.NewWriter(w)
+
+	record := make([]string, len(table.Columns)+1)
+	record[0] = "timestamp"
+	for i, column := range table.Columns {
+		record[i+1] = column.Name
+	}
+	if err := out.Write(record); err != nil {
+		return err
+	}
+
+	for row, timestamp := range table.Timestamps {
+		record[0] = timestamp.UTC().Format(time.RFC3339Nano)
+		for i, column := range table.Columns {
+			record[i+1], _ = column.Text(row)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// writeJSON writes one flat object per line, leaving out missing fields
+func writeJSON(w io.Writer, table *Table) error {
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+
+	for row, timestamp := range table.Timestamps {
+		object := map[string]interface{}{"timestamp": timestamp.UTC()}
+		for _, column := range table.Columns {
+			if value := column.values[row]; value != nil {
+				object[column.Name] = value
+			}
+		}
+		if err := encoder.Encode(object); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,310 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Parquet constants used by writeParquet, from parquet.thrift
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetDataPage     = 0
+	parquetUncompressed = 0
+)
+
+// Thrift compact protocol field types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetMagic starts and ends a Parquet file
+var parquetMagic = []byte("PAR1")
+
+// parquetColumn is a written column chunk, described again in the footer
+type parquetColumn struct {
+	name   string
+	kind   int32
+	offset int64
+	size   int64
+}
+
+// writeParquet writes the table as a Parquet file with one row group and
+// one uncompressed data page per column. The timestamp is a required
+// INT64 in microseconds; other columns are optional DOUBLE or UTF-8 text.
+// This is the subset of the format every reader supports, and keeps the
+// agent free of a Parquet library.
+func writeParquet(w io.Writer, table *Table) error {
+	out := &countingWriter{w: w}
+	if _, err := out.Write(parquetMagic); err != nil {
+		return err
+	}
+
+	var written []parquetColumn
+
+	var timestamps bytes.Buffer
+	for _, timestamp := range table.Timestamps {
+		binary.Write(&timestamps, binary.LittleEndian, timestamp.UnixMicro())
+	}
+	offset := out.n
+	if err := writeDataPage(out, table.Rows(), timestamps.Bytes()); err != nil {
+		return err
+	}
+	written = append(written, parquetColumn{"timestamp", parquetInt64, offset, out.n - offset})
+
+	for _, column := range table.Columns {
+		var page bytes.Buffer
+		levels := make([]bool, table.Rows())
+		var values bytes.Buffer
+		for row := range levels {
+			if column.Numeric {
+				f, ok := column.Float(row)
+				if ok {
+					binary.Write(&values, binary.LittleEndian, math.Float64bits(f))
+				}
+				levels[row] = ok
+			} else {
+				s, ok := column.Text(row)
+				if ok {
+					binary.Write(&values, binary.LittleEndian, uint32(len(s)))
+					values.WriteString(s)
+				}
+				levels[row] = ok
+			}
+		}
+		writeLevels(&page, levels)
+		page.Write(values.Bytes())
+
+		kind := int32(parquetByteArray)
+		if column.Numeric {
+			kind = parquetDouble
+		}
+		offset := out.n
+		if err := writeDataPage(out, table.Rows(), page.Bytes()); err != nil {
+			return err
+		}
+		written = append(written, parquetColumn{column.Name, kind, offset, out.n - offset})
+	}
+
+	footer := parquetFooter(table, written)
+	if _, err := out.Write(footer); err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.LittleEndian, uint32(len(footer))); err != nil {
+		return err
+	}
+	_, err := out.Write(parquetMagic)
+	return err
+}
+
+// writeDataPage writes a page header and its data
+func writeDataPage(w io.Writer, values int, data []byte) error {
+	var header compactWriter
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(len(data)))
+	header.i32(3, int32(len(data)))
+	header.beginStruct(5)
+	header.i32(1, int32(values))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.end()
+	header.end()
+
+	if _, err := w.Write(header.buf); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// writeLevels writes the definition levels of an optional column, true
+// where a row has a value, as length-prefixed RLE runs of bit width 1
+func writeLevels(buf *bytes.Buffer, levels []bool) {
+	var runs []byte
+	for start := 0; start < len(levels); {
+		end := start + 1
+		for end < len(levels) && levels[end] == levels[start] {
+			end++
+		}
+		runs = binary.AppendUvarint(runs, uint64(end-start)<<1)
+		if levels[start] {
+			runs = append(runs, 1)
+		} else {
+			runs = append(runs, 0)
+		}
+		start = end
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(len(runs)))
+	buf.Write(runs)
+}
+
+// parquetFooter encodes the FileMetaData for the written columns
+func parquetFooter(table *Table, columns []parquetColumn) []byte {
+	var c compactWriter
+	c.i32(1, 1)
+
+	c.beginList(2, thriftStruct, len(columns)+1)
+	c.beginElement()
+	c.binary(4, "schema")
+	c.i32(5, int32(len(columns)))
+	c.end()
+	for i, column := range columns {
+		c.beginElement()
+		c.i32(1, column.kind)
+		if i == 0 {
+			c.i32(3, parquetRequired)
+		} else {
+			c.i32(3, parquetOptional)
+		}
+		c.binary(4, column.name)
+		switch {
+		case i == 0:
+			c.i32(6, parquetTimestampMicros)
+		case column.kind == parquetByteArray:
+			c.i32(6, parquetUTF8)
+		}
+		c.end()
+	}
+
+	c.i64(3, int64(table.Rows()))
+
+	var total int64
+	for _, column := range columns {
+		total += column.size
+	}
+	c.beginList(4, thriftStruct, 1)
+	c.beginElement()
+	c.beginList(1, thriftStruct, len(columns))
+	for _, column := range columns {
+		c.beginElement()
+		c.i64(2, column.offset)
+		c.beginStruct(3)
+		c.i32(1, column.kind)
+		c.beginList(2, thriftI32, 2)
+		c.varint(parquetPlain)
+		c.varint(parquetRLE)
+		c.beginList(3, thriftBinary, 1)
+		c.str(column.name)
+		c.i32(4, parquetUncompressed)
+		c.i64(5, int64(table.Rows()))
+		c.i64(6, column.size)
+		c.i64(7, column.size)
+		c.i64(9, column.offset)
+		c.end()
+		c.end()
+	}
+	c.i64(2, total)
+	c.i64(3, int64(table.Rows()))
+	c.end()
+
+	c.binary(6, "btc-monitor")
+	c.end()
+	return c.buf
+}
+
+// compactWriter encodes Thrift structs in the compact protocol. Fields
+// must be written in increasing id order within a struct.
+type compactWriter struct {
+	buf   []byte
+	last  int16   // Id of the previous field in the current struct
+	outer []int16 // last of the enclosing structs
+}
+
+// field writes a field header, as a delta from the previous id if it fits
+func (c *compactWriter) field(id int16, kind byte) {
+	if delta := id - c.last; delta > 0 && delta <= 15 {
+		c.buf = append(c.buf, byte(delta)<<4|kind)
+	} else {
+		c.buf = append(c.buf, kind)
+		c.varint(int64(id))
+	}
+	c.last = id
+}
+
+// varint writes a zigzag-encoded integer, as used for i16, i32 and i64
+func (c *compactWriter) varint(v int64) {
+	c.buf = binary.AppendUvarint(c.buf, uint64(v<<1^v>>63))
+}
+
+// str writes a length-prefixed string without a field header
+func (c *compactWriter) str(s string) {
+	c.buf = binary.AppendUvarint(c.buf, uint64(len(s)))
+	c.buf = append(c.buf, s...)
+}
+
+func (c *compactWriter) i32(id int16, v int32) {
+	c.field(id, thriftI32)
+	c.varint(int64(v))
+}
+
+func (c *compactWriter) i64(id int16, v int64) {
+	c.field(id, thriftI64)
+	c.varint(v)
+}
+
+func (c *compactWriter) binary(id int16, s string) {
+	c.field(id, thriftBinary)
+	c.str(s)
+}
+
+// beginList writes a list field header; the n elements follow
+func (c *compactWriter) beginList(id int16, kind byte, n int) {
+	c.field(id, thriftList)
+	if n < 15 {
+		c.buf = append(c.buf, byte(n)<<4|kind)
+	} else {
+		c.buf = append(c.buf, 0xf0|kind)
+		c.buf = binary.AppendUvarint(c.buf, uint64(n))
+	}
+}
+
+// beginStruct starts a struct field, closed by end
+func (c *compactWriter) beginStruct(id int16) {
+	c.field(id, thriftStruct)
+	c.beginElement()
+}
+
+// beginElement starts a struct inside a list, closed by end
+func (c *compactWriter) beginElement() {
+	c.outer = append(c.outer, c.last)
+	c.last = 0
+}
+
+// end closes the current struct
+func (c *compactWriter) end() {
+	c.buf = append(c.buf, 0)
+	if n := len(c.outer); n > 0 {
+		c.last = c.outer[n-1]
+		c.outer = c.outer[:n-1]
+	}
+}
+
+// countingWriter tracks the offset in the file being written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
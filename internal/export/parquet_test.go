@@ -0,0 +1,309 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// thriftReader decodes Thrift compact protocol structs into maps of field
+// id to value, independently of compactWriter. Integers decode as int64,
+// binary as string and lists as []interface{}.
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		r.t.Fatalf("thrift data ends at offset %d", r.pos)
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("bad varint at offset %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(kind byte) interface{} {
+	switch kind {
+	case thriftI32, thriftI64, 4: // i16 is encoded like the others
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		if r.pos+n > len(r.buf) {
+			r.t.Fatalf("binary of %d bytes at offset %d runs past the end", n, r.pos)
+		}
+		s := string(r.buf[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.t.Fatalf("unexpected thrift type %d at offset %d", kind, r.pos)
+	return nil
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		if id <= last {
+			r.t.Fatalf("field %d follows field %d", id, last)
+		}
+		last = id
+		fields[id] = r.value(header & 0x0f)
+	}
+}
+
+// parquetLevels decodes length-prefixed RLE definition levels of bit width
+// 1, returning the rest of the page
+func parquetLevels(t *testing.T, page []byte, rows int) ([]bool, []byte) {
+	t.Helper()
+	if len(page) < 4 {
+		t.Fatalf("page of %d bytes has no levels", len(page))
+	}
+	n := int(binary.LittleEndian.Uint32(page))
+	runs, rest := page[4:4+n], page[4+n:]
+
+	var levels []bool
+	for len(runs) > 0 {
+		header, size := binary.Uvarint(runs)
+		if size <= 0 || header&1 != 0 || len(runs) < size+1 {
+			t.Fatalf("levels are not RLE runs: % x", runs)
+		}
+		for i := uint64(0); i < header>>1; i++ {
+			levels = append(levels, runs[size] == 1)
+		}
+		runs = runs[size+1:]
+	}
+	if len(levels) != rows {
+		t.Fatalf("got %d definition levels, want %d", len(levels), rows)
+	}
+	return levels, rest
+}
+
+// checkParquetPage decodes a column chunk's data page and compares its
+// values with the column, or with the timestamps when column is nil
+func checkParquetPage(t *testing.T, chunk []byte, table *Table, column *Column) {
+	t.Helper()
+	r := &thriftReader{t: t, buf: chunk}
+	header := r.structure()
+	body := chunk[r.pos:]
+
+	if header[1] != int64(parquetDataPage) {
+		t.Fatalf("page type %v, want a data page", header[1])
+	}
+	if header[2] != int64(len(body)) || header[3] != int64(len(body)) {
+		t.Fatalf("page sizes %v and %v, body has %d bytes", header[2], header[3], len(body))
+	}
+	dataPage := header[5].(map[int16]interface{})
+	if dataPage[1] != int64(table.Rows()) || dataPage[2] != int64(parquetPlain) {
+		t.Fatalf("data page header %v, want %d plain values", dataPage, table.Rows())
+	}
+
+	if column == nil {
+		if len(body) != 8*table.Rows() {
+			t.Fatalf("timestamp page has %d bytes, want %d", len(body), 8*table.Rows())
+		}
+		for row, timestamp := range table.Timestamps {
+			if got := int64(binary.LittleEndian.Uint64(body[8*row:])); got != timestamp.UnixMicro() {
+				t.Errorf("row %d: timestamp %d, want %d", row, got, timestamp.UnixMicro())
+			}
+		}
+		return
+	}
+
+	levels, values := parquetLevels(t, body, table.Rows())
+	for row, defined := range levels {
+		if want := column.values[row] != nil; defined != want {
+			t.Fatalf("%s row %d: defined %v, want %v", column.Name, row, defined, want)
+		}
+		if !defined {
+			continue
+		}
+		if column.Numeric {
+			got := math.Float64frombits(binary.LittleEndian.Uint64(values))
+			if want, _ := column.Float(row); got != want {
+				t.Errorf("%s row %d: %v, want %v", column.Name, row, got, want)
+			}
+			values = values[8:]
+		} else {
+			n := int(binary.LittleEndian.Uint32(values))
+			got := string(values[4 : 4+n])
+			if want, _ := column.Text(row); got != want {
+				t.Errorf("%s row %d: %q, want %q", column.Name, row, got, want)
+			}
+			values = values[4+n:]
+		}
+	}
+	if len(values) != 0 {
+		t.Fatalf("%s page has %d bytes left over", column.Name, len(values))
+	}
+}
+
+func TestParquetLayout(t *testing.T) {
+	many := map[string][]interface{}{}
+	for i := 0; i < 20; i++ {
+		many[fmt.Sprintf("system.cpu%02d", i)] = series(3, func(row int) interface{} { return float64(i*row) / 3 })
+	}
+
+	tests := []struct {
+		name  string
+		table *Table
+	}{
+		{
+			name:  "no samples",
+			table: testTable(0, nil),
+		},
+		{
+			name: "missing values",
+			table: testTable(5, map[string][]interface{}{
+				"bitcoin.peers": {8.0, nil, nil, 10.5, -1.0},
+				"bitcoin.chain": {"main", "main", nil, "test", ""},
+				"tor.circuits":  {nil, nil, nil, nil, nil},
+			}),
+		},
+		{
+			name:  "long schema list",
+			table: testTable(3, many),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeParquet(&buf, tt.table); err != nil {
+				t.Fatalf("writeParquet: %v", err)
+			}
+			data := buf.Bytes()
+			if len(data) < 12 || !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+				t.Fatalf("file is not framed by %q", parquetMagic)
+			}
+			footerStart := len(data) - 8 - int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+			if footerStart < len(parquetMagic) {
+				t.Fatalf("footer length runs past the start of the file")
+			}
+
+			r := &thriftReader{t: t, buf: data[footerStart : len(data)-8]}
+			meta := r.structure()
+			if r.pos != len(r.buf) {
+				t.Fatalf("footer has %d bytes after the file metadata", len(r.buf)-r.pos)
+			}
+			rows := int64(tt.table.Rows())
+			if meta[1] != int64(1) || meta[3] != rows {
+				t.Fatalf("version %v with %v rows, want version 1 with %d", meta[1], meta[3], rows)
+			}
+
+			// The timestamp comes first, then the table's columns
+			names := []string{"timestamp"}
+			kinds := []int64{parquetInt64}
+			for _, column := range tt.table.Columns {
+				names = append(names, column.Name)
+				if column.Numeric {
+					kinds = append(kinds, parquetDouble)
+				} else {
+					kinds = append(kinds, parquetByteArray)
+				}
+			}
+
+			schema := meta[2].([]interface{})
+			root := schema[0].(map[int16]interface{})
+			if len(schema) != len(names)+1 || root[5] != int64(len(names)) {
+				t.Fatalf("schema has %d elements and %v children, want %d columns", len(schema), root[5], len(names))
+			}
+			for i, element := range schema[1:] {
+				fields := element.(map[int16]interface{})
+				repetition, converted := int64(parquetOptional), int64(parquetUTF8)
+				switch {
+				case i == 0:
+					repetition, converted = parquetRequired, parquetTimestampMicros
+				case kinds[i] == parquetDouble:
+					converted = -1
+				}
+				if fields[4] != names[i] || fields[1] != kinds[i] || fields[3] != repetition {
+					t.Errorf("schema element %d is %v, want %s of type %d", i, fields, names[i], kinds[i])
+				}
+				if got, ok := fields[6]; converted < 0 && ok || converted >= 0 && got != converted {
+					t.Errorf("schema element %s has converted type %v, want %d", names[i], got, converted)
+				}
+			}
+
+			groups := meta[4].([]interface{})
+			if len(groups) != 1 {
+				t.Fatalf("got %d row groups, want 1", len(groups))
+			}
+			group := groups[0].(map[int16]interface{})
+			chunks := group[1].([]interface{})
+			if len(chunks) != len(names) || group[3] != rows {
+				t.Fatalf("row group has %d column chunks and %v rows, want %d and %d", len(chunks), group[3], len(names), rows)
+			}
+
+			// Chunks are written back to back between the magic and the
+			// footer
+			offset := int64(len(parquetMagic))
+			for i, chunk := range chunks {
+				fields := chunk.(map[int16]interface{})
+				metadata := fields[3].(map[int16]interface{})
+				size, _ := metadata[7].(int64)
+				if fields[2] != offset || metadata[9] != offset {
+					t.Fatalf("chunk %s at %v and page %v, want %d", names[i], fields[2], metadata[9], offset)
+				}
+				if metadata[1] != kinds[i] || !reflect.DeepEqual(metadata[3], []interface{}{names[i]}) {
+					t.Errorf("chunk %d has type %v and path %v, want %s of type %d", i, metadata[1], metadata[3], names[i], kinds[i])
+				}
+				if metadata[4] != int64(parquetUncompressed) || metadata[5] != rows || metadata[6] != size {
+					t.Errorf("chunk %s metadata %v, want %d uncompressed values", names[i], metadata, rows)
+				}
+
+				var column *Column
+				if i > 0 {
+					column = tt.table.Columns[i-1]
+				}
+				checkParquetPage(t, data[offset:offset+size], tt.table, column)
+				offset += size
+			}
+			if offset != int64(footerStart) {
+				t.Fatalf("chunks end at %d, footer starts at %d", offset, footerStart)
+			}
+			if group[2] != offset-int64(len(parquetMagic)) {
+				t.Errorf("row group total size %v, want %d", group[2], offset-int64(len(parquetMagic)))
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// SQLite file format constants. Pages have no reserved bytes, so the
+// usable size is the page size.
+const (
+	sqlitePageSize  = 4096
+	sqliteHeaderLen = 100 // Database header at the start of page 1
+
+	sqliteLeafTable     = 0x0D
+	sqliteInteriorTable = 0x05
+
+	// Payload kept on a table leaf page before the rest spills to overflow
+	// pages, as defined by the file format
+	sqliteMaxLocal = sqlitePageSize - 35
+	sqliteMinLocal = (sqlitePageSize-12)*32/255 - 23
+)
+
+// sqliteSampleGroup holds top-level fields that belong to no section
+const sqliteSampleGroup = "sample"
+
+// sqliteGroup is one table of the database: the columns of a metric group,
+// such as bitcoin or system, named without the group prefix
+type sqliteGroup struct {
+	name    string
+	columns []*Column
+	fields  []string
+}
+
+// sqliteNode is a b-tree page before it is written. Interior nodes point
+// at their children through cells and a right-most child.
+type sqliteNode struct {
+	leaf       bool
+	cells      [][]byte
+	rightChild uint32
+	maxRowID   int64
+}
+
+// sqliteFile collects the pages of a database; page n is pages[n-1]
+type sqliteFile struct {
+	pages [][]byte
+}
+
+// writeSQLite writes the table as a SQLite 3 database with one table per
+// metric group. Each table has a timestamp column in RFC 3339 and one REAL
+// or TEXT column per field; rows without any field of a group are left out
+// of its table. This writes the file format directly, keeping the agent
+// free of a database library.
+func writeSQLite(w io.Writer, table *Table) error {
+	file := &sqliteFile{}
+	file.allocate() // Page 1 is the root of the schema table
+
+	var schema []sqliteCell
+	for _, group := range sqliteGroups(table) {
+		var rows []sqliteCell
+		values := make([]interface{}, len(group.columns)+1)
+		for row, timestamp := range table.Timestamps {
+			present := false
+			for i, column := range group.columns {
+				values[i+1] = column.values[row]
+				present = present || values[i+1] != nil
+			}
+			if !present {
+				continue
+			}
+			values[0] = timestamp.UTC().Format(time.RFC3339Nano)
+			rowID := int64(len(rows) + 1)
+			rows = append(rows, sqliteCell{rowID, file.leafCell(rowID, sqliteRecord(values...))})
+		}
+
+		root := file.buildTree(rows)
+		page := file.place(root)
+		schemaID := int64(len(schema) + 1)
+		record := sqliteRecord("table", group.name, group.name, int64(page), sqliteCreateTable(group))
+		schema = append(schema, sqliteCell{schemaID, file.leafCell(schemaID, record)})
+	}
+
+	// Only page 1 may be an interior page without cells, pointing at its
+	// single child, which is how a schema root too large for page 1 fits
+	root := file.buildTree(schema)
+	if !root.fits(sqliteHeaderLen) {
+		root = &sqliteNode{rightChild: file.place(root)}
+	}
+	root.write(file.pages[0], sqliteHeaderLen)
+	file.writeHeader()
+
+	for _, page := range file.pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteGroups splits the columns by their first path element, renaming
+// fields whose names SQLite would take for the same column
+func sqliteGroups(table *Table) []*sqliteGroup {
+	var groups []*sqliteGroup
+	byName := map[string]*sqliteGroup{}
+	used := map[string]map[string]bool{}
+
+	for _, column := range table.Columns {
+		name, field, ok := strings.Cut(column.Name, ".")
+		if !ok {
+			name, field = sqliteSampleGroup, column.Name
+		}
+
+		// SQLite compares table and column names case-insensitively
+		key := strings.ToLower(name)
+		group := byName[key]
+		if group == nil {
+			group = &sqliteGroup{name: name}
+			byName[key] = group
+			groups = append(groups, group)
+			used[key] = map[string]bool{"timestamp": true}
+		}
+		unique := field
+		for n := 2; used[key][strings.ToLower(unique)]; n++ {
+			unique = fmt.Sprintf("%s_%d", field, n)
+		}
+		used[key][strings.ToLower(unique)] = true
+
+		group.columns = append(group.columns, column)
+		group.fields = append(group.fields, unique)
+	}
+	return groups
+}
+
+// sqliteCreateTable returns the CREATE TABLE statement of a group
+func sqliteCreateTable(group *sqliteGroup) string {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE " + sqliteQuote(group.name) + " (\n  timestamp TEXT NOT NULL")
+	for i, column := range group.columns {
+		kind := "TEXT"
+		if column.Numeric {
+			kind = "REAL"
+		}
+		b.WriteString(",\n  " + sqliteQuote(group.fields[i]) + " " + kind)
+	}
+	b.WriteString("\n)")
+	return b.String()
+}
+
+// sqliteQuote quotes an identifier
+func sqliteQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqliteRecord encodes values in the record format: a header of serial
+// types followed by the values. Values are nil, int64, float64 or string.
+func sqliteRecord(values ...interface{}) []byte {
+	var types, body []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			types = sqliteAppendVarint(types, 0)
+		case int64:
+			serialType, size := sqliteIntType(v)
+			types = sqliteAppendVarint(types, serialType)
+			for i := size - 1; i >= 0; i-- {
+				body = append(body, byte(v>>(8*i)))
+			}
+		case float64:
+			types = sqliteAppendVarint(types, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			types = sqliteAppendVarint(types, uint64(13+2*len(v)))
+			body = append(body, v...)
+		}
+	}
+
+	// The header size counts its own varint
+	headerLen := len(types) + 1
+	for len(sqliteAppendVarint(nil, uint64(headerLen)))+len(types) != headerLen {
+		headerLen++
+	}
+	record := sqliteAppendVarint(nil, uint64(headerLen))
+	record = append(record, types...)
+	return append(record, body...)
+}
+
+// sqliteIntType returns the serial type and size of the smallest integer
+// encoding holding v
+func sqliteIntType(v int64) (uint64, int) {
+	switch {
+	case v == 0:
+		return 8, 0
+	case v == 1:
+		return 9, 0
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return 1, 1
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 2, 2
+	case v >= -1<<23 && v < 1<<23:
+		return 3, 3
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4, 4
+	case v >= -1<<47 && v < 1<<47:
+		return 5, 6
+	default:
+		return 6, 8
+	}
+}
+
+// sqliteAppendVarint appends v as a SQLite varint: big-endian groups of
+// seven bits, with all eight bits used in a ninth byte
+func sqliteAppendVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		for i := 8; i > 0; i-- {
+			b = append(b, byte(v>>(8+7*(i-1)))|0x80)
+		}
+		return append(b, byte(v))
+	}
+
+	var groups [8]byte
+	n := 0
+	for {
+		groups[n] = byte(v & 0x7F)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i > 0; i-- {
+		b = append(b, groups[i]|0x80)
+	}
+	return append(b, groups[0])
+}
+
+// sqliteCell is a table leaf cell with its row ID
+type sqliteCell struct {
+	rowID int64
+	data  []byte
+}
+
+// allocate adds an empty page, returning its number and contents
+func (f *sqliteFile) allocate() (uint32, []byte) {
+	page := make([]byte, sqlitePageSize)
+	f.pages = append(f.pages, page)
+	return uint32(len(f.pages)), page
+}
+
+// leafCell encodes a table leaf cell, moving payload that does not fit
+// the page to a chain of overflow pages
+func (f *sqliteFile) leafCell(rowID int64, payload []byte) []byte {
+	cell := sqliteAppendVarint(nil, uint64(len(payload)))
+	cell = sqliteAppendVarint(cell, uint64(rowID))
+
+	local := len(payload)
+	if local > sqliteMaxLocal {
+		local = sqliteMinLocal + (len(payload)-sqliteMinLocal)%(sqlitePageSize-4)
+		if local > sqliteMaxLocal {
+			local = sqliteMinLocal
+		}
+	}
+	cell = append(cell, payload[:local]...)
+	if local == len(payload) {
+		return cell
+	}
+
+	first, page := f.allocate()
+	cell = binary.BigEndian.AppendUint32(cell, first)
+	for rest := payload[local:]; ; {
+		n := copy(page[4:], rest)
+		rest = rest[n:]
+		if len(rest) == 0 {
+			break
+		}
+		next, nextPage := f.allocate()
+		binary.BigEndian.PutUint32(page, next)
+		page = nextPage
+	}
+	return cell
+}
+
+// buildTree packs cells into leaf pages and adds interior levels until one
+// node is left, which is returned unwritten so the caller can place it
+func (f *sqliteFile) buildTree(cells []sqliteCell) *sqliteNode {
+	level := []*sqliteNode{{leaf: true}}
+	for _, cell := range cells {
+		node := level[len(level)-1]
+		node.cells = append(node.cells, cell.data)
+		if !node.fits(0) {
+			node.cells = node.cells[:len(node.cells)-1]
+			node = &sqliteNode{leaf: true, cells: [][]byte{cell.data}}
+			level = append(level, node)
+		}
+		node.maxRowID = cell.rowID
+	}
+
+	for len(level) > 1 {
+		var parents []*sqliteNode
+		parent := &sqliteNode{}
+		for _, child := range level {
+			page := f.place(child)
+			if parent.rightChild != 0 {
+				parent.cells = append(parent.cells, sqliteInteriorCell(parent.rightChild, parent.maxRowID))
+				if !parent.fits(0) {
+					parent.cells = parent.cells[:len(parent.cells)-1]
+					parents = append(parents, parent)
+					parent = &sqliteNode{}
+				}
+			}
+			parent.rightChild = page
+			parent.maxRowID = child.maxRowID
+		}
+		level = append(parents, parent)
+	}
+	return level[0]
+}
+
+// place writes a node to a new page, returning its number
+func (f *sqliteFile) place(node *sqliteNode) uint32 {
+	number, page := f.allocate()
+	node.write(page, 0)
+	return number
+}
+
+// sqliteInteriorCell points at a child whose largest row ID is maxRowID
+func sqliteInteriorCell(child uint32, maxRowID int64) []byte {
+	cell := binary.BigEndian.AppendUint32(nil, child)
+	return sqliteAppendVarint(cell, uint64(maxRowID))
+}
+
+// headerLen returns the size of the node's page header
+func (n *sqliteNode) headerLen() int {
+	if n.leaf {
+		return 8
+	}
+	return 12
+}
+
+// fits reports whether the node fits a page whose b-tree header starts at
+// offset
+func (n *sqliteNode) fits(offset int) bool {
+	size := offset + n.headerLen()
+	for _, cell := range n.cells {
+		size += 2 + len(cell)
+	}
+	return size <= sqlitePageSize
+}
+
+// write lays out the node in page, with its header at offset and its
+// cells packed at the end of the page
+func (n *sqliteNode) write(page []byte, offset int) {
+	pageType := byte(sqliteInteriorTable)
+	if n.leaf {
+		pageType = sqliteLeafTable
+	}
+	page[offset] = pageType
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(n.cells)))
+	if !n.leaf {
+		binary.BigEndian.PutUint32(page[offset+8:], n.rightChild)
+	}
+
+	content := sqlitePageSize
+	pointer := offset + n.headerLen()
+	for _, cell := range n.cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[pointer:], uint16(content))
+		pointer += 2
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+}
+
+// writeHeader fills in the database header on page 1
+func (f *sqliteFile) writeHeader() {
+	header := f.pages[0][:sqliteHeaderLen]
+	copy(header, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(header[16:], sqlitePageSize)
+	header[18] = 1 // Legacy (rollback journal) write and read versions
+	header[19] = 1
+	header[21] = 64 // Payload fractions, fixed by the format
+	header[22] = 32
+	header[23] = 32
+	binary.BigEndian.PutUint32(header[24:], 1) // File change counter
+	binary.BigEndian.PutUint32(header[28:], uint32(len(f.pages)))
+	binary.BigEndian.PutUint32(header[40:], 1) // Schema cookie
+	binary.BigEndian.PutUint32(header[44:], 4) // Schema format
+	binary.BigEndian.PutUint32(header[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(header[92:], 1) // Version-valid-for, the change counter
+	binary.BigEndian.PutUint32(header[96:], 3045000)
+}
@@ -0,0 +1,437 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sqliteRow is a row read back from a table b-tree
+type sqliteRow struct {
+	rowID  int64
+	values []interface{}
+}
+
+// sqliteReader reads table b-trees the way SQLite does, independently of
+// the writer's layout decisions
+type sqliteReader struct {
+	t        *testing.T
+	data     []byte
+	pageSize int
+}
+
+func newSQLiteReader(t *testing.T, data []byte) *sqliteReader {
+	t.Helper()
+	if len(data) < sqliteHeaderLen || string(data[:16]) != "SQLite format 3\x00" {
+		t.Fatalf("missing SQLite header")
+	}
+	r := &sqliteReader{t: t, data: data, pageSize: int(binary.BigEndian.Uint16(data[16:]))}
+	if pages := int(binary.BigEndian.Uint32(data[28:])); pages*r.pageSize != len(data) {
+		t.Fatalf("header counts %d pages of %d bytes, file has %d bytes", pages, r.pageSize, len(data))
+	}
+	return r
+}
+
+func (r *sqliteReader) page(number uint32) []byte {
+	r.t.Helper()
+	if number < 1 || int(number)*r.pageSize > len(r.data) {
+		r.t.Fatalf("page %d out of range", number)
+	}
+	return r.data[int(number-1)*r.pageSize : int(number)*r.pageSize]
+}
+
+// varint decodes a SQLite varint
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = v<<7 | uint64(b[i]&0x7F)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+// table returns the rows of the b-tree rooted at page, checking that row
+// IDs ascend and respect the interior keys
+func (r *sqliteReader) table(root uint32) []sqliteRow {
+	var rows []sqliteRow
+	r.walk(root, math.MinInt64, math.MaxInt64, &rows)
+	for i := 1; i < len(rows); i++ {
+		if rows[i].rowID <= rows[i-1].rowID {
+			r.t.Fatalf("row IDs out of order: %d after %d", rows[i].rowID, rows[i-1].rowID)
+		}
+	}
+	return rows
+}
+
+func (r *sqliteReader) walk(number uint32, low, high int64, rows *[]sqliteRow) {
+	page := r.page(number)
+	offset := 0
+	if number == 1 {
+		offset = sqliteHeaderLen
+	}
+	count := int(binary.BigEndian.Uint16(page[offset+3:]))
+
+	switch page[offset] {
+	case sqliteLeafTable:
+		for i := 0; i < count; i++ {
+			cell := page[binary.BigEndian.Uint16(page[offset+8+2*i:]):]
+			size, n := sqliteVarint(cell)
+			rowID, m := sqliteVarint(cell[n:])
+			if int64(rowID) <= low || int64(rowID) > high {
+				r.t.Fatalf("row %d on page %d outside its parent's range (%d, %d]", rowID, number, low, high)
+			}
+			payload := r.payload(cell[n+m:], int(size))
+			*rows = append(*rows, sqliteRow{int64(rowID), sqliteDecodeRecord(r.t, payload)})
+		}
+	case sqliteInteriorTable:
+		if count == 0 && number != 1 {
+			r.t.Fatalf("interior page %d has no cells", number)
+		}
+		for i := 0; i < count; i++ {
+			cell := page[binary.BigEndian.Uint16(page[offset+12+2*i:]):]
+			child := binary.BigEndian.Uint32(cell)
+			key, _ := sqliteVarint(cell[4:])
+			r.walk(child, low, int64(key), rows)
+			low = int64(key)
+		}
+		r.walk(binary.BigEndian.Uint32(page[offset+8:]), low, high, rows)
+	default:
+		r.t.Fatalf("page %d has unknown type %#x", number, page[offset])
+	}
+}
+
+// payload collects a cell's payload, following the overflow chain
+func (r *sqliteReader) payload(cell []byte, size int) []byte {
+	usable := r.pageSize
+	maxLocal := usable - 35
+	local := size
+	if size > maxLocal {
+		minLocal := (usable-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+
+	payload := append([]byte(nil), cell[:local]...)
+	if local == size {
+		return payload
+	}
+	next := binary.BigEndian.Uint32(cell[local:])
+	for len(payload) < size {
+		if next == 0 {
+			r.t.Fatalf("overflow chain ends %d bytes short", size-len(payload))
+		}
+		page := r.page(next)
+		n := min(size-len(payload), usable-4)
+		payload = append(payload, page[4:4+n]...)
+		next = binary.BigEndian.Uint32(page)
+	}
+	if next != 0 {
+		r.t.Fatalf("overflow chain continues past the payload")
+	}
+	return payload
+}
+
+// sqliteDecodeRecord decodes a record into nil, int64, float64 and string
+// values
+func sqliteDecodeRecord(t *testing.T, record []byte) []interface{} {
+	t.Helper()
+	headerLen, n := sqliteVarint(record)
+	header, body := record[n:headerLen], record[headerLen:]
+
+	var values []interface{}
+	for len(header) > 0 {
+		serialType, m := sqliteVarint(header)
+		header = header[m:]
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType >= 1 && serialType <= 6:
+			size := []int{0, 1, 2, 3, 4, 6, 8}[serialType]
+			v := int64(int8(body[0])) // Sign-extend from the first byte
+			for _, b := range body[1:size] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+			body = body[size:]
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(body)))
+			body = body[8:]
+		case serialType == 8 || serialType == 9:
+			values = append(values, int64(serialType-8))
+		case serialType >= 13 && serialType%2 == 1:
+			size := int(serialType-13) / 2
+			values = append(values, string(body[:size]))
+			body = body[size:]
+		default:
+			t.Fatalf("unexpected serial type %d", serialType)
+		}
+	}
+	if len(body) != 0 {
+		t.Fatalf("record has %d bytes past its values", len(body))
+	}
+	return values
+}
+
+func TestSQLiteRecord(t *testing.T) {
+	values := []interface{}{
+		nil, int64(0), int64(1), int64(2), int64(-1),
+		int64(math.MaxInt8), int64(math.MinInt8), int64(math.MaxInt8 + 1),
+		int64(math.MaxInt16), int64(math.MinInt16), int64(math.MaxInt16 + 1),
+		int64(1<<23 - 1), int64(-1 << 23), int64(1 << 23),
+		int64(math.MaxInt32), int64(math.MinInt32), int64(math.MaxInt32 + 1),
+		int64(1<<47 - 1), int64(-1 << 47), int64(1 << 47),
+		int64(math.MaxInt64), int64(math.MinInt64),
+		0.5, -1e300, math.MaxFloat64, float64(1<<53 + 2),
+		"", "block", strings.Repeat("x", 200),
+	}
+	for _, value := range values {
+		got := sqliteDecodeRecord(t, sqliteRecord(value))
+		if len(got) != 1 || got[0] != value {
+			t.Errorf("record of %v (%T) decodes to %v", value, value, got)
+		}
+	}
+	if got := sqliteDecodeRecord(t, sqliteRecord(values...)); !reflect.DeepEqual(got, values) {
+		t.Errorf("record of all values decodes to %v", got)
+	}
+
+	for _, v := range []uint64{0, 0x7F, 0x80, 1<<14 - 1, 1 << 14, 1<<56 - 1, 1 << 56, math.MaxUint64} {
+		encoded := sqliteAppendVarint(nil, v)
+		if got, n := sqliteVarint(encoded); got != v || n != len(encoded) {
+			t.Errorf("varint %d decodes to %d from %d of %d bytes", v, got, n, len(encoded))
+		}
+	}
+}
+
+// testTable builds a table from columns of per-row values, one timestamp
+// per minute
+func testTable(rows int, columns map[string][]interface{}) *Table {
+	table := &Table{Timestamps: make([]time.Time, rows)}
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range table.Timestamps {
+		table.Timestamps[i] = start.Add(time.Duration(i) * time.Minute)
+	}
+	for name, values := range columns {
+		column := &Column{Name: name, Numeric: true, values: values}
+		for _, v := range values {
+			if _, ok := v.(string); ok {
+				column.Numeric = false
+			}
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	sort.Slice(table.Columns, func(i, j int) bool {
+		return table.Columns[i].Name < table.Columns[j].Name
+	})
+	return table
+}
+
+// series returns n values from f
+func series(n int, f func(i int) interface{}) []interface{} {
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = f(i)
+	}
+	return values
+}
+
+func TestSQLiteRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		table  *Table
+		tables []string // Expected table names, in schema order
+	}{
+		{
+			name:  "no samples",
+			table: testTable(0, nil),
+		},
+		{
+			name: "empty table",
+			table: testTable(3, map[string][]interface{}{
+				"bitcoin.peers": {8.0, 9.0, nil},
+				"tor.circuits":  {nil, nil, nil},
+			}),
+			tables: []string{"bitcoin", "tor"},
+		},
+		{
+			name: "overflow payloads",
+			table: testTable(4, map[string][]interface{}{
+				"bitcoin.warnings": {
+					strings.Repeat("a", sqliteMaxLocal),
+					strings.Repeat("b", sqliteMaxLocal+1),
+					strings.Repeat("c", 3*sqlitePageSize+17),
+					strings.Repeat("d", 20000),
+				},
+				"bitcoin.peers": {1.0, nil, 3.0, 4.0},
+			}),
+			tables: []string{"bitcoin"},
+		},
+		{
+			// More leaf pages than one interior page can point at, so the
+			// tree needs a second interior level
+			name: "many rows",
+			table: testTable(70000, map[string][]interface{}{
+				"bitcoin.block_height": series(70000, func(i int) interface{} { return float64(800000 + i) }),
+			}),
+			tables: []string{"bitcoin"},
+		},
+		{
+			name: "negative and large numbers",
+			table: testTable(5, map[string][]interface{}{
+				"system.delta": {-1.0, -1e300, math.MaxFloat64, float64(1<<53 + 2), math.SmallestNonzeroFloat64},
+				"system.count": {0.0, 1.0, -128.0, 4294967296.0, -9007199254740992.0},
+			}),
+			tables: []string{"system"},
+		},
+		{
+			name: "colliding names",
+			table: testTable(2, map[string][]interface{}{
+				"Bitcoin.peers":     {1.0, nil},
+				"bitcoin.Peers":     {2.0, nil},
+				"bitcoin.peers":     {3.0, 30.0},
+				"bitcoin.peers_2":   {4.0, nil},
+				"bitcoin.timestamp": {"t", nil},
+				"state":             {"running", "paused"},
+				"Sample.x":          {nil, 5.0},
+			}),
+			tables: []string{"Bitcoin", "Sample"},
+		},
+		{
+			// Enough tables that the schema does not fit on page 1
+			name: "large schema",
+			table: testTable(1, func() map[string][]interface{} {
+				columns := map[string][]interface{}{}
+				for i := 0; i < 120; i++ {
+					columns[fmt.Sprintf("group%03d.value", i)] = []interface{}{float64(i)}
+				}
+				return columns
+			}()),
+			tables: func() []string {
+				var names []string
+				for i := 0; i < 120; i++ {
+					names = append(names, fmt.Sprintf("group%03d", i))
+				}
+				return names
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeSQLite(&buf, tt.table); err != nil {
+				t.Fatalf("writeSQLite: %v", err)
+			}
+			r := newSQLiteReader(t, buf.Bytes())
+
+			groups := sqliteGroups(tt.table)
+			schema := r.table(1)
+			if len(schema) != len(tt.tables) || len(groups) != len(tt.tables) {
+				t.Fatalf("got %d tables in the schema and %d groups, want %v", len(schema), len(groups), tt.tables)
+			}
+
+			seen := map[string]bool{}
+			for i, entry := range schema {
+				name, _ := entry.values[1].(string)
+				if entry.values[0] != "table" || name != tt.tables[i] || entry.values[2] != name {
+					t.Fatalf("schema entry %d = %v, want table %s", i, entry.values[:3], tt.tables[i])
+				}
+				if seen[strings.ToLower(name)] {
+					t.Fatalf("table name %s repeats", name)
+				}
+				seen[strings.ToLower(name)] = true
+				if sql := entry.values[4]; sql != sqliteCreateTable(groups[i]) {
+					t.Errorf("table %s has statement %v", name, sql)
+				}
+
+				columns := map[string]bool{"timestamp": true}
+				for _, field := range groups[i].fields {
+					if columns[strings.ToLower(field)] {
+						t.Fatalf("column %s of %s repeats", field, name)
+					}
+					columns[strings.ToLower(field)] = true
+				}
+
+				root, _ := entry.values[3].(int64)
+				checkSQLiteRows(t, r.table(uint32(root)), tt.table, groups[i])
+			}
+
+			checkWithSQLite(t, buf.Bytes(), tt.table, groups)
+		})
+	}
+}
+
+// checkSQLiteRows compares a table's rows with the samples that have a
+// field of its group
+func checkSQLiteRows(t *testing.T, rows []sqliteRow, table *Table, group *sqliteGroup) {
+	t.Helper()
+	next := 0
+	for row, timestamp := range table.Timestamps {
+		want := []interface{}{timestamp.UTC().Format(time.RFC3339Nano)}
+		present := false
+		for _, column := range group.columns {
+			want = append(want, column.values[row])
+			present = present || column.values[row] != nil
+		}
+		if !present {
+			continue
+		}
+		if next >= len(rows) {
+			t.Fatalf("table %s has %d rows, want more", group.name, len(rows))
+		}
+		if got := rows[next]; got.rowID != int64(next+1) || !reflect.DeepEqual(got.values, want) {
+			t.Fatalf("table %s row %d = %d %.80v, want %.80v", group.name, next+1, got.rowID, got.values, want)
+		}
+		next++
+	}
+	if next != len(rows) {
+		t.Fatalf("table %s has %d rows, want %d", group.name, len(rows), next)
+	}
+}
+
+// checkWithSQLite opens the database with the sqlite3 shell, when it is
+// installed, and runs its integrity check and a count of every table
+func checkWithSQLite(t *testing.T, data []byte, table *Table, groups []*sqliteGroup) {
+	t.Helper()
+	shell, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "export.db")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	query := "PRAGMA integrity_check;"
+	want := "ok\n"
+	for _, group := range groups {
+		query += "SELECT count(*) FROM " + sqliteQuote(group.name) + ";"
+		count := 0
+		for row := range table.Timestamps {
+			for _, column := range group.columns {
+				if column.values[row] != nil {
+					count++
+					break
+				}
+			}
+		}
+		want += fmt.Sprintf("%d\n", count)
+	}
+
+	out, err := exec.Command(shell, "-readonly", path, query).CombinedOutput()
+	if err != nil || string(out) != want {
+		t.Fatalf("sqlite3 returned %q, %v; want %q", out, err, want)
+	}
+}
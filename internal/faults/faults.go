@@ -0,0 +1,184 @@
+// Package faults injects failures into collection and storage so retry,
+// error handling and alerting paths can be exercised in integration and
+// soak tests. It is configured by command-line flags that are left out of
+// the usage message.
+package faults
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/storage"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// flagPrefix starts the name of every fault flag
+const flagPrefix = "fault."
+
+// errInjected marks failures that were injected rather than real
+var errInjected = errors.New("injected fault")
+
+// Injector decides which operations fail. A nil *Injector injects nothing.
+type Injector struct {
+	rpcDelay         time.Duration
+	rpcDelayRate     float64
+	storageErrorRate float64
+	torPartialRate   float64
+	seed             int64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// RegisterFlags adds the fault flags to fs. Call Enabled after parsing to
+// get the configured injector.
+func RegisterFlags(fs *flag.FlagSet) *Injector {
+	i := &Injector{}
+	fs.DurationVar(&i.rpcDelay, flagPrefix+"rpc-delay", 0, "Delay Bitcoin RPC calls; delays beyond the RPC timeout fail the call")
+	fs.Float64Var(&i.rpcDelayRate, flagPrefix+"rpc-delay-rate", 1, "Fraction of Bitcoin RPC calls delayed")
+	fs.Float64Var(&i.storageErrorRate, flagPrefix+"storage-error-rate", 0, "Fraction of sample writes that fail")
+	fs.Float64Var(&i.torPartialRate, flagPrefix+"tor-partial-rate", 0, "Fraction of Tor control-port sessions cut off partway through a reply")
+	fs.Int64Var(&i.seed, flagPrefix+"seed", 0, "Random seed for reproducible faults; 0 picks one")
+	return i
+}
+
+// IsFlag reports whether a flag name belongs to fault injection, so usage
+// output can leave it out
+func IsFlag(name string) bool {
+	return strings.HasPrefix(name, flagPrefix)
+}
+
+// Enabled returns the injector if any fault is configured, or nil
+func (i *Injector) Enabled() *Injector {
+	if i == nil || (i.rpcDelay <= 0 && i.storageErrorRate <= 0 && i.torPartialRate <= 0) {
+		return nil
+	}
+
+	seed := i.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	i.rng = rand.New(rand.NewSource(seed))
+	return i
+}
+
+// String describes the configured faults for logging
+func (i *Injector) String() string {
+	if i == nil {
+		return "none"
+	}
+
+	var parts []string
+	if i.rpcDelay > 0 {
+		parts = append(parts, fmt.Sprintf("rpc-delay=%v@%g", i.rpcDelay, i.rpcDelayRate))
+	}
+	if i.storageErrorRate > 0 {
+		parts = append(parts, fmt.Sprintf("storage-error-rate=%g", i.storageErrorRate))
+	}
+	if i.torPartialRate > 0 {
+		parts = append(parts, fmt.Sprintf("tor-partial-rate=%g", i.torPartialRate))
+	}
+	return strings.Join(parts, " ")
+}
+
+// hit reports whether a fault with the given rate occurs this time
+func (i *Injector) hit(rate float64) bool {
+	if i == nil || rate <= 0 {
+		return false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rng.Float64() < rate
+}
+
+// SlowRPC delays an RPC call. A delay that reaches timeout fails the call
+// the same way a bitcoin-cli timeout does.
+func (i *Injector) SlowRPC(ctx context.Context, timeout time.Duration) error {
+	if i == nil || i.rpcDelay <= 0 || !i.hit(i.rpcDelayRate) {
+		return nil
+	}
+
+	delay := min(i.rpcDelay, timeout)
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if delay >= timeout {
+		return fmt.Errorf("command timed out after %v (%w)", timeout, errInjected)
+	}
+	return nil
+}
+
+// PartialReply reports whether a control-port session should be cut off,
+// and after how many bytes
+func (i *Injector) PartialReply() (int, bool) {
+	if i == nil || !i.hit(i.torPartialRate) {
+		return 0, false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rng.Intn(256), true
+}
+
+// WrapStorage returns backend with sample writes failing at the configured
+// rate. Annotation and compaction support is kept.
+func (i *Injector) WrapStorage(backend storage.StorageBackend) storage.StorageBackend {
+	if i == nil || i.storageErrorRate <= 0 {
+		return backend
+	}
+
+	faulty := &faultyStorage{StorageBackend: backend, faults: i}
+	if full, ok := backend.(fullBackend); ok {
+		return &faultyFullStorage{faultyStorage: faulty, annotator: full, compactor: full}
+	}
+	return faulty
+}
+
+// fullBackend is a backend that also annotates and compacts
+type fullBackend interface {
+	storage.Annotator
+	storage.Compactor
+}
+
+// faultyStorage fails some sample writes
+type faultyStorage struct {
+	storage.StorageBackend
+	faults *Injector
+}
+
+func (s *faultyStorage) Write(sample *metrics.Sample) error {
+	if s.faults.hit(s.faults.storageErrorRate) {
+		return fmt.Errorf("failed to write sample: %w", errInjected)
+	}
+	return s.StorageBackend.Write(sample)
+}
+
+// faultyFullStorage is faultyStorage for backends with annotations and
+// compaction
+type faultyFullStorage struct {
+	*faultyStorage
+	annotator storage.Annotator
+	compactor storage.Compactor
+}
+
+func (s *faultyFullStorage) AddAnnotation(annotation *metrics.Annotation) error {
+	return s.annotator.AddAnnotation(annotation)
+}
+
+func (s *faultyFullStorage) Annotations(startTime, endTime time.Time) ([]*metrics.Annotation, error) {
+	return s.annotator.Annotations(startTime, endTime)
+}
+
+func (s *faultyFullStorage) Compact() error {
+	return s.compactor.Compact()
+}
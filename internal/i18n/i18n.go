@@ -0,0 +1,158 @@
+// Package i18n translates notification text. A message catalog is a JSON
+// object mapping message IDs to fmt format strings; translations may
+// reorder arguments with explicit indexes such as %[2]s. Metric names,
+// rule names and other identifiers are passed in as arguments and are
+// never translated.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is used for any message missing from a catalog
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+// Localizer formats messages for one locale
+type Localizer struct {
+	locale   string
+	messages map[string]string
+	fallback map[string]string
+}
+
+var (
+	englishOnce sync.Once
+	english     *Localizer
+)
+
+// English returns the localizer for the default locale
+func English() *Localizer {
+	englishOnce.Do(func() {
+		messages, err := loadBuiltin(DefaultLocale)
+		if err != nil {
+			panic(fmt.Sprintf("i18n: default catalog is invalid: %v", err))
+		}
+		english = &Localizer{locale: DefaultLocale, messages: messages, fallback: messages}
+	})
+	return english
+}
+
+// New creates a localizer for a locale such as "de" or "pt-BR". A region
+// falls back to its language's catalog. A catalog named <locale>.json in
+// dir, if dir is set, overrides or extends the built-in messages.
+func New(locale, dir string) (*Localizer, error) {
+	if locale == "" {
+		locale = DefaultLocale
+	}
+
+	messages := make(map[string]string)
+	found := false
+
+	for _, candidate := range candidates(locale) {
+		builtinMessages, err := loadBuiltin(candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for id, text := range builtinMessages {
+			messages[id] = text
+		}
+		found = true
+		break
+	}
+
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, locale+".json"))
+		switch {
+		case err == nil:
+			custom, err := parseCatalog(data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid catalog %s.json: %w", locale, err)
+			}
+			for id, text := range custom {
+				messages[id] = text
+			}
+			found = true
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("failed to read catalog: %w", err)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no message catalog for locale %q (available: %s)", locale, strings.Join(Locales(), ", "))
+	}
+
+	return &Localizer{
+		locale:   locale,
+		messages: messages,
+		fallback: English().messages,
+	}, nil
+}
+
+// Locale returns the locale the localizer was created for
+func (l *Localizer) Locale() string {
+	return l.locale
+}
+
+// T formats a message, falling back to English and then to the message ID
+func (l *Localizer) T(id string, args ...interface{}) string {
+	format, ok := l.messages[id]
+	if !ok {
+		if format, ok = l.fallback[id]; !ok {
+			return id
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Locales returns the built-in locales
+func Locales() []string {
+	entries, _ := builtin.ReadDir("locales")
+
+	locales := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		locales = append(locales, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// candidates lists catalogs to try for a locale, most specific first
+func candidates(locale string) []string {
+	locale = strings.ReplaceAll(locale, "_", "-")
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		return []string{locale, lang}
+	}
+	return []string{locale}
+}
+
+// loadBuiltin reads an embedded catalog
+func loadBuiltin(locale string) (map[string]string, error) {
+	data, err := builtin.ReadFile("locales/" + locale + ".json")
+	if err != nil {
+		return nil, err
+	}
+	return parseCatalog(data)
+}
+
+// parseCatalog decodes a catalog file
+func parseCatalog(data []byte) (map[string]string, error) {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
@@ -0,0 +1,439 @@
+package influx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/alert"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+var logger = logging.New("influxdb")
+
+// writeAttempts is how many times a batch is tried before it is put back
+// to wait for the next flush
+const writeAttempts = 3
+
+// retryDelay is the wait before the second attempt; it doubles each time
+const retryDelay = time.Second
+
+// Writer batches samples and writes them to InfluxDB in line protocol.
+// Each sample section becomes a measurement named <prefix>_<section>, e.g.
+// btcmon_bitcoin; additional nodes and custom collectors are told apart by
+// node and collector tags. Samples are kept while InfluxDB is unreachable,
+// up to a limit, and written once it is back.
+type Writer struct {
+	writeURL      string
+	token         string // Version 2
+	username      string // Version 1
+	password      string
+	prefix        string
+	tags          map[string]string // Added to every point
+	batchSize     int
+	maxBuffered   int
+	flushInterval time.Duration
+	client        *http.Client
+
+	mu      sync.Mutex
+	pending [][]byte // Encoded samples, oldest first
+	dropped int      // Samples discarded since the last successful write
+	failing bool
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewWriter creates a writer for the InfluxDB settings in cfg, connecting
+// through dialer, and starts its flush loop
+func NewWriter(cfg config.InfluxDBConfig, dialer *netproxy.Dialer) (*Writer, error) {
+	writeURL, err := buildWriteURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(cfg.Tags)+1)
+	tags["host"], _ = os.Hostname()
+	for key, value := range cfg.Tags {
+		tags[key] = value
+	}
+
+	w := &Writer{
+		writeURL:      writeURL,
+		token:         cfg.Token,
+		username:      cfg.Username,
+		password:      cfg.Password,
+		prefix:        cfg.MeasurementPrefix,
+		tags:          tags,
+		batchSize:     max(cfg.BatchSize, 1),
+		maxBuffered:   max(cfg.MaxBufferedSamples, cfg.BatchSize),
+		flushInterval: time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+		client:        &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second, Transport: dialer.Transport()},
+		flush:         make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// buildWriteURL returns the write endpoint for the configured API version
+func buildWriteURL(cfg config.InfluxDBConfig) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(cfg.URL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return "", fmt.Errorf("invalid InfluxDB URL: %q", cfg.URL)
+	}
+
+	query := url.Values{"precision": {"ns"}}
+	switch cfg.Version {
+	case 1:
+		if cfg.Database == "" {
+			return "", fmt.Errorf("InfluxDB v1 requires a database")
+		}
+		base.Path += "/write"
+		query.Set("db", cfg.Database)
+		if cfg.RetentionPolicy != "" {
+			query.Set("rp", cfg.RetentionPolicy)
+		}
+	case 2:
+		if cfg.Org == "" || cfg.Bucket == "" {
+			return "", fmt.Errorf("InfluxDB v2 requires an org and a bucket")
+		}
+		base.Path += "/api/v2/write"
+		query.Set("org", cfg.Org)
+		query.Set("bucket", cfg.Bucket)
+	default:
+		return "", fmt.Errorf("unsupported InfluxDB version %d (use 1 or 2)", cfg.Version)
+	}
+
+	base.RawQuery = query.Encode()
+	return base.String(), nil
+}
+
+// Send queues a sample for the next batch without blocking collection
+func (w *Writer) Send(sample *metrics.Sample) {
+	lines := encodeSample(sample, w.prefix, w.tags)
+	if len(lines) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	w.pending = append(w.pending, lines)
+	if excess := len(w.pending) - w.maxBuffered; excess > 0 {
+		w.pending = w.pending[excess:]
+		w.dropped += excess
+	}
+	full := len(w.pending) >= w.batchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close writes any queued samples and stops the flush loop. A final write
+// that fails is not retried.
+func (w *Writer) Close() {
+	close(w.stop)
+	<-w.done
+}
+
+// run flushes full batches as they fill and partial ones periodically
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.flush:
+			// While InfluxDB is down, wait for the ticker instead of
+			// retrying every time a batch fills
+			w.mu.Lock()
+			failing := w.failing
+			w.mu.Unlock()
+			if !failing {
+				w.flushPending(false)
+			}
+		case <-ticker.C:
+			w.flushPending(false)
+		case <-w.stop:
+			w.flushPending(true)
+			return
+		}
+	}
+}
+
+// flushPending writes queued samples in batches, including a final partial
+// one, until the queue is empty or a write fails. On the final flush,
+// samples that cannot be written are dropped.
+func (w *Writer) flushPending(final bool) {
+	for {
+		w.mu.Lock()
+		n := min(len(w.pending), w.batchSize)
+		batch := w.pending[:n:n]
+		w.mu.Unlock()
+
+		if n == 0 {
+			return
+		}
+
+		err := w.writeWithRetry(bytes.Join(batch, nil), final)
+
+		w.mu.Lock()
+		var rejected *rejectedError
+		switch {
+		case err == nil || errors.As(err, &rejected):
+			w.pending = w.pending[n:]
+		case final:
+			w.dropped += len(w.pending)
+			w.pending = nil
+		}
+		dropped := w.dropped
+		if err == nil {
+			w.dropped = 0
+		}
+		wasFailing := w.failing
+		w.failing = err != nil && rejected == nil
+		w.mu.Unlock()
+
+		switch {
+		case rejected != nil:
+			logger.Warn("InfluxDB rejected a batch, discarding it", "samples", n, "error", err)
+		case err != nil:
+			if !wasFailing {
+				logger.Warn("Failed to write to InfluxDB, keeping samples for the next flush", "error", err)
+			}
+			return
+		case wasFailing || dropped > 0:
+			logger.Info("InfluxDB writes recovered", "dropped_samples", dropped)
+		}
+	}
+}
+
+// rejectedError is a client error from InfluxDB, such as malformed points
+// or bad credentials, that retrying the same batch cannot fix
+type rejectedError struct {
+	status  string
+	message string
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("InfluxDB returned %s: %s", e.status, e.message)
+}
+
+// writeWithRetry writes a batch, retrying transient failures with
+// exponential backoff. The final flush on shutdown makes a single attempt.
+func (w *Writer) writeWithRetry(body []byte, final bool) error {
+	attempts := writeAttempts
+	if final {
+		attempts = 1
+	}
+
+	delay := retryDelay
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = w.write(body)
+		var rejected *rejectedError
+		if err == nil || errors.As(err, &rejected) || attempt == attempts {
+			break
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-w.stop:
+			return err
+		}
+	}
+	return err
+}
+
+// write posts one batch of lines
+func (w *Writer) write(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	} else if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return &rejectedError{status: resp.Status, message: strings.TrimSpace(string(message))}
+	}
+	return fmt.Errorf("InfluxDB returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
+
+// point is one line of line protocol being assembled
+type point struct {
+	measurement string
+	tags        string
+	fields      map[string]float64
+}
+
+// encodeSample converts a sample's numeric fields to line protocol, one
+// line per measurement and tag set
+func encodeSample(sample *metrics.Sample, prefix string, tags map[string]string) []byte {
+	points := make(map[string]*point)
+	baseTags := encodeTags(tags)
+
+	for name, value := range alert.Fields(sample) {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		section, field, ok := strings.Cut(name, ".")
+		if !ok {
+			continue
+		}
+
+		pointTags := baseTags
+		switch section {
+		case "nodes":
+			// nodes.<name>.<field> joins the primary node's measurement
+			node, rest, ok := strings.Cut(field, ".")
+			if !ok {
+				continue
+			}
+			section, field = "bitcoin", rest
+			pointTags = encodeTags(withTag(tags, "node", node))
+		case "custom":
+			collector, rest, ok := strings.Cut(field, ".")
+			if !ok {
+				continue
+			}
+			field = rest
+			pointTags = encodeTags(withTag(tags, "collector", collector))
+		}
+
+		key := section + pointTags
+		p, ok := points[key]
+		if !ok {
+			p = &point{
+				measurement: prefix + "_" + section,
+				tags:        pointTags,
+				fields:      make(map[string]float64),
+			}
+			points[key] = p
+		}
+		p.fields[field] = value
+	}
+
+	keys := make([]string, 0, len(points))
+	for key := range points {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	timestamp := strconv.FormatInt(sample.Timestamp.UnixNano(), 10)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		p := points[key]
+
+		names := make([]string, 0, len(p.fields))
+		for name := range p.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		buf.WriteString(escape(p.measurement, ", "))
+		buf.WriteString(p.tags)
+		for i, name := range names {
+			if i == 0 {
+				buf.WriteByte(' ')
+			} else {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(escape(name, ",= "))
+			buf.WriteByte('=')
+			buf.WriteString(strconv.FormatFloat(p.fields[name], 'f', -1, 64))
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(timestamp)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// encodeTags renders tags as ",key=value" pairs sorted by key, as InfluxDB
+// recommends. Tags with empty values are invalid and omitted.
+func encodeTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key, value := range tags {
+		if key != "" && value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteByte(',')
+		b.WriteString(escape(key, ",= "))
+		b.WriteByte('=')
+		b.WriteString(escape(tags[key], ",= "))
+	}
+	return b.String()
+}
+
+// withTag returns a copy of tags with one more tag
+func withTag(tags map[string]string, key, value string) map[string]string {
+	copied := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+// escape backslash-escapes the given special characters
+func escape(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
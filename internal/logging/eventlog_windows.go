@@ -0,0 +1,97 @@
+//go:build windows
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event IDs written to the Event Log, one per level
+const (
+	eventIDInfo    = 1
+	eventIDWarning = 2
+	eventIDError   = 3
+)
+
+// SetupEventLog installs a default logger writing to the Windows Event Log
+// under the given source, which must already be registered. The returned
+// function closes the log.
+func SetupEventLog(source, level string) (func() error, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	elog, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+
+	slog.SetDefault(slog.New(&eventLogHandler{
+		elog:  elog,
+		level: lvl,
+		with:  func(h slog.Handler) slog.Handler { return h },
+	}))
+	return elog.Close, nil
+}
+
+// eventLogHandler formats records as text and reports them as Event Log
+// information, warning or error events
+type eventLogHandler struct {
+	elog  *eventlog.Log
+	level slog.Level
+	with  func(slog.Handler) slog.Handler
+}
+
+// Enabled implements slog.Handler
+func (h *eventLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+// Handle implements slog.Handler
+func (h *eventLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	text := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: h.level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// The Event Log records the time and level itself
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	if err := h.with(text).Handle(ctx, r); err != nil {
+		return err
+	}
+
+	msg := strings.TrimSuffix(buf.String(), "\n")
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.elog.Error(eventIDError, msg)
+	case r.Level >= slog.LevelWarn:
+		return h.elog.Warning(eventIDWarning, msg)
+	default:
+		return h.elog.Info(eventIDInfo, msg)
+	}
+}
+
+// WithAttrs implements slog.Handler
+func (h *eventLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &eventLogHandler{elog: h.elog, level: h.level, with: func(next slog.Handler) slog.Handler {
+		return h.with(next).WithAttrs(attrs)
+	}}
+}
+
+// WithGroup implements slog.Handler
+func (h *eventLogHandler) WithGroup(name string) slog.Handler {
+	return &eventLogHandler{elog: h.elog, level: h.level, with: func(next slog.Handler) slog.Handler {
+		return h.with(next).WithGroup(name)
+	}}
+}
@@ -0,0 +1,76 @@
+// Package logging configures the agent's leveled logger. Every record
+// carries a component attribute; errors and durations are logged under the
+// "error" and "duration" keys so log queries work across components.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Setup installs the default logger for the given level ("debug", "info",
+// "warn" or "error") and format ("text" or "json")
+func Setup(w io.Writer, level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text", "":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// New returns a logger for a component. Loggers are typically created at
+// package initialization, before Setup runs, so records are resolved
+// against the default logger at the time they are written.
+func New(component string) *slog.Logger {
+	return slog.New(&deferredHandler{
+		with: func(h slog.Handler) slog.Handler {
+			return h.WithAttrs([]slog.Attr{slog.String("component", component)})
+		},
+	})
+}
+
+// deferredHandler forwards records to the current default handler
+type deferredHandler struct {
+	with func(slog.Handler) slog.Handler
+}
+
+// Enabled implements slog.Handler
+func (h *deferredHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *deferredHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.with(slog.Default().Handler()).Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *deferredHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &deferredHandler{with: func(next slog.Handler) slog.Handler {
+		return h.with(next).WithAttrs(attrs)
+	}}
+}
+
+// WithGroup implements slog.Handler
+func (h *deferredHandler) WithGroup(name string) slog.Handler {
+	return &deferredHandler{with: func(next slog.Handler) slog.Handler {
+		return h.with(next).WithGroup(name)
+	}}
+}
@@ -0,0 +1,124 @@
+// Package netproxy connects to external services, optionally through a
+// SOCKS5 proxy such as Tor
+package netproxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+)
+
+// connectTimeout bounds connecting when the context has no deadline. Tor
+// can take a while to build a circuit.
+const connectTimeout = 60 * time.Second
+
+// Dialer opens outbound connections for integrations. A nil Dialer
+// connects directly.
+type Dialer struct {
+	proxyAddr   string
+	directHosts map[string]bool
+	directNets  []*net.IPNet
+}
+
+// New returns a dialer for the outbound proxy settings, or nil when the
+// proxy is disabled
+func New(cfg config.OutboundProxyConfig) *Dialer {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	d := &Dialer{proxyAddr: cfg.Address, directHosts: make(map[string]bool)}
+	for _, host := range cfg.DirectHosts {
+		if _, network, err := net.ParseCIDR(host); err == nil {
+			d.directNets = append(d.directNets, network)
+		} else {
+			d.directHosts[strings.ToLower(host)] = true
+		}
+	}
+	return d
+}
+
+// ProxyAddr returns the proxy's address, or "" when connecting directly
+func (d *Dialer) ProxyAddr() string {
+	if d == nil {
+		return ""
+	}
+	return d.proxyAddr
+}
+
+// DialContext connects to addr, through the proxy unless addr is loopback
+// or a direct host. Only TCP is supported through the proxy.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := connectTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	if d == nil || d.direct(host) {
+		dialer := net.Dialer{Timeout: timeout}
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return nil, err
+	}
+	return DialSOCKS5(ctx, d.proxyAddr, host, port, timeout)
+}
+
+// DialTimeout is DialContext with a timeout, like net.DialTimeout
+func (d *Dialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, addr)
+}
+
+// Transport returns an HTTP transport that connects through the dialer, or
+// nil for the default transport when connecting directly
+func (d *Dialer) Transport() http.RoundTripper {
+	if d == nil {
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Environment proxies would bypass the SOCKS proxy
+	transport.Proxy = nil
+	transport.DialContext = d.DialContext
+	return transport
+}
+
+// direct reports whether host is reached without the proxy. Hostnames are
+// compared as written and never resolved locally, which would leak the
+// lookup outside the proxy.
+func (d *Dialer) direct(host string) bool {
+	if strings.EqualFold(host, "localhost") || d.directHosts[strings.ToLower(host)] {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, network := range d.directNets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
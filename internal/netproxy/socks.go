@@ -0,0 +1,110 @@
+package netproxy
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// socksReplies describes SOCKS5 reply codes, including Tor's extended
+// onion service codes
+var socksReplies = map[byte]string{
+	0x01: "general failure",
+	0x02: "connection not allowed",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+	0xF0: "onion service descriptor not found",
+	0xF1: "onion service descriptor invalid",
+	0xF2: "onion service introduction failed",
+	0xF3: "onion service rendezvous failed",
+	0xF4: "onion service missing client authorization",
+	0xF5: "onion service wrong client authorization",
+	0xF6: "onion address invalid",
+	0xF7: "onion service introduction timed out",
+}
+
+// DialSOCKS5 connects to host:port through a SOCKS5 proxy without
+// authentication, resolving the hostname at the proxy (required for .onion)
+func DialSOCKS5(ctx context.Context, proxyAddr, host string, port int, timeout time.Duration) (net.Conn, error) {
+	if len(host) > 255 {
+		return nil, fmt.Errorf("hostname too long")
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SOCKS proxy: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Abort a slow rendezvous on shutdown
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// Greeting: version 5, one method, no authentication
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS greeting failed: %w", err)
+	}
+	if reply[0] != 0x05 || reply[1] != 0x00 {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS proxy rejected authentication method")
+	}
+
+	// Connect request with a domain name address
+	req := []byte{0x05, 0x01, 0x00, 0x03, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS connect failed: %w", err)
+	}
+	if header[1] != 0x00 {
+		conn.Close()
+		if reason, ok := socksReplies[header[1]]; ok {
+			return nil, fmt.Errorf("SOCKS connect failed: %s", reason)
+		}
+		return nil, fmt.Errorf("SOCKS connect failed: code 0x%02x", header[1])
+	}
+
+	// Discard the bound address
+	var addrLen int
+	switch header[3] {
+	case 0x01:
+		addrLen = 4
+	case 0x04:
+		addrLen = 16
+	case 0x03:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		addrLen = int(l[0])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,23 @@
+// Package permissions checks, and optionally repairs, the ownership and
+// modes of the agent's files at startup. Files left owned by root after
+// running the agent by hand, or made unreadable for a dashboard, otherwise
+// show up later as puzzling permission denied errors.
+package permissions
+
+import (
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+)
+
+var logger = logging.New("permissions")
+
+// Check compares the data directory, and the directory of socketPath when
+// it is a Unix socket, with cfg and logs every difference, fixing it when
+// cfg.Repair is set. An error means cfg itself is unusable, e.g. an
+// unknown owner; files that could not be fixed are only logged.
+func Check(cfg config.PermissionsConfig, dataDir, socketPath string) error {
+	if cfg.Owner == "" && cfg.Group == "" && cfg.DirMode == "" && cfg.FileMode == "" && cfg.SocketDirMode == "" {
+		return nil // Nothing configured
+	}
+	return check(cfg, dataDir, socketPath)
+}
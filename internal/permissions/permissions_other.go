@@ -0,0 +1,245 @@
+//go:build !windows
+
+package permissions
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+)
+
+// modeDirs are the directories under the data directory whose modes are
+// checked, besides the data directory itself
+var modeDirs = []string{"metrics", "raw"}
+
+// checker compares files with the configured owner and modes
+type checker struct {
+	repair bool
+	uid    int // -1 when unchecked
+	gid    int // -1 when unchecked
+
+	dirMode  os.FileMode // 0 when unchecked
+	fileMode os.FileMode // 0 when unchecked
+
+	differences int
+	repaired    int
+}
+
+func check(cfg config.PermissionsConfig, dataDir, socketPath string) error {
+	dirMode, fileMode, socketDirMode, err := cfg.Modes()
+	if err != nil {
+		return err
+	}
+	uid, err := lookupID(cfg.Owner, lookupUser)
+	if err != nil {
+		return err
+	}
+	gid, err := lookupID(cfg.Group, lookupGroup)
+	if err != nil {
+		return err
+	}
+
+	c := &checker{
+		repair:   cfg.Repair,
+		uid:      uid,
+		gid:      gid,
+		dirMode:  dirMode,
+		fileMode: fileMode,
+	}
+
+	// Ownership everywhere, modes only where a dashboard reads
+	c.walk(dataDir, func(path string) bool {
+		if path == dataDir {
+			return true
+		}
+		for _, dir := range modeDirs {
+			root := filepath.Join(dataDir, dir)
+			if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	})
+
+	if socketDirMode != 0 && !strings.HasPrefix(socketPath, "tcp:") {
+		c.checkSocketDir(filepath.Dir(socketPath), socketDirMode)
+	}
+
+	switch {
+	case c.differences == 0:
+		logger.Debug("File permissions match the configuration", "path", dataDir)
+	case c.repair:
+		logger.Info("Checked file permissions", "differences", c.differences, "repaired", c.repaired)
+	default:
+		logger.Warn("File permissions differ from the configuration; set permissions.repair to fix them", "differences", c.differences)
+	}
+	return nil
+}
+
+// walk checks everything under root, modes only for the paths withModes
+// accepts. A missing root has nothing to check.
+func (c *checker) walk(root string, withModes func(path string) bool) {
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warn("Failed to check permissions", "path", path, "error", err)
+			}
+			return nil
+		}
+		c.checkPath(path, withModes(path))
+		return nil
+	})
+	if err != nil {
+		logger.Warn("Failed to check permissions", "path", root, "error", err)
+	}
+}
+
+// checkPath checks one directory or regular file; sockets, symlinks and
+// other special files are left alone
+func (c *checker) checkPath(path string, modes bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("Failed to check permissions", "path", path, "error", err)
+		}
+		return
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return
+	}
+
+	c.checkOwner(path, info)
+	if !modes {
+		return
+	}
+	want := c.fileMode
+	if info.IsDir() {
+		want = c.dirMode
+	}
+	c.checkMode(path, info, want)
+}
+
+// checkSocketDir creates the socket directory if needed and checks its
+// owner and mode
+func (c *checker) checkSocketDir(dir string, mode os.FileMode) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, mode); err != nil {
+			logger.Warn("Failed to create socket directory", "path", dir, "error", err)
+			return
+		}
+		logger.Info("Created socket directory", "path", dir, "mode", fmt.Sprintf("%04o", mode))
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		logger.Warn("Failed to check permissions", "path", dir, "error", err)
+		return
+	}
+	c.checkOwner(dir, info)
+	c.checkMode(dir, info, mode)
+}
+
+// checkOwner compares the owner and group of a file with the configured
+// ones
+func (c *checker) checkOwner(path string, info os.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	uid, gid := -1, -1
+	if c.uid >= 0 && int(stat.Uid) != c.uid {
+		uid = c.uid
+	}
+	if c.gid >= 0 && int(stat.Gid) != c.gid {
+		gid = c.gid
+	}
+	if uid < 0 && gid < 0 {
+		return
+	}
+
+	c.differences++
+	have := fmt.Sprintf("%d:%d", stat.Uid, stat.Gid)
+	if !c.repair {
+		logger.Warn("File owner differs from the configuration", "path", path, "owner", have, "want", c.ownerString())
+		return
+	}
+	if err := os.Lchown(path, uid, gid); err != nil {
+		logger.Warn("Failed to change file owner", "path", path, "owner", have, "want", c.ownerString(), "error", err)
+		return
+	}
+	c.repaired++
+	logger.Info("Changed file owner", "path", path, "from", have, "to", c.ownerString())
+}
+
+// checkMode compares the permission bits of a file with want, unless want
+// is 0
+func (c *checker) checkMode(path string, info os.FileInfo, want os.FileMode) {
+	have := info.Mode().Perm()
+	if want == 0 || have == want {
+		return
+	}
+
+	c.differences++
+	if !c.repair {
+		logger.Warn("File mode differs from the configuration", "path", path, "mode", fmt.Sprintf("%04o", have), "want", fmt.Sprintf("%04o", want))
+		return
+	}
+	if err := os.Chmod(path, want); err != nil {
+		logger.Warn("Failed to change file mode", "path", path, "mode", fmt.Sprintf("%04o", have), "want", fmt.Sprintf("%04o", want), "error", err)
+		return
+	}
+	c.repaired++
+	logger.Info("Changed file mode", "path", path, "from", fmt.Sprintf("%04o", have), "to", fmt.Sprintf("%04o", want))
+}
+
+// ownerString formats the configured owner and group as uid:gid, with
+// "-" for one that is not checked
+func (c *checker) ownerString() string {
+	format := func(id int) string {
+		if id < 0 {
+			return "-"
+		}
+		return strconv.Itoa(id)
+	}
+	return format(c.uid) + ":" + format(c.gid)
+}
+
+// lookupID resolves a user or group given by name or numeric ID, or
+// returns -1 for an empty one
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	idString, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(idString)
+}
+
+func lookupUser(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown permissions owner %q: %w", name, err)
+	}
+	return u.Uid, nil
+}
+
+func lookupGroup(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown permissions group %q: %w", name, err)
+	}
+	return g.Gid, nil
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package permissions
+
+import "github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+
+// check does nothing on Windows, where access is controlled by ACLs rather
+// than owners and modes
+func check(cfg config.PermissionsConfig, dataDir, socketPath string) error {
+	logger.Debug("Permission checks are not supported on Windows")
+	return nil
+}
@@ -0,0 +1,235 @@
+// Package pushgateway shares a few public statistics with a community
+// Prometheus pushgateway, for voluntary network-health telemetry
+package pushgateway
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+var logger = logging.New("pushgateway")
+
+// instanceFile holds the random instance label in the data directory, so
+// pushes from one node replace each other across restarts
+const instanceFile = "pushgateway_instance"
+
+// userAgentComment matches the comments operators can add to the node's
+// user agent with -uacomment, which may identify them
+var userAgentComment = regexp.MustCompile(`\([^)]*\)`)
+
+// Pusher periodically replaces its group on the pushgateway with the
+// public statistics from the newest sample. Everything else in the sample
+// stays local.
+type Pusher struct {
+	groupURL string
+	version  string // Monitor version
+	interval time.Duration
+	client   *http.Client
+
+	mu      sync.Mutex
+	body    []byte // Rendered from the newest sample; nil until the node has reported
+	failing bool
+
+	ready chan struct{} // Signalled when the first statistics arrive
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewPusher creates a pusher for the settings in cfg, connecting through
+// dialer, and starts its push loop. The instance label is created in
+// dataDir unless configured.
+func NewPusher(cfg config.PushgatewayConfig, dataDir, version string, dialer *netproxy.Dialer) (*Pusher, error) {
+	base, err := url.Parse(strings.TrimSuffix(cfg.URL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid pushgateway URL: %q", cfg.URL)
+	}
+
+	instance := cfg.Instance
+	if instance == "" {
+		instance, err = instanceID(dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pushgateway instance ID: %w", err)
+		}
+	}
+
+	p := &Pusher{
+		groupURL: base.String() + "/metrics/job/" + url.PathEscape(cfg.Job) + "/instance/" + url.PathEscape(instance),
+		version:  version,
+		interval: time.Duration(cfg.IntervalSeconds) * time.Second,
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second, Transport: dialer.Transport()},
+		ready:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go p.run()
+	return p, nil
+}
+
+// Send keeps the public statistics of a sample for the next push
+func (p *Pusher) Send(sample *metrics.Sample) {
+	body := render(sample, p.version)
+	if body == nil {
+		return
+	}
+
+	p.mu.Lock()
+	first := p.body == nil
+	p.body = body
+	p.mu.Unlock()
+
+	if first {
+		select {
+		case p.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close stops pushing. The last push stays on the pushgateway.
+func (p *Pusher) Close() {
+	close(p.stop)
+	<-p.done
+}
+
+// run pushes once the node has first reported and then every interval
+func (p *Pusher) run() {
+	defer close(p.done)
+
+	select {
+	case <-p.ready:
+	case <-p.stop:
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.pushLatest()
+
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// pushLatest pushes the newest statistics, logging failures once until a
+// push succeeds again
+func (p *Pusher) pushLatest() {
+	p.mu.Lock()
+	body := p.body
+	wasFailing := p.failing
+	p.mu.Unlock()
+
+	err := p.push(body)
+
+	p.mu.Lock()
+	p.failing = err != nil
+	p.mu.Unlock()
+
+	switch {
+	case err != nil && !wasFailing:
+		logger.Warn("Failed to push statistics, will retry at the next interval", "error", err)
+	case err == nil && wasFailing:
+		logger.Info("Pushing statistics recovered")
+	}
+}
+
+// push replaces the group on the pushgateway with body
+func (p *Pusher) push(body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, p.groupURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
+
+// render returns the public statistics of a sample in the Prometheus text
+// format, or nil if the primary node has not reported. This is the only
+// data that leaves the host, so fields are picked one by one rather than
+// filtered from the whole sample.
+func render(sample *metrics.Sample, version string) []byte {
+	node := sample.Bitcoin
+	if node == nil || node.BlockHeight == 0 {
+		return nil
+	}
+
+	chain := label("chain", node.Chain)
+	subversion := strings.TrimSpace(userAgentComment.ReplaceAllString(node.Subversion, ""))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# TYPE btc_monitor_block_height gauge\nbtc_monitor_block_height{%s} %d\n", chain, node.BlockHeight)
+	fmt.Fprintf(&buf, "# TYPE btc_monitor_node_uptime_seconds gauge\nbtc_monitor_node_uptime_seconds{%s} %d\n", chain, node.UptimeSeconds/3600*3600)
+	fmt.Fprintf(&buf, "# TYPE btc_monitor_info gauge\nbtc_monitor_info{%s,%s,%s,%s} 1\n", chain,
+		label("monitor_version", version),
+		label("node_version", strconv.Itoa(node.Version)),
+		label("node_subversion", subversion))
+	return buf.Bytes()
+}
+
+// label renders a Prometheus label pair with its value escaped
+func label(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return name + `="` + value + `"`
+}
+
+// instanceID returns the random instance label kept in dir, creating it on
+// first use. It is not derived from the hostname or any address.
+func instanceID(dir string) (string, error) {
+	path := filepath.Join(dir, instanceFile)
+	data, err := os.ReadFile(path)
+	if err == nil && len(bytes.TrimSpace(data)) > 0 {
+		return string(bytes.TrimSpace(data)), nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	instance := hex.EncodeToString(id)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(instance+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return instance, nil
+}
@@ -0,0 +1,207 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Aggregation functions supported per bucket. Percentiles are also accepted
+// as "p" followed by a number, e.g. "p95".
+const (
+	AggMin = "min"
+	AggAvg = "avg"
+	AggMax = "max"
+)
+
+// Bucket holds per-field statistics for the samples in one time step
+type Bucket struct {
+	Start      time.Time                     `json:"start"`
+	Count      int                           `json:"count"`
+	Fields     map[string]map[string]float64 `json:"fields"`               // field -> aggregation -> value
+	Histograms map[string][]HistogramBin     `json:"histograms,omitempty"` // field -> value distribution
+}
+
+// HistogramBin counts the values in a bucket that fall at or below Le and
+// above the previous bin's bound; the last bin's Le is "+Inf"
+type HistogramBin struct {
+	Le    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+// ParseHistogramEdges parses ascending histogram upper bounds such as
+// "10,50,100,500"
+func ParseHistogramEdges(value string) ([]float64, error) {
+	var edges []float64
+	for _, part := range strings.Split(value, ",") {
+		edge, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid histogram bound: %s", part)
+		}
+		if len(edges) > 0 && edge <= edges[len(edges)-1] {
+			return nil, fmt.Errorf("histogram bounds must be ascending")
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
+
+// ParseAggregations parses a comma-separated list such as "min,max". An
+// empty list selects all aggregations.
+func ParseAggregations(value string) ([]string, error) {
+	if value == "" {
+		return []string{AggMin, AggAvg, AggMax}, nil
+	}
+
+	var aggs []string
+	for _, agg := range strings.Split(value, ",") {
+		agg = strings.ToLower(strings.TrimSpace(agg))
+		switch agg {
+		case AggMin, AggAvg, AggMax:
+			aggs = append(aggs, agg)
+		default:
+			if _, ok := parsePercentile(agg); !ok {
+				return nil, fmt.Errorf("unknown aggregation: %s", agg)
+			}
+			aggs = append(aggs, agg)
+		}
+	}
+
+	return aggs, nil
+}
+
+// parsePercentile parses "p95" style aggregations into a fraction
+func parsePercentile(agg string) (float64, bool) {
+	if !strings.HasPrefix(agg, "p") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(agg[1:], 64)
+	if err != nil || p <= 0 || p > 100 {
+		return 0, false
+	}
+	return p / 100, true
+}
+
+// alignStep returns the start of the step holding t, counting steps from
+// the Unix epoch. time.Truncate counts from the zero Time instead, which
+// only agrees for steps that divide a day.
+func alignStep(t time.Time, step time.Duration) time.Time {
+	ns := t.UnixNano()
+	offset := ns % int64(step)
+	if offset < 0 {
+		offset += int64(step)
+	}
+	return time.Unix(0, ns-offset).In(t.Location())
+}
+
+// Aggregate groups samples into buckets of width step, aligned to the Unix
+// epoch, and computes the requested aggregations for every numeric field.
+// When histEdges is non-empty, each bucket also gets a histogram per field,
+// computed in the same pass.
+func Aggregate(samples []*metrics.Sample, step time.Duration, aggs []string, histEdges []float64) []*Bucket {
+	type accumulator struct {
+		min, max, sum float64
+		n             int
+		hist          []int     // len(histEdges)+1, the last bin is +Inf
+		values        []float64 // Only kept when a percentile is requested
+	}
+
+	wantValues := false
+	for _, agg := range aggs {
+		if _, ok := parsePercentile(agg); ok {
+			wantValues = true
+		}
+	}
+
+	var buckets []*Bucket
+	var accs map[string]*accumulator
+	var current *Bucket
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		for field, acc := range accs {
+			values := make(map[string]float64, len(aggs))
+			for _, agg := range aggs {
+				switch agg {
+				case AggMin:
+					values[AggMin] = acc.min
+				case AggAvg:
+					values[AggAvg] = acc.sum / float64(acc.n)
+				case AggMax:
+					values[AggMax] = acc.max
+				default:
+					if p, ok := parsePercentile(agg); ok {
+						sort.Float64s(acc.values)
+						rank := int(math.Ceil(p*float64(len(acc.values)))) - 1
+						values[agg] = acc.values[max(rank, 0)]
+					}
+				}
+			}
+			current.Fields[field] = values
+
+			if acc.hist != nil {
+				bins := make([]HistogramBin, len(acc.hist))
+				for i, count := range acc.hist {
+					le := "+Inf"
+					if i < len(histEdges) {
+						le = strconv.FormatFloat(histEdges[i], 'g', -1, 64)
+					}
+					bins[i] = HistogramBin{Le: le, Count: count}
+				}
+				if current.Histograms == nil {
+					current.Histograms = make(map[string][]HistogramBin)
+				}
+				current.Histograms[field] = bins
+			}
+		}
+		buckets = append(buckets, current)
+	}
+
+	// Samples arrive sorted by timestamp from storage, but don't rely on it
+	sorted := make([]*metrics.Sample, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	for _, sample := range sorted {
+		start := alignStep(sample.Timestamp, step)
+		if current == nil || !start.Equal(current.Start) {
+			flush()
+			current = &Bucket{Start: start, Fields: make(map[string]map[string]float64)}
+			accs = make(map[string]*accumulator)
+		}
+		current.Count++
+
+		for field, value := range Flatten(sample) {
+			acc, ok := accs[field]
+			if !ok {
+				acc = &accumulator{min: math.Inf(1), max: math.Inf(-1)}
+				if len(histEdges) > 0 {
+					acc.hist = make([]int, len(histEdges)+1)
+				}
+				accs[field] = acc
+			}
+			if acc.hist != nil {
+				acc.hist[sort.SearchFloat64s(histEdges, value)]++
+			}
+			acc.min = math.Min(acc.min, value)
+			acc.max = math.Max(acc.max, value)
+			acc.sum += value
+			acc.n++
+			if wantValues {
+				acc.values = append(acc.values, value)
+			}
+		}
+	}
+	flush()
+
+	return buckets
+}
@@ -0,0 +1,212 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache keeps the buckets of recent aggregated queries, so a dashboard
+// polling the same panel, e.g. the last 24 hours at 5 minute steps, only
+// reads and aggregates the buckets that changed since its last request.
+// Only buckets wholly inside a requested range and already over are kept,
+// and writes make the buckets they fall in stale; see Invalidate.
+type Cache struct {
+	mu         sync.Mutex
+	entries    map[string]*cacheEntry // By CacheKey
+	generation uint64                 // Bumped by Invalidate
+	maxEntries int
+	maxBuckets int // Per entry; the oldest beyond it are dropped
+	ttl        time.Duration
+}
+
+// cacheEntry holds the buckets computed for one key, by the Unix time of
+// their start in nanoseconds. A nil bucket records a step without samples,
+// which Aggregate leaves out.
+type cacheEntry struct {
+	step    time.Duration
+	buckets map[int64]*Bucket
+	created time.Time
+	used    time.Time
+}
+
+// NewCache creates a cache of up to maxEntries queries with up to
+// maxBuckets buckets each. Entries are dropped after ttl, which bounds how
+// long data changed other than by writes, e.g. by retention cleanup, can
+// be served.
+func NewCache(maxEntries, maxBuckets int, ttl time.Duration) *Cache {
+	return &Cache{
+		entries:    make(map[string]*cacheEntry),
+		maxEntries: maxEntries,
+		maxBuckets: maxBuckets,
+		ttl:        ttl,
+	}
+}
+
+// CacheKey identifies the buckets of an aggregation; the time range is not
+// part of it, so overlapping ranges share buckets
+func CacheKey(step time.Duration, aggs []string, histEdges []float64, fields []string) string {
+	return fmt.Sprintf("%d|%s|%v|%s", step, strings.Join(aggs, ","), histEdges, strings.Join(fields, ","))
+}
+
+// Aggregate returns the buckets of width step for a range, taking those it
+// has cached and calling compute for the parts before and after them.
+// compute must return the buckets of the samples from start to end
+// inclusive, as Aggregate with the options in key does. Ranges of more
+// than maxBuckets steps are computed whole and not cached.
+func (c *Cache) Aggregate(key string, step time.Duration, startTime, endTime time.Time, compute func(start, end time.Time) ([]*Bucket, error)) ([]*Bucket, error) {
+	// Looking up and storing walk every step of the range under mu, so
+	// ranges with more steps than an entry keeps bypass the cache
+	if step <= 0 || endTime.Sub(startTime)/step > time.Duration(c.maxBuckets) {
+		return compute(startTime, endTime)
+	}
+
+	cached, cachedStart, cachedEnd, generation := c.lookup(key, step, startTime, endTime)
+	if cachedStart.Equal(cachedEnd) {
+		buckets, err := compute(startTime, endTime)
+		if err != nil {
+			return nil, err
+		}
+		c.store(key, generation, step, startTime, endTime, buckets)
+		return buckets, nil
+	}
+
+	var buckets []*Bucket
+	if startTime.Before(cachedStart) {
+		head, err := compute(startTime, cachedStart.Add(-time.Nanosecond))
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, head...)
+	}
+	buckets = append(buckets, cached...)
+
+	tail, err := compute(cachedEnd, endTime)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, generation, step, cachedEnd, endTime, tail)
+	return append(buckets, tail...), nil
+}
+
+// lookup returns the cached buckets from the first whole step of a range
+// on, as far as they are cached without a gap, and the span they cover;
+// the span is empty when nothing is cached. generation is passed back to
+// store.
+func (c *Cache) lookup(key string, step time.Duration, startTime, endTime time.Time) (buckets []*Bucket, cachedStart, cachedEnd time.Time, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	generation = c.generation
+	first := firstWholeStep(startTime, step)
+	entry := c.entries[key]
+	if entry != nil && time.Since(entry.created) > c.ttl {
+		delete(c.entries, key)
+		entry = nil
+	}
+	if entry == nil {
+		return nil, first, first, generation
+	}
+	entry.used = time.Now()
+
+	bucketStart := first
+	for ; !bucketStart.Add(step).After(endTime.Add(time.Nanosecond)); bucketStart = bucketStart.Add(step) {
+		bucket, ok := entry.buckets[bucketStart.UnixNano()]
+		if !ok {
+			break
+		}
+		if bucket != nil {
+			buckets = append(buckets, bucket)
+		}
+	}
+	return buckets, first, bucketStart, generation
+}
+
+// store caches the whole steps that are over among the buckets computed
+// from from to endTime, unless a write was invalidated since the lookup
+// that returned generation
+func (c *Cache) store(key string, generation uint64, step time.Duration, from, endTime time.Time, buckets []*Bucket) {
+	first := firstWholeStep(from, step)
+	// Start of the first step that is not whole or not over
+	end := endTime.Add(time.Nanosecond)
+	if now := time.Now(); now.Before(end) {
+		end = now
+	}
+	end = alignStep(end, step)
+	if !first.Before(end) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	entry := c.entries[key]
+	if entry == nil {
+		c.evict()
+		entry = &cacheEntry{step: step, buckets: make(map[int64]*Bucket), created: time.Now()}
+		c.entries[key] = entry
+	}
+	entry.used = time.Now()
+
+	for bucketStart := first; bucketStart.Before(end); bucketStart = bucketStart.Add(step) {
+		entry.buckets[bucketStart.UnixNano()] = nil
+	}
+	for _, bucket := range buckets {
+		if _, ok := entry.buckets[bucket.Start.UnixNano()]; ok {
+			entry.buckets[bucket.Start.UnixNano()] = bucket
+		}
+	}
+
+	// Ranges move forward as dashboards refresh, leaving old steps behind
+	oldest := end.Add(-time.Duration(c.maxBuckets) * step).UnixNano()
+	for bucketStart := range entry.buckets {
+		if bucketStart < oldest {
+			delete(entry.buckets, bucketStart)
+		}
+	}
+}
+
+// Invalidate drops the cached buckets that a sample written at t falls in,
+// and any after it
+func (c *Cache) Invalidate(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, entry := range c.entries {
+		for bucketStart := range entry.buckets {
+			if bucketStart+int64(entry.step) > t.UnixNano() {
+				delete(entry.buckets, bucketStart)
+			}
+		}
+	}
+}
+
+// evict makes room for a new entry by dropping the least recently used
+// one. Callers hold mu.
+func (c *Cache) evict() {
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+	var oldest string
+	for key, entry := range c.entries {
+		if oldest == "" || entry.used.Before(c.entries[oldest].used) {
+			oldest = key
+		}
+	}
+	delete(c.entries, oldest)
+}
+
+// firstWholeStep returns the start of the first step, aligned as by
+// Aggregate, that begins at or after t
+func firstWholeStep(t time.Time, step time.Duration) time.Time {
+	start := alignStep(t, step)
+	if start.Before(t) {
+		start = start.Add(step)
+	}
+	return start
+}
@@ -0,0 +1,269 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// testStore holds samples for a Cache's compute function to aggregate
+type testStore struct {
+	samples []*metrics.Sample
+	calls   int
+}
+
+func (s *testStore) add(t time.Time, value int64) {
+	s.samples = append(s.samples, &metrics.Sample{
+		Timestamp: t,
+		Derived:   &metrics.DerivedMetrics{DiskGrowthBytesPerDay: value},
+	})
+}
+
+func (s *testStore) query(start, end time.Time) []*metrics.Sample {
+	var samples []*metrics.Sample
+	for _, sample := range s.samples {
+		if !sample.Timestamp.Before(start) && !sample.Timestamp.After(end) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// fill adds a sample every interval from start until end, with values
+// that differ between samples so every aggregation is checked
+func (s *testStore) fill(start, end time.Time, interval time.Duration) {
+	i := int64(0)
+	for t := start; t.Before(end); t = t.Add(interval) {
+		s.add(t, i*7%100)
+		i++
+	}
+}
+
+type timeRange struct {
+	start, end time.Time
+}
+
+var aggTestAggs = []string{AggMin, AggAvg, AggMax, "p90"}
+
+// cachedAggregate runs a range through the cache, aggregating from store
+func cachedAggregate(t *testing.T, cache *Cache, store *testStore, step time.Duration, r timeRange) []*Bucket {
+	t.Helper()
+	key := CacheKey(step, aggTestAggs, nil, nil)
+	buckets, err := cache.Aggregate(key, step, r.start, r.end, func(start, end time.Time) ([]*Bucket, error) {
+		store.calls++
+		return Aggregate(store.query(start, end), step, aggTestAggs, nil), nil
+	})
+	if err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	return buckets
+}
+
+// assertSameBuckets compares cached buckets with a plain Aggregate of the
+// same range
+func assertSameBuckets(t *testing.T, store *testStore, step time.Duration, r timeRange, got []*Bucket) {
+	t.Helper()
+	want := Aggregate(store.query(r.start, r.end), step, aggTestAggs, nil)
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("range %s to %s:\ngot  %s\nwant %s", r.start.Format(time.RFC3339), r.end.Format(time.RFC3339), gotJSON, wantJSON)
+	}
+}
+
+func TestCacheAggregateMatchesAggregate(t *testing.T) {
+	base := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return base.Add(d) }
+
+	tests := []struct {
+		name   string
+		step   time.Duration
+		ranges []timeRange
+	}{
+		{
+			name: "same range twice",
+			step: 5 * time.Minute,
+			ranges: []timeRange{
+				{at(0), at(time.Hour)},
+				{at(0), at(time.Hour)},
+			},
+		},
+		{
+			name: "range moving forward",
+			step: 5 * time.Minute,
+			ranges: []timeRange{
+				{at(0), at(time.Hour)},
+				{at(10 * time.Minute), at(70 * time.Minute)},
+				{at(20*time.Minute + 30*time.Second), at(80*time.Minute + 15*time.Second)},
+			},
+		},
+		{
+			name: "range extending before the cached buckets",
+			step: 5 * time.Minute,
+			ranges: []timeRange{
+				{at(30 * time.Minute), at(time.Hour)},
+				{at(0), at(time.Hour)},
+				{at(12 * time.Minute), at(45 * time.Minute)},
+			},
+		},
+		{
+			name: "range inside the cached buckets",
+			step: 10 * time.Minute,
+			ranges: []timeRange{
+				{at(0), at(2 * time.Hour)},
+				{at(25 * time.Minute), at(55*time.Minute - time.Second)},
+			},
+		},
+		{
+			name: "step not dividing a day",
+			step: 7 * time.Minute,
+			ranges: []timeRange{
+				{at(0), at(time.Hour)},
+				{at(3 * time.Minute), at(90 * time.Minute)},
+				{at(0), at(90 * time.Minute)},
+			},
+		},
+		{
+			name: "step not dividing a minute",
+			step: 13 * time.Second,
+			ranges: []timeRange{
+				{at(0), at(10 * time.Minute)},
+				{at(time.Minute), at(12 * time.Minute)},
+			},
+		},
+		{
+			name: "range crossing midnight",
+			step: 7 * time.Minute,
+			ranges: []timeRange{
+				{at(-time.Hour), at(time.Hour)},
+				{at(-30 * time.Minute), at(30 * time.Minute)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &testStore{}
+			store.fill(at(-2*time.Hour), at(3*time.Hour), 10*time.Second)
+			cache := NewCache(4, 4096, time.Hour)
+
+			for _, r := range tt.ranges {
+				got := cachedAggregate(t, cache, store, tt.step, r)
+				assertSameBuckets(t, store, tt.step, r, got)
+			}
+		})
+	}
+}
+
+func TestCacheServesRepeatedRangeFromCache(t *testing.T) {
+	base := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	store := &testStore{}
+	store.fill(base, base.Add(time.Hour), 10*time.Second)
+	cache := NewCache(4, 4096, time.Hour)
+	r := timeRange{base, base.Add(time.Hour)}
+
+	cachedAggregate(t, cache, store, 5*time.Minute, r)
+	store.calls = 0
+	got := cachedAggregate(t, cache, store, 5*time.Minute, r)
+	assertSameBuckets(t, store, 5*time.Minute, r, got)
+
+	// Only the tail after the last whole step is computed again
+	if store.calls != 1 {
+		t.Errorf("compute called %d times for a cached range, want 1", store.calls)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	base := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	step := 5 * time.Minute
+
+	tests := []struct {
+		name  string
+		write time.Time
+	}{
+		{"inside a cached bucket", base.Add(12*time.Minute + 3*time.Second)},
+		{"at the start of a cached bucket", base.Add(20 * time.Minute)},
+		{"in the first cached bucket", base.Add(time.Second)},
+		{"in the last cached bucket", base.Add(59 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &testStore{}
+			store.fill(base, base.Add(time.Hour), 10*time.Second)
+			cache := NewCache(4, 4096, time.Hour)
+			r := timeRange{base, base.Add(time.Hour)}
+
+			cachedAggregate(t, cache, store, step, r)
+			store.add(tt.write, 1000)
+			cache.Invalidate(tt.write)
+
+			got := cachedAggregate(t, cache, store, step, r)
+			assertSameBuckets(t, store, step, r, got)
+		})
+	}
+}
+
+func TestCacheWriteDuringCompute(t *testing.T) {
+	base := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	step := 5 * time.Minute
+	store := &testStore{}
+	store.fill(base, base.Add(time.Hour), 10*time.Second)
+	cache := NewCache(4, 4096, time.Hour)
+	r := timeRange{base, base.Add(time.Hour)}
+	write := base.Add(17 * time.Minute)
+
+	// A write invalidated after the lookup must keep the buckets computed
+	// before it out of the cache
+	key := CacheKey(step, aggTestAggs, nil, nil)
+	_, err := cache.Aggregate(key, step, r.start, r.end, func(start, end time.Time) ([]*Bucket, error) {
+		buckets := Aggregate(store.query(start, end), step, aggTestAggs, nil)
+		store.add(write, 1000)
+		cache.Invalidate(write)
+		return buckets, nil
+	})
+	if err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+
+	got := cachedAggregate(t, cache, store, step, r)
+	assertSameBuckets(t, store, step, r, got)
+}
+
+func TestCacheBypassesRangesWithTooManySteps(t *testing.T) {
+	base := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	store := &testStore{}
+	store.fill(base, base.Add(10*time.Second), time.Second)
+	cache := NewCache(4, 4096, time.Hour)
+
+	for _, step := range []time.Duration{time.Microsecond, time.Millisecond} {
+		r := timeRange{base, base.Add(10 * time.Second)}
+		got := cachedAggregate(t, cache, store, step, r)
+		assertSameBuckets(t, store, step, r, got)
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("cache kept %d entries for ranges of more steps than an entry holds", len(cache.entries))
+	}
+}
+
+func TestAlignStep(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		step time.Duration
+		want time.Time
+	}{
+		{time.Unix(125, 0), time.Minute, time.Unix(120, 0)},
+		{time.Unix(120, 0), time.Minute, time.Unix(120, 0)},
+		{time.Unix(1000, 0), 7 * time.Minute, time.Unix(840, 0)},
+		{time.Unix(-1, 0), time.Minute, time.Unix(-60, 0)},
+		{time.Date(2024, 3, 10, 0, 3, 0, 0, time.UTC), 7 * time.Minute, time.Date(2024, 3, 9, 23, 59, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := alignStep(tt.t, tt.step); !got.Equal(tt.want) {
+			t.Errorf("alignStep(%v, %v) = %v, want %v", tt.t.UTC(), tt.step, got.UTC(), tt.want.UTC())
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package query
+
+import (
+	"math"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Correlation summarizes how two fields move together over a range
+type Correlation struct {
+	FieldA  string   `json:"field_a"`
+	FieldB  string   `json:"field_b"`
+	Samples int      `json:"samples"` // Samples that had both fields
+	Pearson *float64 `json:"pearson"` // nil when either series is constant or too short
+}
+
+// Correlate computes the Pearson correlation coefficient between two fields
+// over the samples that contain both
+func Correlate(samples []*metrics.Sample, fieldA, fieldB string) *Correlation {
+	result := &Correlation{FieldA: fieldA, FieldB: fieldB}
+
+	var sumA, sumB, sumAA, sumBB, sumAB float64
+	for _, sample := range samples {
+		fields := Flatten(sample)
+		a, okA := fields[fieldA]
+		b, okB := fields[fieldB]
+		if !okA || !okB {
+			continue
+		}
+
+		result.Samples++
+		sumA += a
+		sumB += b
+		sumAA += a * a
+		sumBB += b * b
+		sumAB += a * b
+	}
+
+	n := float64(result.Samples)
+	if result.Samples < 2 {
+		return result
+	}
+
+	covariance := sumAB - sumA*sumB/n
+	varianceA := sumAA - sumA*sumA/n
+	varianceB := sumBB - sumB*sumB/n
+	if varianceA <= 0 || varianceB <= 0 {
+		return result
+	}
+
+	r := covariance / math.Sqrt(varianceA*varianceB)
+	r = math.Max(-1, math.Min(1, r)) // Guard against rounding just outside [-1, 1]
+	result.Pearson = &r
+
+	return result
+}
@@ -0,0 +1,51 @@
+package query
+
+import (
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Crossing directions
+const (
+	CrossingUp   = "up"
+	CrossingDown = "down"
+)
+
+// Crossing is a point where a field moved across a threshold
+type Crossing struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"` // "up" or "down"
+	Value     float64   `json:"value"`
+	Previous  float64   `json:"previous"`
+}
+
+// Crossings returns every time field crossed threshold in either direction.
+// Reaching the threshold counts as being above it. Samples without the
+// field are skipped.
+func Crossings(samples []*metrics.Sample, field string, threshold float64) []Crossing {
+	crossings := []Crossing{}
+
+	var previous float64
+	havePrevious := false
+	for _, sample := range samples {
+		value, ok := Flatten(sample)[field]
+		if !ok {
+			continue
+		}
+
+		if havePrevious {
+			switch {
+			case previous < threshold && value >= threshold:
+				crossings = append(crossings, Crossing{Time: sample.Timestamp, Direction: CrossingUp, Value: value, Previous: previous})
+			case previous >= threshold && value < threshold:
+				crossings = append(crossings, Crossing{Time: sample.Timestamp, Direction: CrossingDown, Value: value, Previous: previous})
+			}
+		}
+
+		previous = value
+		havePrevious = true
+	}
+
+	return crossings
+}
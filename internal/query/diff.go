@@ -0,0 +1,69 @@
+package query
+
+import (
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// FieldDiff is the change in one numeric field between two samples
+type FieldDiff struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Delta float64 `json:"delta"`
+}
+
+// SampleDiff compares two samples field by field
+type SampleDiff struct {
+	FromTime time.Time            `json:"from_time"`
+	ToTime   time.Time            `json:"to_time"`
+	Elapsed  string               `json:"elapsed"`
+	Fields   map[string]FieldDiff `json:"fields"`
+}
+
+// Nearest returns the sample whose timestamp is closest to t, or nil if
+// samples is empty
+func Nearest(samples []*metrics.Sample, t time.Time) *metrics.Sample {
+	var best *metrics.Sample
+	var bestDistance time.Duration
+
+	for _, sample := range samples {
+		distance := sample.Timestamp.Sub(t)
+		if distance < 0 {
+			distance = -distance
+		}
+		if best == nil || distance < bestDistance {
+			best = sample
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+// Diff computes deltas for every numeric field present in both samples
+func Diff(from, to *metrics.Sample) *SampleDiff {
+	fromFields := Flatten(from)
+	toFields := Flatten(to)
+
+	diff := &SampleDiff{
+		FromTime: from.Timestamp,
+		ToTime:   to.Timestamp,
+		Elapsed:  to.Timestamp.Sub(from.Timestamp).String(),
+		Fields:   make(map[string]FieldDiff),
+	}
+
+	for field, fromValue := range fromFields {
+		toValue, ok := toFields[field]
+		if !ok {
+			continue
+		}
+		diff.Fields[field] = FieldDiff{
+			From:  fromValue,
+			To:    toValue,
+			Delta: toValue - fromValue,
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,107 @@
+package query
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// ParseFields splits a comma-separated field list such as
+// "bitcoin.block_height,system.cpu_percent"
+func ParseFields(value string) []string {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// SelectFields returns a copy of the sample reduced to the requested dotted
+// field paths, keeping the sample's nested shape and its timestamp. A path
+// may name a whole section, e.g. "tor".
+func SelectFields(sample *metrics.Sample, fields []string) map[string]interface{} {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return nil
+	}
+
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil
+	}
+
+	selected := map[string]interface{}{
+		"timestamp": tree["timestamp"],
+	}
+
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		value, ok := lookup(tree, path)
+		if !ok {
+			continue
+		}
+		assign(selected, path, value)
+	}
+
+	return selected
+}
+
+// MatchesField reports whether a flattened field name is covered by one of
+// the requested paths
+func MatchesField(name string, fields []string) bool {
+	for _, field := range fields {
+		if name == field || strings.HasPrefix(name, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterBuckets drops bucket fields not covered by the requested paths
+func FilterBuckets(buckets []*Bucket, fields []string) {
+	for _, bucket := range buckets {
+		for name := range bucket.Fields {
+			if !MatchesField(name, fields) {
+				delete(bucket.Fields, name)
+			}
+		}
+		for name := range bucket.Histograms {
+			if !MatchesField(name, fields) {
+				delete(bucket.Histograms, name)
+			}
+		}
+	}
+}
+
+// lookup walks a decoded JSON object along path
+func lookup(node map[string]interface{}, path []string) (interface{}, bool) {
+	value, ok := node[path[0]]
+	if !ok {
+		return nil, false
+	}
+	if len(path) == 1 {
+		return value, true
+	}
+
+	child, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookup(child, path[1:])
+}
+
+// assign sets value at path in node, creating intermediate objects
+func assign(node map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := node[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			node[key] = child
+		}
+		node = child
+	}
+	node[path[len(path)-1]] = value
+}
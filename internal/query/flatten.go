@@ -0,0 +1,76 @@
+package query
+
+import (
+	"encoding/json"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Flatten returns the numeric fields of a sample keyed by their dotted JSON
+// path, e.g. "bitcoin.block_height" or "system.cpu_percent". Booleans are
+// reported as 0 or 1; strings, arrays and the timestamp are omitted.
+func Flatten(sample *metrics.Sample) map[string]float64 {
+	fields := make(map[string]float64)
+	if !walkSample(sample, func(path string, value interface{}) {
+		if f, ok := value.(float64); ok {
+			fields[path] = f
+		}
+	}) {
+		return nil
+	}
+	return fields
+}
+
+// FlattenScalars is Flatten with string fields included, such as
+// "bitcoin.chain" or "state"; values are float64 or string
+func FlattenScalars(sample *metrics.Sample) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if !walkSample(sample, func(path string, value interface{}) {
+		fields[path] = value
+	}) {
+		return nil
+	}
+	return fields
+}
+
+// walkSample calls visit with every numeric, boolean (as 0 or 1) and
+// string leaf of a sample except the timestamp. It returns false if the
+// sample cannot be encoded.
+func walkSample(sample *metrics.Sample, visit func(path string, value interface{})) bool {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return false
+	}
+
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return false
+	}
+	delete(tree, "timestamp")
+
+	flattenInto(visit, "", tree)
+	return true
+}
+
+// flattenInto walks a decoded JSON object visiting scalar leaves
+func flattenInto(visit func(path string, value interface{}), prefix string, node map[string]interface{}) {
+	for key, value := range node {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case float64, string:
+			visit(path, v)
+		case bool:
+			if v {
+				visit(path, 1.0)
+			} else {
+				visit(path, 0.0)
+			}
+		case map[string]interface{}:
+			flattenInto(visit, path, v)
+		}
+	}
+}
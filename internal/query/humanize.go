@@ -0,0 +1,52 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Humanize rewrites the numbers in a JSON sample whose field names carry a
+// unit as readable strings, e.g. "disk_used_bytes": "1.2 TiB". Counts and
+// other unitless numbers are left alone.
+func Humanize(data []byte) ([]byte, error) {
+	var tree interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(humanizeNode("", tree))
+}
+
+// humanizeNode converts node, found at the dotted path, and its children
+func humanizeNode(path string, node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			v[key] = humanizeNode(childPath, child)
+		}
+	case []interface{}:
+		// Elements share their array's path
+		for i, child := range v {
+			v[i] = humanizeNode(path, child)
+		}
+	case json.Number:
+		unit := metrics.UnitOf(path)
+		if unit == metrics.UnitNone {
+			return v
+		}
+		value, err := v.Float64()
+		if err != nil {
+			return v
+		}
+		return metrics.Quantity{Value: value, Unit: unit}.String()
+	}
+	return node
+}
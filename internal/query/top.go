@@ -0,0 +1,34 @@
+package query
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// TopEntry is one sample's value of a field
+type TopEntry struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Top returns the n samples with the highest values of field, highest
+// first. Ties keep chronological order.
+func Top(samples []*metrics.Sample, field string, n int) []TopEntry {
+	entries := []TopEntry{}
+	for _, sample := range samples {
+		if value, ok := Flatten(sample)[field]; ok {
+			entries = append(entries, TopEntry{Time: sample.Timestamp, Value: value})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Value > entries[j].Value
+	})
+
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
@@ -0,0 +1,168 @@
+// Package redact removes privacy-sensitive data from samples before they
+// leave the host, following a configured redaction profile
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// placeholder replaces a removed address in string values
+const placeholder = "[redacted]"
+
+var (
+	// ipv4Pattern and ipv6Pattern find address candidates in text; matches
+	// are only replaced if they parse as an address, so times such as
+	// "12:30:00" are left alone
+	ipv4Pattern = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	ipv6Pattern = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:%[0-9A-Za-z]+)?`)
+
+	// onionPattern matches any .onion or .i2p host name, not only well-formed
+	// v3 onion and b32 addresses
+	onionPattern = regexp.MustCompile(`(?i)\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:onion|i2p)\b`)
+)
+
+// Profile is a compiled redaction profile
+type Profile struct {
+	addresses bool
+	onions    bool
+	wallet    bool
+	fields    [][]string // Paths split at dots
+}
+
+// New compiles a redaction profile
+func New(cfg config.RedactionProfile) *Profile {
+	p := &Profile{
+		addresses: cfg.PeerAddresses,
+		onions:    cfg.OnionAddresses,
+		wallet:    cfg.WalletData,
+	}
+	for _, field := range cfg.Fields {
+		if field != "" {
+			p.fields = append(p.fields, strings.Split(field, "."))
+		}
+	}
+	return p
+}
+
+// Sample returns a redacted copy of a sample. The sample itself is not
+// changed, since other consumers share it.
+func (p *Profile) Sample(sample *metrics.Sample) (*metrics.Sample, error) {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return nil, err
+	}
+	data, err = p.JSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var redacted metrics.Sample
+	if err := json.Unmarshal(data, &redacted); err != nil {
+		return nil, err
+	}
+	return &redacted, nil
+}
+
+// JSON redacts an encoded sample
+func (p *Profile) JSON(data []byte) ([]byte, error) {
+	var tree interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return json.Marshal(p.Tree(tree))
+}
+
+// Tree redacts a sample decoded into maps and slices, in place where it
+// can, and returns the result. Field paths are relative to tree.
+func (p *Profile) Tree(tree interface{}) interface{} {
+	for _, path := range p.fields {
+		removePath(tree, path)
+	}
+	return p.scrub(tree)
+}
+
+// scrub removes wallet fields and replaces addresses in string values
+func (p *Profile) scrub(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if p.wallet && isWalletField(key) {
+				delete(v, key)
+				continue
+			}
+			v[key] = p.scrub(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = p.scrub(child)
+		}
+	case string:
+		return p.scrubText(v)
+	}
+	return node
+}
+
+// scrubText replaces the addresses the profile removes in s
+func (p *Profile) scrubText(s string) string {
+	if p.onions {
+		s = onionPattern.ReplaceAllString(s, placeholder)
+	}
+	if p.addresses {
+		replaceAddr := func(match string) string {
+			host, _, _ := strings.Cut(match, "%")
+			if _, err := netip.ParseAddr(host); err != nil {
+				return match
+			}
+			return placeholder
+		}
+		// IPv4 first, so an IPv4-mapped IPv6 address is not cut in half
+		s = ipv4Pattern.ReplaceAllStringFunc(s, replaceAddr)
+		s = ipv6Pattern.ReplaceAllStringFunc(s, replaceAddr)
+	}
+	return s
+}
+
+// isWalletField reports whether a field name suggests wallet data
+func isWalletField(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "wallet") || strings.Contains(name, "balance")
+}
+
+// removePath deletes the field at path below node. A "*" element matches
+// every key of an object, and a path continues into each element of a
+// list.
+func removePath(node interface{}, path []string) {
+	switch v := node.(type) {
+	case []interface{}:
+		for _, child := range v {
+			removePath(child, path)
+		}
+	case map[string]interface{}:
+		if path[0] == "*" {
+			for key, child := range v {
+				if len(path) == 1 {
+					delete(v, key)
+				} else {
+					removePath(child, path[1:])
+				}
+			}
+			return
+		}
+		if len(path) == 1 {
+			delete(v, path[0])
+			return
+		}
+		if child, ok := v[path[0]]; ok {
+			removePath(child, path[1:])
+		}
+	}
+}
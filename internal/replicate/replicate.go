@@ -0,0 +1,234 @@
+// Package replicate copies compressed daily metrics files to S3-compatible
+// storage or an SFTP server, for history that outlives the device
+package replicate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/storage"
+)
+
+var logger = logging.New("replication")
+
+// stateFile lists the files already uploaded, in the data directory
+const stateFile = "replication.json"
+
+// state is the content of stateFile
+type state struct {
+	Uploaded []string `json:"uploaded"`
+}
+
+// target stores files on another host
+type target interface {
+	// upload copies the local file at path to name, a slash-separated path
+	// below the target's root
+	upload(ctx context.Context, path, name string) error
+	String() string
+}
+
+// Replicator uploads the compressed daily files in the metrics directory
+// that have not been uploaded yet, oldest first. It runs when storage
+// compresses a file and every retry interval, which also picks up files
+// compressed while the agent was stopped; after a failure the rest wait
+// for the next attempt.
+type Replicator struct {
+	target        target
+	dataDir       string
+	prefix        string
+	timeout       time.Duration
+	retryInterval time.Duration
+
+	uploaded map[string]bool // Names of files uploaded, kept in stateFile
+	failing  bool
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a replicator for the settings in cfg, connecting to S3
+// through dialer, and starts it
+func New(cfg config.ReplicationConfig, dataDir string, dialer *netproxy.Dialer) (*Replicator, error) {
+	var t target
+	switch cfg.Target {
+	case "s3":
+		s3, err := newS3Target(cfg.S3, dialer)
+		if err != nil {
+			return nil, err
+		}
+		t = s3
+	case "sftp":
+		t = newSFTPTarget(cfg.SFTP)
+	default:
+		return nil, fmt.Errorf("unknown replication target %q (use s3 or sftp)", cfg.Target)
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("replication prefix is not set and the hostname is unknown: %w", err)
+		}
+		prefix = hostname
+	}
+
+	r := &Replicator{
+		target:        t,
+		dataDir:       dataDir,
+		prefix:        prefix,
+		timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
+		retryInterval: time.Duration(cfg.RetryIntervalSeconds) * time.Second,
+		uploaded:      make(map[string]bool),
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		logger.Warn("Failed to read replication state, uploading every file again", "error", err)
+	}
+
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	go r.run()
+	return r, nil
+}
+
+// String describes where files are uploaded to
+func (r *Replicator) String() string {
+	return r.target.String() + "/" + r.prefix
+}
+
+// Replicate schedules uploading a newly compressed file
+func (r *Replicator) Replicate(string) {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the replicator, abandoning an upload in progress; it is
+// retried on the next start
+func (r *Replicator) Close() {
+	r.cancel()
+	<-r.done
+}
+
+// run uploads pending files at startup, when woken, and periodically
+func (r *Replicator) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		r.uploadPending()
+
+		select {
+		case <-r.wake:
+		case <-ticker.C:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// uploadPending uploads the files not uploaded yet until one fails
+func (r *Replicator) uploadPending() {
+	names, err := storage.CompressedFiles(r.dataDir)
+	if err != nil {
+		logger.Warn("Failed to list files to replicate", "error", err)
+		return
+	}
+	r.forgetDeleted(names)
+
+	for _, name := range names {
+		if r.uploaded[name] {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+		err := r.target.upload(ctx, filepath.Join(r.dataDir, "metrics", name), path.Join(r.prefix, name))
+		cancel()
+		if r.ctx.Err() != nil {
+			return // Shutting down
+		}
+		if err != nil {
+			if !r.failing {
+				logger.Warn("Failed to replicate file, will retry", "file", name, "target", r.String(), "retry", r.retryInterval, "error", err)
+			}
+			r.failing = true
+			return
+		}
+
+		if r.failing {
+			logger.Info("Replication recovered", "target", r.String())
+			r.failing = false
+		}
+		r.uploaded[name] = true
+		if err := r.save(); err != nil {
+			logger.Warn("Failed to save replication state", "error", err)
+		}
+		logger.Info("Replicated data file", "file", name, "target", r.String())
+	}
+}
+
+// forgetDeleted drops files removed by retention from the uploaded set
+func (r *Replicator) forgetDeleted(names []string) {
+	for name := range r.uploaded {
+		if !slices.Contains(names, name) {
+			delete(r.uploaded, name)
+		}
+	}
+}
+
+// load reads the set of uploaded files
+func (r *Replicator) load() error {
+	data, err := os.ReadFile(filepath.Join(r.dataDir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved state
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	for _, name := range saved.Uploaded {
+		r.uploaded[name] = true
+	}
+	return nil
+}
+
+// save writes the set of uploaded files, replacing the file atomically
+func (r *Replicator) save() error {
+	var saved state
+	for name := range r.uploaded {
+		saved.Uploaded = append(saved.Uploaded, name)
+	}
+	slices.Sort(saved.Uploaded)
+
+	data, err := json.Marshal(&saved)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(r.dataDir, stateFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
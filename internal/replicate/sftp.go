@@ -0,0 +1,91 @@
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+)
+
+// sftpTarget uploads files by running the OpenSSH sftp client in batch
+// mode. Host keys are checked strictly and only key authentication is
+// tried, so nothing ever waits for input.
+type sftpTarget struct {
+	command string
+	args    []string // Options and destination
+	host    string
+}
+
+// newSFTPTarget creates a target for the server in cfg
+func newSFTPTarget(cfg config.SFTPConfig) *sftpTarget {
+	args := []string{"-b", "-", "-P", strconv.Itoa(cfg.Port), "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes"}
+	if cfg.KeyFile != "" {
+		args = append(args, "-i", cfg.KeyFile)
+	}
+	if cfg.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+cfg.KnownHostsFile)
+	}
+
+	host := cfg.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	args = append(args, cfg.User+"@"+host)
+
+	return &sftpTarget{command: cfg.Command, args: args, host: cfg.Host}
+}
+
+// String names the server
+func (t *sftpTarget) String() string {
+	return "sftp://" + t.host
+}
+
+// upload creates the directories of name, then writes the file under a
+// temporary name and renames it, so the server never holds a partial file
+// under the final name
+func (t *sftpTarget) upload(ctx context.Context, localPath, name string) error {
+	var batch strings.Builder
+	dir := path.Dir(name)
+	if dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			// A leading - lets the batch continue when the directory exists
+			fmt.Fprintf(&batch, "-mkdir %s\n", quote(strings.Join(parts[:i+1], "/")))
+		}
+	}
+	fmt.Fprintf(&batch, "put %s %s\n", quote(localPath), quote(name+".tmp"))
+	fmt.Fprintf(&batch, "-rm %s\n", quote(name))
+	fmt.Fprintf(&batch, "rename %s %s\n", quote(name+".tmp"), quote(name))
+
+	cmd := exec.CommandContext(ctx, t.command, t.args...)
+	cmd.Stdin = strings.NewReader(batch.String())
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("sftp failed: %w: %s", err, lastLine(output.String()))
+	}
+	return nil
+}
+
+// quote wraps a path in double quotes for an sftp batch file, escaping
+// backslashes and quotes
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// lastLine returns the last non-empty line of output, where sftp reports
+// the error that stopped the batch
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 10ms",
+		"@every soon",
+		"@fortnightly",
+	}
+
+	for _, spec := range specs {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, 1, 10, 12, 30, 0, 0, time.UTC)
+	date := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		spec  string
+		after time.Time
+		want  []time.Time
+	}{
+		{"every minute", "* * * * *", from, []time.Time{date(1, 10, 12, 31), date(1, 10, 12, 32)}},
+		{"strictly after a matching minute", "30 12 * * *", from, []time.Time{date(1, 11, 12, 30)}},
+		{"seconds are dropped", "31 12 * * *", from.Add(59 * time.Second), []time.Time{date(1, 10, 12, 31)}},
+		{"list and range", "0,30 9-10 * * *", from, []time.Time{date(1, 11, 9, 0), date(1, 11, 9, 30), date(1, 11, 10, 0)}},
+		{"step", "*/20 * * * *", from, []time.Time{date(1, 10, 12, 40), date(1, 10, 13, 0)}},
+		{"step from a value", "10/25 * * * *", from, []time.Time{date(1, 10, 12, 35), date(1, 10, 13, 10)}},
+		{"range with step", "0 1-7/3 * * *", from, []time.Time{date(1, 11, 1, 0), date(1, 11, 4, 0), date(1, 11, 7, 0)}},
+		{"descriptor", "@monthly", from, []time.Time{date(2, 1, 0, 0), date(3, 1, 0, 0)}},
+		{"weekly descriptor", "@weekly", from, []time.Time{date(1, 14, 0, 0), date(1, 21, 0, 0)}},
+
+		// Day of month 1, or any Monday
+		{"both day fields restricted match either", "0 0 1 * 1", from,
+			[]time.Time{date(1, 15, 0, 0), date(1, 22, 0, 0), date(1, 29, 0, 0), date(2, 1, 0, 0), date(2, 5, 0, 0)}},
+		// Odd days that are Mondays, not odd days or Mondays
+		{"day of month with star step", "0 0 */2 * 1", from,
+			[]time.Time{date(1, 15, 0, 0), date(1, 29, 0, 0), date(2, 5, 0, 0), date(2, 19, 0, 0)}},
+		// Sundays, Tuesdays, Thursdays and Saturdays from the 15th on
+		{"day of week with star step", "0 0 15-31 * */2", from,
+			[]time.Time{date(1, 16, 0, 0), date(1, 18, 0, 0), date(1, 20, 0, 0), date(1, 21, 0, 0)}},
+		{"day of month only", "0 0 13 * *", from, []time.Time{date(1, 13, 0, 0), date(2, 13, 0, 0)}},
+		{"day of week only", "0 0 * * 5", from, []time.Time{date(1, 12, 0, 0), date(1, 19, 0, 0)}},
+
+		{"7 is Sunday", "0 6 * * 7", from, []time.Time{date(1, 14, 6, 0), date(1, 21, 6, 0)}},
+		{"0 is Sunday", "0 6 * * 0", from, []time.Time{date(1, 14, 6, 0)}},
+		{"weekday range through 7", "0 6 * * 5-7", from, []time.Time{date(1, 12, 6, 0), date(1, 13, 6, 0), date(1, 14, 6, 0), date(1, 19, 6, 0)}},
+
+		{"leap day", "0 0 29 2 *", from, []time.Time{date(2, 29, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)}},
+		{"31st skips short months", "0 0 31 * *", from, []time.Time{date(1, 31, 0, 0), date(3, 31, 0, 0), date(5, 31, 0, 0)}},
+		{"Feb 30 never matches", "0 0 30 2 *", from, []time.Time{{}}},
+		{"Apr 31 never matches", "0 0 31 4 *", from, []time.Time{{}}},
+
+		{"other time zones are converted to UTC", "0 12 * * *", time.Date(2024, 1, 10, 13, 0, 0, 0, time.FixedZone("CET", 3600)),
+			[]time.Time{date(1, 11, 12, 0)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			after := tt.after
+			for i, want := range tt.want {
+				got := s.Next(after)
+				if !got.Equal(want) {
+					t.Fatalf("run %d of %q after %v = %v, want %v", i+1, tt.spec, after, got, want)
+				}
+				after = got
+			}
+		})
+	}
+}
+
+func TestEvery(t *testing.T) {
+	s, err := Parse("@every 90m")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	from := time.Date(2024, 1, 10, 12, 30, 15, 0, time.UTC)
+	if got, want := s.Next(from), from.Add(90*time.Minute); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
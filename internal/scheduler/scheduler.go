@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+var logger = logging.New("scheduler")
+
+// JobFunc is the work performed by a scheduled job. The context is
+// cancelled when the scheduler stops; long-running jobs should honor it.
+type JobFunc func(ctx context.Context) error
+
+// job is a registered maintenance job and its run state
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	fn       JobFunc
+
+	mu      sync.Mutex
+	status  metrics.JobStatus
+	running bool
+}
+
+// Scheduler runs low-frequency maintenance jobs on cron-like schedules.
+// A job that is still running when it is next due is skipped rather than
+// started twice.
+type Scheduler struct {
+	jitter time.Duration
+	align  time.Duration // See SetAlignment
+	jobs   []*job
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	// Passed to running jobs and cancelled by Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a scheduler that delays each run by a random amount up to jitter
+func New(jitter time.Duration) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		jitter: jitter,
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// SetAlignment delays every run to the next wall-clock multiple of step,
+// so jobs share their wakeup with other work aligned the same way. Call it
+// before Start.
+func (s *Scheduler) SetAlignment(step time.Duration) {
+	s.align = step
+}
+
+// Align returns the first wall-clock multiple of step at or after t, e.g.
+// the next full five minutes for a step of five minutes
+func Align(t time.Time, step time.Duration) time.Time {
+	if step <= 0 {
+		return t
+	}
+	aligned := t.Truncate(step)
+	if aligned.Before(t) {
+		aligned = aligned.Add(step)
+	}
+	return aligned
+}
+
+// Add registers a job under a cron expression (see Parse)
+func (s *Scheduler) Add(name, spec string, fn JobFunc) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for job %s: %w", name, err)
+	}
+
+	s.jobs = append(s.jobs, &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		fn:       fn,
+		status: metrics.JobStatus{
+			Name:     name,
+			Schedule: spec,
+		},
+	})
+
+	return nil
+}
+
+// Start begins running all registered jobs
+func (s *Scheduler) Start() {
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+}
+
+// Stop stops scheduling new runs, cancels the context of running jobs and
+// waits for them to return
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Jobs returns the current status of every registered job
+func (s *Scheduler) Jobs() []metrics.JobStatus {
+	statuses := make([]metrics.JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		status := j.status
+		status.Running = j.running
+		j.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].Name < statuses[k].Name
+	})
+
+	return statuses
+}
+
+// loop waits for each activation of a job and runs it
+func (s *Scheduler) loop(j *job) {
+	defer s.wg.Done()
+
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			logger.Warn("Job has no future activation, disabling", "job", j.name)
+			return
+		}
+		if s.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+		}
+		next = Align(next, s.align)
+
+		j.mu.Lock()
+		j.status.NextRun = next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			s.trigger(j)
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// trigger starts a job run unless the previous run is still in progress
+func (s *Scheduler) trigger(j *job) {
+	j.mu.Lock()
+	if j.running {
+		j.status.SkippedCount++
+		j.mu.Unlock()
+		logger.Warn("Job still running, skipping this activation", "job", j.name)
+		return
+	}
+	j.running = true
+	j.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(j)
+	}()
+}
+
+// run executes a job and records its outcome
+func (s *Scheduler) run(j *job) {
+	startTime := time.Now()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return j.fn(s.ctx)
+	}()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	duration := time.Since(startTime)
+
+	j.running = false
+	j.status.LastRun = startTime.UTC()
+	j.status.LastDurationMs = duration.Milliseconds()
+	j.status.RunCount++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.LastError = err.Error()
+		j.status.ErrorCount++
+		logger.Warn("Job failed", "job", j.name, "duration", duration, "error", err)
+		return
+	}
+	logger.Debug("Job finished", "job", j.name, "duration", duration)
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/redact"
+)
+
+// anonymousKey is the identity used for requests when no API keys are
+// configured
+const anonymousKey = "anonymous"
+
+// authFailureLimit caps the unknown API keys one address may present per
+// minute. It is checked before a key is looked up, so keys cannot be
+// guessed faster; clients reaching the API through Tor share one address.
+const authFailureLimit = 10
+
+// authFailures tracks the failed key checks of HTTP clients by address
+type authFailures struct {
+	mu      sync.Mutex
+	clients map[string]*tokenBucket
+}
+
+// bucket returns the failure bucket of a client address
+func (f *authFailures) bucket(addr string) *tokenBucket {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.clients == nil {
+		f.clients = make(map[string]*tokenBucket)
+	}
+	bucket := f.clients[addr]
+	if bucket == nil {
+		if len(f.clients) >= maxClientBuckets {
+			// Idle for a minute means refilled completely
+			for key, b := range f.clients {
+				if b.idle() > time.Minute {
+					delete(f.clients, key)
+				}
+			}
+		}
+		bucket = newTokenBucket(authFailureLimit)
+		f.clients[addr] = bucket
+	}
+	return bucket
+}
+
+// apiKey is a configured API key with its rate limiter state
+type apiKey struct {
+	name   string
+	secret []byte
+	scopes map[string]bool
+
+	redaction *redact.Profile // nil unless the key has a redaction profile
+
+	limit  int // Requests per minute
+	bucket *tokenBucket
+}
+
+// newAPIKeys builds the key set from configuration
+func newAPIKeys(keys []config.APIKeyConfig, profiles map[string]config.RedactionProfile) []*apiKey {
+	var result []*apiKey
+	for _, k := range keys {
+		scopes := make(map[string]bool, len(k.Scopes))
+		for _, scope := range k.Scopes {
+			scopes[scope] = true
+		}
+
+		key := &apiKey{
+			name:   k.Name,
+			secret: []byte(k.Key),
+			scopes: scopes,
+			limit:  k.RateLimitPerMinute,
+			bucket: newTokenBucket(k.RateLimitPerMinute),
+		}
+		if k.RedactionProfile != "" {
+			key.redaction = redact.New(profiles[k.RedactionProfile])
+		}
+		result = append(result, key)
+	}
+	return result
+}
+
+// keyRedaction returns the redaction profile of the named key, or nil if
+// its responses are not redacted
+func (s *Server) keyRedaction(name string) *redact.Profile {
+	if name == shareKeyName && s.shares != nil {
+		return s.shares.redaction
+	}
+	for _, k := range s.apiKeys {
+		if k.name == name {
+			return k.redaction
+		}
+	}
+	return nil
+}
+
+// allows reports whether the key grants a scope
+func (k *apiKey) allows(scope string) bool {
+	return k.scopes[config.ScopeAdmin] || k.scopes[scope]
+}
+
+// take consumes one request from the key's rate limit, returning how long
+// to wait when none is available
+func (k *apiKey) take() (time.Duration, bool) {
+	if k.limit <= 0 {
+		return 0, true
+	}
+	return k.bucket.take(k.limit)
+}
+
+// lookupKey finds the key presented by a request
+func (s *Server) lookupKey(presented string) *apiKey {
+	return findKey(s.apiKeys, presented)
+}
+
+// lookupTCPKey finds the key presented by a TLS query client
+func (s *Server) lookupTCPKey(presented string) *apiKey {
+	return findKey(s.tcpKeys, presented)
+}
+
+// findKey returns the key in keys whose secret is presented
+func findKey(keys []*apiKey, presented string) *apiKey {
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(presented), k.secret) == 1 {
+			return k
+		}
+	}
+	return nil
+}
+
+// requestKey extracts the API key from the Authorization or X-API-Key
+// header. Where allowBasic is set, a key sent as the Basic password lets a
+// browser log in to the API through its own prompt; the user name is
+// ignored. Browsers cannot set headers on WebSocket requests, so the
+// api_key query parameter is accepted there.
+func requestKey(r *http.Request, allowBasic, allowQuery bool) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		if _, password, ok := r.BasicAuth(); ok && allowBasic {
+			return password
+		}
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if allowQuery {
+		return r.URL.Query().Get("api_key")
+	}
+	return ""
+}
+
+// basicAllowed reports whether a request may authenticate with Basic
+// credentials. Browsers resend them on their own, also on requests another
+// site makes, so they only open GET requests for read-metrics endpoints,
+// whose responses other origins cannot read. Controls need a key in a
+// header a cross-site form cannot set.
+func basicAllowed(r *http.Request, scope string) bool {
+	return scope == config.ScopeReadMetrics && (r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
+
+// requireScope wraps a handler so it only runs for keys holding scope, or
+// for share links to a shared read-metrics endpoint. Without configured
+// keys, only read-metrics is served, unauthenticated.
+func (s *Server) requireScope(scope string, handler func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if scope == config.ScopeReadMetrics && s.serveShare(w, r, handler) {
+			return
+		}
+
+		if len(s.apiKeys) == 0 {
+			if scope != config.ScopeReadMetrics {
+				writeHTTPError(w, http.StatusForbidden, "configure an API key with the "+scope+" scope to use this endpoint")
+				return
+			}
+			handler(w, r, anonymousKey)
+			return
+		}
+
+		allowBasic := basicAllowed(r, scope)
+		presented := requestKey(r, allowBasic, r.URL.Path == "/api/v1/ws")
+		if presented == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="btc-monitor"`)
+			if allowBasic {
+				w.Header().Add("WWW-Authenticate", `Basic realm="btc-monitor"`)
+			}
+			writeHTTPError(w, http.StatusUnauthorized, "API key required")
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		failures := s.authFailures.bucket(host)
+		if wait, ok := failures.available(authFailureLimit); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			writeHTTPError(w, http.StatusTooManyRequests, "too many invalid API keys")
+			return
+		}
+
+		key := s.lookupKey(presented)
+		if key == nil {
+			failures.take(authFailureLimit)
+			logger.Warn("HTTP request rejected: unknown API key", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="btc-monitor", error="invalid_token"`)
+			if allowBasic {
+				w.Header().Add("WWW-Authenticate", `Basic realm="btc-monitor"`)
+			}
+			writeHTTPError(w, http.StatusUnauthorized, "invalid API key")
+			return
+		}
+
+		if !key.allows(scope) {
+			logger.Warn("HTTP request rejected: API key lacks scope", "method", r.Method, "path", r.URL.Path, "api_key", key.name, "scope", scope)
+			writeHTTPError(w, http.StatusForbidden, "API key lacks the "+scope+" scope")
+			return
+		}
+
+		if wait, ok := key.take(); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			writeHTTPError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		handler(w, r, key.name)
+	}
+}
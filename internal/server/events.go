@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/alert"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/redact"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Event types pushed to live-update subscribers
+const (
+	EventSample = "sample"
+	EventAlert  = "alert"
+	EventBlock  = "block"
+)
+
+// Event is a live update pushed to WebSocket clients
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// BlockEvent reports that the node's block height advanced
+type BlockEvent struct {
+	Height         int `json:"height"`
+	PreviousHeight int `json:"previous_height"`
+}
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before it is disconnected
+const subscriberBuffer = 64
+
+// EventHub fans out samples, alert transitions, and block events to live
+// subscribers. It doubles as an alert notifier.
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]struct{}
+	lastHeight  int
+	closed      bool
+
+	schemaVersion int // Output schema version of event payloads
+}
+
+// newEventHub creates an empty hub
+func newEventHub() *EventHub {
+	return &EventHub{
+		subscribers: make(map[chan []byte]struct{}),
+	}
+}
+
+// subscribe registers a new subscriber channel
+func (h *EventHub) subscribe() chan []byte {
+	ch := make(chan []byte, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.subscribers[ch] = struct{}{}
+
+	return ch
+}
+
+// close disconnects every subscriber and refuses new ones
+func (h *EventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// unsubscribe removes a subscriber
+func (h *EventHub) unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends an event to every subscriber, dropping subscribers whose
+// buffer is full rather than blocking collection
+func (h *EventHub) publish(eventType string, data interface{}) {
+	payload, err := encodeVersioned(&Event{
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: data,
+	}, h.schemaVersion)
+	if err != nil {
+		logger.Warn("Failed to marshal event", "event", eventType, "error", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- payload:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// PublishSample pushes a new sample, plus a block event when the block
+// height advanced since the previous sample
+func (h *EventHub) PublishSample(sample *metrics.Sample) {
+	h.publish(EventSample, sample)
+
+	if sample.Bitcoin == nil {
+		return
+	}
+
+	h.mu.Lock()
+	previous := h.lastHeight
+	h.lastHeight = sample.Bitcoin.BlockHeight
+	h.mu.Unlock()
+
+	if previous > 0 && sample.Bitcoin.BlockHeight > previous {
+		h.publish(EventBlock, &BlockEvent{
+			Height:         sample.Bitcoin.BlockHeight,
+			PreviousHeight: previous,
+		})
+	}
+}
+
+// Name returns the notifier name
+func (h *EventHub) Name() string {
+	return "websocket"
+}
+
+// Notify pushes an alert transition to subscribers
+func (h *EventHub) Notify(a *alert.Alert) error {
+	h.publish(EventAlert, a)
+	return nil
+}
+
+// redactEvent applies a redaction profile to the data of an encoded event
+func redactEvent(profile *redact.Profile, payload []byte) ([]byte, error) {
+	var event map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		return nil, err
+	}
+	if data, ok := event["data"]; ok {
+		event["data"] = profile.Tree(data)
+	}
+	return json.Marshal(event)
+}
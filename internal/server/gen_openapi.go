@@ -0,0 +1,28 @@
+//go:build ignore
+
+// gen_openapi writes the HTTP API's OpenAPI document to the given path.
+// Run it with go generate after changing the API or pkg/metrics types.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/server"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run gen_openapi.go <output.json>")
+	}
+
+	data, err := json.MarshalIndent(server.OpenAPI(), "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(os.Args[1], append(data, '\n'), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/scheduler"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// socketMode is the permission the Unix socket file is created with
+const socketMode os.FileMode = 0660
+
+// openSocketMode is used instead when socket access is checked against
+// peer credentials
+const openSocketMode os.FileMode = 0666
+
+// socketCheckInterval is how often the socket file is checked. A file
+// deleted by a cleanup script or a second agent otherwise leaves the
+// listener running with nothing that clients can connect to.
+const socketCheckInterval = 30 * time.Second
+
+// maxAcceptBackoff caps the pause after repeated accept errors, e.g. when
+// the process is out of file descriptors
+const maxAcceptBackoff = time.Second
+
+// socketHealth tracks the query listener. Its mutex also guards
+// Server.listener, which the watchdog replaces.
+type socketHealth struct {
+	mu            sync.Mutex
+	file          os.FileInfo // The socket file as created; nil for TCP and pipes
+	acceptErrors  int64
+	acceptFailing bool // The last Accept failed
+	restarts      int64
+	rejectedConns int64 // Over max_connections
+	rateLimited   int64 // Requests refused by rate_limit_per_minute
+	lastError     string
+	lastErrorTime time.Time
+
+	align time.Duration // See SetSocketCheckAlignment
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// setListener makes listener the current one and remembers the socket
+// file it created, so a replaced file can be told apart
+func (s *Server) setListener(listener net.Listener) {
+	var file os.FileInfo
+	if isUnixSocket(s.socketPath) {
+		file, _ = os.Stat(s.socketPath)
+	}
+
+	s.health.mu.Lock()
+	s.listener = listener
+	s.health.file = file
+	s.health.acceptFailing = false
+	s.health.mu.Unlock()
+}
+
+// recordSocketError counts a failure of the query listener
+func (s *Server) recordSocketError(err error, accept bool) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	if accept {
+		s.health.acceptErrors++
+		s.health.acceptFailing = true
+	}
+	s.health.lastError = err.Error()
+	s.health.lastErrorTime = time.Now().UTC()
+}
+
+// SocketHealth reports whether the query socket can accept clients
+func (s *Server) SocketHealth() *metrics.SocketHealth {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	health := &metrics.SocketHealth{
+		Usable:        s.listener != nil && !s.health.acceptFailing,
+		AcceptErrors:  s.health.acceptErrors,
+		Restarts:      s.health.restarts,
+		Rejected:      s.health.rejectedConns,
+		RateLimited:   s.health.rateLimited,
+		LastError:     s.health.lastError,
+		LastErrorTime: s.health.lastErrorTime,
+	}
+	if !isUnixSocket(s.socketPath) {
+		return health
+	}
+
+	exists, ours, permissionsOK := s.checkSocketFile()
+	health.FileExists = &exists
+	health.PermissionsOK = &permissionsOK
+	health.Usable = health.Usable && ours
+	return health
+}
+
+// checkSocketFile stats the socket file: whether it exists, whether it is
+// the one the current listener created, and whether its mode is intact.
+// Callers hold health.mu.
+func (s *Server) checkSocketFile() (exists, ours, permissionsOK bool) {
+	info, err := os.Stat(s.socketPath)
+	if err != nil {
+		return false, false, false
+	}
+	ours = s.health.file != nil && os.SameFile(info, s.health.file)
+	// Windows does not keep Unix permission bits on socket files
+	permissionsOK = runtime.GOOS == "windows" || info.Mode().Perm() == s.socketFileMode()
+	return true, ours, permissionsOK
+}
+
+// SetSocketCheckAlignment moves the socket file checks to wall-clock
+// multiples of step, at least socketCheckInterval apart, so they share
+// their wakeup with collection. Call it before Start.
+func (s *Server) SetSocketCheckAlignment(step time.Duration) {
+	s.health.align = step
+}
+
+// startSocketWatchdog checks the Unix socket file every
+// socketCheckInterval until Shutdown
+func (s *Server) startSocketWatchdog() {
+	s.health.stop = make(chan struct{})
+	s.health.done = make(chan struct{})
+
+	go func() {
+		defer close(s.health.done)
+
+		warnedMode := false
+		for {
+			next := scheduler.Align(time.Now().Add(socketCheckInterval), s.health.align)
+			select {
+			case <-time.After(time.Until(next)):
+			case <-s.health.stop:
+				return
+			}
+
+			s.health.mu.Lock()
+			exists, ours, permissionsOK := s.checkSocketFile()
+			s.health.mu.Unlock()
+
+			if exists && !permissionsOK && !warnedMode {
+				logger.Warn("Query socket permissions were changed", "path", s.socketPath, "want", s.socketFileMode())
+			}
+			warnedMode = exists && !permissionsOK
+
+			if !ours {
+				s.restartListener(exists)
+			}
+		}
+	}()
+}
+
+// stopSocketWatchdog stops the watchdog if it runs and waits for it
+func (s *Server) stopSocketWatchdog() {
+	if s.health.stop == nil {
+		return
+	}
+	close(s.health.stop)
+	<-s.health.done
+}
+
+// restartListener recreates the Unix socket after its file was deleted or
+// replaced, and closes the old listener. A failure is retried at the next
+// check.
+func (s *Server) restartListener(replaced bool) {
+	if replaced {
+		logger.Warn("Query socket file was replaced, recreating it", "path", s.socketPath)
+	} else {
+		logger.Warn("Query socket file is missing, recreating it", "path", s.socketPath)
+	}
+
+	listener, err := listenSocket(s.socketPath, s.socketFileMode())
+	if err != nil {
+		logger.Error("Failed to recreate query socket", "path", s.socketPath, "error", err)
+		s.recordSocketError(err, false)
+		return
+	}
+
+	s.health.mu.Lock()
+	old := s.listener
+	s.health.mu.Unlock()
+
+	if unix, ok := old.(*net.UnixListener); ok {
+		// The path now belongs to the new listener
+		unix.SetUnlinkOnClose(false)
+	}
+	if old != nil {
+		old.Close()
+	}
+
+	s.setListener(listener)
+	s.health.mu.Lock()
+	s.health.restarts++
+	s.health.mu.Unlock()
+
+	go s.acceptConnections(listener)
+	logger.Info("Query socket recreated", "path", s.socketPath)
+}
+
+// acceptBackoff returns the pause after consecutive accept failures,
+// doubling from 5ms up to maxAcceptBackoff
+func acceptBackoff(failures int) time.Duration {
+	delay := 5 * time.Millisecond << min(failures-1, 8)
+	return min(delay, maxAcceptBackoff)
+}
@@ -0,0 +1,393 @@
+package server
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/query"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/websocket"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// wsPingInterval is how often idle WebSocket clients are pinged
+const wsPingInterval = 30 * time.Second
+
+// gzipMinBytes is the smallest response worth compressing
+const gzipMinBytes = 1024
+
+// EnableHTTP serves the HTTP API when the server starts
+func (s *Server) EnableHTTP(cfg config.HTTPConfig) {
+	s.httpConfig = &cfg
+	var profiles map[string]config.RedactionProfile
+	if s.config != nil {
+		profiles = s.config.RedactionProfiles
+	}
+	s.apiKeys = newAPIKeys(cfg.APIKeys, profiles)
+}
+
+// startHTTP starts the HTTP listener
+func (s *Server) startHTTP() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/status", s.requireScope(config.ScopeReadMetrics, s.handleStatus))
+	mux.HandleFunc("GET /api/v1/current", s.requireScope(config.ScopeReadMetrics, s.handleCurrent))
+	mux.HandleFunc("GET /api/v1/summary", s.requireScope(config.ScopeReadMetrics, s.handleSummary))
+	mux.HandleFunc("GET /api/v1/metrics", s.requireScope(config.ScopeReadMetrics, s.handlePrometheus))
+	mux.HandleFunc("GET /api/v1/mempool", s.requireScope(config.ScopeReadMetrics, s.handleMempool))
+	mux.HandleFunc("GET /api/v1/ws", s.requireScope(config.ScopeReadMetrics, s.handleWebSocket))
+	mux.HandleFunc("GET /api/v1/config", s.requireScope(config.ScopeReadConfig, s.handleConfig))
+	mux.HandleFunc("POST /api/v1/pause", s.requireScope(config.ScopeAdmin, s.handlePause))
+	mux.HandleFunc("POST /api/v1/resume", s.requireScope(config.ScopeAdmin, s.handleResume))
+	mux.HandleFunc("POST /api/v1/shares", s.requireScope(config.ScopeAdmin, s.handleCreateShare))
+	mux.HandleFunc("DELETE /api/v1/shares", s.requireScope(config.ScopeAdmin, s.handleRevokeShares))
+	mux.HandleFunc("GET /api/v1/openapi.json", s.handleOpenAPI)
+
+	allowed, err := parseAllowlist(s.httpConfig.AllowedIPs)
+	if err != nil {
+		return err
+	}
+
+	if s.httpConfig.ShareLinks.Enabled && s.config != nil {
+		s.shares, err = newShareLinks(s.httpConfig.ShareLinks, s.config.DataDir, s.config.RedactionProfiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	addr := s.httpConfig.ListenAddr
+	var handler http.Handler = mux
+	if s.httpConfig.OnionOnly {
+		if addr, err = onionOnlyAddr(addr); err != nil {
+			return err
+		}
+		handler = onionHostOnly(mux)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	listener = newAllowlistListener(listener, allowed)
+
+	s.httpServer = &http.Server{
+		Handler:           s.withSchemaHeader(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Warn("HTTP server stopped", "error", err)
+		}
+	}()
+
+	logger.Info("HTTP server listening", "addr", listener.Addr().String())
+	return nil
+}
+
+// handleWebSocket streams live events to a WebSocket client
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, keyName string) {
+	ws, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	profile := s.keyRedaction(keyName)
+
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case payload, ok := <-events:
+			if !ok {
+				return // Dropped for falling behind, or shutting down
+			}
+			if profile != nil {
+				if payload, err = redactEvent(profile, payload); err != nil {
+					logger.Warn("Failed to redact event, closing WebSocket", "api_key", keyName, "error", err)
+					return
+				}
+			}
+			if err := ws.WriteText(payload, 10*time.Second); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := ws.Ping(10 * time.Second); err != nil {
+				return
+			}
+		case <-ws.Closed():
+			return
+		}
+	}
+}
+
+// handleStatus serves agent status
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request, _ string) {
+	status := s.currentStatus()
+	s.writeVersionedJSON(w, r, status, status.LastCollectionTime)
+}
+
+// handleCurrent serves the most recent sample, with values that have a unit
+// formatted for people when units=human is given
+func (s *Server) handleCurrent(w http.ResponseWriter, r *http.Request, keyName string) {
+	sample, ok := s.currentSample(w)
+	if !ok {
+		return
+	}
+	if profile := s.keyRedaction(keyName); profile != nil {
+		redacted, err := profile.Sample(sample)
+		if err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, fmt.Sprintf("failed to redact sample: %v", err))
+			return
+		}
+		sample = redacted
+	}
+
+	switch r.URL.Query().Get("units") {
+	case "", "raw":
+		s.writeVersionedJSON(w, r, sample, sample.Timestamp)
+	case "human":
+		data, err := s.encode(sample)
+		if err == nil {
+			data, err = query.Humanize(data)
+		}
+		if err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, fmt.Sprintf("failed to marshal response: %v", err))
+			return
+		}
+		writeHTTPJSON(w, r, json.RawMessage(data), sample.Timestamp)
+	default:
+		writeHTTPError(w, http.StatusBadRequest, "units must be raw or human")
+	}
+}
+
+// handleMempool serves a fresh fee distribution of the node's mempool
+func (s *Server) handleMempool(w http.ResponseWriter, r *http.Request, _ string) {
+	if s.mempool == nil {
+		writeHTTPError(w, http.StatusNotFound, "mempool snapshot not available")
+		return
+	}
+
+	snapshot, err := s.mempool.MempoolSnapshot(r.Context())
+	if err != nil {
+		writeHTTPError(w, http.StatusBadGateway, fmt.Sprintf("failed to get mempool snapshot: %v", err))
+		return
+	}
+	s.writeVersionedJSON(w, r, snapshot, snapshot.ComputedAt)
+}
+
+// handleSummary serves a compact summary of the most recent sample
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request, _ string) {
+	sample, ok := s.currentSample(w)
+	if !ok {
+		return
+	}
+	// Pausing stores no new sample, so it counts as the latest change
+	summary, modified := summarize(sample), sample.Timestamp
+	if pause := s.PauseState(); pause != nil {
+		summary.Paused = true
+		if pause.Since.After(modified) {
+			modified = pause.Since
+		}
+	}
+	s.writeVersionedJSON(w, r, summary, modified)
+}
+
+// summarize builds a compact summary of a sample
+func summarize(sample *metrics.Sample) *metrics.Summary {
+	summary := &metrics.Summary{
+		Time:  sample.Timestamp,
+		Stale: sample.Stale,
+	}
+
+	if sample.Bitcoin != nil {
+		summary.BlockHeight = sample.Bitcoin.BlockHeight
+		summary.BlocksBehind = sample.Bitcoin.Headers - sample.Bitcoin.BlockHeight
+		summary.SyncProgress = sample.Bitcoin.SyncProgress
+		summary.Peers = sample.Bitcoin.Peers
+		summary.MempoolTxCount = sample.Bitcoin.MempoolTxCount
+	}
+
+	if sample.System != nil {
+		summary.CPUPercent = math.Round(sample.System.CPUPercent*10) / 10
+		if sample.System.DiskTotalBytes > 0 {
+			pct := float64(sample.System.DiskUsedBytes) / float64(sample.System.DiskTotalBytes) * 100
+			summary.DiskUsedPct = math.Round(pct*10) / 10
+		}
+	}
+
+	if sample.Tor != nil {
+		reachable := sample.Tor.ControlReachable
+		summary.TorReachable = &reachable
+		summary.OnionReachable = sample.Tor.OnionSelfReachable
+	}
+
+	return summary
+}
+
+// handleConfig serves the running configuration with credentials removed
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request, _ string) {
+	if s.config == nil {
+		writeHTTPError(w, http.StatusNotFound, "configuration not available")
+		return
+	}
+	s.writeVersionedJSON(w, r, s.config.Redacted(), time.Time{})
+}
+
+// handlePause pauses collection, attributing the pause to the API key
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request, keyName string) {
+	reason := r.URL.Query().Get("reason")
+	logger.Info("HTTP pause requested", "api_key", keyName)
+	s.Pause(reason)
+	s.writeHTTPPauseState(w)
+}
+
+// handleResume resumes collection, attributing the resume to the API key
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request, keyName string) {
+	logger.Info("HTTP resume requested", "api_key", keyName)
+	s.Resume()
+	s.writeHTTPPauseState(w)
+}
+
+// pauseResponse is the body returned by the pause and resume endpoints
+type pauseResponse struct {
+	Paused bool `json:"paused"`
+	*metrics.PauseInfo
+}
+
+// writeHTTPPauseState writes whether collection is currently paused
+func (s *Server) writeHTTPPauseState(w http.ResponseWriter) {
+	pause := s.PauseState()
+	data, _ := s.encode(pauseResponse{Paused: pause != nil, PauseInfo: pause})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// currentSample loads the latest sample, writing an error response on failure
+func (s *Server) currentSample(w http.ResponseWriter) (*metrics.Sample, bool) {
+	sample, err := s.latestSample()
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get current sample: %v", err))
+		return nil, false
+	}
+	if sample == nil {
+		writeHTTPError(w, http.StatusNotFound, "no samples available")
+		return nil, false
+	}
+	return sample, true
+}
+
+// writeVersionedJSON writes v in the configured output schema
+func (s *Server) writeVersionedJSON(w http.ResponseWriter, r *http.Request, v interface{}, modified time.Time) {
+	data, err := s.encode(v)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Sprintf("failed to marshal response: %v", err))
+		return
+	}
+	writeHTTPJSON(w, r, json.RawMessage(data), modified)
+}
+
+// withSchemaHeader reports the output schema version on every response
+func (s *Server) withSchemaHeader(next http.Handler) http.Handler {
+	version := strconv.Itoa(s.schemaVersion)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(schemaHeader, version)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeHTTPJSON writes v as JSON with ETag and Last-Modified validators,
+// answering 304 Not Modified when the client's copy is still current
+func writeHTTPJSON(w http.ResponseWriter, r *http.Request, v interface{}, modified time.Time) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Sprintf("failed to marshal response: %v", err))
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Vary", "Accept-Encoding")
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Type", "application/json")
+	data = append(data, '\n')
+
+	if len(data) >= gzipMinBytes && headerContains(r.Header, "Accept-Encoding", "gzip") {
+		header.Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(data)
+		gz.Close()
+		return
+	}
+
+	w.Write(data)
+}
+
+// headerContains reports whether a comma-separated header has a token
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since
+// as RFC 9110 prescribes
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err == nil && !modified.Truncate(time.Second).After(since) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeHTTPError writes a JSON error body
+func writeHTTPError(w http.ResponseWriter, status int, message string) {
+	data, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+)
+
+// Default socket limits; see SetSocketLimits
+const (
+	defaultMaxConnections  = 64
+	defaultMaxRequestBytes = 64 << 10
+)
+
+// maxClientBuckets is how many clients' rate limits are tracked before
+// those idle long enough to be full again are dropped
+const maxClientBuckets = 1024
+
+// errRequestTooLong is returned by readRequestLine for a line over
+// max_request_bytes
+var errRequestTooLong = errors.New("request too long")
+
+// socketLimits bounds the connections of the socket and TLS listeners
+type socketLimits struct {
+	slots           chan struct{} // Holds a token per connection being handled
+	maxRequestBytes int
+	timeout         time.Duration
+	ratePerMinute   int
+
+	mu      sync.Mutex
+	clients map[string]*tokenBucket // By clientKey
+	full    bool                    // A connection was turned away since a slot was last free
+}
+
+func newSocketLimits(cfg config.SocketLimitsConfig) *socketLimits {
+	return &socketLimits{
+		slots:           make(chan struct{}, cfg.MaxConnections),
+		maxRequestBytes: cfg.MaxRequestBytes,
+		timeout:         time.Duration(cfg.RequestTimeoutSeconds) * time.Second,
+		ratePerMinute:   cfg.RateLimitPerMinute,
+		clients:         make(map[string]*tokenBucket),
+	}
+}
+
+// SetSocketLimits replaces the default connection limits. Call it before
+// Start.
+func (s *Server) SetSocketLimits(cfg config.SocketLimitsConfig) {
+	s.limits = newSocketLimits(cfg)
+}
+
+// acquireConn takes a connection slot, or closes conn and returns false
+// when all are in use. Callers release a slot they took with releaseConn.
+func (s *Server) acquireConn(conn net.Conn) bool {
+	select {
+	case s.limits.slots <- struct{}{}:
+		return true
+	default:
+	}
+	conn.Close()
+
+	s.health.mu.Lock()
+	s.health.rejectedConns++
+	s.health.mu.Unlock()
+
+	s.limits.mu.Lock()
+	warn := !s.limits.full
+	s.limits.full = true
+	s.limits.mu.Unlock()
+	if warn {
+		logger.Warn("Closing connections over max_connections", "max_connections", cap(s.limits.slots))
+	}
+	return false
+}
+
+// releaseConn frees a slot taken by acquireConn
+func (s *Server) releaseConn() {
+	<-s.limits.slots
+
+	s.limits.mu.Lock()
+	s.limits.full = false
+	s.limits.mu.Unlock()
+}
+
+// allowClient consumes a request from the rate limit of the client at the
+// other end of conn, reporting false when it has none left
+func (s *Server) allowClient(conn net.Conn) bool {
+	if s.limits.ratePerMinute <= 0 {
+		return true
+	}
+	key := clientKey(conn)
+
+	s.limits.mu.Lock()
+	bucket := s.limits.clients[key]
+	if bucket == nil {
+		if len(s.limits.clients) >= maxClientBuckets {
+			s.limits.pruneClients()
+		}
+		bucket = newTokenBucket(s.limits.ratePerMinute)
+		s.limits.clients[key] = bucket
+	}
+	s.limits.mu.Unlock()
+
+	if _, ok := bucket.take(s.limits.ratePerMinute); ok {
+		return true
+	}
+
+	s.health.mu.Lock()
+	s.health.rateLimited++
+	s.health.mu.Unlock()
+	logger.Debug("Client over rate_limit_per_minute", "client", key)
+	return false
+}
+
+// pruneClients drops the buckets of clients idle for a minute, which have
+// refilled completely. Callers hold mu.
+func (l *socketLimits) pruneClients() {
+	for key, bucket := range l.clients {
+		if bucket.idle() > time.Minute {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// clientKey identifies the client of a connection for rate limiting: its
+// address for TCP, and its user for a Unix socket where peer credentials
+// are available. Other local clients share one limit.
+func clientKey(conn net.Conn) string {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	if uid, _, err := peerCredentials(conn); err == nil {
+		return "uid:" + strconv.Itoa(uid)
+	}
+	return "local"
+}
+
+// readRequestLine reads a line of at most maxRequestBytes
+func (s *Server) readRequestLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > s.limits.maxRequestBytes {
+			return "", errRequestTooLong
+		}
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// tokenBucket is a rate limiter holding up to limit tokens, refilled at
+// limit tokens per minute
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit int) *tokenBucket {
+	return &tokenBucket{tokens: float64(limit), last: time.Now()}
+}
+
+// take consumes one token, returning how long to wait when none is
+// available
+func (b *tokenBucket) take(limit int) (time.Duration, bool) {
+	return b.check(limit, true)
+}
+
+// available reports whether a token is left without consuming it,
+// returning how long to wait when none is
+func (b *tokenBucket) available(limit int) (time.Duration, bool) {
+	return b.check(limit, false)
+}
+
+// check refills the bucket and, if a token is left and consume is set,
+// takes it
+func (b *tokenBucket) check(limit int, consume bool) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	perSecond := float64(limit) / 60
+	b.tokens += now.Sub(b.last).Seconds() * perSecond
+	if b.tokens > float64(limit) {
+		b.tokens = float64(limit)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+		return wait, false
+	}
+
+	if consume {
+		b.tokens--
+	}
+	return 0, true
+}
+
+// idle returns how long ago a token was last asked for
+func (b *tokenBucket) idle() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Since(b.last)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// pipePrefix marks a socket path as a Windows named pipe
+const pipePrefix = `\\.\pipe\`
+
+// listenSocket opens the query listener. The socket path is normally a Unix
+// socket; "tcp:host:port" listens on loopback TCP and, on Windows, a \\.\pipe\
+// path listens on a named pipe. mode applies to Unix socket files.
+func listenSocket(path string, mode os.FileMode) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(path, "tcp:"):
+		addr := strings.TrimPrefix(path, "tcp:")
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket address %q: %w", path, err)
+		}
+		if !isLoopbackHost(host) {
+			return nil, fmt.Errorf("socket address %q is not a loopback address; use query_tcp to serve other hosts", path)
+		}
+
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create socket: %w", err)
+		}
+		return listener, nil
+
+	case strings.HasPrefix(path, pipePrefix):
+		listener, err := listenPipe(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create named pipe: %w", err)
+		}
+		return listener, nil
+	}
+
+	// Remove a socket left behind by an unclean exit
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket: %w", err)
+	}
+
+	// Set socket permissions
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return listener, nil
+}
+
+// isUnixSocket reports whether a socket path names a Unix socket file
+func isUnixSocket(path string) bool {
+	return !strings.HasPrefix(path, "tcp:") && !strings.HasPrefix(path, pipePrefix)
+}
+
+// parseAllowlist parses source addresses and CIDR ranges
+func parseAllowlist(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// allowlistListener drops connections whose source address is not allowlisted
+type allowlistListener struct {
+	net.Listener
+	allowed []netip.Prefix
+}
+
+// newAllowlistListener wraps l; an empty allowlist accepts every source
+func newAllowlistListener(l net.Listener, allowed []netip.Prefix) net.Listener {
+	if len(allowed) == 0 {
+		return l
+	}
+	return &allowlistListener{Listener: l, allowed: allowed}
+}
+
+// Accept returns the next allowlisted connection
+func (l *allowlistListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.permits(conn.RemoteAddr()) {
+			return conn, nil
+		}
+
+		logger.Warn("Rejected connection not in allowlist", "remote", conn.RemoteAddr().String())
+		conn.Close()
+	}
+}
+
+// permits reports whether a remote address is allowlisted
+func (l *allowlistListener) permits(remote net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(remote.String())
+	if err != nil {
+		return false
+	}
+
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range l.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// onionOnlyAddr forces a listen address onto loopback, where only a local
+// Tor hidden service can reach it
+func onionOnlyAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+
+	if isLoopbackHost(host) {
+		return addr, nil
+	}
+
+	loopback := net.JoinHostPort("127.0.0.1", port)
+	logger.Warn("onion_only is set; binding to loopback", "addr", loopback, "configured", addr)
+	return loopback, nil
+}
+
+// isLoopbackHost reports whether host names the loopback interface
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.IsLoopback()
+}
+
+// onionHostOnly rejects requests that were not addressed to an onion
+// service or to loopback. This keeps a browser on the same machine from
+// reaching the API through a DNS-rebound hostname.
+func onionHostOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if !strings.HasSuffix(strings.ToLower(host), ".onion") && !isLoopbackHost(host) {
+			writeHTTPError(w, http.StatusMisdirectedRequest, "this API is only served over its onion address")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/alert"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+//go:generate go run gen_openapi.go ../../api/openapi.json
+
+// schema is a JSON Schema object within the OpenAPI document
+type schema = map[string]interface{}
+
+// apiVersion is the version of the HTTP API described by the document
+const apiVersion = "1.0.0"
+
+// errorResponse is the body returned with every error status
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// OpenAPI builds the OpenAPI 3 document describing the HTTP API. Response
+// schemas are derived from the Go types the handlers marshal, so the
+// document cannot drift from the wire format.
+func OpenAPI() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	ref := func(v interface{}) schema {
+		return schemaFor(reflect.TypeOf(v), schemas)
+	}
+
+	jsonContent := func(s schema) schema {
+		return schema{"application/json": schema{"schema": s}}
+	}
+	errorRef := ref(errorResponse{})
+	response := func(description string, s schema) schema {
+		return schema{"description": description, "content": jsonContent(s)}
+	}
+	errorResp := func(description string) schema {
+		return response(description, errorRef)
+	}
+
+	conditional := []interface{}{
+		schema{"name": "If-None-Match", "in": "header", "schema": schema{"type": "string"}},
+		schema{"name": "If-Modified-Since", "in": "header", "schema": schema{"type": "string"}},
+	}
+	conditionalResponses := func(description string, s schema) schema {
+		return schema{
+			"200": response(description, s),
+			"304": schema{"description": "Not modified since the validator the client sent"},
+			"401": errorResp("Missing or invalid API key"),
+			"403": errorResp("API key lacks the read-metrics scope"),
+			"429": errorResp("Rate limit exceeded"),
+		}
+	}
+
+	operation := func(summary, scope string, params []interface{}, responses schema) schema {
+		security := []interface{}{schema{"bearerAuth": []string{}}, schema{"apiKeyHeader": []string{}}}
+		// Basic credentials, which browsers resend to any site's requests,
+		// only open the read-only endpoints
+		if scope == config.ScopeReadMetrics {
+			security = append(security, schema{"basicAuth": []string{}})
+		}
+		op := schema{
+			"summary":     summary,
+			"responses":   responses,
+			"x-scope":     scope,
+			"security":    security,
+			"operationId": operationID(summary),
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		return op
+	}
+
+	// Share links open an endpoint with the share query parameter instead
+	// of a key
+	shareParam := schema{"name": "share", "in": "query", "schema": schema{"type": "string"},
+		"description": "Share link token, used instead of an API key; see POST /api/v1/shares"}
+	shared := func(op schema) schema {
+		op["security"] = append(op["security"].([]interface{}), schema{})
+		return op
+	}
+
+	adminResponses := schema{
+		"200": response("Current pause state", ref(pauseResponse{})),
+		"401": errorResp("Missing or invalid API key"),
+		"403": errorResp("API key lacks the admin scope"),
+		"429": errorResp("Rate limit exceeded"),
+	}
+
+	paths := schema{
+		"/api/v1/status": schema{"get": operation("Get agent status", config.ScopeReadMetrics, conditional,
+			conditionalResponses("Agent status", ref(metrics.AgentStatus{})))},
+		"/api/v1/current": schema{"get": shared(operation("Get latest sample", config.ScopeReadMetrics,
+			append([]interface{}{
+				schema{"name": "units", "in": "query", "schema": schema{"type": "string", "enum": []string{"raw", "human"}},
+					"description": "human formats sizes, rates, durations, percentages and temperatures as strings such as \"1.5 GiB\""},
+				shareParam,
+			}, conditional...),
+			conditionalResponses("Most recent sample", ref(metrics.Sample{}))))},
+		"/api/v1/metrics": schema{"get": operation("Get latest sample for Prometheus", config.ScopeReadMetrics, nil,
+			schema{
+				"200": schema{
+					"description": "Prometheus text exposition of every numeric field, named with base-unit suffixes",
+					"content":     schema{"text/plain": schema{"schema": schema{"type": "string"}}},
+				},
+				"401": errorResp("Missing or invalid API key"),
+				"403": errorResp("API key lacks the read-metrics scope"),
+				"404": errorResp("No samples available"),
+			})},
+		"/api/v1/mempool": schema{"get": operation("Get mempool fee distribution", config.ScopeReadMetrics, nil,
+			schema{
+				"200": response("Fee distribution, recomputed unless the last one is a few seconds old", ref(metrics.MempoolSnapshot{})),
+				"401": errorResp("Missing or invalid API key"),
+				"403": errorResp("API key lacks the read-metrics scope"),
+				"404": errorResp("Bitcoin collection is not configured"),
+				"429": errorResp("Rate limit exceeded"),
+				"502": errorResp("The node could not be queried"),
+			})},
+		"/api/v1/summary": schema{"get": shared(operation("Get compact summary", config.ScopeReadMetrics,
+			append([]interface{}{shareParam}, conditional...),
+			conditionalResponses("Compact summary of the most recent sample", ref(metrics.Summary{}))))},
+		"/api/v1/ws": schema{"get": operation("Subscribe to live events", config.ScopeReadMetrics,
+			[]interface{}{
+				schema{"name": "api_key", "in": "query", "schema": schema{"type": "string"},
+					"description": "API key, for browsers that cannot set headers on WebSocket requests"},
+			},
+			schema{
+				"101": schema{
+					"description": "WebSocket upgrade. Each text message is an Event whose data is a " +
+						"Sample, Alert, or BlockEvent depending on its type.",
+					"content": jsonContent(ref(Event{})),
+				},
+				"401": errorResp("Missing or invalid API key"),
+				"403": schema{"description": "API key lacks the read-metrics scope, or the Origin header names another host"},
+				"426": schema{"description": "Not a WebSocket upgrade request"},
+			})},
+		"/api/v1/config": schema{"get": operation("Get configuration", config.ScopeReadConfig, nil,
+			schema{
+				"200": response("Running configuration with credentials redacted", ref(config.Config{})),
+				"401": errorResp("Missing or invalid API key"),
+				"403": errorResp("API key lacks the read-config scope"),
+			})},
+		"/api/v1/pause": schema{"post": operation("Pause collection", config.ScopeAdmin,
+			[]interface{}{schema{"name": "reason", "in": "query", "schema": schema{"type": "string"}}},
+			adminResponses)},
+		"/api/v1/resume": schema{"post": operation("Resume collection", config.ScopeAdmin, nil, adminResponses)},
+		"/api/v1/shares": schema{
+			"post": operation("Create share link", config.ScopeAdmin,
+				[]interface{}{schema{"name": "ttl", "in": "query", "schema": schema{"type": "string"},
+					"description": "Lifetime as a Go duration such as \"2h\"; defaults to 24h and is capped at max_ttl_hours"}},
+				schema{
+					"200": response("Read-only link to the current sample and summary", ref(shareResponse{})),
+					"400": errorResp("Invalid ttl"),
+					"401": errorResp("Missing or invalid API key"),
+					"403": errorResp("API key lacks the admin scope"),
+					"404": errorResp("Share links are not enabled"),
+				}),
+			"delete": operation("Revoke share links", config.ScopeAdmin, nil,
+				schema{
+					"204": schema{"description": "Every share link issued so far stops working"},
+					"401": errorResp("Missing or invalid API key"),
+					"403": errorResp("API key lacks the admin scope"),
+					"404": errorResp("Share links are not enabled"),
+				}),
+		},
+		"/api/v1/openapi.json": schema{"get": schema{
+			"summary":     "Get this document",
+			"operationId": "getOpenAPI",
+			"security":    []interface{}{},
+			"responses":   schema{"200": schema{"description": "OpenAPI document", "content": jsonContent(schema{"type": "object"})}},
+		}},
+	}
+
+	// Event data types are not reachable through Event's interface{} field
+	ref(alert.Alert{})
+	ref(BlockEvent{})
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": schema{
+			"title":   "btc-node-monitor HTTP API",
+			"version": apiVersion,
+			"description": "Read-only metrics, live events, and basic control for a btc-monitor agent. " +
+				"JSON objects carry a schema_version member and every response an " + schemaHeader + " header; " +
+				"agents configured with output_schema_version keep the field names of that version.",
+			"x-schema-version": metrics.SchemaVersion,
+		},
+		"paths": paths,
+		"components": schema{
+			"schemas": schemas,
+			"securitySchemes": schema{
+				"bearerAuth":   schema{"type": "http", "scheme": "bearer"},
+				"basicAuth":    schema{"type": "http", "scheme": "basic", "description": "API key as the password; the user name is ignored. Accepted on read-metrics GET endpoints only"},
+				"apiKeyHeader": schema{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+}
+
+// handleOpenAPI serves the OpenAPI document; it needs no API key
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeHTTPJSON(w, r, OpenAPI(), time.Time{})
+}
+
+// operationID turns a summary like "Get agent status" into "getAgentStatus"
+func operationID(summary string) string {
+	words := strings.Fields(summary)
+	for i, word := range words {
+		if i == 0 {
+			words[i] = strings.ToLower(word)
+		} else {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor derives a JSON Schema from a Go type following encoding/json
+// rules. Named structs are registered in defs and referenced.
+func schemaFor(t reflect.Type, defs map[string]interface{}) schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return schema{"type": "string", "format": "date-time"}
+	case t == rawJSONType:
+		return schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return schema{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return schema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return schema{"type": "string", "format": "byte"}
+		}
+		return schema{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, defs)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := defs[name]; !ok {
+			defs[name] = schema{} // Placeholder guards against recursion
+			defs[name] = structSchema(t, defs)
+		}
+		return schema{"$ref": "#/components/schemas/" + name}
+	default:
+		return schema{} // interface{} and anything else accepts any value
+	}
+}
+
+// structSchema builds an object schema from a struct's exported fields
+func structSchema(t reflect.Type, defs map[string]interface{}) schema {
+	properties := schema{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name are flattened, as encoding/json does
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				flat := structSchema(embedded, defs)
+				for k, v := range flat["properties"].(schema) {
+					properties[k] = v
+				}
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaFor(field.Type, defs)
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	s := schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
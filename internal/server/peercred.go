@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+)
+
+// socketAccess admits Unix socket peers by the user and group IDs the
+// kernel reports for them
+type socketAccess struct {
+	uids map[int]bool
+	gids map[int]bool
+}
+
+// SetSocketAccess restricts the Unix socket to the users and groups in
+// cfg, and to root and the agent's own user. Call it before Start.
+func (s *Server) SetSocketAccess(cfg config.SocketAccessConfig) error {
+	if !isUnixSocket(s.socketPath) {
+		return errors.New("socket_access requires socket_path to be a Unix socket")
+	}
+	if !peerCredentialsSupported {
+		return errors.New("socket_access is only supported on Linux")
+	}
+
+	access := &socketAccess{
+		uids: map[int]bool{0: true, os.Getuid(): true},
+		gids: make(map[int]bool),
+	}
+	for _, name := range cfg.AllowUsers {
+		uid, err := lookupID(name, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("unknown socket_access user %q: %w", name, err)
+		}
+		access.uids[uid] = true
+	}
+	for _, name := range cfg.AllowGroups {
+		gid, err := lookupID(name, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("unknown socket_access group %q: %w", name, err)
+		}
+		access.gids[gid] = true
+	}
+
+	s.socketAccess = access
+	return nil
+}
+
+// socketFileMode returns the mode of the Unix socket file, which is open
+// to everyone when peer credentials decide access
+func (s *Server) socketFileMode() os.FileMode {
+	if s.socketAccess != nil {
+		return openSocketMode
+	}
+	return socketMode
+}
+
+// permits reports whether the peer of conn is allowed, logging a refusal
+func (a *socketAccess) permits(conn net.Conn) bool {
+	uid, gid, err := peerCredentials(conn)
+	if err != nil {
+		logger.Warn("Rejected socket connection without peer credentials", "error", err)
+		return false
+	}
+	if a.uids[uid] || a.gids[gid] {
+		return true
+	}
+
+	// Supplementary groups, e.g. a dashboard user added to the bitcoin group
+	if len(a.gids) > 0 {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			groups, _ := u.GroupIds()
+			if slices.ContainsFunc(groups, func(group string) bool {
+				id, err := strconv.Atoi(group)
+				return err == nil && a.gids[id]
+			}) {
+				return true
+			}
+		}
+	}
+
+	logger.Warn("Rejected socket connection from a user not in socket_access", "uid", uid, "gid", gid)
+	return false
+}
+
+// lookupID resolves a user or group given by name or numeric ID
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	idString, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(idString)
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package server
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// peerCredentialsSupported reports whether peerCredentials works here
+const peerCredentialsSupported = true
+
+// peerCredentials returns the user and group IDs of the process at the
+// other end of a Unix socket connection, as of when it connected
+func peerCredentials(conn net.Conn) (uid, gid int, err error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, 0, errors.New("not a Unix socket connection")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return 0, 0, err
+	}
+	if credErr != nil {
+		return 0, 0, credErr
+	}
+	return int(cred.Uid), int(cred.Gid), nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredentialsSupported reports whether peerCredentials works here
+const peerCredentialsSupported = false
+
+// peerCredentials is only supported on Linux
+func peerCredentials(conn net.Conn) (uid, gid int, err error) {
+	return 0, 0, errors.New("peer credentials are only supported on Linux")
+}
@@ -0,0 +1,145 @@
+//go:build windows
+
+package server
+
+import (
+	"net"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeSDDL limits the query pipe to SYSTEM and Administrators, the
+// equivalent of the root-owned 0660 Unix socket
+const pipeSDDL = "D:P(A;;GA;;;SY)(A;;GA;;;BA)"
+
+// pipeListener accepts connections on a Windows named pipe. Each accepted
+// client consumes the waiting pipe instance and a new one is created for
+// the next client.
+type pipeListener struct {
+	path string
+	sa   *windows.SecurityAttributes
+
+	mu     sync.Mutex
+	next   windows.Handle // Instance waiting for the next client
+	closed bool
+}
+
+// listenPipe creates the first instance of a named pipe, failing if
+// another process already owns the name
+func listenPipe(path string) (net.Listener, error) {
+	sd, err := windows.SecurityDescriptorFromString(pipeSDDL)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &pipeListener{
+		path: path,
+		sa: &windows.SecurityAttributes{
+			Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+			SecurityDescriptor: sd,
+		},
+	}
+
+	if l.next, err = l.createInstance(true); err != nil {
+		return nil, &os.PathError{Op: "listen", Path: path, Err: err}
+	}
+	return l, nil
+}
+
+// createInstance creates a pipe instance that only accepts local clients
+func (l *pipeListener) createInstance(first bool) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+
+	return windows.CreateNamedPipe(name, flags, mode, windows.PIPE_UNLIMITED_INSTANCES, 4096, 4096, 0, l.sa)
+}
+
+// Accept waits for a client to connect to the pipe
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	handle := l.next
+	l.mu.Unlock()
+
+	err := windows.ConnectNamedPipe(handle, nil)
+	if err != nil && err != windows.ERROR_PIPE_CONNECTED {
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: pipeAddr(l.path), Err: err}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		// Woken by Close
+		windows.CloseHandle(handle)
+		return nil, net.ErrClosed
+	}
+
+	if l.next, err = l.createInstance(false); err != nil {
+		l.closed = true
+		windows.CloseHandle(handle)
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: pipeAddr(l.path), Err: err}
+	}
+
+	return &pipeConn{File: os.NewFile(uintptr(handle), l.path), handle: handle, addr: pipeAddr(l.path)}, nil
+}
+
+// Close stops accepting clients. A pending Accept is woken by connecting
+// to the waiting instance.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	if client, err := os.OpenFile(l.path, os.O_RDWR, 0); err == nil {
+		client.Close()
+	}
+	return nil
+}
+
+// Addr returns the pipe path
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+// pipeAddr is the net.Addr of a named pipe
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeConn is an accepted named pipe client. Pipe handles opened for
+// synchronous I/O do not support deadlines; setting one returns an error.
+type pipeConn struct {
+	*os.File
+	handle windows.Handle
+	addr   pipeAddr
+}
+
+// Close flushes unread data to the client before closing, as closing a
+// pipe discards anything the client has not yet read
+func (c *pipeConn) Close() error {
+	windows.FlushFileBuffers(c.handle)
+	return c.File.Close()
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
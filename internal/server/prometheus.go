@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/query"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// prometheusNamespace prefixes every exported metric name
+const prometheusNamespace = "btc_monitor_"
+
+// handlePrometheus serves the latest sample in the Prometheus text
+// exposition format. Names end in their base unit and values are converted
+// to it, so milliseconds are exported as seconds and percentages as ratios.
+func (s *Server) handlePrometheus(w http.ResponseWriter, r *http.Request, _ string) {
+	sample, ok := s.currentSample(w)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(prometheusText(sample))
+}
+
+// prometheusText renders every numeric field of a sample as a gauge
+func prometheusText(sample *metrics.Sample) []byte {
+	fields := query.Flatten(sample)
+
+	// Sanitizing map keys can make two fields collide; the first wins
+	exported := make(map[string]float64, len(fields))
+	names := make([]string, 0, len(fields))
+	fieldNames := make([]string, 0, len(fields))
+	for field := range fields {
+		fieldNames = append(fieldNames, field)
+	}
+	sort.Strings(fieldNames)
+
+	for _, field := range fieldNames {
+		name := prometheusNamespace + metrics.PrometheusName(field)
+		if _, taken := exported[name]; taken {
+			continue
+		}
+		exported[name] = metrics.Quantity{Value: fields[field], Unit: metrics.UnitOf(field)}.Base().Value
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n%s %s\n", name, name, strconv.FormatFloat(exported[name], 'g', -1, 64))
+	}
+	return buf.Bytes()
+}
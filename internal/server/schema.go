@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// schemaHeader carries the output schema version on every HTTP response
+const schemaHeader = "X-Schema-Version"
+
+// SetSchemaVersion pins responses and events to an older output schema so
+// that existing dashboards keep working after an upgrade. Zero selects the
+// current schema.
+func (s *Server) SetSchemaVersion(version int) error {
+	if version == 0 {
+		version = metrics.SchemaVersion
+	}
+	if version < 1 || version > metrics.SchemaVersion {
+		return fmt.Errorf("unsupported output schema version %d (supported: 1-%d)", version, metrics.SchemaVersion)
+	}
+
+	s.schemaVersion = version
+	s.events.schemaVersion = version
+	return nil
+}
+
+// encode marshals a response in the configured output schema
+func (s *Server) encode(v interface{}) ([]byte, error) {
+	return encodeVersioned(v, s.schemaVersion)
+}
+
+// encodeVersioned marshals v, reverting fields renamed after version and
+// adding a schema_version member to the top-level object, or to each object
+// of a top-level array
+func encodeVersioned(v interface{}, version int) ([]byte, error) {
+	if version == 0 {
+		version = metrics.SchemaVersion
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if renames := renamesSince(version); len(renames) > 0 {
+		var tree interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return nil, err
+		}
+		revertRenames(tree, renames)
+		if data, err = json.Marshal(tree); err != nil {
+			return nil, err
+		}
+	}
+
+	return stampVersion(data, version)
+}
+
+// renamesSince returns the renames made after version, newest first
+func renamesSince(version int) []metrics.FieldRename {
+	var renames []metrics.FieldRename
+	for i := len(metrics.Renames) - 1; i >= 0; i-- {
+		if metrics.Renames[i].Version > version {
+			renames = append(renames, metrics.Renames[i])
+		}
+	}
+	return renames
+}
+
+// revertRenames restores old field names throughout a decoded document.
+// A rename applies both to nested objects and to maps keyed by dotted
+// field names, such as aggregation buckets and field selections.
+func revertRenames(v interface{}, renames []metrics.FieldRename) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for _, rename := range renames {
+			if value, ok := node[rename.New]; ok {
+				delete(node, rename.New)
+				node[rename.Old] = value
+			} else if value, ok := removePath(node, strings.Split(rename.New, ".")); ok {
+				setPath(node, strings.Split(rename.Old, "."), value)
+			}
+		}
+		for _, child := range node {
+			revertRenames(child, renames)
+		}
+	case []interface{}:
+		for _, child := range node {
+			revertRenames(child, renames)
+		}
+	}
+}
+
+// removePath deletes and returns the value at a nested path
+func removePath(node map[string]interface{}, path []string) (interface{}, bool) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := node[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		node = child
+	}
+
+	last := path[len(path)-1]
+	value, ok := node[last]
+	if ok {
+		delete(node, last)
+	}
+	return value, ok
+}
+
+// setPath stores a value at a nested path, creating objects as needed
+func setPath(node map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := node[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			node[key] = child
+		}
+		node = child
+	}
+	node[path[len(path)-1]] = value
+}
+
+// stampVersion inserts schema_version as the first member of a top-level
+// object, or of each object in a top-level array
+func stampVersion(data []byte, version int) ([]byte, error) {
+	member := []byte(`"schema_version":` + strconv.Itoa(version))
+
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		return stampObject(data, member), nil
+	case bytes.HasPrefix(data, []byte("[")):
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return nil, err
+		}
+		for i, element := range elements {
+			if bytes.HasPrefix(element, []byte("{")) {
+				elements[i] = stampObject(element, member)
+			}
+		}
+		return json.Marshal(elements)
+	default:
+		return data, nil
+	}
+}
+
+// stampObject inserts a member at the start of a compact JSON object
+func stampObject(object, member []byte) []byte {
+	stamped := make([]byte, 0, len(object)+len(member)+1)
+	stamped = append(stamped, '{')
+	stamped = append(stamped, member...)
+	if len(object) > 2 {
+		stamped = append(stamped, ',')
+	}
+	return append(stamped, object[1:]...)
+}
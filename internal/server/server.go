@@ -2,29 +2,119 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/query"
 	"github.com/bitcoin-node-manager/btc-node-monitor/internal/storage"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/zabbix"
 	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
 )
 
+var logger = logging.New("server")
+
+// requestTimeout bounds reading a command and writing its response unless
+// SetSocketLimits changes it
+const requestTimeout = 10 * time.Second
+
+// diffSearchWindow is how far from a requested time GET diff looks for a sample
+const diffSearchWindow = time.Hour
+
+// maxTopResults caps the count accepted by GET top
+const maxTopResults = 1000
+
+// Bounds of the cache of aggregated GET metrics results: the queries kept,
+// the buckets per query, and how long a query is kept
+const (
+	queryCacheEntries = 32
+	queryCacheBuckets = 4096
+	queryCacheTTL     = 10 * time.Minute
+)
+
+// minMetricsStep is the finest step accepted by GET metrics; samples are
+// collected seconds apart, so finer steps only multiply empty buckets
+const minMetricsStep = time.Second
+
+// backupIdleTimeout bounds how long a BACKUP stream may stall; the stream
+// itself may take as long as the data needs
+const backupIdleTimeout = time.Minute
+
+// RPCProxy forwards allowlisted read-only RPCs to the Bitcoin node
+type RPCProxy interface {
+	Proxy(method string, params []string) (json.RawMessage, error)
+}
+
+// MempoolSource computes the fee distribution of the node's mempool on
+// request
+type MempoolSource interface {
+	MempoolSnapshot(ctx context.Context) (*metrics.MempoolSnapshot, error)
+}
+
+// BlockStatsSource summarizes the time between blocks over a range
+type BlockStatsSource interface {
+	BlockIntervalStats(start, end time.Time) (*metrics.BlockIntervalStats, error)
+}
+
+// JobLister reports the status of scheduled maintenance jobs
+type JobLister interface {
+	Jobs() []metrics.JobStatus
+}
+
 // Server handles Unix socket queries
 type Server struct {
 	socketPath string
-	storage    *storage.Storage
-	listener   net.Listener
-	status     *metrics.AgentStatus
+	storage    storage.StorageBackend
+	proxy      RPCProxy
+	mempool    MempoolSource
+	blocks     BlockStatsSource
+	jobs       JobLister
+	listener   net.Listener   // Guarded by health.mu
+	handlers   sync.WaitGroup // In-flight socket connections
+	statusMu   sync.Mutex
+	status     *metrics.AgentStatus // Guarded by statusMu
 	startTime  time.Time
+
+	// Output schema version of responses; see SetSchemaVersion
+	schemaVersion int
+
+	// Buckets of recent GET metrics aggregations; see InvalidateQueryCache
+	queryCache *query.Cache
+
+	pauseMu sync.Mutex
+	pause   *metrics.PauseInfo
+
+	config     *config.Config
+	events     *EventHub
+	httpConfig *config.HTTPConfig
+	httpServer *http.Server
+	apiKeys    []*apiKey
+	shares     *shareLinks // nil unless share links are enabled
+
+	authFailures authFailures // By client address, for the HTTP API
+
+	tcpConfig   *config.QueryTCPConfig
+	tcpListener net.Listener
+	tcpKeys     []*apiKey
+
+	socketAccess *socketAccess
+	limits       *socketLimits
+
+	health socketHealth
 }
 
 // NewServer creates a new query server
-func NewServer(socketPath string, storage *storage.Storage, version string) *Server {
+func NewServer(socketPath string, storage storage.StorageBackend, version string) *Server {
 	return &Server{
 		socketPath: socketPath,
 		storage:    storage,
@@ -32,46 +122,85 @@ func NewServer(socketPath string, storage *storage.Storage, version string) *Ser
 			Running: true,
 			Version: version,
 		},
-		startTime: time.Now(),
+		startTime:     time.Now(),
+		events:        newEventHub(),
+		schemaVersion: metrics.SchemaVersion,
+		queryCache:    query.NewCache(queryCacheEntries, queryCacheBuckets, queryCacheTTL),
+		limits: newSocketLimits(config.SocketLimitsConfig{
+			MaxConnections:        defaultMaxConnections,
+			MaxRequestBytes:       defaultMaxRequestBytes,
+			RequestTimeoutSeconds: int(requestTimeout.Seconds()),
+		}),
 	}
 }
 
 // Start starts the Unix socket server
 func (s *Server) Start() error {
-	// Remove existing socket if it exists
-	os.Remove(s.socketPath)
-
-	// Create Unix listener
-	listener, err := net.Listen("unix", s.socketPath)
+	listener, err := listenSocket(s.socketPath, s.socketFileMode())
 	if err != nil {
-		return fmt.Errorf("failed to create socket: %w", err)
+		return err
 	}
 
-	// Set socket permissions
-	if err := os.Chmod(s.socketPath, 0660); err != nil {
-		listener.Close()
-		return fmt.Errorf("failed to set socket permissions: %w", err)
+	s.setListener(listener)
+	logger.Info("Socket server listening", "path", s.socketPath)
+
+	// Accept connections
+	go s.acceptConnections(listener)
+	if isUnixSocket(s.socketPath) {
+		s.startSocketWatchdog()
 	}
 
-	s.listener = listener
-	log.Printf("[INFO] Socket server listening on %s", s.socketPath)
+	if s.tcpConfig != nil {
+		if err := s.startTCP(); err != nil {
+			listener.Close()
+			return err
+		}
+	}
 
-	// Accept connections
-	go s.acceptConnections()
+	if s.httpConfig != nil {
+		if err := s.startHTTP(); err != nil {
+			listener.Close()
+			if s.tcpListener != nil {
+				s.tcpListener.Close()
+			}
+			return err
+		}
+	}
 
 	return nil
 }
 
-// acceptConnections handles incoming connections
-func (s *Server) acceptConnections() {
+// acceptConnections handles incoming connections until listener is closed
+func (s *Server) acceptConnections(listener net.Listener) {
+	failures := 0
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
-			log.Printf("[WARN] Failed to accept connection: %v", err)
+			if errors.Is(err, net.ErrClosed) {
+				return // Shutting down or replaced
+			}
+			failures++
+			s.recordSocketError(err, true)
+			logger.Warn("Failed to accept connection", "error", err)
+			time.Sleep(acceptBackoff(failures))
 			continue
 		}
+		if failures > 0 {
+			failures = 0
+			s.health.mu.Lock()
+			s.health.acceptFailing = false
+			s.health.mu.Unlock()
+		}
 
-		go s.handleConnection(conn)
+		if !s.acquireConn(conn) {
+			continue
+		}
+		s.handlers.Add(1)
+		go func() {
+			defer s.handlers.Done()
+			defer s.releaseConn()
+			s.handleConnection(conn)
+		}()
 	}
 }
 
@@ -80,12 +209,31 @@ func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
 	// Set timeout
-	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	conn.SetDeadline(time.Now().Add(s.limits.timeout))
+
+	if s.socketAccess != nil && !s.socketAccess.permits(conn) {
+		s.writeError(conn, "permission denied")
+		return
+	}
+	if !s.allowClient(conn) {
+		s.writeError(conn, "rate limit exceeded")
+		return
+	}
 
-	reader := bufio.NewReader(conn)
-	line, err := reader.ReadString('\n')
+	s.serveCommand(conn, bufio.NewReader(conn), nil)
+}
+
+// serveCommand reads one command from a connection and answers it. A
+// client authenticated with key may only use the commands its scopes
+// cover; local clients, with a nil key, may use all.
+func (s *Server) serveCommand(conn net.Conn, reader *bufio.Reader, key *apiKey) {
+	line, err := s.readRequestLine(reader)
+	if errors.Is(err, errRequestTooLong) {
+		s.writeError(conn, "request too long")
+		return
+	}
 	if err != nil {
-		log.Printf("[WARN] Failed to read from connection: %v", err)
+		logger.Warn("Failed to read from connection", "error", err)
 		return
 	}
 
@@ -98,15 +246,124 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 
 	command := strings.ToUpper(parts[0])
+	if key != nil {
+		if scope := commandScope(command, parts[1:]); !key.allows(scope) {
+			logger.Warn("TLS query rejected: API key lacks scope", "command", command, "api_key", key.name, "scope", scope)
+			s.writeError(conn, "API key lacks the "+scope+" scope")
+			return
+		}
+	}
 
 	switch command {
 	case "GET":
 		s.handleGet(conn, parts[1:])
+	case "PROXY":
+		s.handleProxy(conn, parts[1:])
+	case "ANNOTATE":
+		s.handleAnnotate(conn, parts[1:])
+	case "BACKUP":
+		s.handleBackup(conn)
+	case "PAUSE":
+		s.Pause(strings.Join(parts[1:], " "))
+		s.writePauseState(conn)
+	case "RESUME":
+		s.Resume()
+		s.writePauseState(conn)
+	case "PING":
+		s.handlePing(conn, parts[1:])
+	case "INFO":
+		s.handleInfo(conn)
 	default:
 		s.writeError(conn, fmt.Sprintf("unknown command: %s", command))
 	}
 }
 
+// handlePing answers a health check: PING [client_time]. With the time
+// the client sent the command, the response includes the latency.
+func (s *Server) handlePing(conn net.Conn, args []string) {
+	now := time.Now().UTC()
+	ping := metrics.Ping{ServerTime: now}
+
+	if len(args) > 1 {
+		s.writeError(conn, fmt.Sprintf("unexpected argument: %s", args[1]))
+		return
+	}
+	if len(args) == 1 {
+		sent, err := time.Parse(time.RFC3339Nano, args[0])
+		if err != nil {
+			s.writeError(conn, fmt.Sprintf("invalid client time: %s", args[0]))
+			return
+		}
+		latency := float64(now.Sub(sent).Microseconds()) / 1000
+		ping.LatencyMs = &latency
+	}
+
+	data, err := s.encode(ping)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal ping: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleInfo describes the protocol, the optional features enabled and
+// the limits applied to requests
+func (s *Server) handleInfo(conn net.Conn) {
+	data, err := s.encode(s.info())
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal info: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// info returns what INFO reports
+func (s *Server) info() metrics.ServerInfo {
+	features := []string{}
+	if s.proxy != nil {
+		features = append(features, "proxy")
+	}
+	if s.mempool != nil {
+		features = append(features, "mempool")
+	}
+	if s.blocks != nil {
+		features = append(features, "blocks")
+	}
+	if _, ok := s.storage.(storage.Annotator); ok {
+		features = append(features, "annotations")
+	}
+	if _, ok := s.storage.(storage.Archiver); ok {
+		features = append(features, "backup")
+	}
+	if s.config != nil {
+		features = append(features, "discovery")
+	}
+	if s.httpConfig != nil {
+		features = append(features, "http")
+	}
+	if s.tcpConfig != nil {
+		features = append(features, "tcp")
+	}
+
+	return metrics.ServerInfo{
+		ProtocolVersion: metrics.ProtocolVersion,
+		Version:         s.status.Version,
+		Commands:        []string{"GET", "PROXY", "ANNOTATE", "BACKUP", "PAUSE", "RESUME", "PING", "INFO"},
+		Features:        features,
+		Limits: metrics.ServerLimits{
+			RequestTimeoutSeconds:    int(s.limits.timeout.Seconds()),
+			MaxConnections:           cap(s.limits.slots),
+			MaxRequestBytes:          s.limits.maxRequestBytes,
+			RateLimitPerMinute:       s.limits.ratePerMinute,
+			BackupIdleTimeoutSeconds: int(backupIdleTimeout.Seconds()),
+			DiffSearchWindowSeconds:  int(diffSearchWindow.Seconds()),
+			MaxTopResults:            maxTopResults,
+		},
+	}
+}
+
 // handleGet handles GET commands
 func (s *Server) handleGet(conn net.Conn, args []string) {
 	if len(args) == 0 {
@@ -120,21 +377,62 @@ func (s *Server) handleGet(conn net.Conn, args []string) {
 	case "status":
 		s.handleGetStatus(conn)
 	case "current":
-		s.handleGetCurrent(conn)
+		s.handleGetCurrent(conn, args[1:])
 	case "metrics":
 		s.handleGetMetrics(conn, args[1:])
 	case "config":
 		s.handleGetConfig(conn)
+	case "annotations":
+		s.handleGetAnnotations(conn, args[1:])
+	case "diff":
+		s.handleGetDiff(conn, args[1:])
+	case "crossings":
+		s.handleGetCrossings(conn, args[1:])
+	case "top":
+		s.handleGetTop(conn, args[1:])
+	case "correlation":
+		s.handleGetCorrelation(conn, args[1:])
+	case "discovery":
+		s.handleGetDiscovery(conn, args[1:])
+	case "mempool":
+		s.handleGetMempool(conn)
+	case "blocks":
+		s.handleGetBlocks(conn, args[1:])
 	default:
 		s.writeError(conn, fmt.Sprintf("unknown GET subcommand: %s", subcommand))
 	}
 }
 
+// currentStatus returns a copy of the agent status with the live parts
+// filled in
+func (s *Server) currentStatus() metrics.AgentStatus {
+	s.statusMu.Lock()
+	status := *s.status
+	s.statusMu.Unlock()
+
+	status.UptimeSeconds = int64(time.Since(s.startTime).Seconds())
+	status.Paused = s.PauseState()
+	if s.jobs != nil {
+		status.Jobs = s.jobs.Jobs()
+	}
+	if reporter, ok := s.storage.(storage.CleanupReporter); ok {
+		cleanup := reporter.CleanupStats()
+		status.Cleanup = &cleanup
+	}
+	if reporter, ok := s.storage.(storage.StatsReporter); ok {
+		stats, err := reporter.StorageStats()
+		if err != nil {
+			logger.Warn("Failed to read storage statistics", "error", err)
+		}
+		status.Storage = stats
+	}
+	status.Socket = s.SocketHealth()
+	return status
+}
+
 // handleGetStatus returns agent status
 func (s *Server) handleGetStatus(conn net.Conn) {
-	s.status.UptimeSeconds = int64(time.Since(s.startTime).Seconds())
-
-	data, err := json.Marshal(s.status)
+	data, err := s.encode(s.currentStatus())
 	if err != nil {
 		s.writeError(conn, fmt.Sprintf("failed to marshal status: %v", err))
 		return
@@ -143,9 +441,16 @@ func (s *Server) handleGetStatus(conn net.Conn) {
 	conn.Write(append(data, '\n'))
 }
 
-// handleGetCurrent returns the most recent sample
-func (s *Server) handleGetCurrent(conn net.Conn) {
-	sample, err := s.storage.GetCurrent()
+// handleGetCurrent returns the most recent sample. "GET current human"
+// formats values that have a unit for people.
+func (s *Server) handleGetCurrent(conn net.Conn, args []string) {
+	human := len(args) > 0 && strings.EqualFold(args[0], "human")
+	if len(args) > 0 && !human {
+		s.writeError(conn, fmt.Sprintf("unknown GET current option: %s", args[0]))
+		return
+	}
+
+	sample, err := s.latestSample()
 	if err != nil {
 		s.writeError(conn, fmt.Sprintf("failed to get current sample: %v", err))
 		return
@@ -156,7 +461,10 @@ func (s *Server) handleGetCurrent(conn net.Conn) {
 		return
 	}
 
-	data, err := json.Marshal(sample)
+	data, err := s.encode(sample)
+	if err == nil && human {
+		data, err = query.Humanize(data)
+	}
 	if err != nil {
 		s.writeError(conn, fmt.Sprintf("failed to marshal sample: %v", err))
 		return
@@ -165,22 +473,293 @@ func (s *Server) handleGetCurrent(conn net.Conn) {
 	conn.Write(append(data, '\n'))
 }
 
+// latestSample returns the newest sample. One stored by an earlier run is
+// served until the first collection completes, copied and flagged as
+// stale with its age.
+func (s *Server) latestSample() (*metrics.Sample, error) {
+	sample, err := s.storage.GetCurrent()
+	if err != nil || sample == nil {
+		return sample, err
+	}
+	if !sample.Timestamp.Before(s.startTime) {
+		return sample, nil
+	}
+
+	stale := *sample
+	stale.Stale = true
+	stale.AgeSeconds = int64(time.Since(sample.Timestamp).Seconds())
+	return &stale, nil
+}
+
 // handleGetMetrics returns historical metrics
 func (s *Server) handleGetMetrics(conn net.Conn, args []string) {
+	if len(args) < 1 {
+		s.writeError(conn, "GET metrics requires a start time (ISO8601, relative like -1h, or today)")
+		return
+	}
+
+	startTime, endTime, rest, err := parseTimeRange(args)
+	if err != nil {
+		s.writeError(conn, err.Error())
+		return
+	}
+
+	options, err := parseOptions(rest, "step", "agg", "fields", "hist")
+	if err != nil {
+		s.writeError(conn, err.Error())
+		return
+	}
+
+	fields := query.ParseFields(options["fields"])
+
+	var result interface{}
+	if stepValue, ok := options["step"]; ok {
+		step, err := parseRelativeDuration(stepValue)
+		if err != nil || step <= 0 {
+			s.writeError(conn, fmt.Sprintf("invalid step: %s", stepValue))
+			return
+		}
+		if step < minMetricsStep {
+			s.writeError(conn, fmt.Sprintf("step must be at least %s", minMetricsStep))
+			return
+		}
+		if endTime.Sub(startTime)/step > queryCacheBuckets {
+			s.writeError(conn, fmt.Sprintf("step %s is too fine for the range; at most %d buckets are returned", stepValue, queryCacheBuckets))
+			return
+		}
+
+		aggs, err := query.ParseAggregations(options["agg"])
+		if err != nil {
+			s.writeError(conn, err.Error())
+			return
+		}
+
+		var histEdges []float64
+		if histValue, ok := options["hist"]; ok {
+			histEdges, err = query.ParseHistogramEdges(histValue)
+			if err != nil {
+				s.writeError(conn, err.Error())
+				return
+			}
+		}
+
+		// Steps already over are served from the cache
+		key := query.CacheKey(step, aggs, histEdges, fields)
+		buckets, err := s.queryCache.Aggregate(key, step, startTime, endTime, func(start, end time.Time) ([]*query.Bucket, error) {
+			samples, err := s.storage.Query(start, end)
+			if err != nil {
+				return nil, err
+			}
+			buckets := query.Aggregate(samples, step, aggs, histEdges)
+			if len(fields) > 0 {
+				query.FilterBuckets(buckets, fields)
+			}
+			return buckets, nil
+		})
+		if err != nil {
+			s.writeError(conn, fmt.Sprintf("failed to query metrics: %v", err))
+			return
+		}
+		result = buckets
+	} else if _, ok := options["agg"]; ok {
+		s.writeError(conn, "agg requires step")
+		return
+	} else if _, ok := options["hist"]; ok {
+		s.writeError(conn, "hist requires step")
+		return
+	} else {
+		samples, err := s.storage.Query(startTime, endTime)
+		if err != nil {
+			s.writeError(conn, fmt.Sprintf("failed to query metrics: %v", err))
+			return
+		}
+		result = samples
+		if len(fields) > 0 {
+			selected := make([]map[string]interface{}, 0, len(samples))
+			for _, sample := range samples {
+				selected = append(selected, query.SelectFields(sample, fields))
+			}
+			result = selected
+		}
+	}
+
+	data, err := s.encode(result)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal samples: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleGetAnnotations returns operator notes within a time range
+func (s *Server) handleGetAnnotations(conn net.Conn, args []string) {
+	if len(args) < 1 {
+		s.writeError(conn, "GET annotations requires a start time (ISO8601, relative like -1h, or today)")
+		return
+	}
+
+	startTime, endTime, _, err := parseTimeRange(args)
+	if err != nil {
+		s.writeError(conn, err.Error())
+		return
+	}
+
+	annotator, ok := s.storage.(storage.Annotator)
+	if !ok {
+		s.writeError(conn, "storage backend does not support annotations")
+		return
+	}
+
+	annotations, err := annotator.Annotations(startTime, endTime)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to query annotations: %v", err))
+		return
+	}
+	if annotations == nil {
+		annotations = []*metrics.Annotation{}
+	}
+
+	data, err := s.encode(annotations)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal annotations: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleAnnotate records an operator note: ANNOTATE <time|now> <text>
+func (s *Server) handleAnnotate(conn net.Conn, args []string) {
 	if len(args) < 2 {
-		s.writeError(conn, "GET metrics requires start and end time (ISO8601)")
+		s.writeError(conn, "ANNOTATE requires a time (ISO8601, relative like -10m, or now) and text")
+		return
+	}
+
+	now := time.Now().UTC()
+	annotationTime, err := parseTimeBound(args[0], now)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("invalid time: %v", err))
+		return
+	}
+
+	annotation := &metrics.Annotation{
+		Time:      annotationTime.UTC(),
+		Text:      strings.Join(args[1:], " "),
+		CreatedAt: now,
+	}
+
+	annotator, ok := s.storage.(storage.Annotator)
+	if !ok {
+		s.writeError(conn, "storage backend does not support annotations")
+		return
+	}
+
+	if err := annotator.AddAnnotation(annotation); err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to record annotation: %v", err))
+		return
+	}
+
+	data, err := s.encode(annotation)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal annotation: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleBackup streams a tar archive of the stored metrics. Unlike other
+// commands the response is not JSON, except for an error reported before
+// the archive starts.
+func (s *Server) handleBackup(conn net.Conn) {
+	archiver, ok := s.storage.(storage.Archiver)
+	if !ok {
+		s.writeError(conn, "storage backend does not support backups")
+		return
+	}
+
+	info, err := archiver.Backup(&idleDeadlineWriter{conn: conn, timeout: backupIdleTimeout})
+	if err != nil {
+		// The client sees a truncated archive
+		logger.Warn("Backup failed", "error", err)
+		return
+	}
+	logger.Info("Backup sent", "files", info.Files, "bytes", info.Bytes)
+}
+
+// idleDeadlineWriter extends the write deadline of a connection before each
+// write, so a long transfer only fails if it stalls
+type idleDeadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *idleDeadlineWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.conn.Write(p)
+}
+
+// handleGetDiff compares the samples nearest to two points in time
+func (s *Server) handleGetDiff(conn net.Conn, args []string) {
+	if len(args) != 2 {
+		s.writeError(conn, "GET diff requires two times (ISO8601 or relative like -1d)")
+		return
+	}
+
+	now := time.Now().UTC()
+	var nearest [2]*metrics.Sample
+	for i, arg := range args {
+		t, err := parseTimeBound(arg, now)
+		if err != nil {
+			s.writeError(conn, fmt.Sprintf("invalid time %q: %v", arg, err))
+			return
+		}
+
+		samples, err := s.storage.Query(t.Add(-diffSearchWindow), t.Add(diffSearchWindow))
+		if err != nil {
+			s.writeError(conn, fmt.Sprintf("failed to query metrics: %v", err))
+			return
+		}
+
+		nearest[i] = query.Nearest(samples, t)
+		if nearest[i] == nil {
+			s.writeError(conn, fmt.Sprintf("no samples within %v of %s", diffSearchWindow, t.Format(time.RFC3339)))
+			return
+		}
+	}
+
+	data, err := s.encode(query.Diff(nearest[0], nearest[1]))
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal diff: %v", err))
 		return
 	}
 
-	startTime, err := time.Parse(time.RFC3339, args[0])
+	conn.Write(append(data, '\n'))
+}
+
+// handleGetCrossings lists threshold crossings of a field within a range:
+// GET crossings <field> <threshold> <start> [end]
+func (s *Server) handleGetCrossings(conn net.Conn, args []string) {
+	if len(args) < 3 {
+		s.writeError(conn, "GET crossings requires field, threshold and start time")
+		return
+	}
+
+	field := args[0]
+	threshold, err := strconv.ParseFloat(args[1], 64)
 	if err != nil {
-		s.writeError(conn, fmt.Sprintf("invalid start time: %v", err))
+		s.writeError(conn, fmt.Sprintf("invalid threshold: %s", args[1]))
 		return
 	}
 
-	endTime, err := time.Parse(time.RFC3339, args[1])
+	startTime, endTime, rest, err := parseTimeRange(args[2:])
 	if err != nil {
-		s.writeError(conn, fmt.Sprintf("invalid end time: %v", err))
+		s.writeError(conn, err.Error())
+		return
+	}
+	if len(rest) > 0 {
+		s.writeError(conn, fmt.Sprintf("unexpected argument: %s", rest[0]))
 		return
 	}
 
@@ -190,19 +769,233 @@ func (s *Server) handleGetMetrics(conn net.Conn, args []string) {
 		return
 	}
 
-	data, err := json.Marshal(samples)
+	data, err := s.encode(query.Crossings(samples, field, threshold))
 	if err != nil {
-		s.writeError(conn, fmt.Sprintf("failed to marshal samples: %v", err))
+		s.writeError(conn, fmt.Sprintf("failed to marshal crossings: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleGetTop returns the samples with the highest values of a field:
+// GET top <field> <n> <start> [end]
+func (s *Server) handleGetTop(conn net.Conn, args []string) {
+	if len(args) < 3 {
+		s.writeError(conn, "GET top requires field, count and start time")
+		return
+	}
+
+	field := args[0]
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 || n > maxTopResults {
+		s.writeError(conn, fmt.Sprintf("invalid count: %s (1-%d)", args[1], maxTopResults))
+		return
+	}
+
+	startTime, endTime, rest, err := parseTimeRange(args[2:])
+	if err != nil {
+		s.writeError(conn, err.Error())
+		return
+	}
+	if len(rest) > 0 {
+		s.writeError(conn, fmt.Sprintf("unexpected argument: %s", rest[0]))
+		return
+	}
+
+	samples, err := s.storage.Query(startTime, endTime)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to query metrics: %v", err))
+		return
+	}
+
+	data, err := s.encode(query.Top(samples, field, n))
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal results: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleGetCorrelation correlates two fields over a range:
+// GET correlation <field_a> <field_b> <start> [end]
+func (s *Server) handleGetCorrelation(conn net.Conn, args []string) {
+	if len(args) < 3 {
+		s.writeError(conn, "GET correlation requires two fields and a start time")
+		return
+	}
+
+	startTime, endTime, rest, err := parseTimeRange(args[2:])
+	if err != nil {
+		s.writeError(conn, err.Error())
+		return
+	}
+	if len(rest) > 0 {
+		s.writeError(conn, fmt.Sprintf("unexpected argument: %s", rest[0]))
+		return
+	}
+
+	samples, err := s.storage.Query(startTime, endTime)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to query metrics: %v", err))
+		return
+	}
+
+	data, err := s.encode(query.Correlate(samples, args[0], args[1]))
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal correlation: %v", err))
 		return
 	}
 
 	conn.Write(append(data, '\n'))
 }
 
-// handleGetConfig returns current configuration (placeholder)
+// handleGetDiscovery returns Zabbix low-level discovery JSON:
+// GET discovery <kind>
+func (s *Server) handleGetDiscovery(conn net.Conn, args []string) {
+	if len(args) != 1 {
+		s.writeError(conn, fmt.Sprintf("GET discovery requires a kind (%s)", strings.Join(zabbix.DiscoveryKinds(), ", ")))
+		return
+	}
+	if s.config == nil {
+		s.writeError(conn, "configuration not available")
+		return
+	}
+
+	sample, err := s.storage.GetCurrent()
+	if err != nil {
+		sample = nil // Discovery from configuration alone is still useful
+	}
+
+	rows, err := zabbix.Discover(strings.ToLower(args[0]), s.config, sample)
+	if err != nil {
+		s.writeError(conn, err.Error())
+		return
+	}
+
+	data, err := s.encode(map[string]interface{}{"data": rows})
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal discovery: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleGetMempool returns a fresh fee distribution of the node's mempool
+func (s *Server) handleGetMempool(conn net.Conn) {
+	if s.mempool == nil {
+		s.writeError(conn, "mempool snapshot not available")
+		return
+	}
+
+	snapshot, err := s.mempool.MempoolSnapshot(context.Background())
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to get mempool snapshot: %v", err))
+		return
+	}
+
+	data, err := s.encode(snapshot)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal mempool snapshot: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleGetBlocks summarizes block intervals over a range:
+// GET blocks <start> [end]
+func (s *Server) handleGetBlocks(conn net.Conn, args []string) {
+	if s.blocks == nil {
+		s.writeError(conn, "block intervals not available")
+		return
+	}
+
+	startTime, endTime, rest, err := parseTimeRange(args)
+	if err != nil {
+		s.writeError(conn, err.Error())
+		return
+	}
+	if len(rest) > 0 {
+		s.writeError(conn, fmt.Sprintf("unexpected argument: %s", rest[0]))
+		return
+	}
+
+	stats, err := s.blocks.BlockIntervalStats(startTime, endTime)
+	if err != nil {
+		s.writeError(conn, err.Error())
+		return
+	}
+
+	data, err := s.encode(stats)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal block intervals: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleGetConfig returns the running configuration with credentials removed
 func (s *Server) handleGetConfig(conn net.Conn) {
-	// TODO: Return actual config
-	conn.Write([]byte("{}\n"))
+	if s.config == nil {
+		conn.Write([]byte("{}\n"))
+		return
+	}
+
+	data, err := s.encode(s.config.Redacted())
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal config: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// handleProxy forwards an allowlisted RPC through the agent's node connection
+func (s *Server) handleProxy(conn net.Conn, args []string) {
+	if s.proxy == nil {
+		s.writeError(conn, "proxy not available")
+		return
+	}
+
+	if len(args) == 0 {
+		s.writeError(conn, "PROXY requires an RPC method")
+		return
+	}
+
+	result, err := s.proxy.Proxy(args[0], args[1:])
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("proxy failed: %v", err))
+		return
+	}
+
+	data, err := s.encode(map[string]json.RawMessage{"result": result})
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal result: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
+}
+
+// writePauseState writes whether collection is currently paused
+func (s *Server) writePauseState(conn net.Conn) {
+	resp := struct {
+		Paused bool `json:"paused"`
+		*metrics.PauseInfo
+	}{PauseInfo: s.PauseState()}
+	resp.Paused = resp.PauseInfo != nil
+
+	data, err := s.encode(resp)
+	if err != nil {
+		s.writeError(conn, fmt.Sprintf("failed to marshal pause state: %v", err))
+		return
+	}
+
+	conn.Write(append(data, '\n'))
 }
 
 // writeError writes an error response
@@ -210,21 +1003,130 @@ func (s *Server) writeError(conn net.Conn, message string) {
 	errResp := map[string]string{
 		"error": message,
 	}
-	data, _ := json.Marshal(errResp)
+	data, _ := s.encode(errResp)
 	conn.Write(append(data, '\n'))
 }
 
+// SetRPCProxy enables the PROXY command using the given proxy
+func (s *Server) SetRPCProxy(proxy RPCProxy) {
+	s.proxy = proxy
+}
+
+// SetMempoolSource enables GET mempool using the given source
+func (s *Server) SetMempoolSource(source MempoolSource) {
+	s.mempool = source
+}
+
+// SetBlockStatsSource enables GET blocks using the given source
+func (s *Server) SetBlockStatsSource(source BlockStatsSource) {
+	s.blocks = source
+}
+
+// SetConfig sets the configuration returned by GET config
+func (s *Server) SetConfig(cfg *config.Config) {
+	s.config = cfg
+}
+
+// SetJobLister includes maintenance job status in GET status
+func (s *Server) SetJobLister(jobs JobLister) {
+	s.jobs = jobs
+}
+
+// Pause stops collection until Resume is called; the query server keeps running
+func (s *Server) Pause(reason string) {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.pause != nil {
+		return
+	}
+	s.pause = &metrics.PauseInfo{
+		Reason: reason,
+		Since:  time.Now().UTC(),
+	}
+	logger.Info("Collection paused", "reason", reason)
+}
+
+// Resume restarts collection after Pause
+func (s *Server) Resume() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.pause != nil {
+		logger.Info("Collection resumed", "duration", time.Since(s.pause.Since).Round(time.Second))
+	}
+	s.pause = nil
+}
+
+// PauseState returns the current pause, or nil if collection is running
+func (s *Server) PauseState() *metrics.PauseInfo {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.pause == nil {
+		return nil
+	}
+	pause := *s.pause
+	return &pause
+}
+
 // UpdateStatus updates the agent status
 func (s *Server) UpdateStatus(collectionCount, errorCount int64, lastCollectionTime time.Time) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
 	s.status.CollectionCount = collectionCount
 	s.status.ErrorCount = errorCount
 	s.status.LastCollectionTime = lastCollectionTime
 }
 
-// Stop stops the server
-func (s *Server) Stop() error {
+// InvalidateQueryCache drops the cached GET metrics results that a sample
+// just written at t would change; call it after every write
+func (s *Server) InvalidateQueryCache(t time.Time) {
+	s.queryCache.Invalidate(t)
+}
+
+// Events returns the hub that pushes live updates to WebSocket clients
+func (s *Server) Events() *EventHub {
+	return s.events
+}
+
+// Shutdown stops accepting connections, disconnects WebSocket clients and
+// waits for in-flight requests to finish or ctx to expire. The socket file
+// is removed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopSocketWatchdog()
+	s.health.mu.Lock()
 	if s.listener != nil {
-		return s.listener.Close()
+		s.listener.Close()
 	}
-	return nil
+	s.health.mu.Unlock()
+	if s.tcpListener != nil {
+		s.tcpListener.Close()
+	}
+	s.events.close()
+
+	var err error
+	if s.httpServer != nil {
+		if err = s.httpServer.Shutdown(ctx); err != nil {
+			s.httpServer.Close()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("abandoned in-flight socket requests: %w", ctx.Err())
+	}
+
+	if isUnixSocket(s.socketPath) {
+		os.Remove(s.socketPath)
+	}
+
+	return err
 }
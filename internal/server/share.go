@@ -0,0 +1,221 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/redact"
+)
+
+// shareKeyName is the identity handlers see for requests made with a
+// share link
+const shareKeyName = "share-link"
+
+// shareSecretFile holds the key share links are signed with, in the data
+// directory, so links survive restarts until it is rotated
+const shareSecretFile = "share_secret"
+
+// defaultShareTTL is the lifetime of a link minted without a ttl
+const defaultShareTTL = 24 * time.Hour
+
+// shareRateLimit caps requests per minute across all share links
+const shareRateLimit = 60
+
+// sharePaths are the endpoints a share link opens: the latest state only,
+// with no history, configuration, live stream or controls
+var sharePaths = map[string]bool{
+	"/api/v1/current": true,
+	"/api/v1/summary": true,
+}
+
+// shareLinks mints and verifies share tokens. A token is
+// "<expiry unix>.<nonce>.<signature>", signed with HMAC-SHA256.
+type shareLinks struct {
+	path   string
+	maxTTL time.Duration
+
+	redaction *redact.Profile
+	bucket    *tokenBucket
+
+	mu     sync.RWMutex
+	secret []byte
+}
+
+// newShareLinks loads the signing secret from dataDir, creating it on
+// first use
+func newShareLinks(cfg config.ShareLinksConfig, dataDir string, profiles map[string]config.RedactionProfile) (*shareLinks, error) {
+	links := &shareLinks{
+		path:   filepath.Join(dataDir, shareSecretFile),
+		maxTTL: time.Duration(cfg.MaxTTLHours) * time.Hour,
+		bucket: newTokenBucket(shareRateLimit),
+	}
+	if cfg.RedactionProfile != "" {
+		links.redaction = redact.New(profiles[cfg.RedactionProfile])
+	}
+
+	data, err := os.ReadFile(links.path)
+	switch {
+	case err == nil:
+		if links.secret, err = hex.DecodeString(strings.TrimSpace(string(data))); err != nil || len(links.secret) < 32 {
+			return nil, fmt.Errorf("invalid share link secret in %s", links.path)
+		}
+	case os.IsNotExist(err):
+		if err := links.rotate(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("failed to read share link secret: %w", err)
+	}
+	return links, nil
+}
+
+// rotate replaces the signing secret, invalidating every issued link
+func (l *shareLinks) rotate() error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate share link secret: %w", err)
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(hex.EncodeToString(secret)+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write share link secret: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write share link secret: %w", err)
+	}
+
+	l.mu.Lock()
+	l.secret = secret
+	l.mu.Unlock()
+	return nil
+}
+
+// sign returns the signature of a token's payload
+func (l *shareLinks) sign(payload string) string {
+	l.mu.RLock()
+	mac := hmac.New(sha256.New, l.secret)
+	l.mu.RUnlock()
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// mint issues a token valid until expires
+func (l *shareLinks) mint(expires time.Time) (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate share link: %w", err)
+	}
+	payload := strconv.FormatInt(expires.Unix(), 10) + "." + hex.EncodeToString(nonce)
+	return payload + "." + l.sign(payload), nil
+}
+
+// valid reports whether token was signed with the current secret and has
+// not expired
+func (l *shareLinks) valid(token string, now time.Time) bool {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return false
+	}
+	payload, signature := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(l.sign(payload))) {
+		return false
+	}
+
+	expiry, _, _ := strings.Cut(payload, ".")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && now.Unix() < unix
+}
+
+// shareResponse is the body returned when a share link is created
+type shareResponse struct {
+	Token   string            `json:"token"`
+	Expires time.Time         `json:"expires"`
+	Links   map[string]string `json:"links"` // Shared endpoint paths with the token appended
+}
+
+// handleCreateShare mints a share link lasting the ttl query parameter,
+// a Go duration such as "2h", capped at max_ttl_hours
+func (s *Server) handleCreateShare(w http.ResponseWriter, r *http.Request, keyName string) {
+	if s.shares == nil {
+		writeHTTPError(w, http.StatusNotFound, "share links are not enabled")
+		return
+	}
+
+	ttl := defaultShareTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Sprintf("invalid ttl %q", v))
+			return
+		}
+	}
+	if ttl > s.shares.maxTTL {
+		ttl = s.shares.maxTTL
+	}
+
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	token, err := s.shares.mint(expires)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Info("HTTP share link created", "api_key", keyName, "expires", expires)
+
+	links := make(map[string]string, len(sharePaths))
+	for path := range sharePaths {
+		links[strings.TrimPrefix(path, "/api/v1/")] = path + "?share=" + token
+	}
+	s.writeVersionedJSON(w, r, shareResponse{Token: token, Expires: expires, Links: links}, time.Time{})
+}
+
+// handleRevokeShares rotates the signing secret, so every link issued so
+// far stops working
+func (s *Server) handleRevokeShares(w http.ResponseWriter, r *http.Request, keyName string) {
+	if s.shares == nil {
+		writeHTTPError(w, http.StatusNotFound, "share links are not enabled")
+		return
+	}
+	if err := s.shares.rotate(); err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Info("HTTP share links revoked", "api_key", keyName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveShare runs handler for a request carrying a valid share link to a
+// shared endpoint. It reports false, having written nothing, when the
+// request does not use a share link.
+func (s *Server) serveShare(w http.ResponseWriter, r *http.Request, handler func(http.ResponseWriter, *http.Request, string)) bool {
+	token := r.URL.Query().Get("share")
+	if s.shares == nil || token == "" || !sharePaths[r.URL.Path] {
+		return false
+	}
+
+	if !s.shares.valid(token, time.Now()) {
+		logger.Warn("HTTP request rejected: invalid or expired share link", "path", r.URL.Path, "remote", r.RemoteAddr)
+		writeHTTPError(w, http.StatusUnauthorized, "share link is invalid or has expired")
+		return true
+	}
+	if wait, ok := s.shares.bucket.take(shareRateLimit); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		writeHTTPError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return true
+	}
+
+	handler(w, r, shareKeyName)
+	return true
+}
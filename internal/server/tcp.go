@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+)
+
+// EnableTCP serves the socket protocol over TLS on cfg.ListenAddr as well
+// when the server starts
+func (s *Server) EnableTCP(cfg config.QueryTCPConfig) {
+	s.tcpConfig = &cfg
+	s.tcpKeys = newAPIKeys(cfg.APIKeys, nil)
+}
+
+// startTCP starts the TLS listener
+func (s *Server) startTCP() error {
+	cert, err := tls.LoadX509KeyPair(s.tcpConfig.CertFile, s.tcpConfig.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load query_tcp certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if s.tcpConfig.ClientCAFile != "" {
+		pem, err := os.ReadFile(s.tcpConfig.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read query_tcp client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in query_tcp client CA file %s", s.tcpConfig.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	allowed, err := parseAllowlist(s.tcpConfig.AllowedIPs)
+	if err != nil {
+		return err
+	}
+
+	addr := s.tcpConfig.ListenAddr
+	if s.tcpConfig.OnionOnly {
+		if addr, err = onionOnlyAddr(addr); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on query_tcp address: %w", err)
+	}
+	s.tcpListener = tls.NewListener(newAllowlistListener(listener, allowed), tlsConfig)
+	logger.Info("TLS query listener started", "addr", listener.Addr().String(),
+		"api_keys", len(s.tcpKeys), "client_certificates", s.tcpConfig.ClientCAFile != "")
+
+	go s.acceptTCP(s.tcpListener)
+	return nil
+}
+
+// acceptTCP handles TLS connections until listener is closed. Failures do
+// not count against the health of the query socket.
+func (s *Server) acceptTCP(listener net.Listener) {
+	failures := 0
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			failures++
+			logger.Warn("Failed to accept TLS connection", "error", err)
+			time.Sleep(acceptBackoff(failures))
+			continue
+		}
+		failures = 0
+
+		if !s.acquireConn(conn) {
+			continue
+		}
+		s.handlers.Add(1)
+		go func() {
+			defer s.handlers.Done()
+			defer s.releaseConn()
+			s.handleTCPConnection(conn)
+		}()
+	}
+}
+
+// handleTCPConnection authenticates a TLS client and then serves its
+// command within the scopes of its key. The handshake has checked client
+// certificates already. With API keys, the first line must be
+// "AUTH <key>"; without them, certificate holders get read-metrics.
+func (s *Server) handleTCPConnection(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.limits.timeout))
+
+	// Before authentication, so guessing keys is limited too
+	if !s.allowClient(conn) {
+		s.writeError(conn, "rate limit exceeded")
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	if len(s.tcpKeys) == 0 {
+		s.serveCommand(conn, reader, &apiKey{
+			name:   anonymousKey,
+			scopes: map[string]bool{config.ScopeReadMetrics: true},
+		})
+		return
+	}
+
+	line, err := s.readRequestLine(reader)
+	if err != nil {
+		logger.Warn("Failed to read from TLS connection", "remote", conn.RemoteAddr().String(), "error", err)
+		return
+	}
+
+	presented, ok := strings.CutPrefix(strings.TrimSpace(line), "AUTH ")
+	key := s.lookupTCPKey(strings.TrimSpace(presented))
+	if !ok || key == nil {
+		logger.Warn("TLS query rejected: missing or unknown API key", "remote", conn.RemoteAddr().String())
+		s.writeError(conn, "authentication required")
+		return
+	}
+	if _, ok := key.take(); !ok {
+		s.writeError(conn, "rate limit exceeded")
+		return
+	}
+
+	s.serveCommand(conn, reader, key)
+}
+
+// commandScope returns the API key scope a socket command needs. Reads
+// need read-metrics, the configuration read-config, and commands that
+// change state, reach the node or export the data directory admin.
+func commandScope(command string, args []string) string {
+	switch command {
+	case "GET":
+		if len(args) > 0 && strings.EqualFold(args[0], "config") {
+			return config.ScopeReadConfig
+		}
+		return config.ScopeReadMetrics
+	case "PING", "INFO":
+		return config.ScopeReadMetrics
+	default:
+		return config.ScopeAdmin
+	}
+}
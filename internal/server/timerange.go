@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTimeRange parses the start and optional end of a query range from
+// args and returns the remaining arguments. Each bound may be an RFC3339
+// timestamp, "now", or a relative offset such as "-1h", "-90m", "-2d" or
+// "-1w". The keywords "today" and "yesterday" expand to a whole UTC day
+// (today ends now). When only a start is given, the range ends now.
+func parseTimeRange(args []string) (time.Time, time.Time, []string, error) {
+	if len(args) == 0 {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("missing start time")
+	}
+
+	now := time.Now().UTC()
+	midnight := now.Truncate(24 * time.Hour)
+
+	switch strings.ToLower(args[0]) {
+	case "today":
+		return midnight, now, args[1:], nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), midnight, args[1:], nil
+	}
+
+	startTime, err := parseTimeBound(args[0], now)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("invalid start time: %w", err)
+	}
+
+	endTime := now
+	rest := args[1:]
+	if len(rest) > 0 && !strings.Contains(rest[0], "=") {
+		endTime, err = parseTimeBound(rest[0], now)
+		if err != nil {
+			return time.Time{}, time.Time{}, nil, fmt.Errorf("invalid end time: %w", err)
+		}
+		rest = rest[1:]
+	}
+
+	if endTime.Before(startTime) {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("end time is before start time")
+	}
+
+	return startTime, endTime, rest, nil
+}
+
+// ParseTimeRange parses a start and an optional end in the form the query
+// socket accepts, for commands that read the stored metrics themselves
+func ParseTimeRange(start, end string) (time.Time, time.Time, error) {
+	args := []string{start}
+	if end != "" {
+		args = append(args, end)
+	}
+
+	startTime, endTime, rest, err := parseTimeRange(args)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if len(rest) > 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s is a whole day and takes no end time", start)
+	}
+	return startTime, endTime, nil
+}
+
+// parseOptions parses trailing key=value query options, rejecting keys that
+// are not in allowed
+func parseOptions(args []string, allowed ...string) (map[string]string, error) {
+	options := make(map[string]string, len(args))
+
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid option %q, expected key=value", arg)
+		}
+
+		key = strings.ToLower(key)
+		known := false
+		for _, a := range allowed {
+			if key == a {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown option: %s", key)
+		}
+
+		options[key] = value
+	}
+
+	return options, nil
+}
+
+// parseTimeBound parses a single absolute or relative time
+func parseTimeBound(value string, now time.Time) (time.Time, error) {
+	if strings.EqualFold(value, "now") {
+		return now, nil
+	}
+
+	if strings.HasPrefix(value, "-") {
+		d, err := parseRelativeDuration(value[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseRelativeDuration extends time.ParseDuration with day ("d") and week
+// ("w") units, which are the natural way to ask for longer windows
+func parseRelativeDuration(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			count, err := strconv.ParseFloat(n, 64)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			return time.Duration(count * float64(unit)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
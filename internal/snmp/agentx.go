@@ -0,0 +1,304 @@
+package snmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// AgentX PDU types (RFC 2741 section 6.1)
+const (
+	pduOpen       = 1
+	pduClose      = 2
+	pduRegister   = 3
+	pduGet        = 5
+	pduGetNext    = 6
+	pduGetBulk    = 7
+	pduTestSet    = 8
+	pduCommitSet  = 9
+	pduUndoSet    = 10
+	pduCleanupSet = 11
+	pduResponse   = 18
+)
+
+// Header flags
+const (
+	flagNonDefaultContext = 0x08
+	flagNetworkByteOrder  = 0x10
+)
+
+// headerSize is the fixed AgentX header length
+const headerSize = 20
+
+// maxPayload bounds PDUs accepted from the master agent
+const maxPayload = 1 << 20
+
+// Varbind value types
+const (
+	typeInteger      = 2
+	typeOctetString  = 4
+	typeNull         = 5
+	typeGauge32      = 66
+	typeTimeTicks    = 67
+	typeCounter64    = 70
+	typeNoSuchObject = 128
+	typeEndOfMibView = 130
+)
+
+// Response error codes
+const (
+	errNone        = 0
+	errNotWritable = 17
+)
+
+// oid is an object identifier as a list of sub-identifiers
+type oid []uint32
+
+// parseOID parses dotted notation such as "1.3.6.1.4.1.8072"
+func parseOID(s string) (oid, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), ".")
+	if s == "" {
+		return nil, fmt.Errorf("empty OID")
+	}
+
+	parts := strings.Split(s, ".")
+	result := make(oid, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q: %w", s, err)
+		}
+		result[i] = uint32(n)
+	}
+	return result, nil
+}
+
+// String formats the OID in dotted notation
+func (o oid) String() string {
+	parts := make([]string, len(o))
+	for i, n := range o {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// compare orders OIDs lexicographically
+func (o oid) compare(other oid) int {
+	for i := 0; i < len(o) && i < len(other); i++ {
+		if o[i] < other[i] {
+			return -1
+		}
+		if o[i] > other[i] {
+			return 1
+		}
+	}
+	switch {
+	case len(o) < len(other):
+		return -1
+	case len(o) > len(other):
+		return 1
+	}
+	return 0
+}
+
+// header is the fixed part of every PDU
+type header struct {
+	Type          byte
+	Flags         byte
+	SessionID     uint32
+	TransactionID uint32
+	PacketID      uint32
+}
+
+// varbind is a name/value pair in a response
+type varbind struct {
+	name  oid
+	vtype uint16
+	value interface{} // int32, uint32, uint64, string, or nil
+}
+
+// encoder builds a PDU payload in network byte order
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint16(v uint16) { binary.Write(&e.buf, binary.BigEndian, v) }
+func (e *encoder) uint32(v uint32) { binary.Write(&e.buf, binary.BigEndian, v) }
+func (e *encoder) uint64(v uint64) { binary.Write(&e.buf, binary.BigEndian, v) }
+
+// oid encodes an OID, using the 1.3.6.1 prefix compression when possible
+func (e *encoder) oid(o oid, include bool) {
+	prefix := byte(0)
+	subids := o
+	if len(o) >= 5 && o[0] == 1 && o[1] == 3 && o[2] == 6 && o[3] == 1 && o[4] > 0 && o[4] < 256 {
+		prefix = byte(o[4])
+		subids = o[5:]
+	}
+
+	inc := byte(0)
+	if include {
+		inc = 1
+	}
+	e.buf.Write([]byte{byte(len(subids)), prefix, inc, 0})
+	for _, n := range subids {
+		e.uint32(n)
+	}
+}
+
+// octetString encodes a length-prefixed string padded to 4 bytes
+func (e *encoder) octetString(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf.WriteString(s)
+	if pad := (4 - len(s)%4) % 4; pad > 0 {
+		e.buf.Write(make([]byte, pad))
+	}
+}
+
+// varbind encodes a name/value pair
+func (e *encoder) varbind(vb varbind) {
+	e.uint16(vb.vtype)
+	e.uint16(0)
+	e.oid(vb.name, false)
+
+	switch v := vb.value.(type) {
+	case int32:
+		e.uint32(uint32(v))
+	case uint32:
+		e.uint32(v)
+	case uint64:
+		e.uint64(v)
+	case string:
+		e.octetString(v)
+	}
+}
+
+// packet frames a payload with a header
+func packet(h header, payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{1, h.Type, h.Flags | flagNetworkByteOrder, 0})
+	binary.Write(&buf, binary.BigEndian, h.SessionID)
+	binary.Write(&buf, binary.BigEndian, h.TransactionID)
+	binary.Write(&buf, binary.BigEndian, h.PacketID)
+	binary.Write(&buf, binary.BigEndian, uint32(len(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// readPacket reads one PDU, returning its header, payload, and byte order
+func readPacket(r io.Reader) (header, []byte, binary.ByteOrder, error) {
+	raw := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return header{}, nil, nil, err
+	}
+	if raw[0] != 1 {
+		return header{}, nil, nil, fmt.Errorf("unsupported AgentX version %d", raw[0])
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if raw[2]&flagNetworkByteOrder != 0 {
+		order = binary.BigEndian
+	}
+
+	h := header{
+		Type:          raw[1],
+		Flags:         raw[2],
+		SessionID:     order.Uint32(raw[4:8]),
+		TransactionID: order.Uint32(raw[8:12]),
+		PacketID:      order.Uint32(raw[12:16]),
+	}
+
+	length := order.Uint32(raw[16:20])
+	if length > maxPayload {
+		return header{}, nil, nil, fmt.Errorf("PDU too large: %d bytes", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return header{}, nil, nil, err
+	}
+
+	return h, payload, order, nil
+}
+
+// decoder reads fields from a PDU payload
+type decoder struct {
+	data  []byte
+	order binary.ByteOrder
+	err   error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.err = fmt.Errorf("truncated PDU")
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.take(2); b != nil {
+		return d.order.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return d.order.Uint32(b)
+	}
+	return 0
+}
+
+// oid decodes an OID and its include flag
+func (d *decoder) oid() (oid, bool) {
+	b := d.take(4)
+	if b == nil {
+		return nil, false
+	}
+
+	n, prefix, include := int(b[0]), b[1], b[2] != 0
+	var o oid
+	if prefix != 0 {
+		o = oid{1, 3, 6, 1, uint32(prefix)}
+	}
+	for i := 0; i < n; i++ {
+		o = append(o, d.uint32())
+	}
+	return o, include
+}
+
+// octetString decodes a padded string
+func (d *decoder) octetString() string {
+	n := int(d.uint32())
+	b := d.take(n + (4-n%4)%4)
+	if b == nil {
+		return ""
+	}
+	return string(b[:n])
+}
+
+// searchRange is a start/end pair from Get, GetNext and GetBulk PDUs
+type searchRange struct {
+	start   oid
+	include bool
+	end     oid
+}
+
+// searchRanges decodes the remaining payload as a SearchRangeList
+func (d *decoder) searchRanges() []searchRange {
+	var ranges []searchRange
+	for len(d.data) > 0 && d.err == nil {
+		start, include := d.oid()
+		end, _ := d.oid()
+		ranges = append(ranges, searchRange{start: start, include: include, end: end})
+	}
+	return ranges
+}
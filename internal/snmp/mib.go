@@ -0,0 +1,161 @@
+package snmp
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// truthValue encodes a boolean as SNMPv2-TC TruthValue (1 = true, 2 = false)
+func truthValue(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 2
+}
+
+// gauge clamps a value into Gauge32 range
+func gauge(v float64) uint32 {
+	if v <= 0 || math.IsNaN(v) {
+		return 0
+	}
+	if v >= math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(v)
+}
+
+// scalar is one object under the base OID, served at instance .0
+type scalar struct {
+	sub   uint32
+	vtype uint16
+	// value returns the object's value, or false when the sample lacks it
+	value func(s *metrics.Sample, version string) (interface{}, bool)
+}
+
+// Objects under the base OID, each at instance .0:
+//
+//	1 blockHeight        Gauge32      10 chain               OCTET STRING
+//	2 headers            Gauge32      11 cpuPercent          Gauge32 (hundredths)
+//	3 blocksBehind       Gauge32      12 diskUsedPercent     Gauge32 (hundredths)
+//	4 peers              Gauge32      13 diskAvailBytes      Counter64
+//	5 inboundPeers       Gauge32      14 memoryAvailBytes    Counter64
+//	6 outboundPeers      Gauge32      15 torControlReachable TruthValue
+//	7 mempoolTxCount     Gauge32      16 torCircuits         Gauge32
+//	8 syncProgress       Gauge32      17 sampleAge           TimeTicks
+//	  (hundredths of a percent)       18 agentVersion        OCTET STRING
+//	9 initialBlockDownload TruthValue
+//
+// Sub-identifiers are part of the public interface; append new objects
+// rather than renumbering.
+var scalars = []scalar{
+	{1, typeGauge32, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return gauge(float64(b.BlockHeight)) })},
+	{2, typeGauge32, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return gauge(float64(b.Headers)) })},
+	{3, typeGauge32, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return gauge(float64(b.Headers - b.BlockHeight)) })},
+	{4, typeGauge32, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return gauge(float64(b.Peers)) })},
+	{5, typeGauge32, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return gauge(float64(b.InboundPeers)) })},
+	{6, typeGauge32, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return gauge(float64(b.OutboundPeers)) })},
+	{7, typeGauge32, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return gauge(float64(b.MempoolTxCount)) })},
+	{8, typeGauge32, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return gauge(b.SyncProgress * 10000) })}, // Hundredths of a percent
+	{9, typeInteger, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return truthValue(b.IBD) })},
+	{10, typeOctetString, bitcoinValue(func(b *metrics.BitcoinMetrics) interface{} { return b.Chain })},
+	{11, typeGauge32, systemValue(func(s *metrics.SystemMetrics) interface{} { return gauge(s.CPUPercent * 100) })}, // Hundredths of a percent
+	{12, typeGauge32, systemValue(func(s *metrics.SystemMetrics) interface{} {
+		if s.DiskTotalBytes == 0 {
+			return uint32(0)
+		}
+		return gauge(float64(s.DiskUsedBytes) / float64(s.DiskTotalBytes) * 10000) // Hundredths of a percent
+	})},
+	{13, typeCounter64, systemValue(func(s *metrics.SystemMetrics) interface{} { return uint64(max(s.DiskAvailBytes, 0)) })},
+	{14, typeCounter64, systemValue(func(s *metrics.SystemMetrics) interface{} { return uint64(max(s.MemoryAvailBytes, 0)) })},
+	{15, typeInteger, torValue(func(t *metrics.TorMetrics) interface{} { return truthValue(t.ControlReachable) })},
+	{16, typeGauge32, torValue(func(t *metrics.TorMetrics) interface{} { return gauge(float64(t.EstablishedCount)) })},
+	{17, typeTimeTicks, func(s *metrics.Sample, _ string) (interface{}, bool) {
+		return gauge(time.Since(s.Timestamp).Seconds() * 100), true // Age of the latest sample
+	}},
+	{18, typeOctetString, func(_ *metrics.Sample, version string) (interface{}, bool) { return version, true }},
+}
+
+func init() {
+	sort.Slice(scalars, func(i, j int) bool { return scalars[i].sub < scalars[j].sub })
+}
+
+func bitcoinValue(f func(*metrics.BitcoinMetrics) interface{}) func(*metrics.Sample, string) (interface{}, bool) {
+	return func(s *metrics.Sample, _ string) (interface{}, bool) {
+		if s.Bitcoin == nil {
+			return nil, false
+		}
+		return f(s.Bitcoin), true
+	}
+}
+
+func systemValue(f func(*metrics.SystemMetrics) interface{}) func(*metrics.Sample, string) (interface{}, bool) {
+	return func(s *metrics.Sample, _ string) (interface{}, bool) {
+		if s.System == nil {
+			return nil, false
+		}
+		return f(s.System), true
+	}
+}
+
+func torValue(f func(*metrics.TorMetrics) interface{}) func(*metrics.Sample, string) (interface{}, bool) {
+	return func(s *metrics.Sample, _ string) (interface{}, bool) {
+		if s.Tor == nil {
+			return nil, false
+		}
+		return f(s.Tor), true
+	}
+}
+
+// mibView is a snapshot of the objects available for one request
+type mibView struct {
+	base    oid
+	entries []varbind // Sorted by name
+}
+
+// newMIBView evaluates every scalar against the latest sample; objects the
+// sample lacks are left out, so walks skip them
+func newMIBView(base oid, sample *metrics.Sample, version string) *mibView {
+	view := &mibView{base: base}
+	if sample == nil {
+		sample = &metrics.Sample{}
+	}
+
+	for _, s := range scalars {
+		value, ok := s.value(sample, version)
+		if !ok {
+			continue
+		}
+		name := append(append(oid{}, base...), s.sub, 0)
+		view.entries = append(view.entries, varbind{name: name, vtype: s.vtype, value: value})
+	}
+	return view
+}
+
+// get returns the exact object, or noSuchObject
+func (v *mibView) get(name oid) varbind {
+	for _, entry := range v.entries {
+		if entry.name.compare(name) == 0 {
+			return entry
+		}
+	}
+	return varbind{name: name, vtype: typeNoSuchObject}
+}
+
+// next returns the first object after start (or at it, when include is
+// set) and before end, or endOfMibView
+func (v *mibView) next(r searchRange) varbind {
+	for _, entry := range v.entries {
+		c := entry.name.compare(r.start)
+		if c < 0 || (c == 0 && !r.include) {
+			continue
+		}
+		if len(r.end) > 0 && entry.name.compare(r.end) >= 0 {
+			break
+		}
+		return entry
+	}
+	return varbind{name: r.start, vtype: typeEndOfMibView}
+}
@@ -0,0 +1,290 @@
+// Package snmp exposes key metrics over SNMP as an AgentX (RFC 2741)
+// subagent of the host's master agent, such as net-snmp's snmpd with
+// "master agentx" enabled.
+package snmp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+var logger = logging.New("snmp")
+
+// reconnectDelay is how long to wait before reconnecting to the master
+const reconnectDelay = 30 * time.Second
+
+// requestTimeout bounds the Open and Register exchanges
+const requestTimeout = 10 * time.Second
+
+// Subagent registers the base OID with the master agent and answers its
+// Get, GetNext and GetBulk requests from the latest sample
+type Subagent struct {
+	network string
+	address string
+	base    oid
+	current func() (*metrics.Sample, error)
+	version string
+
+	mu   sync.Mutex
+	conn net.Conn
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSubagent creates a subagent; current returns the latest sample
+func NewSubagent(cfg config.SNMPConfig, current func() (*metrics.Sample, error), version string) (*Subagent, error) {
+	base, err := parseOID(cfg.BaseOID)
+	if err != nil {
+		return nil, err
+	}
+
+	network, address := "unix", cfg.MasterAddress
+	if addr, ok := strings.CutPrefix(cfg.MasterAddress, "tcp:"); ok {
+		network, address = "tcp", addr
+	} else if path, ok := strings.CutPrefix(cfg.MasterAddress, "unix:"); ok {
+		address = path
+	}
+
+	return &Subagent{
+		network: network,
+		address: address,
+		base:    base,
+		current: current,
+		version: version,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Start connects to the master agent in the background, reconnecting
+// whenever the session ends
+func (a *Subagent) Start() {
+	go func() {
+		defer close(a.done)
+		for {
+			err := a.session()
+			select {
+			case <-a.stop:
+				return
+			default:
+			}
+
+			logger.Warn("AgentX session ended, reconnecting", "error", err, "delay", reconnectDelay)
+			select {
+			case <-a.stop:
+				return
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}()
+}
+
+// Stop closes the session and waits for the subagent to exit
+func (a *Subagent) Stop() {
+	close(a.stop)
+
+	a.mu.Lock()
+	if a.conn != nil {
+		a.conn.Close()
+	}
+	a.mu.Unlock()
+
+	<-a.done
+}
+
+// session runs one connection to the master agent until it fails
+func (a *Subagent) session() error {
+	conn, err := net.DialTimeout(a.network, a.address, requestTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	a.mu.Lock()
+	a.conn = conn
+	a.mu.Unlock()
+
+	sessionID, err := a.open(conn)
+	if err != nil {
+		return err
+	}
+	if err := a.register(conn, sessionID); err != nil {
+		return err
+	}
+	logger.Info("AgentX subagent registered", "oid", a.base.String(), "master", a.address)
+
+	conn.SetDeadline(time.Time{})
+	for {
+		h, payload, order, err := readPacket(conn)
+		if err != nil {
+			return err
+		}
+
+		if h.Type == pduClose {
+			return fmt.Errorf("master closed the session")
+		}
+
+		resp, err := a.handle(h, &decoder{data: payload, order: order})
+		if err != nil {
+			return err
+		}
+		if resp == nil {
+			continue
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// open sends an Open-PDU and returns the session ID assigned by the master
+func (a *Subagent) open(conn net.Conn) (uint32, error) {
+	var e encoder
+	e.buf.Write([]byte{byte(requestTimeout / time.Second), 0, 0, 0})
+	e.oid(a.base, false)
+	e.octetString("btc-node-monitor " + a.version)
+
+	h, err := a.request(conn, header{Type: pduOpen, PacketID: 1}, e.buf.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("open failed: %w", err)
+	}
+	return h.SessionID, nil
+}
+
+// register claims the base OID subtree
+func (a *Subagent) register(conn net.Conn, sessionID uint32) error {
+	var e encoder
+	e.buf.Write([]byte{0, 127, 0, 0}) // Default timeout, default priority, no range
+	e.oid(a.base, false)
+
+	if _, err := a.request(conn, header{Type: pduRegister, SessionID: sessionID, PacketID: 2}, e.buf.Bytes()); err != nil {
+		return fmt.Errorf("register %s failed: %w", a.base, err)
+	}
+	return nil
+}
+
+// request sends a PDU and waits for the master's response
+func (a *Subagent) request(conn net.Conn, h header, payload []byte) (header, error) {
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	if _, err := conn.Write(packet(h, payload)); err != nil {
+		return header{}, err
+	}
+
+	resp, body, order, err := readPacket(conn)
+	if err != nil {
+		return header{}, err
+	}
+	if resp.Type != pduResponse {
+		return header{}, fmt.Errorf("unexpected PDU type %d", resp.Type)
+	}
+
+	d := &decoder{data: body, order: order}
+	d.uint32() // sysUpTime
+	if code := d.uint16(); code != errNone {
+		return header{}, fmt.Errorf("master returned error %d", code)
+	}
+	return resp, d.err
+}
+
+// handle answers one PDU from the master
+func (a *Subagent) handle(h header, d *decoder) ([]byte, error) {
+	if h.Flags&flagNonDefaultContext != 0 {
+		d.octetString() // Only the default context is served
+	}
+
+	var (
+		varbinds []varbind
+		errCode  uint16
+		index    uint16
+	)
+
+	switch h.Type {
+	case pduGet, pduGetNext, pduGetBulk:
+		sample, err := a.current()
+		if err != nil {
+			sample = nil
+		}
+		view := newMIBView(a.base, sample, a.version)
+
+		switch h.Type {
+		case pduGet:
+			for _, r := range d.searchRanges() {
+				varbinds = append(varbinds, view.get(r.start))
+			}
+		case pduGetNext:
+			for _, r := range d.searchRanges() {
+				varbinds = append(varbinds, view.next(r))
+			}
+		case pduGetBulk:
+			nonRepeaters := int(d.uint16())
+			maxRepetitions := int(d.uint16())
+			varbinds = getBulk(view, d.searchRanges(), nonRepeaters, maxRepetitions)
+		}
+
+	case pduTestSet:
+		errCode, index = errNotWritable, 1
+	case pduCommitSet, pduUndoSet, pduCleanupSet:
+		// Nothing is writable, so there is nothing to commit or undo
+	default:
+		return nil, nil // Notifications and unknown PDUs need no response
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	var e encoder
+	e.uint32(0) // sysUpTime
+	e.uint16(errCode)
+	e.uint16(index)
+	for _, vb := range varbinds {
+		e.varbind(vb)
+	}
+
+	return packet(header{
+		Type:          pduResponse,
+		SessionID:     h.SessionID,
+		TransactionID: h.TransactionID,
+		PacketID:      h.PacketID,
+	}, e.buf.Bytes()), nil
+}
+
+// getBulk implements GetBulk: the first nonRepeaters ranges behave like
+// GetNext, the rest are walked up to maxRepetitions times
+func getBulk(view *mibView, ranges []searchRange, nonRepeaters, maxRepetitions int) []varbind {
+	var varbinds []varbind
+
+	for i := 0; i < nonRepeaters && i < len(ranges); i++ {
+		varbinds = append(varbinds, view.next(ranges[i]))
+	}
+
+	if nonRepeaters >= len(ranges) {
+		return varbinds
+	}
+	repeaters := append([]searchRange(nil), ranges[nonRepeaters:]...)
+	for rep := 0; rep < maxRepetitions; rep++ {
+		allEnded := true
+		for i := range repeaters {
+			vb := view.next(repeaters[i])
+			varbinds = append(varbinds, vb)
+			if vb.vtype != typeEndOfMibView {
+				allEnded = false
+				repeaters[i].start = vb.name
+				repeaters[i].include = false
+			}
+		}
+		if allEnded {
+			break
+		}
+	}
+
+	return varbinds
+}
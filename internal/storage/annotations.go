@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// annotationsFile holds operator notes; it is small and never rotated
+const annotationsFile = "annotations.jsonl"
+
+// annotationsMu serializes appends to the annotations file
+var annotationsMu sync.Mutex
+
+// AddAnnotation records an operator note at the given time
+func (s *Storage) AddAnnotation(annotation *metrics.Annotation) error {
+	data, err := json.Marshal(annotation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal annotation: %w", err)
+	}
+
+	annotationsMu.Lock()
+	defer annotationsMu.Unlock()
+
+	path := filepath.Join(s.dataDir, annotationsFile)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open annotations file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write annotation: %w", err)
+	}
+
+	return file.Sync()
+}
+
+// Annotations retrieves operator notes within a time range
+func (s *Storage) Annotations(startTime, endTime time.Time) ([]*metrics.Annotation, error) {
+	file, err := os.Open(filepath.Join(s.dataDir, annotationsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var annotations []*metrics.Annotation
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		var annotation metrics.Annotation
+		if err := json.Unmarshal(scanner.Bytes(), &annotation); err != nil {
+			continue // Skip malformed lines
+		}
+
+		if annotation.Time.Before(startTime) || annotation.Time.After(endTime) {
+			continue
+		}
+
+		annotations = append(annotations, &annotation)
+	}
+
+	sort.Slice(annotations, func(i, j int) bool {
+		return annotations[i].Time.Before(annotations[j].Time)
+	})
+
+	return annotations, scanner.Err()
+}
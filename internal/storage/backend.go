@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+var logger = logging.New("storage")
+
+// StorageBackend persists samples. Storage (JSON Lines files) is the default
+// implementation; programs embedding the agent may supply their own.
+type StorageBackend interface {
+	Write(sample *metrics.Sample) error
+	Query(startTime, endTime time.Time) ([]*metrics.Sample, error)
+	GetCurrent() (*metrics.Sample, error) // Newest sample that is not a pause marker
+	Cleanup() error
+	Close() error
+}
+
+// Annotator is implemented by backends that can store operator notes
+type Annotator interface {
+	AddAnnotation(annotation *metrics.Annotation) error
+	Annotations(startTime, endTime time.Time) ([]*metrics.Annotation, error)
+}
+
+// Compactor is implemented by backends with a periodic compaction step
+type Compactor interface {
+	Compact() error
+}
+
+// Archiver is implemented by backends that can write a backup of their
+// files while the agent runs
+type Archiver interface {
+	Backup(w io.Writer) (*BackupInfo, error)
+}
+
+// Replicator copies each daily file off the host once it is compressed.
+// Replicate must not block.
+type Replicator interface {
+	Replicate(path string)
+}
+
+// CleanupReporter is implemented by backends that delete old files
+type CleanupReporter interface {
+	CleanupStats() metrics.CleanupStats
+}
+
+// StatsReporter is implemented by backends that can describe what they
+// store
+type StatsReporter interface {
+	StorageStats() (*metrics.StorageStats, error)
+}
+
+// NewBackend creates the backend selected by name: "jsonl" (the default),
+// "cbor" or "memory"
+func NewBackend(name, dataDir string, retentionDays int) (StorageBackend, error) {
+	switch name {
+	case "", "jsonl":
+		return NewStorage(dataDir, retentionDays)
+	case "cbor":
+		return NewCBORStorage(dataDir, retentionDays)
+	case "memory":
+		return NewMemoryStorage(retentionDays), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", name)
+	}
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupManifest is the first entry of a backup archive
+const backupManifest = "backup.json"
+
+// backupDir is the directory the metrics files are stored under in a backup
+const backupDir = "metrics"
+
+// BackupInfo describes a backup archive
+type BackupInfo struct {
+	Created time.Time `json:"created"`
+	Files   int       `json:"files"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// ErrMetricsExist is returned by RestoreDir when the data directory
+// already holds metrics and replacing them was not requested
+var ErrMetricsExist = errors.New("metrics already exist")
+
+// backupFile is a file to copy into a backup, up to size bytes
+type backupFile struct {
+	name string
+	size int64
+}
+
+// Backup writes a tar archive of the metrics directory to w. Compression
+// and cleanup wait until it is done, and samples written meanwhile are
+// left out, so the archive is a consistent snapshot even while the agent
+// keeps collecting.
+func (s *Storage) Backup(w io.Writer) (*BackupInfo, error) {
+	s.filesMu.RLock()
+	defer s.filesMu.RUnlock()
+
+	// Size the files between writes, so the current day's file ends with a
+	// whole record, and after writing out samples held in memory
+	s.writeMu.Lock()
+	var err error
+	if s.currentFile != nil {
+		err = s.flush()
+	}
+	annotationsMu.Lock()
+	files, listErr := listBackupFiles(s.dataDir)
+	annotationsMu.Unlock()
+	s.writeMu.Unlock()
+	if err = errors.Join(err, listErr); err != nil {
+		return nil, err
+	}
+
+	return writeBackup(w, s.dataDir, files)
+}
+
+// BackupDir writes a tar archive of the metrics stored in dataDir to w.
+// The agent must not be running; use Storage.Backup in the agent.
+func BackupDir(w io.Writer, dataDir string) (*BackupInfo, error) {
+	dir := filepath.Join(dataDir, "metrics")
+	files, err := listBackupFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return writeBackup(w, dir, files)
+}
+
+// listBackupFiles returns the data files, their indexes and the
+// annotations in dir with their current sizes
+func listBackupFiles(dir string) ([]backupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []backupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isBackupFile(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		files = append(files, backupFile{name: name, size: info.Size()})
+	}
+	return files, nil
+}
+
+// isBackupFile reports whether a file in the metrics directory belongs in
+// a backup
+func isBackupFile(name string) bool {
+	if name == annotationsFile {
+		return true
+	}
+	_, _, _, ok := parseDataFile(strings.TrimSuffix(name, indexSuffix))
+	return ok
+}
+
+// writeBackup writes the manifest and then the files, each cut at its
+// listed size
+func writeBackup(w io.Writer, dir string, files []backupFile) (*BackupInfo, error) {
+	info := &BackupInfo{Created: time.Now().UTC(), Files: len(files)}
+	for _, file := range files {
+		info.Bytes += file.size
+	}
+
+	manifest, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	archive := tar.NewWriter(w)
+	if err := archive.WriteHeader(&tar.Header{
+		Name:    backupManifest,
+		Mode:    0644,
+		Size:    int64(len(manifest)),
+		ModTime: info.Created,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := archive.Write(manifest); err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if err := addBackupFile(archive, dir, file); err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", file.name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// addBackupFile copies the first file.size bytes of a file into archive
+func addBackupFile(archive *tar.Writer, dir string, file backupFile) error {
+	src, err := os.Open(filepath.Join(dir, file.name))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := archive.WriteHeader(&tar.Header{
+		Name:    path.Join(backupDir, file.name),
+		Mode:    0644,
+		Size:    file.size,
+		ModTime: stat.ModTime(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.CopyN(archive, src, file.size)
+	return err
+}
+
+// RestoreDir replaces the metrics stored in dataDir with those in a backup
+// archive read from r. The archive is unpacked next to the metrics
+// directory and swapped in only once complete, and existing metrics are
+// refused unless replace is set. The agent must not be running.
+func RestoreDir(r io.Reader, dataDir string, replace bool) (*BackupInfo, error) {
+	dir := filepath.Join(dataDir, "metrics")
+	existing, err := listBackupFiles(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(existing) > 0 && !replace {
+		return nil, fmt.Errorf("%w: %s holds %d files", ErrMetricsExist, dir, len(existing))
+	}
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(dataDir, "metrics.restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	info, err := unpackBackup(r, staging)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(staging, 0755); err != nil {
+		return nil, err
+	}
+
+	// Keep the old directory until the new one is in place
+	old := dir + ".old"
+	os.RemoveAll(old)
+	if err := os.Rename(dir, old); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		os.Rename(old, dir)
+		return nil, err
+	}
+	os.RemoveAll(old)
+
+	return info, nil
+}
+
+// unpackBackup extracts the metrics files of a backup archive into dir and
+// returns its manifest
+func unpackBackup(r io.Reader, dir string) (*BackupInfo, error) {
+	archive := tar.NewReader(r)
+	var info *BackupInfo
+	restored := 0
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		if header.Name == backupManifest {
+			info = &BackupInfo{}
+			if err := json.NewDecoder(archive).Decode(info); err != nil {
+				return nil, fmt.Errorf("invalid backup manifest: %w", err)
+			}
+			continue
+		}
+
+		name, ok := strings.CutPrefix(header.Name, backupDir+"/")
+		if header.Typeflag != tar.TypeReg || !ok || !isBackupFile(name) {
+			return nil, fmt.Errorf("unexpected entry %q in backup", header.Name)
+		}
+		if err := extractFile(archive, filepath.Join(dir, name), header.ModTime); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+		restored++
+	}
+
+	if info == nil {
+		return nil, fmt.Errorf("not a btc-monitor backup: %s is missing", backupManifest)
+	}
+	if restored != info.Files {
+		return nil, fmt.Errorf("backup is incomplete: %d of %d files", restored, info.Files)
+	}
+	return info, nil
+}
+
+// extractFile writes the current archive entry to a new file
+func extractFile(r io.Reader, path string, modTime time.Time) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
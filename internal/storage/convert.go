@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// endOfTime is later than any stored sample
+var endOfTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Convert rewrites the stored metrics in dataDir in the file encoding of a
+// storage backend, "jsonl" or "cbor", and returns how many days it
+// converted. Days before today stay compressed. A day stored in both
+// encodings, as after switching backends mid-day, is merged. The agent
+// must not be running.
+func Convert(dataDir, backend string) (int, error) {
+	enc := encodingByName(backend)
+	if enc == nil {
+		return 0, fmt.Errorf("cannot convert metrics to %q (use jsonl or cbor)", backend)
+	}
+
+	dir := filepath.Join(dataDir, "metrics")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	files := map[string][]string{} // By day
+	var pending []string           // Days with files in another encoding
+	for _, entry := range entries {
+		day, fileEnc, _, ok := parseDataFile(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		if fileEnc != enc && !slices.Contains(pending, day) {
+			pending = append(pending, day)
+		}
+		files[day] = append(files[day], entry.Name())
+	}
+	sort.Strings(pending)
+
+	today := time.Now().UTC().Format("2006-01-02")
+	for i, day := range pending {
+		if err := convertDay(dir, day, files[day], enc, day < today); err != nil {
+			return i, fmt.Errorf("failed to convert %s: %w", day, err)
+		}
+	}
+	return len(pending), nil
+}
+
+// convertDay merges the files of one day into a single file in enc,
+// compressing it if compress is set. The old files are removed only once
+// the new one is complete.
+func convertDay(dir, day string, names []string, enc *encoding, compress bool) error {
+	var samples []*metrics.Sample
+	for _, name := range names {
+		fileSamples, err := readFile(filepath.Join(dir, name), time.Time{}, endOfTime)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, fileSamples...)
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp.Before(samples[j].Timestamp)
+	})
+
+	path := filepath.Join(dir, day+enc.ext)
+	idx, err := writeSamples(path+".tmp", samples, enc)
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if name == filepath.Base(path) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		os.Remove(filepath.Join(dir, name) + indexSuffix)
+	}
+
+	if compress {
+		compressFile(path)
+		return nil
+	}
+	return writeIndex(path, idx)
+}
+
+// writeSamples writes samples in time order to a new file in enc and
+// returns its index
+func writeSamples(path string, samples []*metrics.Sample, enc *encoding) (fileIndex, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	var idx fileIndex
+	var offset int64
+	for i, sample := range samples {
+		data, err := enc.marshal(sample)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if i%indexInterval == 0 {
+			idx = append(idx, indexEntry{timestamp: sample.Timestamp, offset: offset})
+		}
+		n, err := file.Write(data)
+		offset += int64(n)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return idx, file.Close()
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/cbor"
+)
+
+// maxRecordSize bounds one stored sample, well above what a sample with
+// many nodes and custom collectors takes
+const maxRecordSize = 16 << 20
+
+// encoding is a format for the records of a data file. The format of a
+// file is known from its extension, so a directory can hold both while
+// switching or converting.
+type encoding struct {
+	name      string
+	ext       string                                   // File extension before any .gz
+	marshal   func(v interface{}) ([]byte, error)      // One record, framed for appending
+	unmarshal func(record []byte, v interface{}) error // One record as returned by split
+	split     bufio.SplitFunc
+}
+
+// jsonLines stores one JSON document per line; it is the default
+var jsonLines = &encoding{
+	name: "jsonl",
+	ext:  ".jsonl",
+	marshal: func(v interface{}) ([]byte, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	},
+	unmarshal: json.Unmarshal,
+	split:     scanLines,
+}
+
+// cborSequence stores samples as a sequence of CBOR items, with the JSON
+// field names coded through sampleKeys
+var cborSequence = &encoding{
+	name:      "cbor",
+	ext:       ".cbor",
+	marshal:   sampleCodec.Marshal,
+	unmarshal: sampleCodec.Unmarshal,
+	split:     cbor.ScanItems,
+}
+
+// encodings lists the formats data files are read in
+var encodings = []*encoding{jsonLines, cborSequence}
+
+// encodingByName returns the encoding called name, or nil
+func encodingByName(name string) *encoding {
+	for _, enc := range encodings {
+		if enc.name == name {
+			return enc
+		}
+	}
+	return nil
+}
+
+// parseDataFile splits a daily data file name such as 2024-01-02.jsonl.gz
+// into its day and encoding. ok is false for any other file.
+func parseDataFile(name string) (day string, enc *encoding, compressed, ok bool) {
+	base, compressed := strings.CutSuffix(name, ".gz")
+	for _, candidate := range encodings {
+		day, found := strings.CutSuffix(base, candidate.ext)
+		if !found {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			return "", nil, false, false
+		}
+		return day, candidate, compressed, true
+	}
+	return "", nil, false, false
+}
+
+// encodingOf returns the encoding of a data file path, JSON Lines for any
+// name parseDataFile does not recognise
+func encodingOf(path string) *encoding {
+	if _, enc, _, ok := parseDataFile(filepath.Base(path)); ok {
+		return enc
+	}
+	return jsonLines
+}
+
+// scanLines is a bufio.SplitFunc for lines that keeps the newline, so a
+// record is the exact bytes stored
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// newRecordScanner reads the records of a data file
+func newRecordScanner(r io.Reader, enc *encoding) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxRecordSize)
+	scanner.Split(enc.split)
+	return scanner
+}
+
+// recordTimestamp returns the timestamp of a stored sample without decoding
+// the rest of it
+func recordTimestamp(enc *encoding, record []byte) (time.Time, bool) {
+	var sample struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+	if err := enc.unmarshal(record, &sample); err != nil || sample.Timestamp.IsZero() {
+		return time.Time{}, false
+	}
+	return sample.Timestamp, true
+}
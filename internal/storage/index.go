@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// indexInterval is how many samples apart index entries are. In compressed
+// files it is also the number of samples per gzip member, so a reader can
+// start decompressing at any entry.
+const indexInterval = 60
+
+// indexSuffix names the index next to a data file, e.g.
+// 2024-01-02.jsonl.idx or 2024-01-02.cbor.gz.idx
+const indexSuffix = ".idx"
+
+// indexEntry locates a sample in a data file: the offset of its record in
+// an uncompressed file, or of the gzip member it starts in a compressed one
+type indexEntry struct {
+	timestamp time.Time
+	offset    int64
+}
+
+// fileIndex lists entries in file order. Samples are written in time
+// order, so it can bound the part of a file holding a time range.
+type fileIndex []indexEntry
+
+// span returns the byte range of a data file that holds every sample from
+// startTime to endTime; to is -1 for the end of the file. Without an index
+// that is the whole file.
+func (idx fileIndex) span(startTime, endTime time.Time) (from, to int64) {
+	to = -1
+	for _, entry := range idx {
+		if entry.timestamp.Before(startTime) {
+			from = entry.offset
+		}
+		if entry.timestamp.After(endTime) {
+			to = entry.offset
+			break
+		}
+	}
+	return from, to
+}
+
+// readIndex loads the index of a data file. A missing or unreadable index,
+// or one whose entries are not in time order, e.g. after the clock was set
+// back, yields nil so the whole file is read.
+func readIndex(path string) fileIndex {
+	file, err := os.Open(path + indexSuffix)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var idx fileIndex
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, err := parseIndexEntry(scanner.Text())
+		if err != nil {
+			logger.Debug("Ignoring malformed metrics index", "file", path+indexSuffix, "error", err)
+			return nil
+		}
+		if len(idx) > 0 {
+			last := idx[len(idx)-1]
+			if entry.timestamp.Before(last.timestamp) || entry.offset <= last.offset {
+				return nil
+			}
+		}
+		idx = append(idx, entry)
+	}
+	if scanner.Err() != nil {
+		return nil
+	}
+	return idx
+}
+
+// parseIndexEntry parses a "<RFC 3339 timestamp> <offset>" line
+func parseIndexEntry(line string) (indexEntry, error) {
+	timestampText, offsetText, ok := strings.Cut(line, " ")
+	if !ok {
+		return indexEntry{}, fmt.Errorf("malformed index line %q", line)
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+	if err != nil {
+		return indexEntry{}, err
+	}
+	offset, err := strconv.ParseInt(offsetText, 10, 64)
+	if err != nil || offset < 0 {
+		return indexEntry{}, fmt.Errorf("malformed index offset %q", offsetText)
+	}
+	return indexEntry{timestamp: timestamp, offset: offset}, nil
+}
+
+// format renders an entry as an index line
+func (e indexEntry) format() string {
+	return e.timestamp.UTC().Format(time.RFC3339Nano) + " " + strconv.FormatInt(e.offset, 10) + "\n"
+}
+
+// appendIndexEntry adds an entry to the index of a data file being written
+func appendIndexEntry(path string, entry indexEntry) error {
+	file, err := os.OpenFile(path+indexSuffix, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(entry.format()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeIndex replaces the index of a data file
+func writeIndex(path string, idx fileIndex) error {
+	var buf strings.Builder
+	for _, entry := range idx {
+		buf.WriteString(entry.format())
+	}
+
+	tmp := path + indexSuffix + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path+indexSuffix)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressIndexed gzips a data file in enc into dst as one gzip member per
+// indexInterval samples, which gzip readers decode as a single stream, and
+// returns the index of the members. The index is nil if the samples are
+// not in time order.
+func compressIndexed(src io.Reader, dst io.Writer, enc *encoding) (fileIndex, error) {
+	counter := &countingWriter{w: dst}
+	scanner := newRecordScanner(src, enc)
+
+	var idx fileIndex
+	var gz *gzip.Writer
+	var last time.Time
+	ordered := true
+	for records := 0; scanner.Scan(); records++ {
+		record := scanner.Bytes()
+		timestamp, ok := recordTimestamp(enc, record)
+		if ok {
+			if timestamp.Before(last) {
+				ordered = false
+			}
+			last = timestamp
+		}
+
+		if records%indexInterval == 0 {
+			if gz != nil {
+				if err := gz.Close(); err != nil {
+					return nil, err
+				}
+			}
+			if ok {
+				idx = append(idx, indexEntry{timestamp: timestamp, offset: counter.n})
+			}
+			gz = gzip.NewWriter(counter)
+		}
+		if _, err := gz.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if gz == nil {
+		// An empty file still needs a valid gzip stream
+		gz = gzip.NewWriter(counter)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if !ordered {
+		return nil, nil
+	}
+	return idx, nil
+}
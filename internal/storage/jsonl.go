@@ -1,30 +1,93 @@
 package storage
 
 import (
-	"bufio"
 	"compress/gzip"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
 )
 
-// Storage handles JSON Lines file storage with rotation
+// Storage handles daily file storage with rotation, in JSON Lines or CBOR
 type Storage struct {
 	dataDir     string
-	currentFile *os.File
+	currentFile *os.File // Append-only writer, never repositioned
+	readHandle  *os.File // Separate read handle for the current day's file
 	currentDay  string
 	retention   int // days
+
+	// Days to keep the named sample sections, and the others, for instead;
+	// see SetSectionRetention. Guarded by filesMu.
+	sectionRetention map[string]int
+	otherRetention   int
+
+	// Encoding of the files written; files in any encoding are read
+	encoding *encoding
+
+	// Most recent sample, kept in memory so GetCurrent does not re-read
+	// the day's file on every request
+	latestMu sync.RWMutex
+	latest   *metrics.Sample
+
+	// Background cleanup and compression, waited for by Close
+	background sync.WaitGroup
+
+	// writeMu is held while a sample is appended. filesMu is held for
+	// reading by queries and backups, and for writing while files are
+	// compressed or deleted, so readers never see a file half compressed
+	// or a day both compressed and not.
+	writeMu sync.Mutex
+	filesMu sync.RWMutex
+
+	// Records not yet written to the current file, with their samples for
+	// Query and their index entries; see SetFlushInterval. Guarded by
+	// writeMu.
+	flushInterval  time.Duration
+	lastFlush      time.Time
+	pending        []byte
+	pendingSamples []*metrics.Sample
+	pendingIndex   []indexEntry
+
+	// Told about each compressed file; see SetReplicator. Guarded by
+	// writeMu.
+	replicator Replicator
+
+	// Cap on the size of the metrics directory, 0 for none. The mutex also
+	// keeps rotation and the cleanup job from enforcing it at once.
+	sizeMu   sync.Mutex
+	maxBytes int64
+
+	cleanupMu   sync.Mutex
+	cleanup     metrics.CleanupStats
+	compression *metrics.CompressionStats // Guarded by cleanupMu
+
+	// Index of the current day's file, which gets an entry every
+	// indexInterval samples
+	currentSize   int64 // Bytes in the current file
+	sinceIndexed  int   // Samples written since the last entry
+	lastTimestamp time.Time
+	unindexed     bool // Samples went back in time, so the day is not indexed
 }
 
-// NewStorage creates a new storage handler
+// NewStorage creates a new storage handler writing JSON Lines
 func NewStorage(dataDir string, retentionDays int) (*Storage, error) {
+	return newStorage(dataDir, retentionDays, jsonLines)
+}
+
+// NewCBORStorage creates a storage handler writing CBOR, which takes about
+// half the space of JSON Lines. Files written in JSON Lines stay readable.
+func NewCBORStorage(dataDir string, retentionDays int) (*Storage, error) {
+	return newStorage(dataDir, retentionDays, cborSequence)
+}
+
+func newStorage(dataDir string, retentionDays int, enc *encoding) (*Storage, error) {
 	// Create data directory if it doesn't exist
 	metricsDir := filepath.Join(dataDir, "metrics")
 	if err := os.MkdirAll(metricsDir, 0755); err != nil {
@@ -33,6 +96,7 @@ func NewStorage(dataDir string, retentionDays int) (*Storage, error) {
 
 	s := &Storage{
 		dataDir:   metricsDir,
+		encoding:  enc,
 		retention: retentionDays,
 	}
 
@@ -41,38 +105,154 @@ func NewStorage(dataDir string, retentionDays int) (*Storage, error) {
 		return nil, err
 	}
 
+	// Serve the last stored sample until the first collection completes
+	s.primeLatest()
+
 	// Clean up old files
-	go s.cleanupOldFiles()
+	s.inBackground(func() { s.Cleanup() })
 
 	return s, nil
 }
 
 // Write writes a sample to storage
 func (s *Storage) Write(sample *metrics.Sample) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
 	// Check if rotation needed
 	if err := s.rotateIfNeeded(); err != nil {
 		return err
 	}
 
-	// Marshal to JSON
-	data, err := json.Marshal(sample)
+	data, err := s.encoding.marshal(sample)
 	if err != nil {
 		return fmt.Errorf("failed to marshal sample: %w", err)
 	}
 
-	// Write line
-	if _, err := s.currentFile.Write(append(data, '\n')); err != nil {
-		return fmt.Errorf("failed to write sample: %w", err)
+	s.indexSample(sample.Timestamp)
+
+	s.pending = append(s.pending, data...)
+	s.pendingSamples = append(s.pendingSamples, sample)
+	s.currentSize += int64(len(data))
+
+	// A pause marker carries no values, so it must not replace the sample
+	// served as current
+	if sample.Paused == nil {
+		s.latestMu.Lock()
+		s.latest = sample
+		s.latestMu.Unlock()
+	}
+
+	if time.Since(s.lastFlush) < s.flushInterval {
+		return nil
+	}
+	return s.flush()
+}
+
+// SetFlushInterval holds written samples in memory and writes them out
+// together at most this often, so the disk is not woken for every sample.
+// Samples still held are lost if the agent crashes. The default, 0,
+// writes and syncs every sample.
+func (s *Storage) SetFlushInterval(interval time.Duration) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.flushInterval = interval
+}
+
+// SetReplicator passes the path of each daily file compressed from now on
+// to r
+func (s *Storage) SetReplicator(r Replicator) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.replicator = r
+}
+
+// flush writes the pending records to the current file and syncs it, then
+// appends their index entries. A failed write is retried from where it
+// stopped by the next flush. Callers hold writeMu.
+func (s *Storage) flush() error {
+	s.lastFlush = time.Now()
+
+	if len(s.pending) > 0 {
+		n, err := s.currentFile.Write(s.pending)
+		s.pending = s.pending[n:]
+		if err != nil {
+			return fmt.Errorf("failed to write sample: %w", err)
+		}
+		if err := s.currentFile.Sync(); err != nil {
+			return err
+		}
+	}
+	s.pending = nil
+	s.pendingSamples = nil
+
+	path := filepath.Join(s.dataDir, s.currentDay+s.encoding.ext)
+	for _, entry := range s.pendingIndex {
+		if err := appendIndexEntry(path, entry); err != nil {
+			logger.Warn("Failed to update metrics index", "file", path+indexSuffix, "error", err)
+			break
+		}
+	}
+	s.pendingIndex = nil
+	return nil
+}
+
+// indexSample adds an index entry for a sample about to be written at the
+// end of the current file when one is due. An index that could mislead
+// readers is removed instead.
+func (s *Storage) indexSample(timestamp time.Time) {
+	path := filepath.Join(s.dataDir, s.currentDay+s.encoding.ext)
+
+	if s.unindexed {
+		return
+	}
+	if timestamp.Before(s.lastTimestamp) {
+		s.unindexed = true
+		s.pendingIndex = nil
+		if err := os.Remove(path + indexSuffix); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to remove metrics index", "file", path+indexSuffix, "error", err)
+		}
+		return
+	}
+	s.lastTimestamp = timestamp
+
+	s.sinceIndexed++
+	if s.sinceIndexed < indexInterval {
+		return
 	}
+	s.pendingIndex = append(s.pendingIndex, indexEntry{timestamp: timestamp, offset: s.currentSize})
+	s.sinceIndexed = 0
+}
 
-	// Flush to disk
-	return s.currentFile.Sync()
+// ReadRange reads the samples stored in dataDir within a time range without
+// opening the directory for writing, so it is safe while the agent runs
+func ReadRange(dataDir string, startTime, endTime time.Time) ([]*metrics.Sample, error) {
+	s := &Storage{dataDir: filepath.Join(dataDir, "metrics")}
+	return s.Query(startTime, endTime)
 }
 
 // Query retrieves samples within a time range
 func (s *Storage) Query(startTime, endTime time.Time) ([]*metrics.Sample, error) {
 	var samples []*metrics.Sample
 
+	// Taken first: if they are flushed meanwhile, the files have them. The
+	// current day's file is read only as far as it was flushed, so a record
+	// being appended is never read half written.
+	s.writeMu.Lock()
+	pending := s.pendingSamples
+	var currentPath string
+	var flushed int64
+	if s.currentFile != nil {
+		currentPath = filepath.Join(s.dataDir, s.currentDay+s.encoding.ext)
+		flushed = s.currentSize - int64(len(s.pending))
+	}
+	s.writeMu.Unlock()
+
+	s.filesMu.RLock()
+	defer s.filesMu.RUnlock()
+
 	// Find all relevant files
 	files, err := s.getFilesForTimeRange(startTime, endTime)
 	if err != nil {
@@ -80,10 +260,14 @@ func (s *Storage) Query(startTime, endTime time.Time) ([]*metrics.Sample, error)
 	}
 
 	for _, file := range files {
-		fileSamples, err := s.readFile(file, startTime, endTime)
+		size := int64(-1)
+		if file == currentPath {
+			size = flushed
+		}
+		fileSamples, err := readFileUpTo(file, size, startTime, endTime)
 		if err != nil {
 			// Log warning but continue
-			fmt.Printf("[WARN] Failed to read file %s: %v\n", file, err)
+			logger.Warn("Failed to read metrics file", "file", file, "error", err)
 			continue
 		}
 		samples = append(samples, fileSamples...)
@@ -94,43 +278,109 @@ func (s *Storage) Query(startTime, endTime time.Time) ([]*metrics.Sample, error)
 		return samples[i].Timestamp.Before(samples[j].Timestamp)
 	})
 
+	// Samples not yet flushed are newer than any in the files
+	for _, sample := range pending {
+		if len(samples) > 0 && !sample.Timestamp.After(samples[len(samples)-1].Timestamp) {
+			continue
+		}
+		if sample.Timestamp.Before(startTime) || sample.Timestamp.After(endTime) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+
 	return samples, nil
 }
 
-// GetCurrent retrieves the most recent sample
+// GetCurrent retrieves the most recent sample, skipping pause markers. The
+// returned sample is shared and must not be modified.
 func (s *Storage) GetCurrent() (*metrics.Sample, error) {
-	// Get current file path
-	if s.currentDay == "" {
-		return nil, fmt.Errorf("no current file")
+	s.latestMu.RLock()
+	latest := s.latest
+	s.latestMu.RUnlock()
+
+	if latest != nil {
+		return latest, nil
 	}
 
-	currentPath := filepath.Join(s.dataDir, s.currentDay+".jsonl")
+	// Nothing written since startup; fall back to the day's file
+	s.latestMu.Lock()
+	defer s.latestMu.Unlock()
 
-	// Open file for reading (separate from write handle)
-	file, err := os.Open(currentPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open current file for reading: %w", err)
+	if s.latest != nil {
+		return s.latest, nil
+	}
+	if s.readHandle == nil {
+		return nil, fmt.Errorf("no current file")
+	}
+
+	// Only the read handle is repositioned; the writer stays at the end
+	if _, err := s.readHandle.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind current file: %w", err)
 	}
-	defer file.Close()
 
 	var lastSample *metrics.Sample
-	scanner := bufio.NewScanner(file)
+	scanner := newRecordScanner(s.readHandle, s.encoding)
 
 	for scanner.Scan() {
 		var sample metrics.Sample
-		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
-			continue // Skip malformed lines
+		if err := s.encoding.unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue // Skip malformed records
+		}
+		if sample.Paused == nil {
+			lastSample = &sample
 		}
-		lastSample = &sample
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
+	s.latest = lastSample
 	return lastSample, nil
 }
 
+// primeLatest loads the newest stored sample from the most recent file
+// holding one, which may be from an earlier day if the agent was stopped
+func (s *Storage) primeLatest() {
+	s.filesMu.RLock()
+	defer s.filesMu.RUnlock()
+
+	files, err := s.getFilesForTimeRange(time.Time{}, time.Now().UTC().Add(24*time.Hour))
+	if err != nil {
+		logger.Warn("Failed to list metrics files", "error", err)
+		return
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		samples, err := readFile(files[i], time.Time{}, time.Now().UTC().Add(24*time.Hour))
+		if err != nil {
+			logger.Warn("Failed to read metrics file", "file", filepath.Base(files[i]), "error", err)
+			continue
+		}
+		latest := lastValues(samples)
+		if latest == nil {
+			continue
+		}
+
+		s.latestMu.Lock()
+		s.latest = latest
+		s.latestMu.Unlock()
+		logger.Debug("Loaded last stored sample", "timestamp", latest.Timestamp)
+		return
+	}
+}
+
+// lastValues returns the newest sample that is not a pause marker, or nil
+func lastValues(samples []*metrics.Sample) *metrics.Sample {
+	for i := len(samples) - 1; i >= 0; i-- {
+		if samples[i].Paused == nil {
+			return samples[i]
+		}
+	}
+	return nil
+}
+
 // rotateIfNeeded checks if file rotation is needed and performs it
 func (s *Storage) rotateIfNeeded() error {
 	now := time.Now().UTC()
@@ -142,26 +392,88 @@ func (s *Storage) rotateIfNeeded() error {
 
 	// Close current file
 	if s.currentFile != nil {
+		// Records still held belong to the old day's file, and its index
+		// entries to that file's index, so it stays current until they
+		// are out
+		if err := s.flush(); err != nil {
+			return fmt.Errorf("failed to write pending samples before rotation: %w", err)
+		}
 		s.currentFile.Close()
 
 		// Compress previous day's file in background
-		oldPath := filepath.Join(s.dataDir, s.currentDay+".jsonl")
-		go compressFile(oldPath)
+		oldPath := filepath.Join(s.dataDir, s.currentDay+s.encoding.ext)
+		replicator := s.replicator
+		s.inBackground(func() {
+			s.filesMu.Lock()
+			compressed := s.compressFile(oldPath)
+			s.filesMu.Unlock()
+			if compressed && replicator != nil {
+				replicator.Replicate(oldPath + ".gz")
+			}
+			s.Cleanup()
+		})
 	}
 
-	// Open new file
-	newPath := filepath.Join(s.dataDir, currentDay+".jsonl")
+	// Open new file, which exists already when the agent restarts during
+	// the day, perhaps after stopping in the middle of a write
+	newPath := filepath.Join(s.dataDir, currentDay+s.encoding.ext)
+	recoverFile(newPath, s.encoding)
 	file, err := os.OpenFile(newPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open metrics file: %w", err)
 	}
 
+	reader, err := os.Open(newPath)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open metrics file for reading: %w", err)
+	}
+
+	// Swapped in one step, so GetCurrent never finds no file mid-rotation
+	s.latestMu.Lock()
+	if s.readHandle != nil {
+		s.readHandle.Close()
+	}
+	s.readHandle = reader
+	s.latestMu.Unlock()
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat metrics file: %w", err)
+	}
+
 	s.currentFile = file
 	s.currentDay = currentDay
+	s.currentSize = info.Size()
+	s.sinceIndexed = indexInterval // Index the first sample written
+	s.lastTimestamp = time.Time{}
+	s.unindexed = false
 
 	return nil
 }
 
+// inBackground runs fn in a goroutine that Close waits for, so shutdown
+// never leaves a half-written compressed file behind
+func (s *Storage) inBackground(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// closeReadFile closes the read handle for the current day's file
+func (s *Storage) closeReadFile() {
+	s.latestMu.Lock()
+	defer s.latestMu.Unlock()
+
+	if s.readHandle != nil {
+		s.readHandle.Close()
+		s.readHandle = nil
+	}
+}
+
 // getFilesForTimeRange returns files that may contain data for the time range
 func (s *Storage) getFilesForTimeRange(startTime, endTime time.Time) ([]string, error) {
 	var files []string
@@ -177,16 +489,11 @@ func (s *Storage) getFilesForTimeRange(startTime, endTime time.Time) ([]string,
 		}
 
 		name := entry.Name()
-		if !strings.HasSuffix(name, ".jsonl") && !strings.HasSuffix(name, ".jsonl.gz") {
-			continue
-		}
-
-		// Extract date from filename
-		dateStr := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".jsonl")
-		fileDate, err := time.Parse("2006-01-02", dateStr)
-		if err != nil {
+		day, _, _, ok := parseDataFile(name)
+		if !ok {
 			continue
 		}
+		fileDate, _ := time.Parse("2006-01-02", day)
 
 		// Check if file is within range
 		fileEndOfDay := fileDate.Add(24 * time.Hour)
@@ -201,19 +508,40 @@ func (s *Storage) getFilesForTimeRange(startTime, endTime time.Time) ([]string,
 	return files, nil
 }
 
-// readFile reads samples from a file (handles .gz)
-func (s *Storage) readFile(path string, startTime, endTime time.Time) ([]*metrics.Sample, error) {
+// readFile reads samples from a file (handles .gz and either encoding),
+// using its index to skip the parts outside the time range
+func readFile(path string, startTime, endTime time.Time) ([]*metrics.Sample, error) {
+	return readFileUpTo(path, -1, startTime, endTime)
+}
+
+// readFileUpTo is readFile for only the first size bytes of a file that
+// may be growing; a negative size reads all of it
+func readFileUpTo(path string, size int64, startTime, endTime time.Time) ([]*metrics.Sample, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
+	from, to := readIndex(path).span(startTime, endTime)
+	if size >= 0 && (to < 0 || to > size) {
+		to = size
+	}
+	if to >= 0 && from > to {
+		from = to
+	}
+	if _, err := file.Seek(from, io.SeekStart); err != nil {
+		return nil, err
+	}
+
 	var reader io.Reader = file
+	if to >= 0 {
+		reader = io.LimitReader(file, to-from)
+	}
 
 	// Handle gzip files
 	if strings.HasSuffix(path, ".gz") {
-		gzReader, err := gzip.NewReader(file)
+		gzReader, err := gzip.NewReader(reader)
 		if err != nil {
 			return nil, err
 		}
@@ -221,13 +549,14 @@ func (s *Storage) readFile(path string, startTime, endTime time.Time) ([]*metric
 		reader = gzReader
 	}
 
+	enc := encodingOf(path)
 	var samples []*metrics.Sample
-	scanner := bufio.NewScanner(reader)
+	scanner := newRecordScanner(reader, enc)
 
 	for scanner.Scan() {
 		var sample metrics.Sample
-		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
-			continue // Skip malformed lines
+		if err := enc.unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue // Skip malformed records
 		}
 
 		// Filter by time range
@@ -241,92 +570,283 @@ func (s *Storage) readFile(path string, startTime, endTime time.Time) ([]*metric
 	return samples, scanner.Err()
 }
 
-// cleanupOldFiles removes files older than retention period
-func (s *Storage) cleanupOldFiles() {
-	cutoff := time.Now().UTC().AddDate(0, 0, -s.retention)
+// SetMaxBytes caps the total size of the stored metrics. When the cap is
+// exceeded, the oldest compressed files are deleted regardless of the
+// retention period.
+func (s *Storage) SetMaxBytes(maxBytes int64) {
+	s.sizeMu.Lock()
+	s.maxBytes = maxBytes
+	s.sizeMu.Unlock()
+
+	s.inBackground(func() { s.Cleanup() })
+}
+
+// Cleanup removes files older than retention period, and the oldest files
+// beyond the size cap
+func (s *Storage) Cleanup() error {
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+
+	deleted, err := removeExpired(s.dataDir, s.retention, "metrics")
+	if err != nil {
+		return err
+	}
+	s.recordCleanup(deleted + s.enforceMaxBytes())
+	s.stripExpiredSections()
+	return nil
+}
+
+// recordCleanup adds a cleanup run that deleted some files to the stats
+func (s *Storage) recordCleanup(deleted int) {
+	s.cleanupMu.Lock()
+	defer s.cleanupMu.Unlock()
+
+	s.cleanup.LastRun = time.Now().UTC()
+	s.cleanup.LastDeletedFiles = deleted
+	s.cleanup.DeletedFiles += int64(deleted)
+}
+
+// CleanupStats reports what retention cleanup has deleted since startup
+func (s *Storage) CleanupStats() metrics.CleanupStats {
+	s.cleanupMu.Lock()
+	defer s.cleanupMu.Unlock()
+
+	return s.cleanup
+}
+
+// enforceMaxBytes deletes the oldest compressed files, with their indexes,
+// until the metrics directory fits in the size cap, and returns how many
+// it deleted. The current day's file is never deleted.
+func (s *Storage) enforceMaxBytes() int {
+	s.sizeMu.Lock()
+	defer s.sizeMu.Unlock()
+
+	if s.maxBytes <= 0 {
+		return 0
+	}
 
 	entries, err := os.ReadDir(s.dataDir)
 	if err != nil {
-		fmt.Printf("[WARN] Failed to read data directory: %v\n", err)
-		return
+		logger.Warn("Failed to read data directory", "error", err)
+		return 0
 	}
 
+	var total int64
+	var compressed []string // Sorted by name, so oldest first
 	for _, entry := range entries {
-		if entry.IsDir() {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
 			continue
 		}
+		total += info.Size()
+		if _, _, gz, ok := parseDataFile(entry.Name()); ok && gz {
+			compressed = append(compressed, entry.Name())
+		}
+	}
 
-		name := entry.Name()
-		if !strings.HasSuffix(name, ".jsonl.gz") {
+	deleted := 0
+	for _, name := range compressed {
+		if total <= s.maxBytes {
+			return deleted
+		}
+		path := filepath.Join(s.dataDir, name)
+		size := fileSize(path) + fileSize(path+indexSuffix)
+		if err := os.Remove(path); err != nil {
+			logger.Warn("Failed to delete metrics file over the size cap", "file", name, "error", err)
 			continue
 		}
+		os.Remove(path + indexSuffix)
+		total -= size
+		deleted++
+		logger.Info("Deleted metrics file over the size cap", "file", name, "max_storage_bytes", s.maxBytes)
+	}
 
-		// Extract date from filename
-		dateStr := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".jsonl")
-		fileDate, err := time.Parse("2006-01-02", dateStr)
-		if err != nil {
+	if total > s.maxBytes {
+		logger.Warn("Metrics storage exceeds its size cap with only the current day left", "bytes", total, "max_storage_bytes", s.maxBytes)
+	}
+	return deleted
+}
+
+// fileSize returns the size of a file, or 0 if it cannot be read
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// removeExpired deletes the compressed daily files in dir older than
+// retention days and returns how many it deleted; kind names the files in
+// log messages
+func removeExpired(dir string, retention int, kind string) (int, error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, -retention)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Warn("Failed to read data directory", "error", err)
+		return 0, err
+	}
+
+	deleted := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		day, _, compressed, ok := parseDataFile(name)
+		if !ok || !compressed {
 			continue
 		}
+		fileDate, _ := time.Parse("2006-01-02", day)
 
 		// Delete if older than retention
 		if fileDate.Before(cutoff) {
-			path := filepath.Join(s.dataDir, name)
+			path := filepath.Join(dir, name)
 			if err := os.Remove(path); err != nil {
-				fmt.Printf("[WARN] Failed to delete old file %s: %v\n", name, err)
+				logger.Warn("Failed to delete old "+kind+" file", "file", name, "error", err)
 			} else {
-				fmt.Printf("[INFO] Deleted old metrics file: %s\n", name)
+				logger.Info("Deleted old "+kind+" file", "file", name)
+				os.Remove(path + indexSuffix)
+				deleted++
 			}
 		}
 	}
+
+	return deleted, nil
+}
+
+// Compact compresses any uncompressed files from previous days, such as
+// those left behind when the agent was not running at rotation time
+func (s *Storage) Compact() error {
+	// The writer rotates lazily on its next write, so while paused or
+	// holding samples it may still have yesterday's file open
+	s.writeMu.Lock()
+	replicator := s.replicator
+	open := s.currentDay
+	s.writeMu.Unlock()
+
+	s.filesMu.Lock()
+	compressed, err := compactDir(s.dataDir, open, s.compressFile)
+	s.filesMu.Unlock()
+
+	if replicator != nil {
+		for _, path := range compressed {
+			replicator.Replicate(path)
+		}
+	}
+	return err
+}
+
+// compactDir compresses the daily files in dir from before today, other
+// than the one for the day open, with compress and returns the paths of
+// the compressed files
+func compactDir(dir, open string, compress func(path string) bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now().UTC().Format("2006-01-02")
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		day, _, compressed, ok := parseDataFile(name)
+		if entry.IsDir() || !ok || compressed || day >= today || day == open {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if compress(path) {
+			paths = append(paths, path+".gz")
+		}
+	}
+
+	return paths, nil
+}
+
+// CompressedFiles returns the names of the compressed daily files in the
+// metrics directory under dataDir, oldest first
+func CompressedFiles(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dataDir, "metrics"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if _, _, compressed, ok := parseDataFile(entry.Name()); ok && compressed && !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
 }
 
-// compressFile compresses a .jsonl file with gzip
-func compressFile(path string) {
+// compressFile compresses a daily data file with gzip, indexing the result,
+// and reports whether it did
+func compressFile(path string) bool {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return // File doesn't exist
+		return false // File doesn't exist
 	}
 
 	// Open source file
 	src, err := os.Open(path)
 	if err != nil {
-		fmt.Printf("[WARN] Failed to open file for compression: %v\n", err)
-		return
+		logger.Warn("Failed to open file for compression", "error", err)
+		return false
 	}
 	defer src.Close()
 
 	// Create destination file
 	dst, err := os.Create(path + ".gz")
 	if err != nil {
-		fmt.Printf("[WARN] Failed to create compressed file: %v\n", err)
-		return
+		logger.Warn("Failed to create compressed file", "error", err)
+		return false
 	}
 	defer dst.Close()
 
 	// Compress
-	gzWriter := gzip.NewWriter(dst)
-	defer gzWriter.Close()
-
-	if _, err := io.Copy(gzWriter, src); err != nil {
-		fmt.Printf("[WARN] Failed to compress file: %v\n", err)
-		return
+	idx, err := compressIndexed(src, dst, encodingOf(path))
+	if err != nil {
+		logger.Warn("Failed to compress file", "error", err)
+		return false
 	}
 
 	// Close and delete original
 	src.Close()
-	gzWriter.Close()
-	dst.Close()
+	if err := dst.Close(); err != nil {
+		logger.Warn("Failed to compress file", "error", err)
+		return false
+	}
+
+	if idx != nil {
+		if err := writeIndex(path+".gz", idx); err != nil {
+			logger.Warn("Failed to write metrics index", "file", path+".gz"+indexSuffix, "error", err)
+		}
+	} else {
+		os.Remove(path + ".gz" + indexSuffix)
+	}
+	os.Remove(path + indexSuffix)
 
 	if err := os.Remove(path); err != nil {
-		fmt.Printf("[WARN] Failed to delete original file: %v\n", err)
+		logger.Warn("Failed to delete original file", "error", err)
 	} else {
-		fmt.Printf("[INFO] Compressed metrics file: %s\n", filepath.Base(path))
+		logger.Info("Compressed data file", "file", path)
 	}
+	return true
 }
 
-// Close closes the storage
+// Close waits for background compression and closes the storage
 func (s *Storage) Close() error {
-	if s.currentFile != nil {
-		return s.currentFile.Close()
+	s.background.Wait()
+	s.closeReadFile()
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.currentFile == nil {
+		return nil
 	}
-	return nil
+	err := s.flush()
+	return errors.Join(err, s.currentFile.Close())
 }
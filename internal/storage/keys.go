@@ -0,0 +1,57 @@
+package storage
+
+import "github.com/bitcoin-node-manager/btc-node-monitor/internal/cbor"
+
+// sampleKeys are the map keys CBOR files store as their position in this
+// list, taken from the JSON field names of metrics.Sample. Append only:
+// existing files depend on every position. A field added to the metrics
+// later is stored under its name until its key is appended here.
+var sampleKeys = []string{
+	"timestamp", "system", "bitcoin", "nodes", "tor", "hardware", "services",
+	"derived", "agent", "custom", "paused", "state", "mempool_space",
+	"socket", "stale", "age_seconds", "cpu_percent", "memory_used_bytes",
+	"memory_total_bytes", "memory_avail_bytes", "disk_used_bytes",
+	"disk_total_bytes", "disk_avail_bytes", "disk_read_bps", "disk_write_bps",
+	"net_rx_bps", "net_tx_bps", "load_avg_1m", "load_avg_5m", "load_avg_15m",
+	"uptime_seconds", "cpu_temperature_c", "throttling", "swap_used_bytes",
+	"swap_total_bytes", "pressure", "clock_offset_seconds",
+	"clock_synchronized", "clock_source", "disks", "interfaces", "active",
+	"under_voltage", "frequency_capped", "throttled", "soft_temp_limit",
+	"under_voltage_occurred", "frequency_capped_occurred",
+	"throttled_occurred", "soft_temp_limit_occurred", "cpu", "memory", "io",
+	"some_avg10", "some_avg60", "some_avg300", "full_avg10", "full_avg60",
+	"full_avg300", "mountpoint", "fstype", "used_bytes", "total_bytes",
+	"avail_bytes", "used_percent", "inodes_used", "inodes_total",
+	"inodes_free", "inodes_used_percent", "rx_bps", "tx_bps", "block_height",
+	"headers", "sync_progress", "ibd", "peers", "inbound_peers",
+	"outbound_peers", "mempool_tx_count", "mempool_size_bytes",
+	"chain_size_bytes", "rpc_latency_ms", "pruned", "chain", "prune_height",
+	"inbound_slots", "inbound_slots_used_percent", "time_offset_seconds",
+	"version", "subversion", "local_addresses", "advertised", "net_recv_bps",
+	"net_sent_bps", "net_recv_month_bytes", "net_sent_month_bytes",
+	"chain_tips_valid_fork", "chain_tips_valid_headers", "chain_tips_invalid",
+	"longest_fork_length", "utxo_count", "utxo_total_amount",
+	"utxo_disk_size_bytes", "utxo_stats_height", "external_tip_height",
+	"addrman", "rpc_method_latency", "address", "port", "score", "network",
+	"listed", "reachable", "new", "tried", "total", "usable", "last_ms",
+	"p50_ms", "p95_ms", "samples", "control_reachable", "circuit_count",
+	"established_count", "bandwidth_read_bps", "bandwidth_write_bps",
+	"onion_services", "control_latency_ms", "purposes", "authenticated",
+	"auth_status", "auth_error", "bootstrap_progress", "bootstrap_tag",
+	"bootstrap_warning", "circuit_established", "onion_self_reachable",
+	"onion_self_latency_ms", "onion_self_error", "circuits", "established",
+	"streams", "source", "chassis_health", "faults", "max_temperature_c",
+	"fans", "power_supplies", "temperatures", "name", "rpm", "health",
+	"celsius", "load_state", "active_state", "sub_state", "failed",
+	"restarts", "active_seconds", "disk_growth_bytes_per_day",
+	"disk_days_until_full", "rss_bytes", "heap_bytes", "goroutines",
+	"rss_growth_bytes_per_day", "goroutine_growth_per_day", "leak_suspected",
+	"leak_warning", "reason", "since", "tip_height", "backend_lag_blocks",
+	"api_latency_ms", "error", "file_exists", "permissions_ok",
+	"accept_errors", "last_error", "last_error_time", "cpu_seconds",
+	"wakeups", "wakeups_per_minute", "tip_age_seconds", "block_interval_seconds",
+	"block_arrival_delay_seconds",
+}
+
+// sampleCodec encodes samples with the sampleKeys table
+var sampleCodec = cbor.NewCodec(sampleKeys)
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// MemoryStorage keeps samples in memory only. Nothing survives a restart,
+// which suits ephemeral deployments and embedding in tests or other tools.
+type MemoryStorage struct {
+	mu          sync.RWMutex
+	samples     []*metrics.Sample // Ascending by timestamp
+	annotations []*metrics.Annotation
+	retention   int // days
+}
+
+// NewMemoryStorage creates an empty in-memory backend
+func NewMemoryStorage(retentionDays int) *MemoryStorage {
+	return &MemoryStorage{retention: retentionDays}
+}
+
+// Write stores a sample
+func (m *MemoryStorage) Write(sample *metrics.Sample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Samples normally arrive in order; keep the slice sorted if not
+	i := len(m.samples)
+	for i > 0 && m.samples[i-1].Timestamp.After(sample.Timestamp) {
+		i--
+	}
+	m.samples = append(m.samples, nil)
+	copy(m.samples[i+1:], m.samples[i:])
+	m.samples[i] = sample
+
+	return nil
+}
+
+// Query retrieves samples within a time range
+func (m *MemoryStorage) Query(startTime, endTime time.Time) ([]*metrics.Sample, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	first := sort.Search(len(m.samples), func(i int) bool {
+		return !m.samples[i].Timestamp.Before(startTime)
+	})
+
+	var samples []*metrics.Sample
+	for _, sample := range m.samples[first:] {
+		if sample.Timestamp.After(endTime) {
+			break
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+// GetCurrent retrieves the most recent sample, skipping pause markers
+func (m *MemoryStorage) GetCurrent() (*metrics.Sample, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return lastValues(m.samples), nil
+}
+
+// Cleanup drops samples older than the retention period
+func (m *MemoryStorage) Cleanup() error {
+	cutoff := time.Now().UTC().AddDate(0, 0, -m.retention)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	first := sort.Search(len(m.samples), func(i int) bool {
+		return !m.samples[i].Timestamp.Before(cutoff)
+	})
+	m.samples = append([]*metrics.Sample(nil), m.samples[first:]...)
+
+	return nil
+}
+
+// AddAnnotation records an operator note
+func (m *MemoryStorage) AddAnnotation(annotation *metrics.Annotation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.annotations = append(m.annotations, annotation)
+	return nil
+}
+
+// Annotations retrieves operator notes within a time range
+func (m *MemoryStorage) Annotations(startTime, endTime time.Time) ([]*metrics.Annotation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var annotations []*metrics.Annotation
+	for _, annotation := range m.annotations {
+		if annotation.Time.Before(startTime) || annotation.Time.After(endTime) {
+			continue
+		}
+		annotations = append(annotations, annotation)
+	}
+
+	sort.Slice(annotations, func(i, j int) bool {
+		return annotations[i].Time.Before(annotations[j].Time)
+	})
+
+	return annotations, nil
+}
+
+// Close releases the stored samples
+func (m *MemoryStorage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.samples = nil
+	m.annotations = nil
+	return nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// rawDir is the directory of the raw stream under the data directory
+const rawDir = "raw"
+
+// RawRecord is one RPC result in the raw stream
+type RawRecord struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Node      string          `json:"node,omitempty"` // Empty for the primary node
+	Method    string          `json:"method"`
+	Params    []string        `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result"`
+}
+
+// RawStore keeps RPC results verbatim in daily JSON Lines files next to
+// the metrics. Files are compressed once their day is over and removed
+// after their own retention period.
+type RawStore struct {
+	dir       string
+	retention int // days
+
+	mu          sync.Mutex
+	currentFile *os.File
+	currentDay  string
+}
+
+// NewRawStore creates the raw stream in dataDir, compressing and removing
+// files left from earlier runs
+func NewRawStore(dataDir string, retentionDays int) (*RawStore, error) {
+	dir := filepath.Join(dataDir, rawDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create raw snapshot directory: %w", err)
+	}
+
+	r := &RawStore{
+		dir:       dir,
+		retention: retentionDays,
+	}
+	if _, err := compactDir(dir, "", compressFile); err != nil {
+		return nil, err
+	}
+	if err := r.Cleanup(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write appends a record to the file of the current day
+func (r *RawStore) Write(record *RawRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal raw snapshot: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.rotateIfNeeded(); err != nil {
+		return err
+	}
+	if _, err := r.currentFile.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write raw snapshot: %w", err)
+	}
+	return r.currentFile.Sync()
+}
+
+// rotateIfNeeded opens the file of the current day, compressing the
+// previous one. Snapshots are minutes apart, so this is done in line
+// rather than in the background.
+func (r *RawStore) rotateIfNeeded() error {
+	today := time.Now().UTC().Format("2006-01-02")
+	if r.currentFile != nil && r.currentDay == today {
+		return nil
+	}
+
+	if r.currentFile != nil {
+		r.currentFile.Close()
+		r.currentFile = nil
+		compressFile(filepath.Join(r.dir, r.currentDay+".jsonl"))
+	}
+
+	file, err := os.OpenFile(filepath.Join(r.dir, today+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open raw snapshot file: %w", err)
+	}
+	r.currentFile = file
+	r.currentDay = today
+	return nil
+}
+
+// Cleanup removes files older than the retention period
+func (r *RawStore) Cleanup() error {
+	_, err := removeExpired(r.dir, r.retention, "raw snapshot")
+	return err
+}
+
+// Close closes the current file
+func (r *RawStore) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.currentFile == nil {
+		return nil
+	}
+	err := r.currentFile.Close()
+	r.currentFile = nil
+	return err
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// recoverFile removes a record left incomplete at the end of a data file or
+// its index when the agent or host stopped in the middle of writing it.
+// Readers would skip it forever, and the next record appended would run on
+// from it and be lost as well.
+func recoverFile(path string, enc *encoding) {
+	// The index first, so its last entry can be trusted as a place to
+	// start scanning the data file
+	if torn, err := truncateTornRecord(path+indexSuffix, scanLines, 0); err != nil {
+		logger.Warn("Failed to check metrics index for a torn entry", "file", filepath.Base(path)+indexSuffix, "error", err)
+	} else if torn > 0 {
+		logger.Warn("Removed torn entry from metrics index", "file", filepath.Base(path)+indexSuffix, "bytes", torn)
+	}
+
+	var from int64
+	if idx := readIndex(path); len(idx) > 0 {
+		from = idx[len(idx)-1].offset
+	}
+	if torn, err := truncateTornRecord(path, enc.split, from); err != nil {
+		logger.Warn("Failed to check metrics file for a torn record", "file", filepath.Base(path), "error", err)
+	} else if torn > 0 {
+		logger.Warn("Removed torn record from metrics file", "file", filepath.Base(path), "bytes", torn)
+	}
+}
+
+// truncateTornRecord cuts a file after its last complete record and
+// returns how many bytes were removed. Scanning starts at from, which must
+// be the start of a record. A missing file has nothing to recover.
+func truncateTornRecord(path string, split bufio.SplitFunc, from int64) (int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if from > info.Size() {
+		from = 0
+	}
+	if _, err := file.Seek(from, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// Splitting as if more data were coming leaves a trailing incomplete
+	// record unread instead of returning it
+	end := from
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxRecordSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		return split(data, false)
+	})
+	for scanner.Scan() {
+		end += int64(len(scanner.Bytes()))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	torn := info.Size() - end
+	if torn == 0 {
+		return 0, nil
+	}
+	if err := file.Truncate(end); err != nil {
+		return 0, err
+	}
+	return torn, file.Sync()
+}
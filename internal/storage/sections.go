@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// sampleSections are the parts of a sample retention can be set for one by
+// one; see SetSectionRetention
+var sampleSections = []string{
+	"system", "bitcoin", "nodes", "tor", "hardware", "services", "derived",
+	"agent", "custom", "mempool_space", "socket",
+}
+
+// SetSectionRetention keeps the named sample sections for their own number
+// of days and the others for otherDays, all no longer than the storage
+// retention that files are kept for. Cleanup removes the sections past
+// their retention from the files.
+func (s *Storage) SetSectionRetention(days map[string]int, otherDays int) {
+	s.filesMu.Lock()
+	s.sectionRetention = days
+	s.otherRetention = otherDays
+	s.filesMu.Unlock()
+
+	s.inBackground(func() { s.Cleanup() })
+}
+
+// strippedFile records the sections already removed from each compressed
+// data file, so each file is read for a section only once. Without it,
+// e.g. after restoring a backup, files are checked again.
+const strippedFile = "stripped_sections.json"
+
+// stripExpiredSections removes the sections past their retention from the
+// compressed files that still hold them. Callers hold filesMu for
+// writing.
+func (s *Storage) stripExpiredSections() {
+	if s.sectionRetention == nil {
+		return
+	}
+
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		logger.Warn("Failed to read data directory", "error", err)
+		return
+	}
+
+	done := s.loadStripped()
+	kept := make(map[string][]string, len(done))
+	changed := false
+
+	now := time.Now().UTC()
+	for _, entry := range entries {
+		day, _, compressed, ok := parseDataFile(entry.Name())
+		if entry.IsDir() || !ok || !compressed {
+			continue
+		}
+		fileDate, _ := time.Parse("2006-01-02", day)
+		if sections, ok := done[entry.Name()]; ok {
+			kept[entry.Name()] = sections
+		}
+
+		var expired []string
+		for _, section := range sampleSections {
+			retention, ok := s.sectionRetention[section]
+			if !ok {
+				retention = s.otherRetention
+			}
+			if fileDate.Before(now.AddDate(0, 0, -retention)) && !slices.Contains(done[entry.Name()], section) {
+				expired = append(expired, section)
+			}
+		}
+		if len(expired) == 0 {
+			continue
+		}
+
+		path := filepath.Join(s.dataDir, entry.Name())
+		stripped, err := stripSections(path, expired)
+		if err != nil {
+			logger.Warn("Failed to remove expired sections from metrics file", "file", entry.Name(), "error", err)
+			continue
+		}
+		if stripped {
+			logger.Info("Removed expired sections from metrics file", "file", entry.Name(), "sections", strings.Join(expired, ","))
+		}
+		kept[entry.Name()] = append(slices.Clone(done[entry.Name()]), expired...)
+		changed = true
+	}
+
+	// Files deleted since are dropped
+	if changed || len(kept) != len(done) {
+		s.saveStripped(kept)
+	}
+}
+
+// loadStripped reads strippedFile, or returns an empty record if there is
+// none or it cannot be read
+func (s *Storage) loadStripped() map[string][]string {
+	done := make(map[string][]string)
+	data, err := os.ReadFile(filepath.Join(s.dataDir, strippedFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("Failed to read stripped sections record", "error", err)
+		}
+		return done
+	}
+	if err := json.Unmarshal(data, &done); err != nil {
+		logger.Warn("Ignoring malformed stripped sections record", "error", err)
+		return make(map[string][]string)
+	}
+	return done
+}
+
+// saveStripped replaces strippedFile with done
+func (s *Storage) saveStripped(done map[string][]string) {
+	data, err := json.Marshal(done)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(s.dataDir, strippedFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		logger.Warn("Failed to write stripped sections record", "error", err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		logger.Warn("Failed to write stripped sections record", "error", err)
+		os.Remove(path + ".tmp")
+	}
+}
+
+// stripSections rewrites a compressed data file without the given
+// sections and reports whether it did; a file without any of them is left
+// as it is
+func stripSections(path string, sections []string) (bool, error) {
+	samples, err := readFile(path, time.Time{}, endOfTime)
+	if err != nil {
+		return false, err
+	}
+
+	held := false
+	for _, sample := range samples {
+		if clearSections(sample, sections) {
+			held = true
+		}
+	}
+	if !held {
+		return false, nil
+	}
+
+	enc := encodingOf(path)
+	var records bytes.Buffer
+	for _, sample := range samples {
+		data, err := enc.marshal(sample)
+		if err != nil {
+			return false, err
+		}
+		records.Write(data)
+	}
+
+	// Replaced only once complete, so readers see either file whole
+	tmp := path + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+	idx, err := compressIndexed(&records, dst, enc)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+
+	if idx != nil {
+		if err := writeIndex(path, idx); err != nil {
+			logger.Warn("Failed to write metrics index", "file", filepath.Base(path)+indexSuffix, "error", err)
+			os.Remove(path + indexSuffix)
+		}
+	} else {
+		os.Remove(path + indexSuffix)
+	}
+	return true, nil
+}
+
+// firstSample reads the first sample of a data file, or nil if it has none
+func firstSample(path string) (*metrics.Sample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	}
+
+	enc := encodingOf(path)
+	scanner := newRecordScanner(reader, enc)
+	for scanner.Scan() {
+		var sample metrics.Sample
+		if err := enc.unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue // Skip malformed records
+		}
+		return &sample, nil
+	}
+	return nil, scanner.Err()
+}
+
+// clearSections removes sections from a sample and reports whether it held
+// any of them
+func clearSections(sample *metrics.Sample, sections []string) bool {
+	held := false
+	for _, section := range sections {
+		switch section {
+		case "system":
+			held = held || sample.System != nil
+			sample.System = nil
+		case "bitcoin":
+			held = held || sample.Bitcoin != nil
+			sample.Bitcoin = nil
+		case "nodes":
+			held = held || sample.Nodes != nil
+			sample.Nodes = nil
+		case "tor":
+			held = held || sample.Tor != nil
+			sample.Tor = nil
+		case "hardware":
+			held = held || sample.Hardware != nil
+			sample.Hardware = nil
+		case "services":
+			held = held || sample.Services != nil
+			sample.Services = nil
+		case "derived":
+			held = held || sample.Derived != nil
+			sample.Derived = nil
+		case "agent":
+			held = held || sample.Agent != nil
+			sample.Agent = nil
+		case "custom":
+			held = held || sample.Custom != nil
+			sample.Custom = nil
+		case "mempool_space":
+			held = held || sample.MempoolSpace != nil
+			sample.MempoolSpace = nil
+		case "socket":
+			held = held || sample.Socket != nil
+			sample.Socket = nil
+		}
+	}
+	return held
+}
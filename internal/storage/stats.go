@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// compressFile compresses a daily file like the function of that name and
+// records the result for StorageStats
+func (s *Storage) compressFile(path string) bool {
+	bytesIn := fileSize(path)
+	compressed := compressFile(path)
+
+	// A file that is gone was never there to compress
+	failed := !compressed && fileSize(path) > 0
+	if !compressed && !failed {
+		return false
+	}
+
+	s.cleanupMu.Lock()
+	defer s.cleanupMu.Unlock()
+
+	if s.compression == nil {
+		s.compression = &metrics.CompressionStats{}
+	}
+	stats := s.compression
+	stats.LastRun = time.Now().UTC()
+	stats.LastFile = filepath.Base(path)
+	stats.LastBytesIn = bytesIn
+	stats.LastBytesOut = 0
+	stats.LastFailed = failed
+	if failed {
+		stats.Failures++
+	} else {
+		stats.LastBytesOut = fileSize(path + ".gz")
+		stats.Files++
+	}
+	return compressed
+}
+
+// StorageStats reports the size of the stored metrics, the time span they
+// cover and the files compressed since startup
+func (s *Storage) StorageStats() (*metrics.StorageStats, error) {
+	s.filesMu.RLock()
+	defer s.filesMu.RUnlock()
+
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &metrics.StorageStats{}
+	var oldest string
+	for _, entry := range entries {
+		_, _, compressed, ok := parseDataFile(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		path := filepath.Join(s.dataDir, entry.Name())
+		stats.Bytes += fileSize(path) + fileSize(path+indexSuffix)
+		stats.Files++
+		if compressed {
+			stats.CompressedFiles++
+		}
+		if oldest == "" {
+			oldest = path // Sorted by name, so by day
+		}
+	}
+
+	if oldest != "" {
+		sample, err := firstSample(oldest)
+		if err != nil {
+			logger.Warn("Failed to read metrics file", "file", filepath.Base(oldest), "error", err)
+		} else if sample != nil {
+			stats.OldestSample = sample.Timestamp
+		}
+	}
+
+	s.latestMu.RLock()
+	if s.latest != nil {
+		stats.NewestSample = s.latest.Timestamp
+	}
+	s.latestMu.RUnlock()
+
+	s.cleanupMu.Lock()
+	if s.compression != nil {
+		compression := *s.compression
+		stats.Compression = &compression
+	}
+	s.cleanupMu.Unlock()
+
+	return stats, nil
+}
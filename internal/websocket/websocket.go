@@ -0,0 +1,408 @@
+// Package websocket implements the parts of the WebSocket protocol (RFC 6455)
+// the agent needs: streaming text frames to API clients, and exchanging text
+// messages with a server such as a Nostr relay
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is the fixed key suffix from RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// maxClientFrame bounds frames accepted from clients, which only ever send
+// control frames to the agent's server
+const maxClientFrame = 4096
+
+// maxServerMessage bounds messages accepted from servers the agent connects
+// to
+const maxServerMessage = 1 << 20
+
+// Conn is a minimal WebSocket connection sending and receiving unfragmented
+// text frames and answering control frames
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	client bool // Masks its frames and expects unmasked ones
+
+	writeMu sync.Mutex
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// Upgrade performs the server side of the opening handshake and takes over
+// the connection. Frames from the client are read in the background: pings
+// are answered and a close frame ends the connection.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("not a websocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return nil, fmt.Errorf("unsupported websocket version")
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin websocket requests are not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("websocket origin %q does not match host %q", r.Header.Get("Origin"), r.Host)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("missing websocket key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("response writer cannot be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("hijack failed: %w", err)
+	}
+
+	conn.SetDeadline(time.Time{})
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := newConn(conn, rw.Reader, false)
+	go ws.readLoop()
+
+	return ws, nil
+}
+
+// Dial connects to a ws:// or wss:// URL through dial and performs the
+// client side of the opening handshake. The context bounds connecting and
+// the handshake.
+func Dial(ctx context.Context, rawURL string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket URL: %w", err)
+	}
+	var port string
+	switch u.Scheme {
+	case "ws":
+		port = "80"
+	case "wss":
+		port = "443"
+	default:
+		return nil, fmt.Errorf("websocket URL %q must use ws or wss", rawURL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("websocket URL %q has no host", rawURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	request := "GET " + u.RequestURI() + " HTTP/1.1\r\n" +
+		"Host: " + u.Host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: server returned %s", resp.Status)
+	}
+	if !headerContains(resp.Header, "Upgrade", "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: invalid upgrade response")
+	}
+
+	conn.SetDeadline(time.Time{})
+	return newConn(conn, reader, true), nil
+}
+
+func newConn(conn net.Conn, reader *bufio.Reader, client bool) *Conn {
+	return &Conn{
+		conn:   conn,
+		reader: reader,
+		client: client,
+		closed: make(chan struct{}),
+	}
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value for a handshake key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// sameOrigin reports whether a request has no Origin or one naming the
+// host it was sent to. Browsers attach cookies and cached Basic credentials
+// to WebSocket requests from any page and do not apply CORS to them, so
+// without this check another site could read the live stream.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Not a browser
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// headerContains reports whether a comma-separated header has a token
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText sends a text frame
+func (ws *Conn) WriteText(data []byte, timeout time.Duration) error {
+	return ws.writeFrame(opText, data, timeout)
+}
+
+// Ping sends a ping frame to keep intermediaries from closing the connection
+func (ws *Conn) Ping(timeout time.Duration) error {
+	return ws.writeFrame(opPing, nil, timeout)
+}
+
+// ReadText waits up to timeout for the next text or binary message from a
+// server, answering pings meanwhile. It returns io.EOF once the server
+// closes the connection. Only connections opened with Dial read this way;
+// Upgrade already reads in the background.
+func (ws *Conn) ReadText(timeout time.Duration) ([]byte, error) {
+	ws.conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var message []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame(maxServerMessage)
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opText, opBinary, opContinuation:
+			if message == nil && opcode == opContinuation {
+				return nil, fmt.Errorf("unexpected continuation frame")
+			}
+			if len(message)+len(payload) > maxServerMessage {
+				return nil, fmt.Errorf("server message too large")
+			}
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		case opClose:
+			ws.Close()
+			return nil, io.EOF
+		case opPing:
+			if err := ws.writeFrame(opPong, payload, 5*time.Second); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Closed is closed when the connection ends
+func (ws *Conn) Closed() <-chan struct{} {
+	return ws.closed
+}
+
+// Close sends a close frame and closes the connection
+func (ws *Conn) Close() {
+	ws.once.Do(func() {
+		ws.writeFrame(opClose, nil, time.Second)
+		ws.conn.Close()
+		close(ws.closed)
+	})
+}
+
+// writeFrame writes a single unfragmented frame, masked when sent by a
+// client as RFC 6455 requires
+func (ws *Conn) writeFrame(opcode byte, payload []byte, timeout time.Duration) error {
+	header := []byte{0x80 | opcode}
+	var maskBit byte
+	if ws.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	var frame []byte
+	if ws.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(header, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(header, payload...)
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	ws.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := ws.conn.Write(frame); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readLoop consumes client frames, answering pings and closes
+func (ws *Conn) readLoop() {
+	defer ws.Close()
+
+	for {
+		_, opcode, payload, err := ws.readFrame(maxClientFrame)
+		if err != nil {
+			return
+		}
+
+		switch opcode {
+		case opClose:
+			return
+		case opPing:
+			if err := ws.writeFrame(opPong, payload, 5*time.Second); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readFrame reads one frame of at most limit bytes. Clients must mask their
+// frames and servers must not.
+func (ws *Conn) readFrame(limit uint64) (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if masked == ws.client {
+		if ws.client {
+			return false, 0, nil, fmt.Errorf("masked server frame")
+		}
+		return false, 0, nil, fmt.Errorf("unmasked client frame")
+	}
+	if length > limit {
+		return false, 0, nil, fmt.Errorf("frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
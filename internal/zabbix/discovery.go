@@ -0,0 +1,164 @@
+package zabbix
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// Discovery kinds, each producing one Zabbix low-level discovery list
+var discoveryKinds = map[string]func(cfg *config.Config, sample *metrics.Sample) []map[string]string{
+	"disks":       discoverDisks,
+	"interfaces":  discoverInterfaces,
+	"backends":    discoverBackends,
+	"rpc_methods": discoverRPCMethods,
+	"custom":      discoverCustom,
+	"alerts":      discoverAlerts,
+}
+
+// DiscoveryKinds returns the supported discovery kinds, sorted
+func DiscoveryKinds() []string {
+	kinds := make([]string, 0, len(discoveryKinds))
+	for kind := range discoveryKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Discover returns low-level discovery rows for a kind. Rows map LLD macros
+// such as {#DISK} to values; sample may be nil before the first collection.
+func Discover(kind string, cfg *config.Config, sample *metrics.Sample) ([]map[string]string, error) {
+	discover, ok := discoveryKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown discovery kind: %s", kind)
+	}
+
+	rows := discover(cfg, sample)
+	if rows == nil {
+		rows = []map[string]string{}
+	}
+	return rows, nil
+}
+
+// discoverDisks lists monitored filesystem paths
+func discoverDisks(cfg *config.Config, _ *metrics.Sample) []map[string]string {
+	if !cfg.System.Enabled {
+		return nil
+	}
+	var rows []map[string]string
+	for _, path := range cfg.System.DiskPaths() {
+		rows = append(rows, map[string]string{"{#DISK}": path})
+	}
+	return rows
+}
+
+// discoverInterfaces lists network interfaces that are up and counted in
+// the system totals, excluding loopback
+func discoverInterfaces(cfg *config.Config, _ *metrics.Sample) []map[string]string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var rows []map[string]string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 || !cfg.System.CountsInterface(iface.Name) {
+			continue
+		}
+		rows = append(rows, map[string]string{"{#IFNAME}": iface.Name})
+	}
+	return rows
+}
+
+// discoverBackends lists the monitored Bitcoin nodes and their transport.
+// {#PREFIX} is the field path of the node's metrics in samples.
+func discoverBackends(cfg *config.Config, sample *metrics.Sample) []map[string]string {
+	var rows []map[string]string
+
+	if cfg.Bitcoin.Enabled {
+		row := map[string]string{
+			"{#BACKEND}":   "bitcoind",
+			"{#NODE}":      cfg.Bitcoin.Name,
+			"{#PREFIX}":    "bitcoin",
+			"{#TRANSPORT}": cfg.Bitcoin.Transport,
+		}
+		if sample != nil && sample.Bitcoin != nil {
+			row["{#CHAIN}"] = sample.Bitcoin.Chain
+		}
+		rows = append(rows, row)
+	}
+
+	for _, node := range cfg.BitcoinNodes {
+		if !node.Enabled {
+			continue
+		}
+		row := map[string]string{
+			"{#BACKEND}":   "bitcoind",
+			"{#NODE}":      node.Name,
+			"{#PREFIX}":    "nodes." + node.Name,
+			"{#TRANSPORT}": node.Transport,
+		}
+		if sample != nil && sample.Nodes[node.Name] != nil {
+			row["{#CHAIN}"] = sample.Nodes[node.Name].Chain
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// discoverRPCMethods lists RPC methods with latency statistics
+func discoverRPCMethods(_ *config.Config, sample *metrics.Sample) []map[string]string {
+	if sample == nil || sample.Bitcoin == nil {
+		return nil
+	}
+
+	var rows []map[string]string
+	for method := range sample.Bitcoin.RPCMethodLatency {
+		rows = append(rows, map[string]string{"{#RPCMETHOD}": method})
+	}
+	sortRows(rows, "{#RPCMETHOD}")
+	return rows
+}
+
+// discoverCustom lists custom collectors present in the latest sample
+func discoverCustom(_ *config.Config, sample *metrics.Sample) []map[string]string {
+	if sample == nil {
+		return nil
+	}
+
+	var rows []map[string]string
+	for name := range sample.Custom {
+		rows = append(rows, map[string]string{"{#COLLECTOR}": name})
+	}
+	sortRows(rows, "{#COLLECTOR}")
+	return rows
+}
+
+// discoverAlerts lists configured alert rules
+func discoverAlerts(cfg *config.Config, _ *metrics.Sample) []map[string]string {
+	if !cfg.Alerts.Enabled {
+		return nil
+	}
+
+	var rows []map[string]string
+	for _, rule := range cfg.Alerts.Rules {
+		rows = append(rows, map[string]string{
+			"{#RULE}":     rule.Name,
+			"{#FIELD}":    rule.Field,
+			"{#SEVERITY}": rule.Severity,
+		})
+	}
+	return rows
+}
+
+// sortRows orders rows by a macro so output is stable between calls
+func sortRows(rows []map[string]string, macro string) {
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][macro] < rows[j][macro]
+	})
+}
@@ -0,0 +1,273 @@
+package zabbix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/alert"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/config"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/logging"
+	"github.com/bitcoin-node-manager/btc-node-monitor/internal/netproxy"
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+var logger = logging.New("zabbix")
+
+// protocolHeader starts every Zabbix protocol message: "ZBXD" plus the
+// flags byte (0x01, uncompressed)
+var protocolHeader = []byte{'Z', 'B', 'X', 'D', 0x01}
+
+// maxResponseBytes bounds the server's reply
+const maxResponseBytes = 1 << 20
+
+// item is one value in a sender request
+type item struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+// senderRequest is the trapper payload
+type senderRequest struct {
+	Request string `json:"request"`
+	Data    []item `json:"data"`
+}
+
+// senderResponse is the server's reply to a sender request
+type senderResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// Sender pushes sample values to Zabbix trapper items, like zabbix_sender.
+// Item keys are <prefix>[<field>], e.g. btcmon[bitcoin.peers]. Discovery
+// lists are sent to <prefix>.discovery[<kind>] whenever they change.
+type Sender struct {
+	cfg     *config.Config
+	server  string
+	host    string
+	prefix  string
+	timeout time.Duration
+	dialer  *netproxy.Dialer
+
+	mu            sync.Mutex
+	sending       bool
+	warnedFailed  bool
+	lastDiscovery map[string][]map[string]string
+
+	inFlight sync.WaitGroup
+}
+
+// NewSender creates a sender for the Zabbix settings in cfg, connecting
+// through dialer
+func NewSender(cfg *config.Config, dialer *netproxy.Dialer) *Sender {
+	host := cfg.Zabbix.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	return &Sender{
+		cfg:           cfg,
+		server:        cfg.Zabbix.Server,
+		host:          host,
+		prefix:        cfg.Zabbix.KeyPrefix,
+		timeout:       time.Duration(cfg.Zabbix.TimeoutSeconds) * time.Second,
+		dialer:        dialer,
+		lastDiscovery: make(map[string][]map[string]string),
+	}
+}
+
+// Send pushes a sample in the background. A send still in progress causes
+// the sample to be skipped rather than queued behind it.
+func (s *Sender) Send(sample *metrics.Sample) {
+	s.mu.Lock()
+	if s.sending {
+		s.mu.Unlock()
+		return
+	}
+	s.sending = true
+	s.mu.Unlock()
+
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		defer func() {
+			s.mu.Lock()
+			s.sending = false
+			s.mu.Unlock()
+		}()
+
+		if err := s.send(sample); err != nil {
+			logger.Warn("Failed to send values to Zabbix", "error", err)
+		}
+	}()
+}
+
+// Close waits for a send in progress, which is bounded by the timeout
+func (s *Sender) Close() {
+	s.inFlight.Wait()
+}
+
+// send builds and delivers the items for a sample
+func (s *Sender) send(sample *metrics.Sample) error {
+	clock := sample.Timestamp.Unix()
+
+	fields := alert.Fields(sample)
+	names := make([]string, 0, len(fields))
+	for name, value := range fields {
+		// Zabbix float items accept neither
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]item, 0, len(names))
+	for _, name := range names {
+		items = append(items, item{
+			Host:  s.host,
+			Key:   fmt.Sprintf("%s[%s]", s.prefix, name),
+			Value: fmt.Sprintf("%g", fields[name]),
+			Clock: clock,
+		})
+	}
+
+	discovery, changed := s.changedDiscovery(sample)
+	for _, kind := range changed {
+		data, err := json.Marshal(map[string]interface{}{"data": discovery[kind]})
+		if err != nil {
+			continue
+		}
+		items = append(items, item{
+			Host:  s.host,
+			Key:   fmt.Sprintf("%s.discovery[%s]", s.prefix, kind),
+			Value: string(data),
+			Clock: clock,
+		})
+	}
+
+	if err := s.deliver(items); err != nil {
+		return err
+	}
+
+	// Only remember discovery lists once the server has them
+	s.mu.Lock()
+	for _, kind := range changed {
+		s.lastDiscovery[kind] = discovery[kind]
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// changedDiscovery returns every discovery list and the kinds that differ
+// from what was last sent
+func (s *Sender) changedDiscovery(sample *metrics.Sample) (map[string][]map[string]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	discovery := make(map[string][]map[string]string)
+	var changed []string
+	for _, kind := range DiscoveryKinds() {
+		rows, err := Discover(kind, s.cfg, sample)
+		if err != nil {
+			continue
+		}
+		discovery[kind] = rows
+
+		if last, ok := s.lastDiscovery[kind]; !ok || !reflect.DeepEqual(last, rows) {
+			changed = append(changed, kind)
+		}
+	}
+
+	return discovery, changed
+}
+
+// deliver sends items to the trapper and checks the reply
+func (s *Sender) deliver(items []item) error {
+	payload, err := json.Marshal(senderRequest{Request: "sender data", Data: items})
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.dialer.DialTimeout("tcp", s.server, s.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	if _, err := conn.Write(encodeMessage(payload)); err != nil {
+		return err
+	}
+
+	reply, err := decodeMessage(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read reply: %w", err)
+	}
+
+	var resp senderResponse
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return fmt.Errorf("invalid reply: %w", err)
+	}
+	if resp.Response != "success" {
+		return fmt.Errorf("server responded %q: %s", resp.Response, resp.Info)
+	}
+
+	// Values for items that do not exist in Zabbix are counted as failed;
+	// warn once rather than every cycle
+	failed := !strings.Contains(resp.Info, "failed: 0;")
+	s.mu.Lock()
+	if failed && !s.warnedFailed {
+		logger.Warn("Zabbix rejected some values; create trapper items for the keys you need", "info", resp.Info)
+	}
+	s.warnedFailed = failed
+	s.mu.Unlock()
+
+	return nil
+}
+
+// encodeMessage frames a payload with the Zabbix protocol header
+func encodeMessage(payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(protocolHeader)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(payload)))
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // Reserved
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// decodeMessage reads one framed message
+func decodeMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, len(protocolHeader)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], protocolHeader[:4]) {
+		return nil, fmt.Errorf("missing ZBXD header")
+	}
+
+	length := binary.LittleEndian.Uint32(header[5:9])
+	if length > maxResponseBytes {
+		return nil, fmt.Errorf("reply too large: %d bytes", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,274 @@
+// Package client queries a running btc-monitor agent over its Unix socket,
+// or the TCP address or Windows named pipe it is configured to listen on,
+// or its query_tcp TLS listener.
+package client
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bitcoin-node-manager/btc-node-monitor/pkg/metrics"
+)
+
+// DefaultTimeout bounds each request, matching the agent's own deadline
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseBytes bounds a single response line
+const maxResponseBytes = 256 << 20
+
+// Client sends line-protocol commands to the agent. Each call uses its own
+// connection, so a Client is safe for concurrent use.
+type Client struct {
+	socketPath string
+	timeout    time.Duration
+	tlsConfig  *tls.Config
+	apiKey     string
+}
+
+// New creates a client for the agent listening on socketPath
+func New(socketPath string) *Client {
+	return &Client{
+		socketPath: socketPath,
+		timeout:    DefaultTimeout,
+	}
+}
+
+// SetTimeout changes the per-request timeout
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// SetTLSConfig sets the configuration for "tls:" addresses, e.g. RootCAs
+// for a private CA or Certificates when the agent requires client
+// certificates. The system roots are used without it.
+func (c *Client) SetTLSConfig(tlsConfig *tls.Config) {
+	c.tlsConfig = tlsConfig
+}
+
+// SetAPIKey sets the query_tcp API key sent before each command
+func (c *Client) SetAPIKey(key string) {
+	c.apiKey = key
+}
+
+// conn is a connection to the agent
+type conn interface {
+	io.ReadWriteCloser
+	SetDeadline(t time.Time) error
+}
+
+// dial connects using the same address forms as the agent's socket_path,
+// or to its query_tcp listener for "tls:host:port"
+func (c *Client) dial() (conn, error) {
+	if addr, ok := strings.CutPrefix(c.socketPath, "tls:"); ok {
+		dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: c.timeout}, Config: c.tlsConfig}
+		return dialer.Dial("tcp", addr)
+	}
+	if addr, ok := strings.CutPrefix(c.socketPath, "tcp:"); ok {
+		return net.DialTimeout("tcp", addr, c.timeout)
+	}
+	if strings.HasPrefix(c.socketPath, pipePrefix) {
+		return dialPipe(c.socketPath, c.timeout)
+	}
+	return net.DialTimeout("unix", c.socketPath, c.timeout)
+}
+
+// AgentError is an error reported by the agent
+type AgentError struct {
+	Message string
+}
+
+func (e *AgentError) Error() string {
+	return "agent: " + e.Message
+}
+
+// Status returns the agent's status
+func (c *Client) Status() (*metrics.AgentStatus, error) {
+	var status metrics.AgentStatus
+	if err := c.Do("GET status", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Ping checks that the agent answers and returns its reply with the round
+// trip time measured by the client
+func (c *Client) Ping() (*metrics.Ping, time.Duration, error) {
+	var ping metrics.Ping
+	sent := time.Now()
+	if err := c.Do("PING "+sent.UTC().Format(time.RFC3339Nano), &ping); err != nil {
+		return nil, 0, err
+	}
+	return &ping, time.Since(sent), nil
+}
+
+// Info returns the protocol version, features and limits of the agent
+func (c *Client) Info() (*metrics.ServerInfo, error) {
+	var info metrics.ServerInfo
+	if err := c.Do("INFO", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Current returns the most recent sample
+func (c *Client) Current() (*metrics.Sample, error) {
+	var sample metrics.Sample
+	if err := c.Do("GET current", &sample); err != nil {
+		return nil, err
+	}
+	return &sample, nil
+}
+
+// QueryRange returns the samples recorded between start and end
+func (c *Client) QueryRange(start, end time.Time) ([]*metrics.Sample, error) {
+	command := fmt.Sprintf("GET metrics %s %s",
+		start.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano))
+
+	var samples []*metrics.Sample
+	if err := c.Do(command, &samples); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// Annotate records an operator note at the given time
+func (c *Client) Annotate(t time.Time, text string) (*metrics.Annotation, error) {
+	if strings.ContainsAny(text, "\r\n") {
+		return nil, errors.New("annotation text must be a single line")
+	}
+
+	var annotation metrics.Annotation
+	command := fmt.Sprintf("ANNOTATE %s %s", t.UTC().Format(time.RFC3339Nano), text)
+	if err := c.Do(command, &annotation); err != nil {
+		return nil, err
+	}
+	return &annotation, nil
+}
+
+// Backup streams a tar archive of the agent's stored metrics to w, as
+// written by BACKUP. The archive is checked while it is copied, so an
+// error is returned if the agent stops partway. The client timeout applies
+// to each read rather than the whole transfer.
+func (c *Client) Backup(w io.Writer) error {
+	conn, err := c.dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write(c.request("BACKUP")); err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+
+	reader := bufio.NewReader(&idleDeadlineReader{conn: conn, timeout: c.timeout})
+	first, err := reader.Peek(1)
+	if err != nil {
+		return errors.New("agent closed the connection without a response")
+	}
+	if first[0] == '{' {
+		line, _ := reader.ReadBytes('\n')
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(line, &errResp) == nil && errResp.Error != "" {
+			return &AgentError{Message: errResp.Error}
+		}
+		return errors.New("unexpected response to BACKUP")
+	}
+
+	archive := tar.NewReader(io.TeeReader(reader, w))
+	for {
+		_, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, archive); err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+	}
+	// Copy the padding after the end of the archive
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	return nil
+}
+
+// request returns the lines that send command, preceded by the API key
+// if one is set
+func (c *Client) request(command string) []byte {
+	if c.apiKey != "" {
+		return []byte("AUTH " + c.apiKey + "\n" + command + "\n")
+	}
+	return []byte(command + "\n")
+}
+
+// idleDeadlineReader extends the deadline of a connection before each read
+type idleDeadlineReader struct {
+	conn    conn
+	timeout time.Duration
+}
+
+func (r *idleDeadlineReader) Read(p []byte) (int, error) {
+	r.conn.SetDeadline(time.Now().Add(r.timeout))
+	return r.conn.Read(p)
+}
+
+// Do sends a raw command and decodes the JSON response into v, for commands
+// without a typed helper
+func (c *Client) Do(command string, v interface{}) error {
+	if strings.ContainsAny(command, "\r\n") {
+		return errors.New("command must be a single line")
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	if _, err := conn.Write(c.request(command)); err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxResponseBytes)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		return errors.New("agent closed the connection without a response")
+	}
+	line := scanner.Bytes()
+
+	if bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(line, &errResp) == nil && errResp.Error != "" {
+			return &AgentError{Message: errResp.Error}
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(line, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
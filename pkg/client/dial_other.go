@@ -0,0 +1,19 @@
+//go:build !windows
+
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultSocketPath is the agent's default socket location
+const DefaultSocketPath = "/var/run/bitcoin-monitor.sock"
+
+// pipePrefix marks a socket path as a Windows named pipe
+const pipePrefix = `\\.\pipe\`
+
+// dialPipe is only supported on Windows
+func dialPipe(path string, timeout time.Duration) (conn, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package client
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// DefaultSocketPath is the agent's default named pipe
+const DefaultSocketPath = `\\.\pipe\bitcoin-monitor`
+
+// pipePrefix marks a socket path as a named pipe
+const pipePrefix = `\\.\pipe\`
+
+// errorPipeBusy is returned while every pipe instance is in use
+const errorPipeBusy = syscall.Errno(231)
+
+// dialPipe opens a named pipe, retrying while the agent is between
+// accepting one client and creating the next pipe instance
+func dialPipe(path string, timeout time.Duration) (conn, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, errorPipeBusy) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,73 @@
+// Package collector lets other packages add their own metrics to the
+// agent's samples. A collector registers itself from an init function:
+//
+//	func init() {
+//		collector.Register(&upsCollector{})
+//	}
+//
+// and is enabled by blank-importing its package from the agent's main
+// package. Each cycle, the value returned by Collect is stored in the
+// sample under custom.<name>, where it is available to queries and alert
+// rules like any built-in metric.
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Collector gathers one set of custom metrics
+type Collector interface {
+	// Name identifies the collector and keys its results in Sample.Custom
+	Name() string
+
+	// Collect returns a JSON-marshalable value. It must return promptly
+	// once ctx is done.
+	Collect(ctx context.Context) (any, error)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Collector)
+)
+
+// Register adds a collector to the registry
+func Register(c Collector) error {
+	if c == nil {
+		return fmt.Errorf("collector is nil")
+	}
+
+	name := c.Name()
+	if name == "" {
+		return fmt.Errorf("collector name is empty")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		return fmt.Errorf("collector %q already registered", name)
+	}
+	registry[name] = c
+
+	return nil
+}
+
+// Registered returns the registered collectors, sorted by name
+func Registered() []Collector {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	collectors := make([]Collector, 0, len(registry))
+	for _, c := range registry {
+		collectors = append(collectors, c)
+	}
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].Name() < collectors[j].Name()
+	})
+
+	return collectors
+}
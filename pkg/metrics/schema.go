@@ -0,0 +1,23 @@
+package metrics
+
+// SchemaVersion is the version of the JSON output schema. It is bumped
+// whenever a field is renamed or removed, and every rename is recorded in
+// Renames so that agents can keep serving older schemas on request.
+const SchemaVersion = 1
+
+// ProtocolVersion is the version of the socket line protocol, reported by
+// INFO. It is bumped whenever a command changes in a way older clients
+// would misread; new commands alone do not bump it.
+const ProtocolVersion = 1
+
+// FieldRename records a field renamed in a schema version. Old and New are
+// dotted paths such as "bitcoin.peers".
+type FieldRename struct {
+	Version int
+	Old     string
+	New     string
+}
+
+// Renames lists every field rename, oldest first. Output pinned to an
+// older schema undoes the renames made after it.
+var Renames = []FieldRename{}
@@ -4,10 +4,146 @@ import "time"
 
 // Sample represents a complete metrics snapshot at a point in time
 type Sample struct {
-	Timestamp time.Time       `json:"timestamp"`
-	System    *SystemMetrics  `json:"system,omitempty"`
-	Bitcoin   *BitcoinMetrics `json:"bitcoin,omitempty"`
-	Tor       *TorMetrics     `json:"tor,omitempty"`
+	Timestamp time.Time                  `json:"timestamp"`
+	System    *SystemMetrics             `json:"system,omitempty"`
+	Bitcoin   *BitcoinMetrics            `json:"bitcoin,omitempty"`
+	Nodes     map[string]*BitcoinMetrics `json:"nodes,omitempty"` // Additional Bitcoin nodes, keyed by configured name
+	Tor       *TorMetrics                `json:"tor,omitempty"`
+	Hardware  *HardwareMetrics           `json:"hardware,omitempty"`
+	Services  map[string]*ServiceStatus  `json:"services,omitempty"` // systemd units, keyed by name without the .service suffix
+	Derived   *DerivedMetrics            `json:"derived,omitempty"`
+	Agent     *AgentMetrics              `json:"agent,omitempty"`
+	Custom    map[string]interface{}     `json:"custom,omitempty"` // Results of custom collectors, keyed by collector name
+	Paused    *PauseInfo                 `json:"paused,omitempty"` // Set on the marker sample written when collection pauses
+	State     string                     `json:"state,omitempty"`  // Operating state of the primary node, one of the NodeState constants
+
+	MempoolSpace *MempoolSpaceMetrics `json:"mempool_space,omitempty"` // Self-hosted mempool.space instance
+
+	Socket *SocketHealth `json:"socket,omitempty"` // The agent's own query socket
+
+	// Set only when serving the last sample stored by an earlier run, before
+	// this run's first collection completes; never stored
+	Stale      bool  `json:"stale,omitempty"`
+	AgeSeconds int64 `json:"age_seconds,omitempty"`
+}
+
+// Operating states of a node. Resource use differs widely between them, so
+// alert rules and baselines can be limited to some.
+const (
+	NodeStateIBD     = "ibd"     // Initial block download
+	NodeStateReindex = "reindex" // Rebuilding the block index or chainstate from the block files
+	NodeStatePruning = "pruning" // Block files were deleted since the previous sample
+	NodeStateSteady  = "steady"  // Following the tip
+)
+
+// DerivedMetrics contains values computed from collected history rather
+// than read directly from a source
+type DerivedMetrics struct {
+	DiskGrowthBytesPerDay int64   `json:"disk_growth_bytes_per_day"`
+	DiskDaysUntilFull     float64 `json:"disk_days_until_full,omitempty"` // Omitted while usage is not growing
+
+	// Block discovery on the primary node, from block header times.
+	// Omitted until the agent has seen a block.
+	TipAgeSeconds            int64 `json:"tip_age_seconds,omitempty"`             // Since the tip's header time
+	BlockIntervalSeconds     int64 `json:"block_interval_seconds,omitempty"`      // Between the tip and its parent
+	BlockArrivalDelaySeconds int64 `json:"block_arrival_delay_seconds,omitempty"` // From the tip's header time until a collection saw it
+}
+
+// BlockIntervalStats describes the time between blocks found by the
+// network. Intervals come from header times, which miners set, so a few are
+// negative or hours long. Under the 10 minute target about 5% of intervals
+// exceed 30 minutes; a similar share means ordinary variance, while long
+// arrival delays point at the local node falling behind.
+type BlockIntervalStats struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	Blocks                 int       `json:"blocks"` // In the range with a known interval
+	MeanIntervalSeconds    float64   `json:"mean_interval_seconds,omitempty"`
+	MedianIntervalSeconds  int64     `json:"median_interval_seconds,omitempty"`
+	LongGaps               int       `json:"long_gaps"` // Intervals over 30 minutes
+	LongGapPercent         float64   `json:"long_gap_percent"`
+	ExpectedLongGapPercent float64   `json:"expected_long_gap_percent"` // For blocks found at random every 10 minutes
+	LongestGap             *BlockGap `json:"longest_gap,omitempty"`
+
+	// Expected over actual time taken to find the blocks: above 100 the
+	// network found them faster than the target
+	LuckPercent float64 `json:"luck_percent,omitempty"`
+
+	// Time from a block's header time until a collection saw it as the tip,
+	// which includes up to one collection interval
+	ArrivalDelayMedianSeconds int64 `json:"arrival_delay_median_seconds,omitempty"`
+	ArrivalDelayMaxSeconds    int64 `json:"arrival_delay_max_seconds,omitempty"`
+
+	Histogram []IntervalBucket `json:"histogram"` // Intervals in the range
+
+	// Every interval since the agent started tracking blocks, kept beyond
+	// the two weeks of blocks the range statistics cover
+	TotalHistogram []IntervalBucket `json:"total_histogram"`
+	TotalBlocks    int64            `json:"total_blocks"`
+	Since          time.Time        `json:"since"`
+}
+
+// IntervalBucket counts block intervals up to a length
+type IntervalBucket struct {
+	MaxSeconds int64 `json:"max_seconds,omitempty"` // Omitted for the last, open-ended bucket
+	Count      int64 `json:"count"`
+}
+
+// BlockGap is the interval before a block
+type BlockGap struct {
+	Height  int       `json:"height"`
+	Time    time.Time `json:"time"` // Header time of the block ending the gap
+	Seconds int64     `json:"seconds"`
+}
+
+// AgentMetrics describes the monitoring agent's own resource use. Growth
+// rates and the leak warning are derived from the running process's
+// history and need a day of it.
+type AgentMetrics struct {
+	RSSBytes              int64   `json:"rss_bytes"`
+	HeapBytes             int64   `json:"heap_bytes"`
+	Goroutines            int     `json:"goroutines"`
+	UptimeSeconds         int64   `json:"uptime_seconds"`
+	RSSGrowthBytesPerDay  int64   `json:"rss_growth_bytes_per_day,omitempty"`
+	GoroutineGrowthPerDay float64 `json:"goroutine_growth_per_day,omitempty"`
+	LeakSuspected         bool    `json:"leak_suspected"`
+	LeakWarning           string  `json:"leak_warning,omitempty"` // What grew, by how much and over how long
+
+	// Power use: user and system CPU time since start, and voluntary
+	// context switches, each a thread of the agent sleeping and being
+	// woken. Omitted where the platform does not report them.
+	CPUSeconds       float64 `json:"cpu_seconds,omitempty"`
+	Wakeups          int64   `json:"wakeups,omitempty"`
+	WakeupsPerMinute float64 `json:"wakeups_per_minute,omitempty"` // Since the previous sample
+}
+
+// SocketHealth describes whether clients can reach the query socket. The
+// file checks apply to Unix sockets only and are omitted otherwise.
+type SocketHealth struct {
+	Usable        bool      `json:"usable"`
+	FileExists    *bool     `json:"file_exists,omitempty"`
+	PermissionsOK *bool     `json:"permissions_ok,omitempty"` // Mode is 0660
+	AcceptErrors  int64     `json:"accept_errors"`            // Since the agent started
+	Restarts      int64     `json:"restarts"`                 // Listener recreated after the file went missing
+	Rejected      int64     `json:"rejected"`                 // Connections closed over max_connections
+	RateLimited   int64     `json:"rate_limited"`             // Requests refused over rate_limit_per_minute
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitempty"`
+}
+
+// Annotation is an operator note attached to a point in time, used to
+// correlate changes like hardware swaps or upgrades with metric shifts
+type Annotation struct {
+	Time      time.Time `json:"time"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PauseInfo describes a deliberate pause in collection
+type PauseInfo struct {
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
 }
 
 // SystemMetrics contains host system performance data
@@ -27,6 +163,107 @@ type SystemMetrics struct {
 	LoadAvg5m        float64 `json:"load_avg_5m"`
 	LoadAvg15m       float64 `json:"load_avg_15m"`
 	UptimeSeconds    int64   `json:"uptime_seconds"`
+
+	CPUTemperatureC float64          `json:"cpu_temperature_c,omitempty"` // Hottest CPU sensor; omitted without one
+	Throttling      *ThrottlingState `json:"throttling,omitempty"`        // Raspberry Pi only
+
+	SwapUsedBytes  int64            `json:"swap_used_bytes"`
+	SwapTotalBytes int64            `json:"swap_total_bytes"`   // 0 when no swap is configured
+	Pressure       *PressureMetrics `json:"pressure,omitempty"` // Linux 4.20 and later only
+
+	// Clock state from chrony, timedatectl or an NTP query. The offset is
+	// positive when the local clock is ahead; timedatectl only reports sync.
+	ClockOffsetSeconds *float64 `json:"clock_offset_seconds,omitempty"`
+	ClockSynchronized  *bool    `json:"clock_synchronized,omitempty"`
+	ClockSource        string   `json:"clock_source,omitempty"`
+
+	// Usage of each monitored path's filesystem, keyed by the configured path.
+	// The disk_* fields above repeat the primary path's usage.
+	Disks map[string]DiskUsage `json:"disks,omitempty"`
+
+	// Rates of every interface except loopback, keyed by name. net_rx_bps and
+	// net_tx_bps only add up the interfaces selected by net_interfaces.
+	Interfaces map[string]InterfaceRates `json:"interfaces,omitempty"`
+}
+
+// InterfaceRates is the traffic on one network interface
+type InterfaceRates struct {
+	RxBPS int64 `json:"rx_bps"` // Bytes per second
+	TxBPS int64 `json:"tx_bps"` // Bytes per second
+}
+
+// PressureMetrics is Linux pressure stall information: the share of time
+// tasks were stalled waiting for a resource. Memory pressure rises before
+// the OOM killer acts, so it is the earliest sign of a node running out.
+type PressureMetrics struct {
+	CPU    PressureStall `json:"cpu"`
+	Memory PressureStall `json:"memory"`
+	IO     PressureStall `json:"io"`
+}
+
+// PressureStall holds the percentage of time over the last 10, 60 and 300
+// seconds that some tasks, or all non-idle tasks at once, were stalled
+type PressureStall struct {
+	SomeAvg10  float64 `json:"some_avg10"`
+	SomeAvg60  float64 `json:"some_avg60"`
+	SomeAvg300 float64 `json:"some_avg300"`
+	FullAvg10  float64 `json:"full_avg10"` // Not reported for CPU before Linux 5.13
+	FullAvg60  float64 `json:"full_avg60"`
+	FullAvg300 float64 `json:"full_avg300"`
+}
+
+// DiskUsage is the space and inode usage of one filesystem. Inodes are 0
+// on filesystems that do not have a fixed number, such as btrfs.
+type DiskUsage struct {
+	Mountpoint        string  `json:"mountpoint,omitempty"`
+	Fstype            string  `json:"fstype,omitempty"`
+	UsedBytes         int64   `json:"used_bytes"`
+	TotalBytes        int64   `json:"total_bytes"`
+	AvailBytes        int64   `json:"avail_bytes"`
+	UsedPercent       float64 `json:"used_percent"`
+	InodesUsed        int64   `json:"inodes_used"`
+	InodesTotal       int64   `json:"inodes_total"`
+	InodesFree        int64   `json:"inodes_free"`
+	InodesUsedPercent float64 `json:"inodes_used_percent"`
+}
+
+// ThrottlingState is the Raspberry Pi firmware's report of power and
+// thermal limits. The *_occurred flags stay set until reboot, so a slow IBD
+// can be traced to throttling that is no longer happening.
+type ThrottlingState struct {
+	Active                  bool `json:"active"` // Any of the current flags is set
+	UnderVoltage            bool `json:"under_voltage"`
+	FrequencyCapped         bool `json:"frequency_capped"`
+	Throttled               bool `json:"throttled"`
+	SoftTempLimit           bool `json:"soft_temp_limit"`
+	UnderVoltageOccurred    bool `json:"under_voltage_occurred"`
+	FrequencyCappedOccurred bool `json:"frequency_capped_occurred"`
+	ThrottledOccurred       bool `json:"throttled_occurred"`
+	SoftTempLimitOccurred   bool `json:"soft_temp_limit_occurred"`
+}
+
+// AddrmanNetwork is the address manager's view of one network
+type AddrmanNetwork struct {
+	New    int `json:"new"`   // Heard about but never connected to
+	Tried  int `json:"tried"` // Connected to successfully at some point
+	Total  int `json:"total"`
+	Usable int `json:"usable"` // Returned by getnodeaddresses, which leaves out stale and failing addresses
+}
+
+// LocalAddress is an address the node advertises to peers
+type LocalAddress struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Score   int    `json:"score"` // Raised each time a peer reports seeing it
+	Network string `json:"network"`
+}
+
+// AdvertisedNetwork reports whether the node advertises an address on a
+// network it is expected to
+type AdvertisedNetwork struct {
+	Listed    bool `json:"listed"` // In localaddresses
+	Score     int  `json:"score"`  // Highest score among the network's addresses
+	Reachable bool `json:"reachable"`
 }
 
 // BitcoinMetrics contains Bitcoin Core node data
@@ -45,6 +282,56 @@ type BitcoinMetrics struct {
 	RPCLatencyMs     int64   `json:"rpc_latency_ms"`     // Time to execute getblockchaininfo
 	Pruned           bool    `json:"pruned"`
 	Chain            string  `json:"chain"`              // "main", "test", "regtest"
+
+	State       string `json:"state,omitempty"`        // One of the NodeState constants
+	PruneHeight int    `json:"prune_height,omitempty"` // Lowest height with complete block data on a pruned node
+
+	InboundSlots            int     `json:"inbound_slots"`              // maxconnections less the 11 reserved for outbound
+	InboundSlotsUsedPercent float64 `json:"inbound_slots_used_percent"` // 100 means new inbound peers are being turned away
+
+	TimeOffsetSeconds int `json:"time_offset_seconds"` // Median offset of peers' clocks from ours, from getnetworkinfo
+
+	Version    int    `json:"version,omitempty"`    // Client version from getnetworkinfo, e.g. 270100
+	Subversion string `json:"subversion,omitempty"` // User agent, e.g. "/Satoshi:27.1.0/"
+
+	// Addresses from getnetworkinfo localaddresses, and for each configured
+	// advertise_networks entry whether one of them is on that network
+	LocalAddresses []LocalAddress               `json:"local_addresses,omitempty"`
+	Advertised     map[string]AdvertisedNetwork `json:"advertised,omitempty"`
+
+	NetRecvBPS        int64 `json:"net_recv_bps"`         // Bytes per second, from getnettotals
+	NetSentBPS        int64 `json:"net_sent_bps"`         // Bytes per second, from getnettotals
+	NetRecvMonthBytes int64 `json:"net_recv_month_bytes"` // Received this calendar month (UTC) while the agent ran
+	NetSentMonthBytes int64 `json:"net_sent_month_bytes"` // Sent this calendar month (UTC) while the agent ran
+
+	ChainTipsValidFork    int `json:"chain_tips_valid_fork"`
+	ChainTipsValidHeaders int `json:"chain_tips_valid_headers"`
+	ChainTipsInvalid      int `json:"chain_tips_invalid"`
+	LongestForkLength     int `json:"longest_fork_length"` // Longest non-active branch, in blocks
+
+	// UTXO set statistics from gettxoutsetinfo, refreshed on their own schedule
+	UTXOCount         int64   `json:"utxo_count,omitempty"`
+	UTXOTotalAmount   float64 `json:"utxo_total_amount,omitempty"` // BTC
+	UTXODiskSizeBytes int64   `json:"utxo_disk_size_bytes,omitempty"`
+	UTXOStatsHeight   int     `json:"utxo_stats_height,omitempty"` // Block height the statistics refer to
+
+	// Best height known outside this node, from the configured external tip source
+	ExternalTipHeight int `json:"external_tip_height,omitempty"`
+
+	// Address manager table sizes keyed by network ("ipv4", "ipv6", "onion",
+	// "i2p", "cjdns"), for spotting address starvation on Tor/I2P-only nodes
+	Addrman map[string]AddrmanNetwork `json:"addrman,omitempty"`
+
+	// Rolling latency per RPC method, keyed by method name
+	RPCMethodLatency map[string]RPCLatencyStats `json:"rpc_method_latency,omitempty"`
+}
+
+// RPCLatencyStats contains rolling latency statistics for a single RPC method
+type RPCLatencyStats struct {
+	LastMs  int64 `json:"last_ms"`
+	P50Ms   int64 `json:"p50_ms"`
+	P95Ms   int64 `json:"p95_ms"`
+	Samples int   `json:"samples"` // Calls in the rolling window
 }
 
 // TorMetrics contains Tor network data
@@ -56,14 +343,228 @@ type TorMetrics struct {
 	BandwidthWriteBPS int64  `json:"bandwidth_write_bps"` // Bytes per second
 	OnionServices     int    `json:"onion_services"`
 	ControlLatencyMs  int64  `json:"control_latency_ms"`
+
+	// Circuits and streams by purpose: "general" for clearnet traffic,
+	// "hs_client" and "hs_service" for onion services we connect to and
+	// host, and "other" for Tor's own testing and measurement circuits
+	Purposes map[string]*TorPurposeStats `json:"purposes,omitempty"`
+
+	// Control-port authentication, omitted when the port is unreachable.
+	// auth_status names the cause of a failure, e.g. "cookie_permission_denied".
+	Authenticated *bool  `json:"authenticated,omitempty"`
+	AuthStatus    string `json:"auth_status,omitempty"`
+	AuthError     string `json:"auth_error,omitempty"`
+
+	// Progress connecting to the Tor network, omitted when Tor could not be
+	// asked. Below 100 Tor is running but cannot carry traffic yet;
+	// bootstrap_warning is why it is stuck, e.g. a clock skew or no route
+	// to the guards.
+	BootstrapProgress  *int   `json:"bootstrap_progress,omitempty"` // Percent
+	BootstrapTag       string `json:"bootstrap_tag,omitempty"`      // Phase, e.g. "conn_done" or "done"
+	BootstrapWarning   string `json:"bootstrap_warning,omitempty"`
+	CircuitEstablished *bool  `json:"circuit_established,omitempty"` // Tor has built a circuit and considers the network reachable
+
+	// Result of the most recent connection to our own onion service via SOCKS
+	OnionSelfReachable *bool  `json:"onion_self_reachable,omitempty"`
+	OnionSelfLatencyMs int64  `json:"onion_self_latency_ms,omitempty"` // Time to complete the rendezvous
+	OnionSelfError     string `json:"onion_self_error,omitempty"`
+}
+
+// TorPurposeStats counts the circuits and streams of one purpose
+type TorPurposeStats struct {
+	Circuits    int `json:"circuits"`
+	Established int `json:"established"` // Circuits in state BUILT
+	Streams     int `json:"streams"`
+}
+
+// ServiceStatus is the state of a systemd unit
+type ServiceStatus struct {
+	LoadState     string `json:"load_state"`   // "loaded", or "not-found" for a unit that is not installed
+	ActiveState   string `json:"active_state"` // e.g. "active", "activating", "failed"
+	SubState      string `json:"sub_state"`    // e.g. "running", "auto-restart"
+	Active        bool   `json:"active"`
+	Failed        bool   `json:"failed"`
+	Restarts      int    `json:"restarts"`                 // Automatic restarts by systemd since the unit was last started by hand
+	ActiveSeconds int64  `json:"active_seconds,omitempty"` // Time since the unit last became active
+}
+
+// MempoolSpaceMetrics describes a self-hosted mempool.space instance
+// compared with the node backing it
+type MempoolSpaceMetrics struct {
+	Reachable        bool    `json:"reachable"`
+	TipHeight        int     `json:"tip_height,omitempty"`
+	BackendLagBlocks *int    `json:"backend_lag_blocks,omitempty"` // Node height minus the instance's; omitted when either is unknown
+	APILatencyMs     float64 `json:"api_latency_ms"`
+	Error            string  `json:"error,omitempty"`
+}
+
+// HardwareMetrics contains host hardware health read from the BMC
+type HardwareMetrics struct {
+	Source          string               `json:"source"`         // "redfish" or "ipmi"
+	ChassisHealth   string               `json:"chassis_health"` // "OK", "Warning", or "Critical"
+	Faults          int                  `json:"faults"`         // Components not reporting OK
+	MaxTemperatureC float64              `json:"max_temperature_c"`
+	Fans            []FanStatus          `json:"fans,omitempty"`
+	PowerSupplies   []PowerSupplyStatus  `json:"power_supplies,omitempty"`
+	Temperatures    []TemperatureReading `json:"temperatures,omitempty"`
+}
+
+// FanStatus is a single fan sensor
+type FanStatus struct {
+	Name   string `json:"name"`
+	RPM    int    `json:"rpm"`
+	Health string `json:"health"`
+}
+
+// PowerSupplyStatus is a single power supply
+type PowerSupplyStatus struct {
+	Name   string `json:"name"`
+	Health string `json:"health"`
+	State  string `json:"state,omitempty"` // Redfish only, e.g. "Enabled"
+}
+
+// TemperatureReading is a single temperature sensor
+type TemperatureReading struct {
+	Name    string  `json:"name"`
+	Celsius float64 `json:"celsius"`
+	Health  string  `json:"health"`
 }
 
 // AgentStatus represents the current state of the monitoring agent
 type AgentStatus struct {
-	Running            bool      `json:"running"`
-	UptimeSeconds      int64     `json:"uptime_seconds,omitempty"`
-	CollectionCount    int64     `json:"collection_count,omitempty"`
-	LastCollectionTime time.Time `json:"last_collection_time,omitempty"`
-	ErrorCount         int64     `json:"error_count,omitempty"`
-	Version            string    `json:"version,omitempty"`
+	Running            bool        `json:"running"`
+	UptimeSeconds      int64       `json:"uptime_seconds,omitempty"`
+	CollectionCount    int64       `json:"collection_count,omitempty"`
+	LastCollectionTime time.Time   `json:"last_collection_time,omitempty"`
+	ErrorCount         int64       `json:"error_count,omitempty"`
+	Version            string      `json:"version,omitempty"`
+	Paused             *PauseInfo  `json:"paused,omitempty"`
+	Jobs               []JobStatus `json:"jobs,omitempty"`
+
+	Cleanup *CleanupStats `json:"cleanup,omitempty"` // Retention cleanup of the stored metrics
+	Storage *StorageStats `json:"storage,omitempty"`
+	Socket  *SocketHealth `json:"socket,omitempty"`
+}
+
+// StorageStats describes the stored metrics, so operators can see that
+// retention and compression keep up
+type StorageStats struct {
+	Bytes           int64             `json:"bytes"` // Daily files with their indexes
+	Files           int               `json:"files"` // Daily files, compressed or not
+	CompressedFiles int               `json:"compressed_files"`
+	OldestSample    time.Time         `json:"oldest_sample,omitempty"`
+	NewestSample    time.Time         `json:"newest_sample,omitempty"`
+	Compression     *CompressionStats `json:"compression,omitempty"` // Omitted until a file is compressed
+}
+
+// CompressionStats counts the daily files compressed since the agent
+// started
+type CompressionStats struct {
+	LastRun      time.Time `json:"last_run"`
+	LastFile     string    `json:"last_file"`
+	LastBytesIn  int64     `json:"last_bytes_in"`  // Size of the last file before compression
+	LastBytesOut int64     `json:"last_bytes_out"` // and after; 0 if it failed
+	LastFailed   bool      `json:"last_failed,omitempty"`
+	Files        int64     `json:"files"`
+	Failures     int64     `json:"failures"`
+}
+
+// Ping answers PING. Latency is measured from the time the client sent,
+// so it is only as accurate as the two clocks agree.
+type Ping struct {
+	ServerTime time.Time `json:"server_time"`
+	LatencyMs  *float64  `json:"latency_ms,omitempty"` // Only when the client sent its time
+}
+
+// ServerInfo answers INFO, so clients can discover what the agent supports
+// before sending heavier requests
+type ServerInfo struct {
+	ProtocolVersion int          `json:"protocol_version"`
+	Version         string       `json:"version,omitempty"`
+	Commands        []string     `json:"commands"`
+	Features        []string     `json:"features"` // Optional parts enabled in this agent
+	Limits          ServerLimits `json:"limits"`
+}
+
+// ServerLimits are the bounds the agent applies to socket requests
+type ServerLimits struct {
+	RequestTimeoutSeconds    int `json:"request_timeout_seconds"`
+	BackupIdleTimeoutSeconds int `json:"backup_idle_timeout_seconds"`
+	DiffSearchWindowSeconds  int `json:"diff_search_window_seconds"`
+	MaxTopResults            int `json:"max_top_results"`
+	MaxConnections           int `json:"max_connections"`
+	MaxRequestBytes          int `json:"max_request_bytes"`
+	RateLimitPerMinute       int `json:"rate_limit_per_minute"` // Per client; 0 means unlimited
+}
+
+// CleanupStats counts the metrics files retention cleanup deleted, for the
+// age limit and the size cap together
+type CleanupStats struct {
+	LastRun          time.Time `json:"last_run,omitempty"`
+	LastDeletedFiles int       `json:"last_deleted_files"` // Deleted by the last run
+	DeletedFiles     int64     `json:"deleted_files"`      // Deleted since the agent started
+}
+
+// JobStatus describes the state of a scheduled maintenance job
+type JobStatus struct {
+	Name           string    `json:"name"`
+	Schedule       string    `json:"schedule"`
+	Running        bool      `json:"running"`
+	LastRun        time.Time `json:"last_run,omitempty"`
+	LastDurationMs int64     `json:"last_duration_ms,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	NextRun        time.Time `json:"next_run,omitempty"`
+	RunCount       int64     `json:"run_count"`
+	ErrorCount     int64     `json:"error_count"`
+	SkippedCount   int64     `json:"skipped_count"` // Activations skipped because the previous run was still going
+}
+
+// Summary is a compact view of the latest sample for bandwidth-constrained
+// clients such as phone widgets polling over Tor
+type Summary struct {
+	Time           time.Time `json:"t"`
+	Paused         bool      `json:"paused,omitempty"`
+	Stale          bool      `json:"stale,omitempty"` // From before the agent restarted
+	BlockHeight    int       `json:"height"`
+	BlocksBehind   int       `json:"behind"`
+	SyncProgress   float64   `json:"sync,omitempty"`
+	Peers          int       `json:"peers"`
+	MempoolTxCount int       `json:"mempool,omitempty"`
+	DiskUsedPct    float64   `json:"disk_pct,omitempty"`
+	CPUPercent     float64   `json:"cpu_pct,omitempty"`
+	TorReachable   *bool     `json:"tor,omitempty"`
+	OnionReachable *bool     `json:"onion,omitempty"`
+}
+
+// MempoolSnapshot is the fee distribution of the node's mempool, computed
+// on request for fee-picker tools. Fee rates are in sat/vB.
+type MempoolSnapshot struct {
+	ComputedAt  time.Time `json:"computed_at"` // Repeated requests are answered from the last snapshot for a few seconds
+	TxCount     int       `json:"tx_count"`
+	VSizeBytes  int64     `json:"vsize_bytes"`
+	TotalFeeSat int64     `json:"total_fee_sat"`
+
+	Buckets         []FeeBucket      `json:"buckets"`          // Ascending by fee rate, including empty buckets
+	ProjectedBlocks []ProjectedBlock `json:"projected_blocks"` // The next blocks if filled by fee rate alone
+}
+
+// FeeBucket totals the transactions paying a fee rate in
+// [min_fee_rate, max_fee_rate); the last bucket has no upper bound
+type FeeBucket struct {
+	MinFeeRate  float64 `json:"min_fee_rate"`
+	MaxFeeRate  float64 `json:"max_fee_rate,omitempty"`
+	TxCount     int     `json:"tx_count"`
+	VSizeBytes  int64   `json:"vsize_bytes"`
+	TotalFeeSat int64   `json:"total_fee_sat"`
+}
+
+// ProjectedBlock is one upcoming block as a miner picking the highest fee
+// rates first would fill it. Fee bumps through child transactions are not
+// taken into account.
+type ProjectedBlock struct {
+	TxCount       int     `json:"tx_count"`
+	VSizeBytes    int64   `json:"vsize_bytes"`
+	TotalFeeSat   int64   `json:"total_fee_sat"`
+	MinFeeRate    float64 `json:"min_fee_rate"` // Lowest fee rate that made it into the block
+	MedianFeeRate float64 `json:"median_fee_rate"`
 }
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Unit is what a numeric sample field measures. Field names carry their
+// unit as a suffix ("_bytes", "_bps", "_ms", ...); UnitOf reads it back so
+// exporters and human-readable output agree on what a number means.
+type Unit string
+
+// Units used by sample fields
+const (
+	UnitNone           Unit = ""
+	UnitBytes          Unit = "bytes"
+	UnitBytesPerSecond Unit = "bytes_per_second"
+	UnitSeconds        Unit = "seconds"
+	UnitMilliseconds   Unit = "milliseconds"
+	UnitPercent        Unit = "percent" // 0-100
+	UnitRatio          Unit = "ratio"   // 0-1
+	UnitCelsius        Unit = "celsius"
+)
+
+// unitSuffixes maps field name suffixes to units
+var unitSuffixes = []struct {
+	suffix string
+	unit   Unit
+}{
+	{"_bytes", UnitBytes},
+	{"_bps", UnitBytesPerSecond},
+	{"_seconds", UnitSeconds},
+	{"_ms", UnitMilliseconds},
+	{"_percent", UnitPercent},
+	{"_pct", UnitPercent},
+	{"_temperature_c", UnitCelsius},
+	{"celsius", UnitCelsius},
+}
+
+// unitOverrides are fields whose names do not end in their unit
+var unitOverrides = map[string]Unit{
+	"bitcoin.sync_progress": UnitRatio,
+}
+
+// UnitOf returns the unit of a flattened field name such as
+// "system.disk_read_bps", or UnitNone for counts and unitless values
+func UnitOf(field string) Unit {
+	_, unit := unitSuffix(field)
+	return unit
+}
+
+// unitSuffix returns the unit of a field and the suffix of its name that
+// gave it away, which is empty for overridden fields
+func unitSuffix(field string) (string, Unit) {
+	if unit, ok := unitOverrides[field]; ok {
+		return "", unit
+	}
+	if i := strings.LastIndexByte(field, '.'); i >= 0 {
+		// Additional nodes share the primary node's fields
+		if strings.HasPrefix(field, "nodes.") {
+			if unit, ok := unitOverrides["bitcoin"+field[i:]]; ok {
+				return "", unit
+			}
+		}
+		field = field[i+1:]
+	}
+	for _, s := range unitSuffixes {
+		if strings.HasSuffix(field, s.suffix) {
+			return s.suffix, s.unit
+		}
+	}
+	return "", UnitNone
+}
+
+// PrometheusName converts a flattened field name to a Prometheus metric
+// name ending in its base unit, e.g. "bitcoin.rpc_latency_ms" becomes
+// "bitcoin_rpc_latency_seconds". Values must be converted with Base to
+// match. Characters Prometheus does not allow, such as those in disk paths
+// and unit names used as map keys, become underscores.
+func PrometheusName(field string) string {
+	suffix, unit := unitSuffix(field)
+	name := strings.TrimSuffix(field, suffix)
+
+	switch base := (Quantity{Unit: unit}).Base().Unit; {
+	case unit == UnitNone:
+	case suffix == "_temperature_c":
+		name += "_temperature_celsius"
+	case suffix == "celsius" || suffix == "_"+string(base):
+		name += suffix
+	default:
+		name += "_" + string(base)
+	}
+
+	var b strings.Builder
+	underscore := false
+	for _, r := range name {
+		valid := r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+		if !valid || r == '_' {
+			if !underscore {
+				b.WriteByte('_')
+			}
+			underscore = true
+			continue
+		}
+		b.WriteRune(r)
+		underscore = false
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+// Quantity is a value with its unit
+type Quantity struct {
+	Value float64
+	Unit  Unit
+}
+
+// Base converts the quantity to the base unit Prometheus conventions use:
+// seconds rather than milliseconds and ratios rather than percentages
+func (q Quantity) Base() Quantity {
+	switch q.Unit {
+	case UnitMilliseconds:
+		return Quantity{q.Value / 1000, UnitSeconds}
+	case UnitPercent:
+		return Quantity{q.Value / 100, UnitRatio}
+	default:
+		return q
+	}
+}
+
+// String formats the quantity for people, e.g. "1.5 GiB", "12.0 MiB/s",
+// "3d 4h" or "45.2%"
+func (q Quantity) String() string {
+	switch q.Unit {
+	case UnitBytes:
+		return Bytes(q.Value).String()
+	case UnitBytesPerSecond:
+		return Bytes(q.Value).String() + "/s"
+	case UnitSeconds:
+		return Seconds(q.Value).String()
+	case UnitMilliseconds:
+		return Seconds(q.Value / 1000).String()
+	case UnitPercent:
+		return fmt.Sprintf("%.1f%%", q.Value)
+	case UnitRatio:
+		return fmt.Sprintf("%.2f%%", q.Value*100)
+	case UnitCelsius:
+		return fmt.Sprintf("%.1f °C", q.Value)
+	default:
+		return fmt.Sprintf("%g", q.Value)
+	}
+}
+
+// Bytes is a size in bytes
+type Bytes float64
+
+// String formats the size with binary prefixes
+func (b Bytes) String() string {
+	const units = "KMGTPE"
+
+	value := math.Abs(float64(b))
+	if value < 1024 {
+		return fmt.Sprintf("%.0f B", float64(b))
+	}
+
+	exp := 0
+	for value >= 1024*1024 && exp < len(units)-1 {
+		value /= 1024
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", math.Copysign(value/1024, float64(b)), units[exp])
+}
+
+// Seconds is a duration in seconds
+type Seconds float64
+
+// String formats long durations in days, hours and minutes, and short ones
+// as Go durations such as "1.5s" or "-4ms"
+func (s Seconds) String() string {
+	value := float64(s)
+	if math.Abs(value) < 60 {
+		return time.Duration(value * float64(time.Second)).Round(time.Millisecond).String()
+	}
+
+	sign := ""
+	if value < 0 {
+		sign, value = "-", -value
+	}
+
+	total := int64(value)
+	days, hours, minutes := total/86400, total%86400/3600, total%3600/60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%s%dd %dh", sign, days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%s%dh %dm", sign, hours, minutes)
+	default:
+		return fmt.Sprintf("%s%dm %ds", sign, minutes, total%60)
+	}
+}